@@ -0,0 +1,5 @@
+// Package exchangepb holds the protobuf messages of the exchange gRPC API and the generated
+// OrderEntry and MarketData clients. Regenerate after editing exchange.proto with go generate.
+package exchangepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative exchange.proto
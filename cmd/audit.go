@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	AuditCmd = &cobra.Command{
+		Use:   "audit ORDERID|CLORDID",
+		Short: "Reconstruct the history of an order from the audit trail",
+		Long: "Print every audit record of an order, found by its OrderID or any of its ClOrdIDs, with the FIX messages " +
+			"that led to them, in the order they were written. The audit trail of each trading date is checked for records " +
+			"changed or missing on the way. ClOrdIDs are only unique per CompID, --comp-id narrows the search to one.",
+		Example: "se audit 2026030200000000001\nse audit --comp-id CLIENT44 --date 20260302 B1",
+		Args:    cobra.ExactArgs(1),
+		RunE:    audit,
+	}
+	auditTrailDir string
+	auditDate     string
+	auditCompID   string
+)
+
+func init() {
+	AuditCmd.Flags().StringVar(&auditTrailDir, "audit-dir", path.Join("data", "audit"),
+		"directory of the audit trail of each trading date")
+	AuditCmd.Flags().StringVar(&auditDate, "date", "",
+		"trading date to search, as YYYYMMDD, every date of the audit trail when empty")
+	AuditCmd.Flags().StringVar(&auditCompID, "comp-id", "", "CompID that sent the order")
+}
+
+func audit(cmd *cobra.Command, args []string) error {
+	fileNames := []string{order_gateway.AuditFileName(auditTrailDir, auditDate)}
+	if auditDate == "" {
+		var err error
+		fileNames, err = filepath.Glob(order_gateway.AuditFileName(auditTrailDir, "*"))
+		if err != nil {
+			return err
+		}
+		slices.Sort(fileNames)
+	}
+	records := make([]order_gateway.AuditRecord, 0)
+	for _, fileName := range fileNames {
+		dayRecords, err := order_gateway.ReadAuditTrail(fileName)
+		if errors.Is(err, order_gateway.ErrAuditTornRecord) {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+		} else if err != nil {
+			return err
+		}
+		records = append(records, dayRecords...)
+	}
+	history := order_gateway.OrderHistory(records, auditCompID, args[0])
+	if len(history) == 0 {
+		return fmt.Errorf("no audit records of order %s", args[0])
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "DATE\tSEQ\tTIME\tEVENT\tCAUSE\tCOMPID\tORDERID\tCLORDID\tDETAIL\n")
+	for _, r := range history {
+		cause := "-"
+		if r.CauseSeq != 0 {
+			cause = fmt.Sprint(r.CauseSeq)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.TradingDate, r.Seq, r.Time.Format(time.RFC3339Nano), r.Event,
+			cause, r.CompID, orDash(r.OrderID), orDash(r.ClOrdID), auditDetail(r))
+	}
+	return w.Flush()
+}
+
+// auditDetail is what a record says beyond its identifiers.
+func auditDetail(r order_gateway.AuditRecord) string {
+	var detail string
+	switch r.Event {
+	case order_gateway.AuditReceived:
+		if r.Protocol != "" && r.Protocol != domain.EntryFIX {
+			return fmt.Sprintf("%s %s", r.Protocol, r.Message)
+		}
+		return strings.ReplaceAll(r.Message, "\x01", "|")
+	case order_gateway.AuditValidated:
+		detail = fmt.Sprintf("%s %s %s @ %s %s", r.Side, r.Quantity, r.Symbol, r.Price, r.OrdType)
+	case order_gateway.AuditMatched, order_gateway.AuditTradeBusted, order_gateway.AuditTradeCorrected:
+		detail = fmt.Sprintf("%s @ %s, trade %s against %s, leaves %s, %s", r.LastQty, r.LastPx, r.TradeID,
+			orDash(r.ContraOrderID), r.LeavesQty, r.Status)
+	case order_gateway.AuditRejected:
+		if r.MsgType != "" {
+			detail = "35=" + r.MsgType
+		}
+	default:
+		detail = fmt.Sprintf("%s %s %s @ %s, leaves %s, %s", r.Side, r.Quantity, r.Symbol, r.Price, r.LeavesQty, r.Status)
+	}
+	if r.OrigClOrdID != "" {
+		detail += ", OrigClOrdID " + r.OrigClOrdID
+	}
+	if r.Text != "" {
+		detail += ": " + r.Text
+	}
+	return strings.TrimPrefix(detail, ": ")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"path"
+	"stock_exchange/internal/services/api_keys"
+	"stock_exchange/internal/services/order_gateway"
+	"time"
+)
+
+// engineFlags adds to cmd the flags of the files the matching engine is configured by,
+// restored from and saved to.
+func engineFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&instrumentsFileName, "instruments", path.Join("config", "instruments.json"),
+		"JSON file with per-instrument settings (allocation policy)")
+	cmd.Flags().StringVar(&sessionsFileName, "sessions", path.Join("config", "sessions.json"),
+		"JSON file with the Logon credentials, firm, accounts and entitlements of each FIX session, Logons are not authenticated without it")
+	cmd.Flags().StringVar(&killSwitchesFile, "kill-switches", path.Join("data", "kill_switches.json"),
+		"JSON file the trading halts in force are saved to and restored from on restart")
+	cmd.Flags().StringVar(&feesFileName, "fees", path.Join("config", "fees.json"),
+		"JSON file with the maker/taker fee schedule and its volume tiers, executions are free without it")
+	cmd.Flags().StringVar(&accountsFileName, "accounts", path.Join("config", "accounts.json"),
+		"JSON file with the order limits, order capacities and allocation sub-accounts of each account, accounts are unlimited without it")
+	cmd.Flags().StringVar(&volumesFileName, "volumes", path.Join("data", "monthly_volumes.json"),
+		"JSON file the month-to-date traded notional of each firm is saved to, which fee tiers go by")
+	cmd.Flags().StringVar(&journalDir, "journal-dir", path.Join("data", "journal"),
+		"directory every order event is journaled to, in a file per trading date that end of day reports are built from")
+	cmd.Flags().StringVar(&auditDir, "audit-dir", path.Join("data", "audit"),
+		"directory the audit trail of every order and the FIX messages behind it is written to, in a file per trading date")
+	cmd.Flags().StringVar(&reportsDir, "reports-dir", path.Join("data", "reports"),
+		"directory the end of day reports are written to, in a directory per trading date")
+	cmd.Flags().IntVar(&instance, "instance", 1,
+		"number of this engine instance, 0-99, encoded in every OrderID, ExecID and TradeID it assigns")
+	cmd.Flags().StringVar(&outboxDir, "outbox-dir", path.Join("data", "outbox"),
+		"directory the execution reports not yet sent to each FIX session are journaled to, and delivered from on Logon")
+	cmd.Flags().IntVar(&backlogAlert, "backlog-alert", order_gateway.DefaultBacklogAlertThreshold,
+		"execution reports waiting for a FIX session that raise an alert")
+	cmd.Flags().StringVar(&apiKeysFileName, "api-keys", path.Join("config", "api_keys.json"),
+		"JSON file with the sha256 of each API key and its CompID, the REST, gRPC and OUCH gateways are disabled without it")
+}
+
+// engine is the matching engine the flags of engineFlags configure, resumed on the
+// latest trading date of its journal, with the files it saves to.
+type engine struct {
+	app         *order_gateway.Application
+	tradingDate string
+	journal     *order_gateway.Journal
+	auditTrail  *order_gateway.AuditTrail
+	volumes     *order_gateway.MonthlyVolumes
+	outbox      *order_gateway.Outbox
+	ids         *order_gateway.IDGenerator
+	// gateways tells whether the api keys file was found, which the REST, gRPC and OUCH gateways need
+	gateways bool
+	keys     api_keys.APIKeys
+}
+
+// openEngine loads the configuration of the engine and restores its trading date, orders
+// and trades from the journal.
+func openEngine() (*engine, error) {
+	var err error
+	instruments := make(order_gateway.Instruments)
+	if _, statErr := os.Stat(instrumentsFileName); statErr == nil {
+		instruments, err = order_gateway.LoadInstruments(instrumentsFileName)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Printf("instruments file %s not found, every symbol will use FIFO allocation", instrumentsFileName)
+	}
+	opts := []order_gateway.Option{order_gateway.WithInstruments(instruments)}
+	var keys api_keys.APIKeys
+	_, apiKeysErr := os.Stat(apiKeysFileName)
+	if apiKeysErr == nil {
+		keys, err = api_keys.LoadAPIKeys(apiKeysFileName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, order_gateway.WithFirms(keys.Firms()))
+	}
+	if _, statErr := os.Stat(sessionsFileName); statErr == nil {
+		sessions, err := order_gateway.LoadSessions(sessionsFileName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, order_gateway.WithSessions(sessions))
+	} else {
+		log.Printf("sessions file %s not found, FIX Logons are not authenticated", sessionsFileName)
+	}
+	if _, statErr := os.Stat(feesFileName); statErr == nil {
+		fees, err := order_gateway.LoadFeeSchedule(feesFileName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, order_gateway.WithFeeSchedule(fees))
+	} else {
+		log.Printf("fee schedule %s not found, executions are not charged", feesFileName)
+	}
+	if _, statErr := os.Stat(accountsFileName); statErr == nil {
+		accounts, err := order_gateway.LoadAccounts(accountsFileName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, order_gateway.WithAccounts(accounts))
+	} else {
+		log.Printf("accounts file %s not found, accounts are not limited", accountsFileName)
+	}
+	volumes, err := order_gateway.LoadMonthlyVolumes(volumesFileName)
+	if err != nil {
+		return nil, err
+	}
+	e := &engine{volumes: volumes, gateways: apiKeysErr == nil, keys: keys}
+	defer func() {
+		if err != nil {
+			e.close()
+		}
+	}()
+	opts = append(opts, order_gateway.WithMonthlyVolumes(volumes))
+	tradingDate, ok, err := order_gateway.LatestTradingDate(journalDir)
+	if err != nil {
+		return nil, err
+	}
+	if today := time.Now().Format(order_gateway.TradingDateLayout); !ok {
+		tradingDate = today
+	} else if tradingDate < today {
+		log.Printf("end of day of trading date %s has not run, orders are taken for it until it does", tradingDate)
+	}
+	journal, err := order_gateway.OpenJournal(journalDir, tradingDate)
+	if err != nil {
+		return nil, err
+	}
+	e.journal = journal
+	auditTrail, err := order_gateway.OpenAuditTrail(auditDir, tradingDate)
+	if err != nil {
+		return nil, err
+	}
+	e.auditTrail = auditTrail
+	opts = append(opts, order_gateway.WithJournal(journal), order_gateway.WithAuditTrail(auditTrail),
+		order_gateway.WithReportsDir(reportsDir))
+	killSwitches, err := order_gateway.LoadKillSwitches(killSwitchesFile)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, order_gateway.WithKillSwitches(killSwitches))
+	ids, err := order_gateway.NewIDGenerator(instance)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, order_gateway.WithIDGenerator(ids))
+	outbox, err := order_gateway.LoadOutbox(outboxDir)
+	if err != nil {
+		return nil, err
+	}
+	e.outbox = outbox
+	opts = append(opts, order_gateway.WithOutbox(outbox), order_gateway.WithBacklogAlertThreshold(backlogAlert))
+	app := order_gateway.NewApplication(opts...)
+	e.app, e.ids, e.tradingDate = app, ids, tradingDate
+	recovered, err := app.RecoverOrders()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("trading date %s, %d orders recovered from the journal", tradingDate, recovered)
+	return e, nil
+}
+
+// close saves what the engine has not saved yet and closes its files.
+func (e *engine) close() {
+	if e.outbox != nil {
+		e.outbox.Flush()
+	}
+	if e.auditTrail != nil {
+		_ = e.auditTrail.Close()
+	}
+	if e.journal != nil {
+		_ = e.journal.Close()
+	}
+	_ = e.volumes.Close()
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"stock_exchange/internal/services/order_gateway"
+	"time"
+)
+
+var (
+	EndOfDayCmd = &cobra.Command{
+		Use:   "eod",
+		Short: "Close the trading date of the exchange while it is stopped",
+		Long: "Run end of day processing on the trading date the journal is on, as the ordermatch command does at --eod-time " +
+			"or on the console's eod command: the DAY orders and the GTD orders due are expired, their execution reports " +
+			"kept for delivery on Logon, the GTC and GTD orders left are carried to the next trading date, the closing and " +
+			"settlement prices, reports and clearing files of the date are written, and the journal and the audit trail " +
+			"roll over. Run it with the files of ordermatch while the exchange is stopped, e.g. when it was stopped before " +
+			"closing; a running exchange closes its trading dates itself.",
+		Example: "se eod\nse eod --journal-dir data/journal --reports-dir data/reports",
+		Args:    cobra.NoArgs,
+		RunE:    endOfDay,
+	}
+)
+
+func init() {
+	engineFlags(EndOfDayCmd)
+}
+
+func endOfDay(cmd *cobra.Command, args []string) error {
+	tradingDate, ok, err := order_gateway.LatestTradingDate(journalDir)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("no journal in %s, there is no trading date to close", journalDir)
+	}
+	if today := time.Now().Format(order_gateway.TradingDateLayout); tradingDate > today {
+		return fmt.Errorf("trading date %s is still to come, it is %s", tradingDate, today)
+	}
+	e, err := openEngine()
+	if err != nil {
+		return err
+	}
+	defer e.close()
+	result, err := e.app.EndOfDay()
+	if err != nil {
+		return fmt.Errorf("end of day of %s failed: %s", result.TradingDate, err)
+	}
+	fmt.Printf("trading date %s closed, %d orders expired, %d carried to %s, reports written to %s\n", result.TradingDate,
+		result.Expired, result.Carried, result.NextTradingDate, result.ReportDir)
+	return nil
+}
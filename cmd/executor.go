@@ -1,8 +1,8 @@
 package cmd
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/quickfixgo/quickfix"
 	"github.com/spf13/cobra"
@@ -11,10 +11,21 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"slices"
+	"stock_exchange/internal/services/admin_console"
+	"stock_exchange/internal/services/grpc_gateway"
+	"stock_exchange/internal/services/itch_feed"
+	"stock_exchange/internal/services/monitoring"
 	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/ouch_gateway"
+	"stock_exchange/internal/services/rest_gateway"
 	"syscall"
+	"time"
 )
 
+// shutdownTimeout is how long the REST requests in progress are waited for on the way out.
+const shutdownTimeout = 5 * time.Second
+
 var (
 	ExecutorCmd = &cobra.Command{
 		Use:     "ordermatch",
@@ -24,8 +35,46 @@ var (
 		Example: "se ordermatch [YOUR_FIX_CONFIG_FILE_HERE.cfg] (default is ./config/ordermatch.cfg)",
 		RunE:    execute,
 	}
+	instrumentsFileName string
+	httpAddr            string
+	apiKeysFileName     string
+	grpcAddr            string
+	ouchAddr            string
+	sessionsFileName    string
+	itchAddr            string
+	itchRetransmitAddr  string
+	itchSnapshotAddr    string
+	killSwitchesFile    string
+	outboxDir           string
+	feesFileName        string
+	accountsFileName    string
+	volumesFileName     string
+	journalDir          string
+	auditDir            string
+	reportsDir          string
+	eodTime             string
+	instance            int
+	backlogAlert        int
+	noConsole           bool
+	metricsAddr         string
 )
 
+func init() {
+	engineFlags(ExecutorCmd)
+	ExecutorCmd.Flags().StringVar(&eodTime, "eod-time", "",
+		"local time, as HH:MM, end of day processing closes the trading date at, empty to run it from the console only")
+	ExecutorCmd.Flags().BoolVar(&noConsole, "no-console", false, "run without the operator console on stdin, e.g. as a service")
+	ExecutorCmd.Flags().StringVar(&metricsAddr, "metrics-addr", ":9100",
+		"listen address of /metrics, /healthz and /readyz, empty to disable them")
+	ExecutorCmd.Flags().StringVar(&httpAddr, "http-addr", ":8080", "listen address of the REST gateway")
+	ExecutorCmd.Flags().StringVar(&grpcAddr, "grpc-addr", ":9090", "listen address of the gRPC gateway")
+	ExecutorCmd.Flags().StringVar(&ouchAddr, "ouch-addr", ":9200", "listen address of the OUCH binary order entry gateway")
+	ExecutorCmd.Flags().StringVar(&itchAddr, "itch-addr", "127.0.0.1:9300",
+		"UDP address, unicast or multicast, the ITCH market data feed is published to, empty to disable the feed")
+	ExecutorCmd.Flags().StringVar(&itchRetransmitAddr, "itch-retransmit-addr", ":9301", "listen address of the ITCH feed retransmission server")
+	ExecutorCmd.Flags().StringVar(&itchSnapshotAddr, "itch-snapshot-addr", ":9302", "listen address of the ITCH feed snapshot server")
+}
+
 func execute(cmd *cobra.Command, args []string) error {
 	var cfgFileName string
 	argLen := len(args)
@@ -67,9 +116,79 @@ func execute(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("error creating file log factory: %s,", err)
 	}
-	app := order_gateway.NewApplication()
+	e, err := openEngine()
+	if err != nil {
+		return err
+	}
+	defer e.close()
+	// stops shut down what was started, last first, before the engine is closed
+	var stops []func()
+	defer func() {
+		for _, stop := range slices.Backward(stops) {
+			stop()
+		}
+	}()
+	app := e.app
+	var eodAt time.Time
+	if eodTime != "" {
+		eodAt, err = time.Parse("15:04", eodTime)
+		if err != nil {
+			return fmt.Errorf("invalid --eod-time %q, expected HH:MM", eodTime)
+		}
+	}
+	var monitoringServer *monitoring.Server
+	if metricsAddr != "" {
+		monitoringServer = monitoring.NewServer(app)
+		monitoringServer.AddCheck("journal", e.journal.Err)
+		monitoringServer.AddCheck("outbound queue", e.outbox.Err)
+		monitoringServer.AddCheck("ids", e.ids.Err)
+		monitoringServer.AddCheck("audit trail", e.auditTrail.Err)
+		go func() {
+			err := monitoringServer.ListenAndServe(metricsAddr)
+			if err != nil {
+				log.Printf("metrics server stopped: %s", err)
+			}
+		}()
+	}
+	for _, halt := range app.Halts() {
+		log.Printf("%s halted since %s: %s", halt, halt.Since, halt.Reason)
+	}
+	for _, backlog := range app.OutboundBacklog() {
+		if backlog.Depth > 0 {
+			log.Printf("%d execution reports for %s restored, they are sent on Logon", backlog.Depth, backlog.CompID)
+		}
+	}
+
+	if eodTime != "" {
+		go scheduleEndOfDay(app, eodAt)
+	}
 
-	log.Printf("acceptor", bytes.NewReader(stringData))
+	if itchAddr != "" {
+		feed := itch_feed.NewFeed(app)
+		go func() {
+			err := feed.PublishTo(itchAddr)
+			if err != nil {
+				log.Printf("ITCH feed stopped: %s", err)
+			}
+		}()
+		go func() {
+			err := feed.ListenAndServeRetransmissions(itchRetransmitAddr)
+			if err != nil {
+				log.Printf("ITCH retransmission server stopped: %s", err)
+			}
+		}()
+		go func() {
+			err := feed.ListenAndServeSnapshots(itchSnapshotAddr)
+			if err != nil {
+				log.Printf("ITCH snapshot server stopped: %s", err)
+			}
+		}()
+		stops = append(stops, func() {
+			_ = feed.Close()
+		})
+	}
+
+	log.Printf("starting acceptor")
 	acceptor, err := quickfix.NewAcceptor(app, quickfix.NewMemoryStoreFactory(), appSettings, logFactory)
 	if err != nil {
 		return fmt.Errorf("unable to create acceptor: %s", err)
@@ -79,24 +198,99 @@ func execute(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("unable to start FIX acceptor: %s", err)
 	}
+	stops = append(stops, acceptor.Stop)
+
+	if e.gateways {
+		restServer := rest_gateway.NewServer(app, e.keys)
+		go func() {
+			err := restServer.ListenAndServe(httpAddr)
+			if err != nil {
+				log.Printf("REST gateway stopped: %s", err)
+			}
+		}()
+		stops = append(stops, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			err := restServer.Shutdown(ctx)
+			if err != nil {
+				log.Printf("REST gateway shutdown: %s", err)
+			}
+		})
+		grpcServer := grpc_gateway.NewServer(app, e.keys)
+		go func() {
+			err := grpcServer.ListenAndServe(grpcAddr)
+			if err != nil {
+				log.Printf("gRPC gateway stopped: %s", err)
+			}
+		}()
+		stops = append(stops, grpcServer.Stop)
+		ouchServer := ouch_gateway.NewServer(app, e.keys)
+		go func() {
+			err := ouchServer.ListenAndServe(ouchAddr)
+			if err != nil {
+				log.Printf("OUCH gateway stopped: %s", err)
+			}
+		}()
+		stops = append(stops, func() {
+			_ = ouchServer.Close()
+		})
+	} else {
+		log.Printf("api keys file %s not found, REST, gRPC and OUCH gateways disabled", apiKeysFileName)
+	}
+
+	if monitoringServer != nil {
+		monitoringServer.SetReady()
+	}
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-interrupt
-		acceptor.Stop()
-		os.Exit(0)
-	}()
+	if !noConsole {
+		go func() {
+			quit, err := admin_console.NewConsole(app, os.Stdin, os.Stdout).Run()
+			if err != nil {
+				log.Printf("console stopped: %s", err)
+			}
+			if quit {
+				interrupt <- os.Interrupt
+				return
+			}
+			log.Printf("console closed, the exchange keeps running until interrupted")
+		}()
+	}
+	<-interrupt
+	log.Printf("shutting down")
+	return nil
+}
 
-	scanner := bufio.NewScanner(os.Stdin)
+// scheduleEndOfDay runs end of day processing at the local time of at, closing every
+// trading date up to the calendar date of the run: none on the days without a trading
+// date, and on startup those whose run was missed while the exchange was stopped.
+func scheduleEndOfDay(app *order_gateway.Application, at time.Time) {
 	for {
-		scanner.Scan()
-
-		//switch value := scanner.Text(); value {
-		//case "#symbols":
-		//	app.Display()
-		//default:
-		//	app.DisplayMarket(value)
-		//}
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		endOfDayUntil(app, next.AddDate(0, 0, -1).Format(order_gateway.TradingDateLayout))
+		time.Sleep(time.Until(next))
+		endOfDayUntil(app, next.Format(order_gateway.TradingDateLayout))
+	}
+}
+
+// endOfDayUntil closes the trading dates of app up to and including date, stopping at
+// one that stays open, which the next run tries again.
+func endOfDayUntil(app *order_gateway.Application, date string) {
+	for app.TradingDate() <= date {
+		result, err := app.EndOfDay()
+		if err != nil {
+			log.Printf("ALERT: end of day of %s failed: %s", result.TradingDate, err)
+			if app.TradingDate() == result.TradingDate {
+				return
+			}
+			continue
+		}
+		log.Printf("trading date %s closed, %d orders expired, %d carried to %s, reports written to %s", result.TradingDate,
+			result.Expired, result.Carried, result.NextTradingDate, result.ReportDir)
 	}
 }
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"stock_exchange/internal/services/order_gateway"
+	"strings"
+)
+
+var HashPasswordCmd = &cobra.Command{
+	Use:     "hash-password",
+	Short:   "Hash a FIX Logon password for the sessions file",
+	Long:    "Read a password from stdin and print its bcrypt hash, the password_bcrypt of a session in the sessions file",
+	Example: "echo -n secret | se hash-password",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			return fmt.Errorf("unable to read password: %s", err)
+		}
+		hash, err := order_gateway.HashPassword(strings.TrimRight(password, "\r\n"))
+		if err != nil {
+			return err
+		}
+		fmt.Println(hash)
+		return nil
+	},
+}
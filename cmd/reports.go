@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"path"
+	"stock_exchange/internal/services/api_keys"
+	"stock_exchange/internal/services/order_gateway"
+	"time"
+)
+
+var (
+	ReportsCmd = &cobra.Command{
+		Use:   "reports",
+		Short: "Build the end of day reports of a trading date again from its journal",
+		Long: "Build the closing prices and the orders, trades, positions and fees of each firm of a trading date, as CSV and JSON, " +
+			"and its clearing files, from the journal of its order events. The clearing breaks found at end of day are kept, " +
+			"there being no trade store left to reconcile with. This only regenerates reports: it does not close the trading date. " +
+			"End of day itself, which expires the DAY orders, carries the GTC and GTD ones and rolls the journal over, runs " +
+			"in the ordermatch command, at --eod-time or on the console's eod command, or in the eod command while the exchange " +
+			"is stopped, and writes these reports as it closes a date.",
+		Example: "se reports --date 20260302",
+		Args:    cobra.NoArgs,
+		RunE:    reports,
+	}
+	reportsDate         string
+	reportsJournalDir   string
+	reportsOutputDir    string
+	reportsSessionsFile string
+	reportsInstruments  string
+	reportsAPIKeysFile  string
+)
+
+func init() {
+	ReportsCmd.Flags().StringVar(&reportsDate, "date", time.Now().Format(order_gateway.TradingDateLayout),
+		"trading date to report, as YYYYMMDD")
+	ReportsCmd.Flags().StringVar(&reportsJournalDir, "journal-dir", path.Join("data", "journal"),
+		"directory of the journal of each trading date")
+	ReportsCmd.Flags().StringVar(&reportsOutputDir, "reports-dir", path.Join("data", "reports"),
+		"directory the reports are written to, in a directory named after the trading date")
+	ReportsCmd.Flags().StringVar(&reportsSessionsFile, "sessions", path.Join("config", "sessions.json"),
+		"JSON file with the firm and clearing firm of each FIX session, CompIDs stand for themselves without it")
+	ReportsCmd.Flags().StringVar(&reportsInstruments, "instruments", path.Join("config", "instruments.json"),
+		"JSON file with the settlement cycle of each instrument, T+2 without it")
+	ReportsCmd.Flags().StringVar(&reportsAPIKeysFile, "api-keys", path.Join("config", "api_keys.json"),
+		"JSON file with the firm of each API key CompID")
+}
+
+func reports(cmd *cobra.Command, args []string) error {
+	sessions := make(order_gateway.Sessions)
+	if _, statErr := os.Stat(reportsSessionsFile); statErr == nil {
+		var err error
+		sessions, err = order_gateway.LoadSessions(reportsSessionsFile)
+		if err != nil {
+			return err
+		}
+	} else {
+		log.Printf("sessions file %s not found, every CompID is reported as a firm of its own", reportsSessionsFile)
+	}
+	instruments := make(order_gateway.Instruments)
+	if _, statErr := os.Stat(reportsInstruments); statErr == nil {
+		var err error
+		instruments, err = order_gateway.LoadInstruments(reportsInstruments)
+		if err != nil {
+			return err
+		}
+	}
+	var firms map[string]string
+	if _, statErr := os.Stat(reportsAPIKeysFile); statErr == nil {
+		keys, err := api_keys.LoadAPIKeys(reportsAPIKeysFile)
+		if err != nil {
+			return err
+		}
+		firms = keys.Firms()
+	}
+	events, err := order_gateway.ReadJournal(order_gateway.JournalFileName(reportsJournalDir, reportsDate))
+	if err != nil {
+		return err
+	}
+	report := order_gateway.BuildDayReport(reportsDate, events, func(compID string) string {
+		if session, ok := sessions[compID]; ok {
+			return session.Firm
+		}
+		return firms[compID]
+	})
+	dir, err := order_gateway.WriteDayReport(reportsOutputDir, report)
+	if err != nil {
+		return err
+	}
+	err = order_gateway.WriteClearingReport(reportsOutputDir,
+		order_gateway.JournalClearingReport(report, sessions, firms, instruments))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d orders and %d executions of %s reported to %s\n", len(report.Orders), len(report.Executions), reportsDate, dir)
+	return nil
+}
@@ -15,5 +15,9 @@ func Execute() error {
 	}
 
 	c.AddCommand(ExecutorCmd)
+	c.AddCommand(HashPasswordCmd)
+	c.AddCommand(EndOfDayCmd)
+	c.AddCommand(ReportsCmd)
+	c.AddCommand(AuditCmd)
 	return c.Execute()
 }
@@ -0,0 +1,514 @@
+package admin_console
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"io"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Console is the operator console of the ordermatch command: one command per line
+// read from in, answered on out.
+type Console struct {
+	app *order_gateway.Application
+	in  io.Reader
+	out io.Writer
+}
+
+func NewConsole(app *order_gateway.Application, in io.Reader, out io.Writer) *Console {
+	return &Console{app: app, in: in, out: out}
+}
+
+type command struct {
+	name  string
+	usage string
+	help  string
+	run   func(c *Console, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"symbols", "symbols", "list the symbols with a book and their best bid and offer", (*Console).symbols},
+		{"book", "book SYMBOL [DEPTH]", "show the aggregated book of SYMBOL, DEPTH levels deep", (*Console).book},
+		{"sessions", "sessions", "show the FIX sessions, their throttles and backlogs", (*Console).sessions},
+		{"order", "order ORDERID | order COMPID CLORDID", "look up an order", (*Console).order},
+		{"orders", "orders [COMPID]", "list the open orders, of COMPID only when given", (*Console).orders},
+		{"cancel", "cancel COMPID CLORDID", "cancel an open order", (*Console).cancel},
+		{"trades", "trades [SYMBOL]", "list the trades, of SYMBOL only when given", (*Console).trades},
+		{"bust", "bust TRADEID [REASON...]", "cancel a trade, reported to both counterparties", (*Console).bust},
+		{"correct", "correct TRADEID PRICE QTY [REASON...]", "restate the price and quantity of a trade", (*Console).correct},
+		{"positions", "positions [ACCOUNT]", "show the positions and P&L, of ACCOUNT only when given", (*Console).positions},
+		{"allocations", "allocations", "list the trading date's allocations of block account fills to sub-accounts",
+			(*Console).allocations},
+		{"fees", "fees", "show each firm's fee tier, month-to-date volume and the day's fees and rebates", (*Console).fees},
+		{"clearing", "clearing", "show the trading date's netting per clearing firm and symbol, as it stands", (*Console).clearing},
+		{"eod", "eod", "close the trading date: expire DAY orders, carry GTC/GTD ones and write the day's reports", (*Console).eod},
+		{"halt", "halt exchange|firm F|session COMPID|symbol S [-cancel] [REASON...]",
+			"halt trading, with -cancel the resting orders are canceled too", (*Console).halt},
+		{"resume", "resume exchange|firm F|session COMPID|symbol S", "lift a halt", (*Console).resume},
+		{"halts", "halts", "list the halts in force", (*Console).halts},
+		{"stats", "stats", "show order and trade totals", (*Console).stats},
+		{"help", "help", "list the commands", (*Console).help},
+	}
+}
+
+// Run serves commands until the end of in, or until quit, which it reports so that the
+// exchange can be stopped.
+func (c *Console) Run() (bool, error) {
+	scanner := bufio.NewScanner(c.in)
+	c.prompt()
+	for scanner.Scan() {
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			c.prompt()
+			continue
+		}
+		if args[0] == "quit" || args[0] == "exit" {
+			return true, nil
+		}
+		err := c.Execute(args)
+		if err != nil {
+			fmt.Fprintf(c.out, "error: %s\n", err)
+		}
+		c.prompt()
+	}
+	return false, scanner.Err()
+}
+
+func (c *Console) prompt() {
+	fmt.Fprint(c.out, "> ")
+}
+
+// Execute runs a single command, its name first.
+func (c *Console) Execute(args []string) error {
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(c, args[1:])
+		}
+	}
+	return fmt.Errorf("unknown command %q, try help", args[0])
+}
+
+func (c *Console) table(write func(w io.Writer)) {
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	write(w)
+	_ = w.Flush()
+}
+
+func (c *Console) help(args []string) error {
+	c.table(func(w io.Writer) {
+		for _, cmd := range commands {
+			fmt.Fprintf(w, "%s\t%s\n", cmd.usage, cmd.help)
+		}
+		fmt.Fprintf(w, "quit\tstop the exchange\n")
+	})
+	return nil
+}
+
+func (c *Console) symbols(args []string) error {
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "SYMBOL\tBID\tBID QTY\tASK\tASK QTY\n")
+		for _, book := range c.app.OrderBooks() {
+			bbo := book.BBO()
+			fmt.Fprintf(w, "%s\t%s\t%s\n", book.Symbol(), level(bbo.Bid), level(bbo.Ask))
+		}
+	})
+	return nil
+}
+
+func level(l *domain.PriceLevel) string {
+	if l == nil {
+		return "-\t-"
+	}
+	return l.Price.String() + "\t" + l.Quantity.String()
+}
+
+func (c *Console) book(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: book SYMBOL [DEPTH]")
+	}
+	depth := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid depth %q", args[1])
+		}
+		depth = n
+	}
+	book, ok := c.app.OrderBook(args[0])
+	if !ok {
+		return fmt.Errorf("no book for %s", args[0])
+	}
+	d := book.Depth(depth)
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "ORDERS\tBID QTY\tBID\tASK\tASK QTY\tORDERS\n")
+		for i := 0; i < max(len(d.Bids), len(d.Asks)); i++ {
+			bid, ask := "\t\t", "\t\t"
+			if i < len(d.Bids) {
+				bid = fmt.Sprintf("%d\t%s\t%s", d.Bids[i].Orders, d.Bids[i].Quantity, d.Bids[i].Price)
+			}
+			if i < len(d.Asks) {
+				ask = fmt.Sprintf("%s\t%s\t%d", d.Asks[i].Price, d.Asks[i].Quantity, d.Asks[i].Orders)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", bid, ask)
+		}
+	})
+	return nil
+}
+
+func (c *Console) sessions(args []string) error {
+	throttles := make(map[string]order_gateway.ThrottleUsage)
+	for _, usage := range c.app.ThrottleUsage() {
+		throttles[usage.CompID] = usage
+	}
+	backlogs := make(map[string]int)
+	for _, backlog := range c.app.OutboundBacklog() {
+		backlogs[backlog.CompID] = backlog.Depth
+	}
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "COMPID\tVERSION\tFIRM\tSTATUS\tBACKLOG\tMSGS/S\tORDERS/S\tCANCELS/S\tBREACHES\n")
+		for _, session := range c.app.FIXSessions() {
+			status := "logged out"
+			if session.LoggedOn {
+				status = "logged on"
+			}
+			throttle := "-\t-\t-\t-"
+			if usage, ok := throttles[session.CompID]; ok {
+				throttle = fmt.Sprintf("%s\t%s\t%s\t%d", bucket(usage.Messages), bucket(usage.NewOrders),
+					bucket(usage.Cancels), usage.Breaches)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", session.CompID, session.BeginString, orDash(session.Firm), status,
+				backlogs[session.CompID], throttle)
+		}
+	})
+	return nil
+}
+
+func bucket(usage order_gateway.BucketUsage) string {
+	if usage.Limit == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f/%.0f", usage.Used, usage.Limit)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func (c *Console) order(args []string) error {
+	var view domain.OrderView
+	var ok bool
+	switch len(args) {
+	case 1:
+		view, ok = c.app.LookupOrderByID(args[0])
+	case 2:
+		view, ok = c.app.LookupOrder(args[0], args[1])
+	default:
+		return fmt.Errorf("usage: order ORDERID | order COMPID CLORDID")
+	}
+	if !ok {
+		return order_gateway.ErrUnknownOrder
+	}
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "order id\t%s\n", view.OrderID)
+		fmt.Fprintf(w, "clordid\t%s\n", view.ClOrdID)
+		fmt.Fprintf(w, "sender\t%s\n", view.SenderCompID)
+		fmt.Fprintf(w, "account\t%s\n", orDash(view.Account))
+		fmt.Fprintf(w, "symbol\t%s\n", view.Symbol)
+		fmt.Fprintf(w, "side\t%s\n", sideName(view.Side))
+		fmt.Fprintf(w, "price\t%s\n", view.Price)
+		fmt.Fprintf(w, "quantity\t%s\n", view.Quantity)
+		fmt.Fprintf(w, "executed\t%s @ %s\n", view.ExecutedQuantity, view.AvgPx())
+		fmt.Fprintf(w, "leaves\t%s\n", view.LeavesQty)
+		fmt.Fprintf(w, "status\t%s\n", statusName(view.Status))
+		fmt.Fprintf(w, "created\t%s\n", view.CreatedAt.Format("2006-01-02 15:04:05.000"))
+	})
+	return nil
+}
+
+func (c *Console) orders(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: orders [COMPID]")
+	}
+	compID := ""
+	if len(args) == 1 {
+		compID = args[0]
+	}
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "ORDER ID\tSENDER\tCLORDID\tSYMBOL\tSIDE\tPRICE\tLEAVES\n")
+		for _, view := range c.app.OpenOrders(compID) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", view.OrderID, view.SenderCompID, view.ClOrdID, view.Symbol,
+				sideName(view.Side), view.Price, view.LeavesQty)
+		}
+	})
+	return nil
+}
+
+func sideName(side domain.OrderSide) string {
+	if side == domain.SELL {
+		return "sell"
+	}
+	return "buy"
+}
+
+func statusName(status domain.OrderStatus) string {
+	switch status {
+	case domain.OrderStatusOpen:
+		return "open"
+	case domain.OrderStatusFilled:
+		return "filled"
+	case domain.OrderStatusRejected:
+		return "rejected"
+	case domain.OrderStatusCanceled:
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
+
+func (c *Console) cancel(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: cancel COMPID CLORDID")
+	}
+	event, err := c.app.Cancel(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "order %s canceled, %s %s left unfilled\n", event.Order.OrderID, event.Order.LeavesQty, event.Order.Symbol)
+	return nil
+}
+
+func (c *Console) trades(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: trades [SYMBOL]")
+	}
+	symbol := ""
+	if len(args) == 1 {
+		symbol = args[0]
+	}
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "TRADE ID	SYMBOL	QTY	PRICE	BUY ORDER	SELL ORDER	STATUS	BUY ACCOUNT	SELL ACCOUNT\n")
+		for _, trade := range c.app.Trades(symbol) {
+			fmt.Fprintf(w, "%s	%s	%s	%s	%s	%s	%s	%s	%s\n", trade.TradeID, trade.Symbol, trade.Quantity, trade.Price,
+				trade.BuyOrderID, trade.SellOrderID, trade.Status, orDash(trade.Buyer.Account), orDash(trade.Seller.Account))
+		}
+	})
+	return nil
+}
+
+func (c *Console) bust(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: bust TRADEID [REASON...]")
+	}
+	_, err := c.app.BustTrade(args[0], strings.Join(args[1:], " "))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "trade %s busted\n", args[0])
+	return nil
+}
+
+func (c *Console) correct(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: correct TRADEID PRICE QTY [REASON...]")
+	}
+	price, err := decimal.NewFromString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid price %q", args[1])
+	}
+	quantity, err := decimal.NewFromString(args[2])
+	if err != nil {
+		return fmt.Errorf("invalid quantity %q", args[2])
+	}
+	_, err = c.app.CorrectTrade(args[0], price, quantity, strings.Join(args[3:], " "))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "trade %s corrected to %s @ %s\n", args[0], quantity, price)
+	return nil
+}
+
+func (c *Console) positions(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: positions [ACCOUNT]")
+	}
+	account := ""
+	if len(args) == 1 {
+		account = args[0]
+	}
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "ACCOUNT\tSYMBOL\tLONG\tSHORT\tAVG COST\tMARK\tREALIZED\tUNREALIZED\n")
+		for _, p := range c.app.Positions(account) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", p.Account, p.Symbol, p.LongQty(), p.ShortQty(),
+				p.AvgCost.Round(4), p.MarkPrice.Round(4), p.RealizedPnL.Round(2), p.UnrealizedPnL.Round(2))
+		}
+	})
+	return nil
+}
+
+func (c *Console) allocations(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: allocations")
+	}
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "ALLOCID\tCOMPID\tACCOUNT\tSYMBOL\tSIDE\tQTY\tAVG PX\tSUB-ACCOUNTS\n")
+		for _, a := range c.app.Allocations() {
+			splits := make([]string, 0, len(a.Splits))
+			for _, split := range a.Splits {
+				splits = append(splits, fmt.Sprintf("%s=%s", split.Account, split.Quantity))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", a.AllocID, a.CompID, a.Account, a.Symbol, sideName(a.Side),
+				a.Quantity, a.AvgPx.Round(4), strings.Join(splits, ","))
+		}
+	})
+	return nil
+}
+
+func (c *Console) fees(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: fees")
+	}
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "FIRM\tTIER\tMTD VOLUME\tEXECS\tMAKER VOL\tTAKER VOL\tFEES\tREBATES\tNET\n")
+		for _, f := range c.app.FeeSummary() {
+			tier := f.Tier
+			if tier == "" {
+				tier = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", f.Firm, tier, f.MonthlyVolume.Round(2), f.Executions,
+				f.MakerVolume.Round(2), f.TakerVolume.Round(2), f.Fees.Round(2), f.Rebates.Round(2), f.Net.Round(2))
+		}
+	})
+	return nil
+}
+
+func (c *Console) clearing(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: clearing")
+	}
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "CLEARING FIRM\tSYMBOL\tEXECS\tBOUGHT QTY\tBOUGHT VALUE\tSOLD QTY\tSOLD VALUE\tNET QTY\tNET CASH\tSETTLES\n")
+		for _, r := range c.app.Clearing() {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.ClearingFirm, r.Symbol, r.Executions, r.BoughtQty,
+				r.BoughtValue, r.SoldQty, r.SoldValue, r.NetQty, r.NetCash, r.SettlementDate)
+		}
+	})
+	return nil
+}
+
+func (c *Console) eod(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: eod")
+	}
+	result, err := c.app.EndOfDay()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "trading date %s closed, %d orders expired, %d carried to %s\n", result.TradingDate, result.Expired,
+		result.Carried, result.NextTradingDate)
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "SYMBOL\tOPEN\tHIGH\tLOW\tCLOSE\tSETTLEMENT\tVOLUME\tTRADES\n")
+		for _, p := range result.Prices {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", p.Symbol, p.Open, p.High, p.Low, p.Close, p.Settlement, p.Volume,
+				p.Trades)
+		}
+	})
+	if len(result.Clearing.Breaks) > 0 {
+		fmt.Fprintf(c.out, "%d clearing breaks between the trade store and the journal\n", len(result.Clearing.Breaks))
+	}
+	if result.ReportDir != "" {
+		fmt.Fprintf(c.out, "reports written to %s\n", result.ReportDir)
+	}
+	return nil
+}
+
+// haltTarget splits the scope and target off the arguments of halt and resume.
+func haltTarget(args []string) (order_gateway.HaltScope, string, []string, error) {
+	if len(args) == 0 {
+		return "", "", nil, fmt.Errorf("missing scope, one of exchange, firm, session or symbol")
+	}
+	scope := order_gateway.HaltScope(args[0])
+	if scope == order_gateway.HaltExchange {
+		return scope, "", args[1:], nil
+	}
+	if len(args) < 2 {
+		return "", "", nil, fmt.Errorf("missing %s to halt", scope)
+	}
+	return scope, args[1], args[2:], nil
+}
+
+func (c *Console) halt(args []string) error {
+	scope, target, rest, err := haltTarget(args)
+	if err != nil {
+		return err
+	}
+	cancelResting := len(rest) > 0 && rest[0] == "-cancel"
+	if cancelResting {
+		rest = rest[1:]
+	}
+	events, err := c.app.Halt(scope, target, strings.Join(rest, " "), cancelResting)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%s halted, %d orders canceled\n", order_gateway.Halt{Scope: scope, Target: target}, len(events))
+	return nil
+}
+
+func (c *Console) resume(args []string) error {
+	scope, target, rest, err := haltTarget(args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("usage: resume exchange|firm F|session COMPID|symbol S")
+	}
+	err = c.app.Resume(scope, target)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%s resumed\n", order_gateway.Halt{Scope: scope, Target: target})
+	return nil
+}
+
+func (c *Console) halts(args []string) error {
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "SCOPE\tTARGET\tSINCE\tREASON\n")
+		for _, halt := range c.app.Halts() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", halt.Scope, orDash(halt.Target),
+				halt.Since.Local().Format("2006-01-02 15:04:05"), halt.Reason)
+		}
+	})
+	return nil
+}
+
+func (c *Console) stats(args []string) error {
+	stats := c.app.Stats()
+	loggedOn := 0
+	sessions := c.app.FIXSessions()
+	for _, session := range sessions {
+		if session.LoggedOn {
+			loggedOn++
+		}
+	}
+	c.table(func(w io.Writer) {
+		fmt.Fprintf(w, "books\t%d\n", stats.Books)
+		fmt.Fprintf(w, "orders\t%d\n", stats.Orders)
+		fmt.Fprintf(w, "open orders\t%d\n", stats.OpenOrders)
+		fmt.Fprintf(w, "trades\t%d\n", stats.Trades)
+		fmt.Fprintf(w, "traded quantity\t%s\n", stats.TradedQuantity)
+		fmt.Fprintf(w, "traded notional\t%s\n", stats.TradedNotional)
+		fmt.Fprintf(w, "FIX sessions\t%d logged on of %d\n", loggedOn, len(sessions))
+		fmt.Fprintf(w, "halts\t%d\n", len(c.app.Halts()))
+	})
+	return nil
+}
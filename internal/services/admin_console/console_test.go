@@ -0,0 +1,135 @@
+package admin_console
+
+import (
+	"bytes"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"slices"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strings"
+	"testing"
+)
+
+func testApp(t *testing.T) *order_gateway.Application {
+	app := order_gateway.NewApplication()
+	orders := []struct {
+		sender, clOrdID string
+		side            domain.OrderSide
+		price, qty      int64
+	}{
+		{"A", "s1", domain.SELL, 11, 100},
+		{"A", "s2", domain.SELL, 12, 50},
+		{"B", "b1", domain.BUY, 10, 200},
+		{"B", "b2", domain.BUY, 11, 40},
+	}
+	for _, o := range orders {
+		_, err := app.Submit(app.NewOrder(o.clOrdID, "VALE3", o.sender, "EX", o.side, enum.OrdType_LIMIT,
+			decimal.NewFromInt(o.price), decimal.NewFromInt(o.qty)))
+		require.NoError(t, err)
+	}
+	return app
+}
+
+func TestConsole_Execute(t *testing.T) {
+	tests := []struct {
+		command string
+		// want are beginnings of output lines, with their columns separated by single spaces
+		want []string
+		err  string
+	}{
+		{"symbols", []string{"VALE3 10 200 11 60"}, ""},
+		{"book VALE3", []string{"1 200 10 11 60 1", "12 50 1"}, ""},
+		{"book VALE3 1", []string{"1 200 10 11 60 1"}, ""},
+		{"book PETR4", nil, "no book for PETR4"},
+		{"book VALE3 x", nil, `invalid depth "x"`},
+		{"order B b2", []string{"clordid b2", "executed 40 @ 11", "status filled"}, ""},
+		{"order {s1}", []string{"clordid s1", "leaves 60", "status open"}, ""},
+		{"order A nope", nil, "unknown order"},
+		{"orders B", []string{"{b1} B b1 VALE3 buy 10 200"}, ""},
+		{"cancel A s2", []string{"order {s2} canceled, 50 VALE3 left unfilled"}, ""},
+		{"cancel A s2", nil, "order is not open"},
+		{"stats", []string{"orders 4", "open orders 2", "trades 1", "traded quantity 40", "traded notional 440", "halts 0"}, ""},
+		{"trades", []string{"{t1} VALE3 40 11 {b2} {s1} active"}, ""},
+		{"positions", []string{"A VALE3 0 40 11 11 0 0", "B VALE3 40 0 11 11 0 0"}, ""},
+		{"positions B", []string{"B VALE3 40"}, ""},
+		{"allocations", []string{"ALLOCID COMPID ACCOUNT SYMBOL SIDE QTY AVG PX SUB-ACCOUNTS"}, ""},
+		{"allocations B", nil, "usage: allocations"},
+		{"fees", []string{"A - 0 1 440 0 0 0 0", "B - 0 1 0 440 0 0 0"}, ""},
+		{"fees A", nil, "usage: fees"},
+		{"clearing", []string{"A VALE3 1 0 0 40 440 -40 440", "B VALE3 1 40 440 0 0 40 -440"}, ""},
+		{"clearing A", nil, "usage: clearing"},
+		{"correct {t1} 10.5 30 price out of band", []string{"trade {t1} corrected to 30 @ 10.5"}, ""},
+		{"correct {t1} 10.5 x", nil, `invalid quantity "x"`},
+		{"order B b2", []string{"executed 30 @ 10.5"}, ""},
+		// what the seller had left keeps working after the shrinking correction
+		{"order {s1}", []string{"executed 30 @ 10.5", "leaves 60", "status open"}, ""},
+		{"bust {t1} erroneous", []string{"trade {t1} busted"}, ""},
+		{"bust {t1}", nil, "trade already busted"},
+		{"bust T9", nil, "unknown trade"},
+		{"trades PETR4", []string{"TRADE ID SYMBOL"}, ""},
+		{"trades VALE3", []string{"{t1} VALE3 30 10.5 {b2} {s1} busted"}, ""},
+		{"halt symbol VALE3 -cancel corporate action", []string{"symbol VALE3 halted, 2 orders canceled"}, ""},
+		{"halt firm", nil, "missing firm to halt"},
+		{"halt desk X", nil, `unknown halt scope "desk"`},
+		{"halts", []string{"symbol VALE3"}, ""},
+		{"resume symbol VALE3", []string{"symbol VALE3 resumed"}, ""},
+		{"resume exchange", nil, "not halted"},
+		{"eod", []string{"trading date {date} closed, 0 orders expired, 0 carried to", "SYMBOL OPEN HIGH LOW CLOSE"}, ""},
+		{"eod now", nil, "usage: eod"},
+		{"sessions", []string{"COMPID VERSION FIRM STATUS"}, ""},
+		{"help", []string{"cancel COMPID CLORDID cancel an open order"}, ""},
+		{"launch", nil, `unknown command "launch", try help`},
+	}
+	app := testApp(t)
+	// {clOrdID} stands for the OrderID the engine gave the order, {t1} for its only trade and
+	// {date} for the trading date
+	var orderIDs []string
+	for _, ref := range [][2]string{{"A", "s1"}, {"A", "s2"}, {"B", "b1"}, {"B", "b2"}} {
+		view, ok := app.LookupOrder(ref[0], ref[1])
+		require.True(t, ok)
+		orderIDs = append(orderIDs, "{"+ref[1]+"}", view.OrderID)
+	}
+	trades := app.Trades("")
+	require.Len(t, trades, 1)
+	orderIDs = append(orderIDs, "{t1}", trades[0].TradeID, "{date}", app.TradingDate())
+	withIDs := strings.NewReplacer(orderIDs...)
+	var out bytes.Buffer
+	console := NewConsole(app, nil, &out)
+	for _, tt := range tests {
+		out.Reset()
+		tt.command = withIDs.Replace(tt.command)
+		for i, want := range tt.want {
+			tt.want[i] = withIDs.Replace(want)
+		}
+		err := console.Execute(strings.Fields(tt.command))
+		if tt.err != "" {
+			require.EqualError(t, err, tt.err, tt.command)
+			continue
+		}
+		require.NoError(t, err, tt.command)
+		lines := strings.Split(out.String(), "\n")
+		for _, want := range tt.want {
+			require.True(t, slices.ContainsFunc(lines, func(line string) bool {
+				return strings.HasPrefix(strings.Join(strings.Fields(line), " "), want)
+			}), "%s: %q not in\n%s", tt.command, want, out.String())
+		}
+	}
+}
+
+func TestConsole_Run(t *testing.T) {
+	app := testApp(t)
+	var out bytes.Buffer
+	quit, err := NewConsole(app, strings.NewReader("symbols\n\nbogus\n"), &out).Run()
+	require.NoError(t, err)
+	require.False(t, quit)
+	require.Contains(t, out.String(), "VALE3")
+	require.Contains(t, out.String(), `error: unknown command "bogus"`)
+
+	out.Reset()
+	quit, err = NewConsole(app, strings.NewReader("quit\nsymbols\n"), &out).Run()
+	require.NoError(t, err)
+	require.True(t, quit)
+	require.NotContains(t, out.String(), "VALE3")
+}
@@ -0,0 +1,86 @@
+// Package api_keys holds the API keys that authenticate the clients of the REST, gRPC and OUCH gateways.
+package api_keys
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// APIKey maps the sha256 of a client key to the CompID its orders are sent as, and
+// the firm that CompID belongs to. Keys themselves are never stored.
+type APIKey struct {
+	CompID    string `json:"comp_id"`
+	KeySHA256 string `json:"key_sha256"`
+	Firm      string `json:"firm"`
+}
+
+type APIKeys []APIKey
+
+type apiKeysFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// LoadAPIKeys reads a JSON API keys file and validates every entry.
+func LoadAPIKeys(fileName string) (APIKeys, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v, %v", fileName, err)
+	}
+	var f apiKeysFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading api keys: %s", err)
+	}
+	firms := make(map[string]string)
+	for _, key := range f.Keys {
+		if key.CompID == "" {
+			return nil, fmt.Errorf("api key without comp_id")
+		}
+		if firm, ok := firms[key.CompID]; ok && firm != key.Firm {
+			return nil, fmt.Errorf("api keys of %s differ in firm", key.CompID)
+		}
+		firms[key.CompID] = key.Firm
+		digest, err := hex.DecodeString(key.KeySHA256)
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("api key of %s: key_sha256 must be a hex encoded sha256", key.CompID)
+		}
+	}
+	return f.Keys, nil
+}
+
+// HashAPIKey returns the value stored as key_sha256 for key.
+func HashAPIKey(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:])
+}
+
+// Firms maps every CompID with a firm to it.
+func (k APIKeys) Firms() map[string]string {
+	firms := make(map[string]string)
+	for _, apiKey := range k {
+		if apiKey.Firm != "" {
+			firms[apiKey.CompID] = apiKey.Firm
+		}
+	}
+	return firms
+}
+
+// CompID returns the CompID key belongs to. Every configured key is compared, in
+// constant time, so timing does not leak which matched.
+func (k APIKeys) CompID(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	digest := HashAPIKey(key)
+	compID := ""
+	for _, apiKey := range k {
+		if subtle.ConstantTimeCompare([]byte(digest), []byte(apiKey.KeySHA256)) == 1 {
+			compID = apiKey.CompID
+		}
+	}
+	return compID, compID != ""
+}
@@ -0,0 +1,111 @@
+package grpc_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"stock_exchange/api/exchangepb"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+)
+
+func toSide(side domain.OrderSide) exchangepb.Side {
+	if side == domain.BUY {
+		return exchangepb.Side_SIDE_BUY
+	}
+	return exchangepb.Side_SIDE_SELL
+}
+
+func toOrderType(ordType enum.OrdType) exchangepb.OrderType {
+	if ordType == enum.OrdType_MARKET {
+		return exchangepb.OrderType_ORDER_TYPE_MARKET
+	}
+	return exchangepb.OrderType_ORDER_TYPE_LIMIT
+}
+
+func toOrderStatus(orderStatus domain.OrderStatus) exchangepb.OrderStatus {
+	switch orderStatus {
+	case domain.OrderStatusOpen:
+		return exchangepb.OrderStatus_ORDER_STATUS_OPEN
+	case domain.OrderStatusFilled:
+		return exchangepb.OrderStatus_ORDER_STATUS_FILLED
+	case domain.OrderStatusRejected:
+		return exchangepb.OrderStatus_ORDER_STATUS_REJECTED
+	case domain.OrderStatusCanceled:
+		return exchangepb.OrderStatus_ORDER_STATUS_CANCELED
+	default:
+		return exchangepb.OrderStatus_ORDER_STATUS_UNSPECIFIED
+	}
+}
+
+func toExecType(eventType order_gateway.OrderEventType) exchangepb.ExecType {
+	switch eventType {
+	case order_gateway.OrderEventNew:
+		return exchangepb.ExecType_EXEC_TYPE_NEW
+	case order_gateway.OrderEventTrade:
+		return exchangepb.ExecType_EXEC_TYPE_TRADE
+	case order_gateway.OrderEventCanceled, order_gateway.OrderEventExpired:
+		return exchangepb.ExecType_EXEC_TYPE_CANCELED
+	case order_gateway.OrderEventReplaced:
+		return exchangepb.ExecType_EXEC_TYPE_REPLACED
+	case order_gateway.OrderEventRejected:
+		return exchangepb.ExecType_EXEC_TYPE_REJECTED
+	default:
+		return exchangepb.ExecType_EXEC_TYPE_UNSPECIFIED
+	}
+}
+
+func toOrder(view domain.OrderView) *exchangepb.Order {
+	return &exchangepb.Order{
+		OrderId:          view.OrderID,
+		ClientOrderId:    view.ClOrdID,
+		Symbol:           view.Symbol,
+		Side:             toSide(view.Side),
+		Type:             toOrderType(view.OrdType),
+		Price:            view.Price.String(),
+		Quantity:         view.Quantity.String(),
+		LeavesQuantity:   view.LeavesQty.String(),
+		ExecutedQuantity: view.ExecutedQuantity.String(),
+		AvgPrice:         view.AvgPx().String(),
+		Status:           toOrderStatus(view.Status),
+		CreatedAt:        timestamppb.New(view.CreatedAt),
+	}
+}
+
+func toExecutionReport(event order_gateway.ExecReportRequiredEvent) *exchangepb.ExecutionReport {
+	return &exchangepb.ExecutionReport{
+		ExecId:            event.ExecID,
+		ExecType:          toExecType(event.Type),
+		Order:             toOrder(event.Order),
+		OrigClientOrderId: event.OrigClOrdID,
+		LastQuantity:      event.LastQty.String(),
+		LastPrice:         event.LastPx.String(),
+		Text:              event.Text,
+	}
+}
+
+func toPriceLevels(levels []domain.PriceLevel) []*exchangepb.PriceLevel {
+	out := make([]*exchangepb.PriceLevel, 0, len(levels))
+	for _, level := range levels {
+		out = append(out, &exchangepb.PriceLevel{
+			Price:    level.Price.String(),
+			Quantity: level.Quantity.String(),
+			Orders:   int32(level.Orders),
+		})
+	}
+	return out
+}
+
+// parseDecimal parses a decimal field, an empty one being zero.
+func parseDecimal(name, value string) (decimal.Decimal, error) {
+	if value == "" {
+		return decimal.Zero, nil
+	}
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.Zero, status.Errorf(codes.InvalidArgument, "%s: %s", name, err)
+	}
+	return d, nil
+}
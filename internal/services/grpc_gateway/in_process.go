@@ -0,0 +1,35 @@
+package grpc_gateway
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"stock_exchange/internal/services/api_keys"
+	"stock_exchange/internal/services/order_gateway"
+)
+
+// InProcessServer runs the gateway over an in-memory listener, for tests of gRPC clients.
+type InProcessServer struct {
+	*Server
+	listener *bufconn.Listener
+}
+
+func StartInProcess(app *order_gateway.Application, keys api_keys.APIKeys, opts ...Option) *InProcessServer {
+	s := &InProcessServer{Server: NewServer(app, keys, opts...), listener: bufconn.Listen(1 << 20)}
+	go func() {
+		_ = s.grpcServer.Serve(s.listener)
+	}()
+	return s
+}
+
+// Dial connects a client to the in-process server.
+func (s *InProcessServer) Dial() (*grpc.ClientConn, error) {
+	return grpc.NewClient("passthrough:///in-process",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+}
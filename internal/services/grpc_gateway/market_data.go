@@ -0,0 +1,21 @@
+package grpc_gateway
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"stock_exchange/api/exchangepb"
+)
+
+func (s *Server) StreamMarketData(req *exchangepb.MarketDataRequest, stream exchangepb.MarketData_StreamMarketDataServer) error {
+	if req.GetSymbol() == "" {
+		return status.Error(codes.InvalidArgument, "symbol is required")
+	}
+	if req.GetDepth() < 0 {
+		return status.Error(codes.InvalidArgument, "depth must not be negative")
+	}
+	sub := s.streams.subscribeBook(req.GetSymbol(), int(req.GetDepth()))
+	defer s.streams.unsubscribeBook(sub)
+	return sub.forward(stream.Context(), func(msg any) error {
+		return stream.Send(msg.(*exchangepb.MarketDataUpdate))
+	})
+}
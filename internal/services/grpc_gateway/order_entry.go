@@ -0,0 +1,139 @@
+package grpc_gateway
+
+import (
+	"context"
+	"errors"
+	"github.com/quickfixgo/enum"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"stock_exchange/api/exchangepb"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+)
+
+func engineError(err error) error {
+	switch {
+	case errors.Is(err, order_gateway.ErrUnknownOrder):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, order_gateway.ErrDuplicateClOrdID):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, order_gateway.ErrOrderNotOpen), errors.Is(err, order_gateway.ErrHalted):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, order_gateway.ErrNotEntitled):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+}
+
+// refuse records that the request of receipt was refused with err, and returns err.
+func refuse(receipt *order_gateway.AuditReceipt, err error) error {
+	receipt.Rejected(status.Convert(err).Message())
+	return err
+}
+
+func (s *Server) NewOrder(ctx context.Context, req *exchangepb.NewOrderRequest) (*exchangepb.OrderResponse, error) {
+	compID := compIDFrom(ctx)
+	receipt := s.app.ReceiveRequest(domain.EntryGRPC, compID, enum.MsgType_ORDER_SINGLE, req.GetClientOrderId(), "",
+		req.String())
+	defer receipt.Done()
+	if req.GetClientOrderId() == "" || req.GetSymbol() == "" {
+		return nil, refuse(receipt, status.Error(codes.InvalidArgument, "client_order_id and symbol are required"))
+	}
+	var side domain.OrderSide
+	switch req.GetSide() {
+	case exchangepb.Side_SIDE_BUY:
+		side = domain.BUY
+	case exchangepb.Side_SIDE_SELL:
+		side = domain.SELL
+	default:
+		return nil, refuse(receipt, status.Error(codes.InvalidArgument, "side is required"))
+	}
+	price, err := parseDecimal("price", req.GetPrice())
+	if err != nil {
+		return nil, refuse(receipt, err)
+	}
+	quantity, err := parseDecimal("quantity", req.GetQuantity())
+	if err != nil {
+		return nil, refuse(receipt, err)
+	}
+	if !quantity.IsPositive() {
+		return nil, refuse(receipt, status.Error(codes.InvalidArgument, "quantity must be positive"))
+	}
+	var ordType enum.OrdType
+	switch req.GetType() {
+	case exchangepb.OrderType_ORDER_TYPE_LIMIT, exchangepb.OrderType_ORDER_TYPE_UNSPECIFIED:
+		ordType = enum.OrdType_LIMIT
+		if !price.IsPositive() {
+			return nil, refuse(receipt, status.Error(codes.InvalidArgument, "limit orders need a positive price"))
+		}
+	case exchangepb.OrderType_ORDER_TYPE_MARKET:
+		ordType = enum.OrdType_MARKET
+	default:
+		return nil, refuse(receipt, status.Error(codes.InvalidArgument, "unknown order type"))
+	}
+	order := s.app.NewOrder(req.GetClientOrderId(), req.GetSymbol(), compID, s.targetCompID, side, ordType, price, quantity)
+	order.SetEntryProtocol(domain.EntryGRPC)
+	receipt.Validated(order)
+	events, err := s.app.Submit(order)
+	if err != nil {
+		return nil, engineError(err)
+	}
+	if len(events) > 0 && events[0].Type == order_gateway.OrderEventRejected {
+		return &exchangepb.OrderResponse{Order: toOrder(events[0].Order), RejectReason: events[0].Text}, nil
+	}
+	view, _ := s.app.LookupOrder(compID, req.GetClientOrderId())
+	return &exchangepb.OrderResponse{Order: toOrder(view)}, nil
+}
+
+func (s *Server) CancelOrder(ctx context.Context, req *exchangepb.CancelOrderRequest) (*exchangepb.OrderResponse, error) {
+	compID := compIDFrom(ctx)
+	receipt := s.app.ReceiveRequest(domain.EntryGRPC, compID, enum.MsgType_ORDER_CANCEL_REQUEST, "", req.GetClientOrderId(),
+		req.String())
+	defer receipt.Done()
+	event, err := s.app.Cancel(compID, req.GetClientOrderId())
+	if err != nil {
+		return nil, refuse(receipt, engineError(err))
+	}
+	return &exchangepb.OrderResponse{Order: toOrder(event.Order)}, nil
+}
+
+func (s *Server) ReplaceOrder(ctx context.Context, req *exchangepb.ReplaceOrderRequest) (*exchangepb.OrderResponse, error) {
+	compID := compIDFrom(ctx)
+	receipt := s.app.ReceiveRequest(domain.EntryGRPC, compID, enum.MsgType_ORDER_CANCEL_REPLACE_REQUEST,
+		req.GetClientOrderId(), req.GetOrigClientOrderId(), req.String())
+	defer receipt.Done()
+	if req.GetClientOrderId() == "" {
+		return nil, refuse(receipt, status.Error(codes.InvalidArgument, "client_order_id is required"))
+	}
+	price, err := parseDecimal("price", req.GetPrice())
+	if err != nil {
+		return nil, refuse(receipt, err)
+	}
+	quantity, err := parseDecimal("quantity", req.GetQuantity())
+	if err != nil {
+		return nil, refuse(receipt, err)
+	}
+	_, err = s.app.Replace(compID, req.GetOrigClientOrderId(), req.GetClientOrderId(), price, quantity)
+	if err != nil {
+		return nil, refuse(receipt, engineError(err))
+	}
+	view, _ := s.app.LookupOrder(compID, req.GetClientOrderId())
+	return &exchangepb.OrderResponse{Order: toOrder(view)}, nil
+}
+
+func (s *Server) OrderStatus(ctx context.Context, req *exchangepb.OrderStatusRequest) (*exchangepb.OrderResponse, error) {
+	view, ok := s.app.LookupOrder(compIDFrom(ctx), req.GetClientOrderId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "order %s not found", req.GetClientOrderId())
+	}
+	return &exchangepb.OrderResponse{Order: toOrder(view)}, nil
+}
+
+func (s *Server) StreamExecutionReports(_ *exchangepb.StreamExecutionReportsRequest, stream exchangepb.OrderEntry_StreamExecutionReportsServer) error {
+	sub := s.streams.subscribeExecutions(compIDFrom(stream.Context()))
+	defer s.streams.unsubscribeExecutions(sub)
+	return sub.forward(stream.Context(), func(msg any) error {
+		return stream.Send(msg.(*exchangepb.ExecutionReport))
+	})
+}
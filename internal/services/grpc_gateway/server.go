@@ -0,0 +1,126 @@
+package grpc_gateway
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log"
+	"net"
+	"stock_exchange/api/exchangepb"
+	"stock_exchange/internal/services/api_keys"
+	"stock_exchange/internal/services/order_gateway"
+)
+
+const (
+	APIKeyMetadata      = "x-api-key"
+	DefaultTargetCompID = "ORDERGATEWAY"
+)
+
+// Server implements the OrderEntry and MarketData gRPC services on top of the
+// same matching path as FIX NewOrderSingle.
+type Server struct {
+	exchangepb.UnimplementedOrderEntryServer
+	exchangepb.UnimplementedMarketDataServer
+	app          *order_gateway.Application
+	keys         api_keys.APIKeys
+	targetCompID string
+	streams      *streamHub
+	grpcServer   *grpc.Server
+}
+
+type Option func(*Server)
+
+// WithTargetCompID sets the TargetCompID of the orders entered through the gateway.
+func WithTargetCompID(targetCompID string) Option {
+	return func(s *Server) {
+		s.targetCompID = targetCompID
+	}
+}
+
+func NewServer(app *order_gateway.Application, keys api_keys.APIKeys, opts ...Option) *Server {
+	s := &Server{
+		app:          app,
+		keys:         keys,
+		targetCompID: DefaultTargetCompID,
+		streams:      newStreamHub(app),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	app.AddListener(s.streams)
+	app.AddBookListener(s.streams)
+	app.Quiesce(s.streams.reset)
+	s.grpcServer = grpc.NewServer(
+		grpc.UnaryInterceptor(s.unaryAuth),
+		grpc.StreamInterceptor(s.streamAuth),
+	)
+	exchangepb.RegisterOrderEntryServer(s.grpcServer, s)
+	exchangepb.RegisterMarketDataServer(s.grpcServer, s)
+	return s
+}
+
+// Serve accepts connections on lis until Stop is called.
+func (s *Server) Serve(lis net.Listener) error {
+	log.Printf("starting gRPC gateway on %s", lis.Addr())
+	return s.grpcServer.Serve(lis)
+}
+
+// ListenAndServe serves the gateway on addr until Stop is called.
+func (s *Server) ListenAndServe(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(lis)
+}
+
+func (s *Server) Stop() {
+	s.grpcServer.Stop()
+}
+
+type compIDKey struct{}
+
+func compIDFrom(ctx context.Context) string {
+	compID, _ := ctx.Value(compIDKey{}).(string)
+	return compID
+}
+
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := md.Get(APIKeyMetadata)
+	if len(keys) != 1 {
+		return nil, status.Errorf(codes.Unauthenticated, "missing %s", APIKeyMetadata)
+	}
+	compID, ok := s.keys.CompID(keys[0])
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid %s", APIKeyMetadata)
+	}
+	return context.WithValue(ctx, compIDKey{}, compID), nil
+}
+
+func (s *Server) unaryAuth(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *Server) streamAuth(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, authenticatedStream{ServerStream: ss, ctx: ctx})
+}
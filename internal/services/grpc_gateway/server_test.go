@@ -0,0 +1,143 @@
+package grpc_gateway
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"stock_exchange/api/exchangepb"
+	"stock_exchange/internal/services/api_keys"
+	"stock_exchange/internal/services/order_gateway"
+	"testing"
+	"time"
+)
+
+type testClients struct {
+	server *InProcessServer
+	orders exchangepb.OrderEntryClient
+	market exchangepb.MarketDataClient
+}
+
+func startTestServer(t *testing.T) testClients {
+	keys := api_keys.APIKeys{
+		{CompID: "CLIENT1", KeySHA256: api_keys.HashAPIKey("key-1")},
+		{CompID: "CLIENT2", KeySHA256: api_keys.HashAPIKey("key-2")},
+	}
+	server := StartInProcess(order_gateway.NewApplication(), keys)
+	t.Cleanup(server.Stop)
+	conn, err := server.Dial()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return testClients{server: server, orders: exchangepb.NewOrderEntryClient(conn), market: exchangepb.NewMarketDataClient(conn)}
+}
+
+func withKey(key string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	return metadata.AppendToOutgoingContext(ctx, APIKeyMetadata, key), cancel
+}
+
+func limit(clOrdID string, side exchangepb.Side, px, qty string) *exchangepb.NewOrderRequest {
+	return &exchangepb.NewOrderRequest{ClientOrderId: clOrdID, Symbol: "VALE3", Side: side,
+		Type: exchangepb.OrderType_ORDER_TYPE_LIMIT, Price: px, Quantity: qty}
+}
+
+func TestServer_Unauthenticated(t *testing.T) {
+	clients := startTestServer(t)
+	ctx, cancel := withKey("wrong")
+	defer cancel()
+	_, err := clients.orders.OrderStatus(ctx, &exchangepb.OrderStatusRequest{ClientOrderId: "x"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServer_OrderEntry(t *testing.T) {
+	clients := startTestServer(t)
+	ctx1, cancel1 := withKey("key-1")
+	defer cancel1()
+	ctx2, cancel2 := withKey("key-2")
+	defer cancel2()
+
+	reports, err := clients.orders.StreamExecutionReports(ctx1, &exchangepb.StreamExecutionReportsRequest{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		hub := clients.server.streams
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return len(hub.executions["CLIENT1"]) == 1
+	}, time.Second, time.Millisecond)
+
+	resp, err := clients.orders.NewOrder(ctx1, limit("s1", exchangepb.Side_SIDE_SELL, "10.5", "100"))
+	require.NoError(t, err)
+	require.Equal(t, exchangepb.OrderStatus_ORDER_STATUS_OPEN, resp.GetOrder().GetStatus())
+	require.NotEmpty(t, resp.GetOrder().GetOrderId())
+
+	_, err = clients.orders.NewOrder(ctx1, limit("s1", exchangepb.Side_SIDE_SELL, "10.5", "100"))
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	resp, err = clients.orders.NewOrder(ctx2, limit("b1", exchangepb.Side_SIDE_BUY, "11", "30"))
+	require.NoError(t, err)
+	require.Equal(t, exchangepb.OrderStatus_ORDER_STATUS_FILLED, resp.GetOrder().GetStatus())
+	require.Equal(t, "10.5", resp.GetOrder().GetAvgPrice())
+
+	resp, err = clients.orders.ReplaceOrder(ctx1, &exchangepb.ReplaceOrderRequest{OrigClientOrderId: "s1", ClientOrderId: "s2", Price: "10.5", Quantity: "80"})
+	require.NoError(t, err)
+	require.Equal(t, "s2", resp.GetOrder().GetClientOrderId())
+	require.Equal(t, "50", resp.GetOrder().GetLeavesQuantity())
+
+	resp, err = clients.orders.OrderStatus(ctx1, &exchangepb.OrderStatusRequest{ClientOrderId: "s2"})
+	require.NoError(t, err)
+	require.Equal(t, "30", resp.GetOrder().GetExecutedQuantity())
+	_, err = clients.orders.OrderStatus(ctx2, &exchangepb.OrderStatusRequest{ClientOrderId: "s2"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	resp, err = clients.orders.CancelOrder(ctx1, &exchangepb.CancelOrderRequest{ClientOrderId: "s2"})
+	require.NoError(t, err)
+	require.Equal(t, exchangepb.OrderStatus_ORDER_STATUS_CANCELED, resp.GetOrder().GetStatus())
+	_, err = clients.orders.CancelOrder(ctx1, &exchangepb.CancelOrderRequest{ClientOrderId: "s2"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	want := []exchangepb.ExecType{
+		exchangepb.ExecType_EXEC_TYPE_NEW,
+		exchangepb.ExecType_EXEC_TYPE_REJECTED,
+		exchangepb.ExecType_EXEC_TYPE_TRADE,
+		exchangepb.ExecType_EXEC_TYPE_REPLACED,
+		exchangepb.ExecType_EXEC_TYPE_CANCELED,
+	}
+	for _, execType := range want {
+		report, err := reports.Recv()
+		require.NoError(t, err)
+		require.Equal(t, execType, report.GetExecType())
+	}
+}
+
+func TestServer_MarketData(t *testing.T) {
+	clients := startTestServer(t)
+	ctx, cancel := withKey("key-1")
+	defer cancel()
+	_, err := clients.orders.NewOrder(ctx, limit("s1", exchangepb.Side_SIDE_SELL, "10", "100"))
+	require.NoError(t, err)
+
+	stream, err := clients.market.StreamMarketData(ctx, &exchangepb.MarketDataRequest{Symbol: "VALE3", Depth: 1})
+	require.NoError(t, err)
+	update, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), update.GetBook().GetSeq())
+	require.Len(t, update.GetBook().GetAsks(), 1)
+
+	// a level outside the requested depth does not produce an update
+	_, err = clients.orders.NewOrder(ctx, limit("s2", exchangepb.Side_SIDE_SELL, "11", "100"))
+	require.NoError(t, err)
+	_, err = clients.orders.NewOrder(ctx, limit("b1", exchangepb.Side_SIDE_BUY, "10", "40"))
+	require.NoError(t, err)
+
+	// the book is published as of the end of the match, then the trade
+	update, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), update.GetBook().GetSeq())
+	require.Equal(t, "60", update.GetBook().GetAsks()[0].GetQuantity())
+	require.Empty(t, update.GetBook().GetBids())
+	update, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "40", update.GetTrade().GetQuantity())
+	require.Equal(t, exchangepb.Side_SIDE_BUY, update.GetTrade().GetAggressorSide())
+}
@@ -0,0 +1,226 @@
+package grpc_gateway
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"stock_exchange/api/exchangepb"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"sync"
+	"time"
+)
+
+const streamBufferSize = 1024
+
+// subscriber is one server stream. Messages are queued without blocking the matching
+// path; a client too slow to drain its queue has the stream ended with ResourceExhausted,
+// so it never silently misses an execution report.
+type subscriber struct {
+	key     string
+	depth   int
+	seq     uint64
+	bids    []domain.PriceLevel
+	asks    []domain.PriceLevel
+	updates chan any
+	once    sync.Once
+	dropped chan struct{}
+}
+
+func newSubscriber(key string) *subscriber {
+	return &subscriber{key: key, updates: make(chan any, streamBufferSize), dropped: make(chan struct{})}
+}
+
+func (s *subscriber) enqueue(msg any) {
+	select {
+	case s.updates <- msg:
+	default:
+		s.once.Do(func() { close(s.dropped) })
+	}
+}
+
+// forward sends queued messages until the client goes away or falls behind.
+func (s *subscriber) forward(ctx context.Context, send func(msg any) error) error {
+	for {
+		select {
+		case msg := <-s.updates:
+			err := send(msg)
+			if err != nil {
+				return err
+			}
+		case <-s.dropped:
+			return status.Error(codes.ResourceExhausted, "stream fell behind, resubscribe")
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// streamHub fans engine events out to execution report and market data streams. The depth
+// of every book is kept from its book events, so publishing never walks a book.
+type streamHub struct {
+	mu         sync.Mutex
+	app        *order_gateway.Application
+	depths     map[string]*domain.DepthTracker
+	executions map[string]map[*subscriber]bool
+	books      map[string]map[*subscriber]bool
+	// changed is the best position of a level changed by the operation in progress, by symbol
+	changed map[string]int
+}
+
+func newStreamHub(app *order_gateway.Application) *streamHub {
+	return &streamHub{
+		app:        app,
+		depths:     make(map[string]*domain.DepthTracker),
+		executions: make(map[string]map[*subscriber]bool),
+		books:      make(map[string]map[*subscriber]bool),
+		changed:    make(map[string]int),
+	}
+}
+
+// reset takes the depth of the books from the books themselves, it runs with the matching path idle.
+func (h *streamHub) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, book := range h.app.OrderBooks() {
+		h.tracker(book.Symbol()).Reset(book.L3())
+	}
+}
+
+func (h *streamHub) tracker(symbol string) *domain.DepthTracker {
+	tracker, ok := h.depths[symbol]
+	if !ok {
+		tracker = domain.NewDepthTracker(symbol)
+		h.depths[symbol] = tracker
+	}
+	return tracker
+}
+
+func add(subs map[string]map[*subscriber]bool, sub *subscriber) {
+	if subs[sub.key] == nil {
+		subs[sub.key] = make(map[*subscriber]bool)
+	}
+	subs[sub.key][sub] = true
+}
+
+func remove(subs map[string]map[*subscriber]bool, sub *subscriber) {
+	delete(subs[sub.key], sub)
+	if len(subs[sub.key]) == 0 {
+		delete(subs, sub.key)
+	}
+}
+
+func (h *streamHub) subscribeExecutions(compID string) *subscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub := newSubscriber(compID)
+	add(h.executions, sub)
+	return sub
+}
+
+func (h *streamHub) unsubscribeExecutions(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	remove(h.executions, sub)
+}
+
+// subscribeBook registers a market data stream and queues the current book as its first update.
+func (h *streamHub) subscribeBook(symbol string, depth int) *subscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub := newSubscriber(symbol)
+	sub.depth = depth
+	add(h.books, sub)
+	h.sendBook(sub, h.tracker(symbol).Depth(depth), true)
+	return sub
+}
+
+func (h *streamHub) unsubscribeBook(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	remove(h.books, sub)
+}
+
+func sameLevels(x, y []domain.PriceLevel) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if !x[i].Price.Equal(y[i].Price) || !x[i].Quantity.Equal(y[i].Quantity) || x[i].Orders != y[i].Orders {
+			return false
+		}
+	}
+	return true
+}
+
+// sendBook queues depth for sub unless it is what sub last received.
+func (h *streamHub) sendBook(sub *subscriber, depth domain.Depth, force bool) {
+	if !force && sameLevels(sub.bids, depth.Bids) && sameLevels(sub.asks, depth.Asks) {
+		return
+	}
+	sub.seq++
+	sub.bids, sub.asks = depth.Bids, depth.Asks
+	sub.enqueue(&exchangepb.MarketDataUpdate{
+		Symbol: sub.key,
+		Update: &exchangepb.MarketDataUpdate_Book{Book: &exchangepb.BookUpdate{
+			Seq:  sub.seq,
+			Bids: toPriceLevels(depth.Bids),
+			Asks: toPriceLevels(depth.Asks),
+		}},
+	})
+}
+
+// OnOrderEvent implements order_gateway.OrderEventListener.
+func (h *streamHub) OnOrderEvent(event order_gateway.ExecReportRequiredEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.executions[event.Order.SenderCompID] {
+		sub.enqueue(toExecutionReport(event))
+	}
+	subs := h.books[event.Order.Symbol]
+	if len(subs) == 0 {
+		return
+	}
+	if event.Type == order_gateway.OrderEventTrade && event.Aggressor {
+		trade := &exchangepb.MarketDataUpdate{
+			Symbol: event.Order.Symbol,
+			Update: &exchangepb.MarketDataUpdate_Trade{Trade: &exchangepb.Trade{
+				Price:         event.LastPx.String(),
+				Quantity:      event.LastQty.String(),
+				AggressorSide: toSide(event.Order.Side),
+				Time:          timestamppb.New(time.Now()),
+			}},
+		}
+		for sub := range subs {
+			sub.enqueue(trade)
+		}
+	}
+	position, ok := h.changed[event.Order.Symbol]
+	if !ok {
+		return
+	}
+	delete(h.changed, event.Order.Symbol)
+	tracker := h.tracker(event.Order.Symbol)
+	for sub := range subs {
+		// levels below the depth of a stream do not change what it sees
+		if sub.depth == 0 || position < sub.depth {
+			h.sendBook(sub, tracker.Depth(sub.depth), false)
+		}
+	}
+}
+
+// OnBookEvent implements domain.BookListener.
+func (h *streamHub) OnBookEvent(event domain.BookEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	changes := h.tracker(event.Symbol).Apply(event)
+	if len(h.books[event.Symbol]) == 0 {
+		return
+	}
+	for _, change := range changes {
+		if position, ok := h.changed[event.Symbol]; !ok || change.Position < position {
+			h.changed[event.Symbol] = change.Position
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package itch_feed
+
+import (
+	"fmt"
+	"slices"
+)
+
+// BookOrder is an order of a BookLevel.
+type BookOrder struct {
+	Reference uint64
+	Shares    uint32
+}
+
+// BookLevel is the orders resting at one price, in priority order.
+type BookLevel struct {
+	Price  int64
+	Orders []BookOrder
+}
+
+type builtOrder struct {
+	stock  string
+	side   byte
+	price  int64
+	shares uint32
+}
+
+// builtSide queues order references by price.
+type builtSide map[int64][]uint64
+
+// BookBuilder rebuilds the order-by-order books from the feed messages, applied in sequence.
+type BookBuilder struct {
+	orders map[uint64]*builtOrder
+	books  map[string]map[byte]builtSide
+}
+
+func NewBookBuilder() *BookBuilder {
+	return &BookBuilder{
+		orders: make(map[uint64]*builtOrder),
+		books:  make(map[string]map[byte]builtSide),
+	}
+}
+
+// Apply updates the books with msg; messages that do not change a book are ignored.
+func (b *BookBuilder) Apply(msg any) error {
+	switch m := msg.(type) {
+	case AddOrder:
+		if _, exists := b.orders[m.OrderReference]; exists {
+			return fmt.Errorf("order %d added twice", m.OrderReference)
+		}
+		o := &builtOrder{stock: m.Stock, side: m.Side, price: m.Price, shares: m.Shares}
+		b.orders[m.OrderReference] = o
+		b.enqueue(m.OrderReference, o)
+	case OrderExecuted:
+		return b.decrement(m.OrderReference, m.ExecutedShares)
+	case OrderCancel:
+		return b.decrement(m.OrderReference, m.CanceledShares)
+	case OrderDelete:
+		o, ok := b.orders[m.OrderReference]
+		if !ok {
+			return fmt.Errorf("unknown order %d", m.OrderReference)
+		}
+		b.remove(m.OrderReference, o)
+	case OrderReplace:
+		o, ok := b.orders[m.OrderReference]
+		if !ok {
+			return fmt.Errorf("unknown order %d", m.OrderReference)
+		}
+		b.remove(m.OrderReference, o)
+		if m.Shares > 0 {
+			o.price, o.shares = m.Price, m.Shares
+			b.orders[m.OrderReference] = o
+			b.enqueue(m.OrderReference, o)
+		}
+	}
+	return nil
+}
+
+func (b *BookBuilder) side(stock string, side byte) builtSide {
+	book, ok := b.books[stock]
+	if !ok {
+		book = map[byte]builtSide{SideBuy: {}, SideSell: {}}
+		b.books[stock] = book
+	}
+	return book[side]
+}
+
+func (b *BookBuilder) enqueue(ref uint64, o *builtOrder) {
+	levels := b.side(o.stock, o.side)
+	levels[o.price] = append(levels[o.price], ref)
+}
+
+func (b *BookBuilder) remove(ref uint64, o *builtOrder) {
+	delete(b.orders, ref)
+	levels := b.side(o.stock, o.side)
+	queue := slices.DeleteFunc(levels[o.price], func(r uint64) bool { return r == ref })
+	if len(queue) == 0 {
+		delete(levels, o.price)
+		return
+	}
+	levels[o.price] = queue
+}
+
+func (b *BookBuilder) decrement(ref uint64, shares uint32) error {
+	o, ok := b.orders[ref]
+	if !ok {
+		return fmt.Errorf("unknown order %d", ref)
+	}
+	if shares > o.shares {
+		return fmt.Errorf("order %d has %d shares, cannot take %d", ref, o.shares, shares)
+	}
+	o.shares -= shares
+	if o.shares == 0 {
+		b.remove(ref, o)
+	}
+	return nil
+}
+
+// Levels returns the levels of one side of the book of stock, from the best price.
+func (b *BookBuilder) Levels(stock string, side byte) []BookLevel {
+	levels := b.side(stock, side)
+	prices := make([]int64, 0, len(levels))
+	for price := range levels {
+		prices = append(prices, price)
+	}
+	slices.Sort(prices)
+	if side == SideBuy {
+		slices.Reverse(prices)
+	}
+	out := make([]BookLevel, 0, len(prices))
+	for _, price := range prices {
+		level := BookLevel{Price: price, Orders: make([]BookOrder, 0, len(levels[price]))}
+		for _, ref := range levels[price] {
+			level.Orders = append(level.Orders, BookOrder{Reference: ref, Shares: b.orders[ref].shares})
+		}
+		out = append(out, level)
+	}
+	return out
+}
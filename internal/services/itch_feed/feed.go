@@ -0,0 +1,417 @@
+package itch_feed
+
+import (
+	"errors"
+	"github.com/shopspring/decimal"
+	"log"
+	"net"
+	"slices"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRetransmissionWindow is how many of the last messages are kept for retransmission.
+const DefaultRetransmissionWindow = 1_000_000
+
+// Feed publishes every change of the engine books as sequenced ITCH-style messages.
+// UDP publishers send them as they happen, the retransmission server fills the gaps of
+// receivers that lost packets from the last messages kept and the snapshot server gives
+// late joiners, and receivers too far behind, the resting orders of every book together
+// with the sequence number they reflect. Each trading date is a session of its own, its
+// sequence numbers starting over from 1.
+type Feed struct {
+	app                  *order_gateway.Application
+	heartbeatInterval    time.Duration
+	retransmissionWindow int
+
+	mu sync.Mutex
+	// previous is the session ended last, kept until the next one ends for the
+	// publishers and retransmissions still behind
+	current     *feedSession
+	previous    *feedSession
+	notify      chan struct{}
+	matchNumber uint64
+	listeners   []net.Listener
+	conns       map[net.Conn]bool
+	done        chan struct{}
+	closed      bool
+}
+
+// feedSession holds the messages of a session kept for retransmission, from sequence number first on.
+type feedSession struct {
+	name     string
+	first    uint64
+	messages [][]byte
+	ended    bool
+}
+
+// next is the sequence number of the next message of the session.
+func (s *feedSession) next() uint64 {
+	return s.first + uint64(len(s.messages))
+}
+
+type Option func(*Feed)
+
+// WithSession sets the session name carried by every packet until the next trading date.
+func WithSession(session string) Option {
+	return func(f *Feed) {
+		f.current.name = session
+	}
+}
+
+// WithRetransmissionWindow sets how many of the last messages are kept for retransmission.
+func WithRetransmissionWindow(messages int) Option {
+	return func(f *Feed) {
+		f.retransmissionWindow = messages
+	}
+}
+
+// WithHeartbeatInterval sets how often an idle publisher announces the next sequence number.
+func WithHeartbeatInterval(interval time.Duration) Option {
+	return func(f *Feed) {
+		f.heartbeatInterval = interval
+	}
+}
+
+func NewFeed(app *order_gateway.Application, opts ...Option) *Feed {
+	f := &Feed{
+		app:                  app,
+		heartbeatInterval:    time.Second,
+		retransmissionWindow: DefaultRetransmissionWindow,
+		current:              &feedSession{name: time.Now().UTC().Format("0601021504"), first: 1},
+		notify:               make(chan struct{}),
+		conns:                make(map[net.Conn]bool),
+		done:                 make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	app.AddBookListener(f)
+	app.AddTradingDayListener(f)
+	return f
+}
+
+// Session is the name of the current feed session.
+func (f *Feed) Session() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.current.name
+}
+
+// LastSequence is the sequence number of the last message of the current session, 0 before the first.
+func (f *Feed) LastSequence() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.current.next() - 1
+}
+
+// OnTradingDay implements order_gateway.TradingDayListener, ending the session of the
+// closed trading date and starting one named after date.
+func (f *Feed) OnTradingDay(date string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.current.ended = true
+	f.previous = f.current
+	f.current = &feedSession{name: date, first: 1}
+	f.matchNumber = 0
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// OnBookEvent implements domain.BookListener.
+func (f *Feed) OnBookEvent(event domain.BookEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ts := timestamp()
+	order := event.Order
+	switch event.Type {
+	case domain.BookEventAdd:
+		f.append(AddOrder{Timestamp: ts, OrderReference: orderReference(order), Side: wireSide(order.Side),
+			Shares: wireShares(event.Quantity), Stock: event.Symbol, Price: wirePrice(order.Price)}.Encode())
+	case domain.BookEventMatch:
+		f.matchNumber++
+		f.append(OrderExecuted{Timestamp: ts, OrderReference: orderReference(order), ExecutedShares: wireShares(event.Quantity),
+			MatchNumber: f.matchNumber}.Encode())
+		f.append(Trade{Timestamp: ts, OrderReference: orderReference(event.Aggressor), Side: wireSide(event.Aggressor.Side),
+			Shares: wireShares(event.Quantity), Stock: event.Symbol, Price: wirePrice(event.Price), MatchNumber: f.matchNumber}.Encode())
+	case domain.BookEventReduce:
+		f.append(OrderCancel{Timestamp: ts, OrderReference: orderReference(order), CanceledShares: wireShares(event.Quantity)}.Encode())
+	case domain.BookEventDelete:
+		f.append(OrderDelete{Timestamp: ts, OrderReference: orderReference(order)}.Encode())
+	case domain.BookEventReplace:
+		f.append(OrderReplace{Timestamp: ts, OrderReference: orderReference(order), Shares: wireShares(event.Quantity),
+			Price: wirePrice(order.Price)}.Encode())
+	}
+}
+
+// append must be called with f.mu held.
+func (f *Feed) append(msg []byte) {
+	s := f.current
+	s.messages = append(s.messages, msg)
+	if drop := len(s.messages) - f.retransmissionWindow; drop > 0 {
+		clear(s.messages[:drop])
+		s.messages = s.messages[drop:]
+		s.first += uint64(drop)
+	}
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// session returns the current session, or the previous one when it is named name.
+func (f *Feed) session(name string) (*feedSession, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.current.name == name {
+		return f.current, true
+	}
+	if f.previous != nil && f.previous.name == name {
+		return f.previous, true
+	}
+	return nil, false
+}
+
+// from returns the messages of s kept from sequence number seq on, the sequence number of
+// the first one, past seq when those before it were dropped, whether s ended and a channel
+// closed when more arrive.
+func (f *Feed) from(s *feedSession, seq uint64) ([][]byte, uint64, bool, chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	seq = max(seq, s.first)
+	if seq >= s.next() {
+		return nil, seq, s.ended, f.notify
+	}
+	return slices.Clone(s.messages[seq-s.first:]), seq, s.ended, f.notify
+}
+
+// Snapshot returns an AddOrder for every resting order, books by symbol, bids then asks
+// and each level in priority order, and the sequence number of the last message they reflect.
+func (f *Feed) Snapshot() ([][]byte, uint64) {
+	var messages [][]byte
+	var seq uint64
+	f.app.Quiesce(func() {
+		seq = f.LastSequence()
+		ts := timestamp()
+		for _, book := range f.app.OrderBooks() {
+			l3 := book.L3()
+			for _, levels := range [][]domain.OrderLevel{l3.Bids, l3.Asks} {
+				for _, level := range levels {
+					for _, order := range level.Orders {
+						messages = append(messages, AddOrder{Timestamp: ts, OrderReference: orderReference(order),
+							Side: wireSide(order.Side), Shares: wireShares(order.LeavesQty), Stock: l3.Symbol,
+							Price: wirePrice(level.Price)}.Encode())
+					}
+				}
+			}
+		}
+	})
+	return messages, seq
+}
+
+// PublishTo sends the feed to a UDP address, unicast or multicast, until Close is called.
+func (f *Feed) PublishTo(addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	log.Printf("publishing ITCH feed to %s", addr)
+	return f.Publish(conn)
+}
+
+// Publish writes every message of the current session from the first kept on to conn,
+// one packet per write, heartbeats while idle, and an end of session packet once the
+// trading date ends, going on with the session of the next one, or once Close is called.
+// Write errors are ignored as a datagram receiver recovers lost packets through
+// retransmission.
+func (f *Feed) Publish(conn net.Conn) error {
+	f.mu.Lock()
+	s := f.current
+	f.mu.Unlock()
+	next := s.first
+	heartbeat := time.NewTicker(f.heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		messages, first, ended, notify := f.from(s, next)
+		for _, p := range packets(s.name, first, messages) {
+			_, _ = conn.Write(p.Encode())
+		}
+		next = first + uint64(len(messages))
+		if len(messages) > 0 {
+			heartbeat.Reset(f.heartbeatInterval)
+			continue
+		}
+		if ended {
+			_, _ = conn.Write(Packet{Session: s.name, SequenceNumber: next, EndOfSession: true}.Encode())
+			f.mu.Lock()
+			s = f.current
+			f.mu.Unlock()
+			next = s.first
+			continue
+		}
+		select {
+		case <-notify:
+		case <-heartbeat.C:
+			_, _ = conn.Write(Packet{Session: s.name, SequenceNumber: next}.Encode())
+		case <-f.done:
+			_, _ = conn.Write(Packet{Session: s.name, SequenceNumber: next, EndOfSession: true}.Encode())
+			return nil
+		}
+	}
+}
+
+// ListenAndServeRetransmissions serves gap fill requests over TCP on addr until Close is called.
+func (f *Feed) ListenAndServeRetransmissions(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return f.ServeRetransmissions(lis)
+}
+
+// ServeRetransmissions answers every RetransmissionRequest of the current or the previous
+// session with the packets holding the messages asked for, at most maxRequestCount of
+// them, or with a heartbeat when they do not exist yet or are no longer kept.
+func (f *Feed) ServeRetransmissions(lis net.Listener) error {
+	log.Printf("serving ITCH retransmissions on %s", lis.Addr())
+	return f.serve(lis, func(conn net.Conn) {
+		for {
+			frame, err := readFrame(conn)
+			if err != nil {
+				return
+			}
+			req, err := decodeRetransmissionRequest(frame)
+			if err != nil || req.SequenceNumber == 0 {
+				return
+			}
+			s, ok := f.session(req.Session)
+			if !ok {
+				return
+			}
+			count := min(uint64(req.Count), maxRequestCount)
+			messages, first, _, _ := f.from(s, req.SequenceNumber)
+			if first != req.SequenceNumber {
+				messages = nil
+			}
+			messages = messages[:min(uint64(len(messages)), count)]
+			responses := packets(s.name, req.SequenceNumber, messages)
+			if len(responses) == 0 {
+				responses = []Packet{{Session: s.name, SequenceNumber: req.SequenceNumber}}
+			}
+			for _, p := range responses {
+				if writeFrame(conn, p.Encode()) != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+// ListenAndServeSnapshots serves book snapshots over TCP on addr until Close is called.
+func (f *Feed) ListenAndServeSnapshots(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return f.ServeSnapshots(lis)
+}
+
+// ServeSnapshots writes every connecting client the current Snapshot, ended by a
+// SnapshotComplete, and closes the connection.
+func (f *Feed) ServeSnapshots(lis net.Listener) error {
+	log.Printf("serving ITCH snapshots on %s", lis.Addr())
+	return f.serve(lis, func(conn net.Conn) {
+		messages, seq := f.Snapshot()
+		for _, msg := range append(messages, SnapshotComplete{SequenceNumber: seq}.Encode()) {
+			if writeFrame(conn, msg) != nil {
+				return
+			}
+		}
+	})
+}
+
+func (f *Feed) serve(lis net.Listener, handle func(conn net.Conn)) error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		_ = lis.Close()
+		return nil
+	}
+	f.listeners = append(f.listeners, lis)
+	f.mu.Unlock()
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			f.mu.Lock()
+			closed := f.closed
+			f.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		f.mu.Lock()
+		f.conns[conn] = true
+		f.mu.Unlock()
+		go func() {
+			defer func() {
+				f.mu.Lock()
+				delete(f.conns, conn)
+				f.mu.Unlock()
+				_ = conn.Close()
+			}()
+			handle(conn)
+		}()
+	}
+}
+
+// Close ends the session of every publisher and stops the TCP servers.
+func (f *Feed) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	close(f.done)
+	for conn := range f.conns {
+		_ = conn.Close()
+	}
+	var err error
+	for _, lis := range f.listeners {
+		err = errors.Join(err, lis.Close())
+	}
+	return err
+}
+
+func timestamp() uint64 {
+	return uint64(time.Now().UnixNano())
+}
+
+func orderReference(order domain.OrderView) uint64 {
+	// OrderIDs of the engine are decimal numbers
+	ref, _ := strconv.ParseUint(order.OrderID, 10, 64)
+	return ref
+}
+
+func wireSide(side domain.OrderSide) byte {
+	if side == domain.BUY {
+		return SideBuy
+	}
+	return SideSell
+}
+
+func wireShares(quantity decimal.Decimal) uint32 {
+	return uint32(quantity.IntPart())
+}
+
+// wirePrice truncates prices finer than PriceDecimals, which instruments should not allow.
+func wirePrice(price decimal.Decimal) int64 {
+	return price.Shift(PriceDecimals).IntPart()
+}
@@ -0,0 +1,321 @@
+package itch_feed
+
+import (
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"math/rand/v2"
+	"net"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const receiveTimeout = 2 * time.Second
+
+type testFeed struct {
+	app          *order_gateway.Application
+	feed         *Feed
+	udp          *net.UDPConn
+	retransmit   string
+	snapshotAddr string
+}
+
+// droppingConn loses every nth packet with messages written to it, never heartbeats.
+type droppingConn struct {
+	net.Conn
+	mu     sync.Mutex
+	n      int
+	writes int
+}
+
+func (c *droppingConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(b) == packetHeaderLen {
+		return c.Conn.Write(b)
+	}
+	c.writes++
+	if c.writes%c.n == 0 {
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+func startTestFeed(t *testing.T, dropEvery int, opts ...Option) testFeed {
+	app := order_gateway.NewApplication()
+	feed := NewFeed(app, append([]Option{WithSession("TEST"), WithHeartbeatInterval(20 * time.Millisecond)}, opts...)...)
+	t.Cleanup(func() { _ = feed.Close() })
+
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = udp.Close() })
+	require.NoError(t, udp.SetReadBuffer(1<<20))
+	var conn net.Conn
+	conn, err = net.DialUDP("udp", nil, udp.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	if dropEvery > 0 {
+		conn = &droppingConn{Conn: conn, n: dropEvery}
+	}
+	go func() {
+		_ = feed.Publish(conn)
+	}()
+
+	retransmit, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = feed.ServeRetransmissions(retransmit)
+	}()
+	snapshots, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = feed.ServeSnapshots(snapshots)
+	}()
+	return testFeed{app: app, feed: feed, udp: udp, retransmit: retransmit.Addr().String(), snapshotAddr: snapshots.Addr().String()}
+}
+
+func (f testFeed) receiver(t *testing.T) *Receiver {
+	r := NewReceiver(f.udp, f.retransmit)
+	t.Cleanup(func() { _ = r.Close() })
+	return r
+}
+
+// drain applies every message published so far.
+func (f testFeed) drain(t *testing.T, r *Receiver, builder *BookBuilder) []any {
+	var messages []any
+	for r.NextSequence() <= f.feed.LastSequence() {
+		seq, msg, err := r.Next(receiveTimeout)
+		require.NoError(t, err)
+		require.NoError(t, builder.Apply(msg), "message %d", seq)
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func requireBuilderMatchesEngine(t *testing.T, app *order_gateway.Application, builder *BookBuilder) {
+	for _, book := range app.OrderBooks() {
+		l3 := book.L3()
+		for side, levels := range map[byte][]domain.OrderLevel{SideBuy: l3.Bids, SideSell: l3.Asks} {
+			want := make([]BookLevel, 0, len(levels))
+			for _, level := range levels {
+				wire := BookLevel{Price: wirePrice(level.Price)}
+				for _, order := range level.Orders {
+					wire.Orders = append(wire.Orders, BookOrder{Reference: orderReference(order), Shares: wireShares(order.LeavesQty)})
+				}
+				want = append(want, wire)
+			}
+			require.Equal(t, want, builder.Levels(l3.Symbol, side), "%s side %c", l3.Symbol, side)
+		}
+	}
+}
+
+func submit(t *testing.T, app *order_gateway.Application, clOrdID, symbol string, side domain.OrderSide, ordType enum.OrdType, px string, qty int64) {
+	_, err := app.Submit(app.NewOrder(clOrdID, symbol, "CLIENT1", "ORDERGATEWAY", side, ordType,
+		decimal.RequireFromString(px), decimal.NewFromInt(qty)))
+	require.NoError(t, err)
+}
+
+// randomFlow sends n random orders, cancels and replaces around a mid price.
+func randomFlow(app *order_gateway.Application, rng *rand.Rand, prefix string, n int) {
+	symbols := []string{"VALE3", "PETR4"}
+	for i := 0; i < n; i++ {
+		open := app.OpenOrders("")
+		clOrdID := fmt.Sprintf("%s%d", prefix, i)
+		price := decimal.New(990+rng.Int64N(21), -2)
+		quantity := decimal.NewFromInt(1 + rng.Int64N(100))
+		switch op := rng.IntN(10); {
+		case op < 2 && len(open) > 0:
+			o := open[rng.IntN(len(open))]
+			_, _ = app.Cancel(o.SenderCompID, o.ClOrdID)
+		case op < 4 && len(open) > 0:
+			o := open[rng.IntN(len(open))]
+			if rng.IntN(2) == 0 {
+				// keep the price and reduce, which keeps priority
+				price = o.Price
+				quantity = o.ExecutedQuantity.Add(decimal.NewFromInt(1 + rng.Int64N(o.LeavesQty.IntPart())))
+			} else {
+				quantity = o.ExecutedQuantity.Add(quantity)
+			}
+			_, _ = app.Replace(o.SenderCompID, o.ClOrdID, clOrdID, price, quantity)
+		default:
+			side := domain.BUY
+			if rng.IntN(2) == 0 {
+				side = domain.SELL
+			}
+			ordType := enum.OrdType_LIMIT
+			if rng.IntN(10) == 0 {
+				ordType = enum.OrdType_MARKET
+			}
+			sender := fmt.Sprintf("CLIENT%d", rng.IntN(3))
+			_, _ = app.Submit(app.NewOrder(clOrdID, symbols[rng.IntN(len(symbols))], sender, "ORDERGATEWAY", side, ordType, price, quantity))
+		}
+	}
+}
+
+func TestMessages_RoundTrip(t *testing.T) {
+	messages := []interface{ Encode() []byte }{
+		AddOrder{Timestamp: 1, OrderReference: 7, Side: SideBuy, Shares: 100, Stock: "VALE3", Price: 465200},
+		OrderExecuted{Timestamp: 2, OrderReference: 7, ExecutedShares: 40, MatchNumber: 3},
+		OrderCancel{Timestamp: 3, OrderReference: 7, CanceledShares: 10},
+		OrderDelete{Timestamp: 4, OrderReference: 7},
+		OrderReplace{Timestamp: 5, OrderReference: 7, Shares: 20, Price: 465100},
+		Trade{Timestamp: 6, OrderReference: 8, Side: SideSell, Shares: 40, Stock: "PETR4", Price: 1, MatchNumber: 3},
+		SnapshotComplete{SequenceNumber: 9},
+	}
+	encoded := make([][]byte, 0, len(messages))
+	for _, msg := range messages {
+		decoded, err := DecodeMessage(msg.Encode())
+		require.NoError(t, err)
+		require.Equal(t, msg, decoded)
+		encoded = append(encoded, msg.Encode())
+	}
+	_, err := DecodeMessage(append(OrderDelete{}.Encode(), 0))
+	require.Error(t, err)
+
+	packet := Packet{Session: "S1", SequenceNumber: 42, Messages: encoded}
+	decoded, err := DecodePacket(packet.Encode())
+	require.NoError(t, err)
+	require.Equal(t, packet, decoded)
+	_, err = DecodePacket(packet.Encode()[:30])
+	require.Error(t, err)
+}
+
+func TestFeed_OrderLifecycleMessages(t *testing.T) {
+	f := startTestFeed(t, 0)
+	r := f.receiver(t)
+	builder := NewBookBuilder()
+
+	submit(t, f.app, "s1", "VALE3", domain.SELL, enum.OrdType_LIMIT, "10.00", 100)
+	submit(t, f.app, "s2", "VALE3", domain.SELL, enum.OrdType_LIMIT, "10.00", 50)
+	submit(t, f.app, "b1", "VALE3", domain.BUY, enum.OrdType_LIMIT, "10.00", 30)
+	_, err := f.app.Replace("CLIENT1", "s1", "s1a", decimal.RequireFromString("10.00"), decimal.NewFromInt(80))
+	require.NoError(t, err)
+	_, err = f.app.Replace("CLIENT1", "s2", "s2a", decimal.RequireFromString("10.05"), decimal.NewFromInt(60))
+	require.NoError(t, err)
+	_, err = f.app.Cancel("CLIENT1", "s1a")
+	require.NoError(t, err)
+
+	messages := f.drain(t, r, builder)
+	kinds := make([]byte, 0, len(messages))
+	for _, msg := range messages {
+		kinds = append(kinds, msg.(interface{ Encode() []byte }).Encode()[0])
+	}
+	require.Equal(t, "AAEPXUD", string(kinds))
+	executed := messages[2].(OrderExecuted)
+	trade := messages[3].(Trade)
+	require.Equal(t, uint32(30), executed.ExecutedShares)
+	require.Equal(t, executed.MatchNumber, trade.MatchNumber)
+	require.Equal(t, SideBuy, trade.Side)
+	require.Equal(t, int64(100000), trade.Price)
+	require.Equal(t, uint32(20), messages[4].(OrderCancel).CanceledShares)
+	s2, ok := f.app.LookupOrder("CLIENT1", "s2a")
+	require.True(t, ok)
+	ref, err := strconv.ParseUint(s2.OrderID, 10, 64)
+	require.NoError(t, err)
+	require.Equal(t, OrderReplace{Timestamp: messages[5].(OrderReplace).Timestamp, OrderReference: ref, Shares: 60, Price: 100500}, messages[5])
+	requireBuilderMatchesEngine(t, f.app, builder)
+	require.Equal(t, []BookLevel{{Price: 100500, Orders: []BookOrder{{Reference: ref, Shares: 60}}}}, builder.Levels("VALE3", SideSell))
+}
+
+func TestFeed_BookBuilderMatchesEngine(t *testing.T) {
+	for _, dropEvery := range []int{0, 3} {
+		t.Run(fmt.Sprintf("drop every %d", dropEvery), func(t *testing.T) {
+			f := startTestFeed(t, dropEvery)
+			r := f.receiver(t)
+			builder := NewBookBuilder()
+			rng := rand.New(rand.NewPCG(34, uint64(dropEvery)))
+			for round := 0; round < 5; round++ {
+				randomFlow(f.app, rng, fmt.Sprintf("r%d-", round), 200)
+				f.drain(t, r, builder)
+				requireBuilderMatchesEngine(t, f.app, builder)
+			}
+		})
+	}
+}
+
+func TestFeed_SnapshotThenLive(t *testing.T) {
+	f := startTestFeed(t, 0)
+	rng := rand.New(rand.NewPCG(7, 7))
+	randomFlow(f.app, rng, "a", 300)
+
+	// a late joiner: the live packets it has buffered overlap the snapshot
+	r := f.receiver(t)
+	snapshot, err := RequestSnapshot(f.snapshotAddr, receiveTimeout)
+	require.NoError(t, err)
+	require.Equal(t, f.feed.LastSequence(), snapshot.SequenceNumber)
+	builder := NewBookBuilder()
+	for _, msg := range snapshot.Messages {
+		require.NoError(t, builder.Apply(msg))
+	}
+	requireBuilderMatchesEngine(t, f.app, builder)
+	r.SetNextSequence(snapshot.SequenceNumber + 1)
+
+	randomFlow(f.app, rng, "b", 300)
+	f.drain(t, r, builder)
+	requireBuilderMatchesEngine(t, f.app, builder)
+}
+
+func TestFeed_HeartbeatsRevealTailLoss(t *testing.T) {
+	// every packet is lost, only heartbeats and retransmissions reach the receiver
+	f := startTestFeed(t, 1)
+	r := f.receiver(t)
+	submit(t, f.app, "b1", "VALE3", domain.BUY, enum.OrdType_LIMIT, "10.00", 10)
+	seq, msg, err := r.Next(receiveTimeout)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), seq)
+	require.Equal(t, uint32(10), msg.(AddOrder).Shares)
+
+	require.NoError(t, f.feed.Close())
+	_, _, err = r.Next(receiveTimeout)
+	require.ErrorIs(t, err, ErrEndOfSession)
+}
+
+func TestFeed_RetransmissionWindow(t *testing.T) {
+	f := startTestFeed(t, 1, WithRetransmissionWindow(2))
+	r := f.receiver(t)
+	for _, clOrdID := range []string{"b1", "b2", "b3"} {
+		submit(t, f.app, clOrdID, "VALE3", domain.BUY, enum.OrdType_LIMIT, "10.00", 10)
+	}
+	_, _, err := r.Next(receiveTimeout)
+	require.ErrorContains(t, err, "messages from 1 are not available")
+
+	r.SetNextSequence(2)
+	for seq := uint64(2); seq <= 3; seq++ {
+		got, msg, err := r.Next(receiveTimeout)
+		require.NoError(t, err)
+		require.Equal(t, seq, got)
+		require.IsType(t, AddOrder{}, msg)
+	}
+}
+
+func TestFeed_SessionPerTradingDate(t *testing.T) {
+	f := startTestFeed(t, 0)
+	r := f.receiver(t)
+	submit(t, f.app, "b1", "VALE3", domain.BUY, enum.OrdType_LIMIT, "10.00", 10)
+	_, msg, err := r.Next(receiveTimeout)
+	require.NoError(t, err)
+	require.IsType(t, AddOrder{}, msg)
+
+	result, err := f.app.EndOfDay()
+	require.NoError(t, err)
+	seq, msg, err := r.Next(receiveTimeout)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), seq)
+	require.IsType(t, OrderDelete{}, msg, "the DAY order expires in the session of its date")
+	_, _, err = r.Next(receiveTimeout)
+	require.ErrorIs(t, err, ErrEndOfSession)
+
+	require.Equal(t, result.NextTradingDate, f.feed.Session())
+	require.Zero(t, f.feed.LastSequence())
+	r = f.receiver(t)
+	submit(t, f.app, "b2", "VALE3", domain.BUY, enum.OrdType_LIMIT, "10.00", 10)
+	seq, msg, err = r.Next(receiveTimeout)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), seq)
+	require.IsType(t, AddOrder{}, msg)
+}
@@ -0,0 +1,243 @@
+package itch_feed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"strings"
+)
+
+// ITCH-style market data messages, one per change of a book. Fields are fixed length:
+// integers big endian, alphas space padded, prices signed integers with PriceDecimals
+// implied decimals. An order keeps its OrderReference, the engine OrderID, for its whole
+// life in the book.
+const (
+	MessageAddOrder         byte = 'A'
+	MessageOrderExecuted    byte = 'E'
+	MessageOrderCancel      byte = 'X'
+	MessageOrderDelete      byte = 'D'
+	MessageOrderReplace     byte = 'U'
+	MessageTrade            byte = 'P'
+	MessageSnapshotComplete byte = 'G'
+
+	SideBuy  byte = 'B'
+	SideSell byte = 'S'
+
+	PriceDecimals = 4
+
+	stockLen = 8
+
+	addOrderLen         = 1 + 8 + 8 + 1 + 4 + stockLen + 8
+	orderExecutedLen    = 1 + 8 + 8 + 4 + 8
+	orderCancelLen      = 1 + 8 + 8 + 4
+	orderDeleteLen      = 1 + 8 + 8
+	orderReplaceLen     = 1 + 8 + 8 + 4 + 8
+	tradeLen            = 1 + 8 + 8 + 1 + 4 + stockLen + 8 + 8
+	snapshotCompleteLen = 1 + 8
+)
+
+// PriceToWire scales a price to the wire representation, failing when it has more than PriceDecimals decimals.
+func PriceToWire(price decimal.Decimal) (int64, error) {
+	scaled := price.Shift(PriceDecimals)
+	if !scaled.IsInteger() {
+		return 0, fmt.Errorf("price %s has more than %d decimals", price, PriceDecimals)
+	}
+	return scaled.IntPart(), nil
+}
+
+func PriceFromWire(price int64) decimal.Decimal {
+	return decimal.New(price, -PriceDecimals)
+}
+
+// AddOrder is an order coming to rest at the back of its price level.
+type AddOrder struct {
+	Timestamp      uint64
+	OrderReference uint64
+	Side           byte
+	Shares         uint32
+	Stock          string
+	Price          int64
+}
+
+// OrderExecuted is a resting order executed at its own price.
+type OrderExecuted struct {
+	Timestamp      uint64
+	OrderReference uint64
+	ExecutedShares uint32
+	MatchNumber    uint64
+}
+
+// OrderCancel is part of a resting order canceled; the order keeps its priority.
+type OrderCancel struct {
+	Timestamp      uint64
+	OrderReference uint64
+	CanceledShares uint32
+}
+
+// OrderDelete is a resting order canceled in full.
+type OrderDelete struct {
+	Timestamp      uint64
+	OrderReference uint64
+}
+
+// OrderReplace moves an order to the back of the queue at Price with Shares left,
+// removing it when Shares is 0. It follows the executions of the order re-entering.
+type OrderReplace struct {
+	Timestamp      uint64
+	OrderReference uint64
+	Shares         uint32
+	Price          int64
+}
+
+// Trade is the aggressor side of a match; the resting side is the OrderExecuted of
+// the same MatchNumber right before it. It does not change the book.
+type Trade struct {
+	Timestamp      uint64
+	OrderReference uint64
+	Side           byte
+	Shares         uint32
+	Stock          string
+	Price          int64
+	MatchNumber    uint64
+}
+
+// SnapshotComplete ends a snapshot, which reflects every message up to SequenceNumber.
+type SnapshotComplete struct {
+	SequenceNumber uint64
+}
+
+// encoder appends fixed length fields to a message buffer.
+type encoder []byte
+
+func (e encoder) byte(b byte) encoder           { return append(e, b) }
+func (e encoder) alpha(s string, n int) encoder { return append(e, alpha(s, n)...) }
+func (e encoder) uint32(v uint32) encoder       { return binary.BigEndian.AppendUint32(e, v) }
+func (e encoder) uint64(v uint64) encoder       { return binary.BigEndian.AppendUint64(e, v) }
+func (e encoder) int64(v int64) encoder         { return binary.BigEndian.AppendUint64(e, uint64(v)) }
+
+// decoder reads fixed length fields from a message whose length was already checked.
+type decoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *decoder) byte() byte {
+	d.pos++
+	return d.b[d.pos-1]
+}
+
+func (d *decoder) alpha(n int) string {
+	d.pos += n
+	return strings.TrimRight(string(d.b[d.pos-n:d.pos]), " ")
+}
+
+func (d *decoder) uint32() uint32 {
+	d.pos += 4
+	return binary.BigEndian.Uint32(d.b[d.pos-4 : d.pos])
+}
+
+func (d *decoder) uint64() uint64 {
+	d.pos += 8
+	return binary.BigEndian.Uint64(d.b[d.pos-8 : d.pos])
+}
+
+func (d *decoder) int64() int64 {
+	return int64(d.uint64())
+}
+
+// alpha left justifies s in a space padded field of n bytes.
+func alpha(s string, n int) []byte {
+	field := []byte(strings.Repeat(" ", n))
+	copy(field, s)
+	return field
+}
+
+func (m AddOrder) Encode() []byte {
+	return encoder(make([]byte, 0, addOrderLen)).byte(MessageAddOrder).uint64(m.Timestamp).uint64(m.OrderReference).
+		byte(m.Side).uint32(m.Shares).alpha(m.Stock, stockLen).int64(m.Price)
+}
+
+func (m OrderExecuted) Encode() []byte {
+	return encoder(make([]byte, 0, orderExecutedLen)).byte(MessageOrderExecuted).uint64(m.Timestamp).
+		uint64(m.OrderReference).uint32(m.ExecutedShares).uint64(m.MatchNumber)
+}
+
+func (m OrderCancel) Encode() []byte {
+	return encoder(make([]byte, 0, orderCancelLen)).byte(MessageOrderCancel).uint64(m.Timestamp).
+		uint64(m.OrderReference).uint32(m.CanceledShares)
+}
+
+func (m OrderDelete) Encode() []byte {
+	return encoder(make([]byte, 0, orderDeleteLen)).byte(MessageOrderDelete).uint64(m.Timestamp).uint64(m.OrderReference)
+}
+
+func (m OrderReplace) Encode() []byte {
+	return encoder(make([]byte, 0, orderReplaceLen)).byte(MessageOrderReplace).uint64(m.Timestamp).
+		uint64(m.OrderReference).uint32(m.Shares).int64(m.Price)
+}
+
+func (m Trade) Encode() []byte {
+	return encoder(make([]byte, 0, tradeLen)).byte(MessageTrade).uint64(m.Timestamp).uint64(m.OrderReference).
+		byte(m.Side).uint32(m.Shares).alpha(m.Stock, stockLen).int64(m.Price).uint64(m.MatchNumber)
+}
+
+func (m SnapshotComplete) Encode() []byte {
+	return encoder(make([]byte, 0, snapshotCompleteLen)).byte(MessageSnapshotComplete).uint64(m.SequenceNumber)
+}
+
+func checkLen(b []byte, want int) error {
+	if len(b) != want {
+		return fmt.Errorf("message %q of %d bytes, want %d", b[0], len(b), want)
+	}
+	return nil
+}
+
+// DecodeMessage decodes a feed message into one of the message types of the package.
+func DecodeMessage(b []byte) (any, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty message")
+	}
+	d := &decoder{b: b, pos: 1}
+	switch b[0] {
+	case MessageAddOrder:
+		if err := checkLen(b, addOrderLen); err != nil {
+			return nil, err
+		}
+		return AddOrder{Timestamp: d.uint64(), OrderReference: d.uint64(), Side: d.byte(), Shares: d.uint32(),
+			Stock: d.alpha(stockLen), Price: d.int64()}, nil
+	case MessageOrderExecuted:
+		if err := checkLen(b, orderExecutedLen); err != nil {
+			return nil, err
+		}
+		return OrderExecuted{Timestamp: d.uint64(), OrderReference: d.uint64(), ExecutedShares: d.uint32(),
+			MatchNumber: d.uint64()}, nil
+	case MessageOrderCancel:
+		if err := checkLen(b, orderCancelLen); err != nil {
+			return nil, err
+		}
+		return OrderCancel{Timestamp: d.uint64(), OrderReference: d.uint64(), CanceledShares: d.uint32()}, nil
+	case MessageOrderDelete:
+		if err := checkLen(b, orderDeleteLen); err != nil {
+			return nil, err
+		}
+		return OrderDelete{Timestamp: d.uint64(), OrderReference: d.uint64()}, nil
+	case MessageOrderReplace:
+		if err := checkLen(b, orderReplaceLen); err != nil {
+			return nil, err
+		}
+		return OrderReplace{Timestamp: d.uint64(), OrderReference: d.uint64(), Shares: d.uint32(), Price: d.int64()}, nil
+	case MessageTrade:
+		if err := checkLen(b, tradeLen); err != nil {
+			return nil, err
+		}
+		return Trade{Timestamp: d.uint64(), OrderReference: d.uint64(), Side: d.byte(), Shares: d.uint32(),
+			Stock: d.alpha(stockLen), Price: d.int64(), MatchNumber: d.uint64()}, nil
+	case MessageSnapshotComplete:
+		if err := checkLen(b, snapshotCompleteLen); err != nil {
+			return nil, err
+		}
+		return SnapshotComplete{SequenceNumber: d.uint64()}, nil
+	default:
+		return nil, fmt.Errorf("unknown message type %q", b[0])
+	}
+}
@@ -0,0 +1,138 @@
+package itch_feed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MoldUDP64-like transport: a packet is a session (10 alpha), the sequence number of its
+// first message (uint64) and a message count (uint16), followed by every message as a
+// uint16 length and its bytes. A packet without messages is a heartbeat announcing the
+// next sequence number. Over TCP, retransmission requests and responses and snapshot
+// messages are framed with a uint16 length.
+const (
+	sessionLen       = 10
+	packetHeaderLen  = sessionLen + 8 + 2
+	requestLen       = sessionLen + 8 + 2
+	maxPacket        = 1400
+	maxRequestCount  = 1000
+	endOfSessionMark = 0xFFFF
+)
+
+// Packet is a decoded MoldUDP64-like packet.
+type Packet struct {
+	Session        string
+	SequenceNumber uint64
+	Messages       [][]byte
+	EndOfSession   bool
+}
+
+func (p Packet) Encode() []byte {
+	size := packetHeaderLen
+	for _, msg := range p.Messages {
+		size += 2 + len(msg)
+	}
+	count := uint16(len(p.Messages))
+	if p.EndOfSession {
+		count = endOfSessionMark
+	}
+	b := encoder(make([]byte, 0, size)).alpha(p.Session, sessionLen).uint64(p.SequenceNumber)
+	b = binary.BigEndian.AppendUint16(b, count)
+	for _, msg := range p.Messages {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(msg)))
+		b = append(b, msg...)
+	}
+	return b
+}
+
+func DecodePacket(b []byte) (Packet, error) {
+	if len(b) < packetHeaderLen {
+		return Packet{}, fmt.Errorf("packet of %d bytes", len(b))
+	}
+	d := &decoder{b: b}
+	p := Packet{Session: d.alpha(sessionLen), SequenceNumber: d.uint64()}
+	count := binary.BigEndian.Uint16(b[d.pos:])
+	d.pos += 2
+	if count == endOfSessionMark {
+		p.EndOfSession = true
+		return p, nil
+	}
+	p.Messages = make([][]byte, 0, count)
+	for i := 0; i < int(count); i++ {
+		if len(b) < d.pos+2 {
+			return Packet{}, fmt.Errorf("packet truncated at message %d", i)
+		}
+		length := int(binary.BigEndian.Uint16(b[d.pos:]))
+		d.pos += 2
+		if len(b) < d.pos+length {
+			return Packet{}, fmt.Errorf("packet truncated at message %d", i)
+		}
+		p.Messages = append(p.Messages, b[d.pos:d.pos+length])
+		d.pos += length
+	}
+	return p, nil
+}
+
+// RetransmissionRequest asks for Count messages from SequenceNumber on.
+type RetransmissionRequest struct {
+	Session        string
+	SequenceNumber uint64
+	Count          uint16
+}
+
+func (r RetransmissionRequest) Encode() []byte {
+	b := encoder(make([]byte, 0, requestLen)).alpha(r.Session, sessionLen).uint64(r.SequenceNumber)
+	return binary.BigEndian.AppendUint16(b, r.Count)
+}
+
+func decodeRetransmissionRequest(b []byte) (RetransmissionRequest, error) {
+	if len(b) != requestLen {
+		return RetransmissionRequest{}, fmt.Errorf("retransmission request of %d bytes", len(b))
+	}
+	d := &decoder{b: b}
+	return RetransmissionRequest{Session: d.alpha(sessionLen), SequenceNumber: d.uint64(),
+		Count: binary.BigEndian.Uint16(b[d.pos:])}, nil
+}
+
+func writeFrame(w io.Writer, payload []byte) error {
+	buf := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(payload)), uint16(len(payload)))
+	_, err := w.Write(append(buf, payload...))
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [2]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[:]))
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// packets splits consecutive messages, the first of them numbered seq, into packets of at most maxPacket bytes.
+func packets(session string, seq uint64, messages [][]byte) []Packet {
+	out := make([]Packet, 0, 1)
+	current := Packet{Session: strings.TrimSpace(session), SequenceNumber: seq}
+	size := packetHeaderLen
+	for _, msg := range messages {
+		if len(current.Messages) > 0 && size+2+len(msg) > maxPacket {
+			out = append(out, current)
+			current = Packet{Session: current.Session, SequenceNumber: seq}
+			size = packetHeaderLen
+		}
+		current.Messages = append(current.Messages, msg)
+		size += 2 + len(msg)
+		seq++
+	}
+	if len(current.Messages) > 0 {
+		out = append(out, current)
+	}
+	return out
+}
@@ -0,0 +1,195 @@
+package itch_feed
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ErrEndOfSession is returned by Receiver.Next once the publisher ended the session
+// and every message before the end was delivered.
+var ErrEndOfSession = errors.New("end of session")
+
+// Receiver is the reference decoder of the feed: it reads packets from a datagram
+// connection and hands out messages strictly in sequence, filling gaps through the
+// retransmission server and dropping duplicates.
+type Receiver struct {
+	conn           net.Conn
+	retransmitAddr string
+	retransmitConn net.Conn
+	session        string
+	next           uint64
+	pending        map[uint64][]byte
+	endOfSession   uint64
+	buf            []byte
+}
+
+// NewReceiver reads packets from conn, expecting sequence number 1 first.
+func NewReceiver(conn net.Conn, retransmitAddr string) *Receiver {
+	return &Receiver{
+		conn:           conn,
+		retransmitAddr: retransmitAddr,
+		next:           1,
+		pending:        make(map[uint64][]byte),
+		buf:            make([]byte, 1<<16),
+	}
+}
+
+// SetNextSequence skips every message before seq, typically after applying a snapshot.
+func (r *Receiver) SetNextSequence(seq uint64) {
+	for s := range r.pending {
+		if s < seq {
+			delete(r.pending, s)
+		}
+	}
+	r.next = seq
+}
+
+// NextSequence is the sequence number of the message Next returns next.
+func (r *Receiver) NextSequence() uint64 {
+	return r.next
+}
+
+// Next returns the next message in sequence and its number.
+func (r *Receiver) Next(timeout time.Duration) (uint64, any, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if msg, ok := r.pending[r.next]; ok {
+			delete(r.pending, r.next)
+			r.next++
+			decoded, err := DecodeMessage(msg)
+			return r.next - 1, decoded, err
+		}
+		if r.endOfSession != 0 && r.next >= r.endOfSession {
+			return 0, nil, ErrEndOfSession
+		}
+		err := r.conn.SetReadDeadline(deadline)
+		if err != nil {
+			return 0, nil, err
+		}
+		n, err := r.conn.Read(r.buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		p, err := DecodePacket(r.buf[:n])
+		if err != nil {
+			return 0, nil, err
+		}
+		if r.session == "" {
+			r.session = p.Session
+		} else if p.Session != r.session {
+			continue
+		}
+		r.store(p)
+		if p.EndOfSession {
+			r.endOfSession = p.SequenceNumber
+		}
+		if p.SequenceNumber > r.next {
+			err = r.fill(r.next, p.SequenceNumber, deadline)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+}
+
+func (r *Receiver) store(p Packet) {
+	for i, msg := range p.Messages {
+		seq := p.SequenceNumber + uint64(i)
+		if seq >= r.next {
+			// the packet buffer is reused by the next read
+			r.pending[seq] = append([]byte(nil), msg...)
+		}
+	}
+}
+
+// fill requests the messages from seq up to, excluding, end that are not pending yet.
+func (r *Receiver) fill(seq, end uint64, deadline time.Time) error {
+	for seq < end {
+		if _, ok := r.pending[seq]; ok {
+			seq++
+			continue
+		}
+		if r.retransmitConn == nil {
+			conn, err := net.DialTimeout("tcp", r.retransmitAddr, time.Until(deadline))
+			if err != nil {
+				return err
+			}
+			r.retransmitConn = conn
+		}
+		err := r.retransmitConn.SetDeadline(deadline)
+		if err != nil {
+			return err
+		}
+		count := min(end-seq, maxRequestCount)
+		err = writeFrame(r.retransmitConn, RetransmissionRequest{Session: r.session, SequenceNumber: seq, Count: uint16(count)}.Encode())
+		if err != nil {
+			return err
+		}
+		for received := uint64(0); received < count; {
+			frame, err := readFrame(r.retransmitConn)
+			if err != nil {
+				return err
+			}
+			p, err := DecodePacket(frame)
+			if err != nil {
+				return err
+			}
+			if len(p.Messages) == 0 {
+				return fmt.Errorf("messages from %d are not available for retransmission", seq+received)
+			}
+			r.store(p)
+			received += uint64(len(p.Messages))
+		}
+		seq += count
+	}
+	return nil
+}
+
+// Close closes the retransmission connection; the datagram connection belongs to the caller.
+func (r *Receiver) Close() error {
+	if r.retransmitConn == nil {
+		return nil
+	}
+	return r.retransmitConn.Close()
+}
+
+// Snapshot is the content of the books as of SequenceNumber.
+type Snapshot struct {
+	SequenceNumber uint64
+	Messages       []any
+}
+
+// RequestSnapshot reads a snapshot from the snapshot server at addr.
+func RequestSnapshot(addr string, timeout time.Duration) (Snapshot, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var snapshot Snapshot
+	for {
+		frame, err := readFrame(conn)
+		if errors.Is(err, io.EOF) {
+			return Snapshot{}, fmt.Errorf("snapshot ended without SnapshotComplete")
+		}
+		if err != nil {
+			return Snapshot{}, err
+		}
+		msg, err := DecodeMessage(frame)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		if complete, ok := msg.(SnapshotComplete); ok {
+			snapshot.SequenceNumber = complete.SequenceNumber
+			return snapshot, nil
+		}
+		snapshot.Messages = append(snapshot.Messages, msg)
+	}
+}
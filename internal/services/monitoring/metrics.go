@@ -0,0 +1,152 @@
+package monitoring
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"time"
+)
+
+// Metrics are the Prometheus metrics of the engine. Counters and histograms are fed
+// by the engine as events happen, book and session gauges are read on every scrape.
+type Metrics struct {
+	registry        *prometheus.Registry
+	ordersReceived  *prometheus.CounterVec
+	ordersRejected  *prometheus.CounterVec
+	ordersMatched   *prometheus.CounterVec
+	reportLatency   *prometheus.HistogramVec
+	reportRetries   *prometheus.CounterVec
+	backlogAlerts   *prometheus.CounterVec
+	backlogDepth    *prometheus.Desc
+	backlogAge      *prometheus.Desc
+	bookQuantity    *prometheus.Desc
+	bookOrders      *prometheus.Desc
+	bookLevels      *prometheus.Desc
+	sessionLoggedOn *prometheus.Desc
+	app             *order_gateway.Application
+}
+
+// NewMetrics registers the metrics of app, along with the Go runtime and process ones.
+func NewMetrics(app *order_gateway.Application) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		ordersReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "exchange_orders_received_total",
+			Help: "New orders received, by symbol and sending CompID.",
+		}, []string{"symbol", "session"}),
+		ordersRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "exchange_orders_rejected_total",
+			Help: "New orders rejected, by symbol and sending CompID.",
+		}, []string{"symbol", "session"}),
+		ordersMatched: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "exchange_orders_matched_total",
+			Help: "Executions of orders, aggressive or resting, by symbol and owning CompID.",
+		}, []string{"symbol", "session"}),
+		reportLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "exchange_execution_report_latency_seconds",
+			Help:    "Time from reading a FIX message to sending each execution report it caused, by receiving CompID.",
+			Buckets: prometheus.ExponentialBuckets(0.00005, 2, 16),
+		}, []string{"session"}),
+		reportRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "exchange_execution_report_retries_total",
+			Help: "Execution report sends retried, by receiving CompID.",
+		}, []string{"session"}),
+		backlogAlerts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "exchange_outbound_backlog_alerts_total",
+			Help: "Times the execution reports waiting for a CompID reached the alert threshold.",
+		}, []string{"session"}),
+		backlogDepth: prometheus.NewDesc("exchange_outbound_backlog",
+			"Execution reports waiting to be sent to the FIX session.", []string{"session"}, nil),
+		backlogAge: prometheus.NewDesc("exchange_outbound_backlog_oldest_age_seconds",
+			"Age of the oldest execution report waiting for the FIX session, 0 without backlog.", []string{"session"}, nil),
+		bookQuantity: prometheus.NewDesc("exchange_book_depth_quantity",
+			"Quantity resting in the book.", []string{"symbol", "side"}, nil),
+		bookOrders: prometheus.NewDesc("exchange_book_depth_orders",
+			"Orders resting in the book.", []string{"symbol", "side"}, nil),
+		bookLevels: prometheus.NewDesc("exchange_book_depth_levels",
+			"Price levels in the book.", []string{"symbol", "side"}, nil),
+		sessionLoggedOn: prometheus.NewDesc("exchange_fix_session_logged_on",
+			"Whether the FIX session is logged on.", []string{"session", "version"}, nil),
+		app: app,
+	}
+	m.registry.MustRegister(m.ordersReceived, m.ordersRejected, m.ordersMatched, m.reportLatency, m.reportRetries,
+		m.backlogAlerts, engineCollector{m}, collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	app.AddListener(m)
+	app.AddDeliveryObserver(m)
+	return m
+}
+
+// OnOrderEvent runs under the engine lock and only updates counters.
+func (m *Metrics) OnOrderEvent(event order_gateway.ExecReportRequiredEvent) {
+	labels := prometheus.Labels{"symbol": event.Order.Symbol, "session": event.Order.SenderCompID}
+	switch event.Type {
+	case order_gateway.OrderEventNew:
+		m.ordersReceived.With(labels).Inc()
+	case order_gateway.OrderEventRejected:
+		m.ordersReceived.With(labels).Inc()
+		m.ordersRejected.With(labels).Inc()
+	case order_gateway.OrderEventTrade:
+		m.ordersMatched.With(labels).Inc()
+	}
+}
+
+func (m *Metrics) ExecutionReportSent(compID string, latency time.Duration) {
+	m.reportLatency.WithLabelValues(compID).Observe(latency.Seconds())
+}
+
+func (m *Metrics) ExecutionReportRetried(compID string) {
+	m.reportRetries.WithLabelValues(compID).Inc()
+}
+
+func (m *Metrics) BacklogAlert(compID string, _ int) {
+	m.backlogAlerts.WithLabelValues(compID).Inc()
+}
+
+// engineCollector reads the books and FIX sessions when scraped.
+type engineCollector struct {
+	m *Metrics
+}
+
+func (c engineCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.m.bookQuantity
+	ch <- c.m.bookOrders
+	ch <- c.m.bookLevels
+	ch <- c.m.sessionLoggedOn
+	ch <- c.m.backlogDepth
+	ch <- c.m.backlogAge
+}
+
+func (c engineCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, book := range c.m.app.OrderBooks() {
+		depth := book.Depth(0)
+		for _, side := range []struct {
+			name   string
+			levels []domain.PriceLevel
+		}{{"bid", depth.Bids}, {"ask", depth.Asks}} {
+			quantity, orders := 0.0, 0
+			for _, level := range side.levels {
+				quantity += level.Quantity.InexactFloat64()
+				orders += level.Orders
+			}
+			ch <- prometheus.MustNewConstMetric(c.m.bookQuantity, prometheus.GaugeValue, quantity, depth.Symbol, side.name)
+			ch <- prometheus.MustNewConstMetric(c.m.bookOrders, prometheus.GaugeValue, float64(orders), depth.Symbol, side.name)
+			ch <- prometheus.MustNewConstMetric(c.m.bookLevels, prometheus.GaugeValue, float64(len(side.levels)), depth.Symbol, side.name)
+		}
+	}
+	for _, session := range c.m.app.FIXSessions() {
+		loggedOn := 0.0
+		if session.LoggedOn {
+			loggedOn = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.m.sessionLoggedOn, prometheus.GaugeValue, loggedOn, session.CompID, session.BeginString)
+	}
+	for _, backlog := range c.m.app.OutboundBacklog() {
+		age := 0.0
+		if !backlog.Oldest.IsZero() {
+			age = time.Since(backlog.Oldest).Seconds()
+		}
+		ch <- prometheus.MustNewConstMetric(c.m.backlogDepth, prometheus.GaugeValue, float64(backlog.Depth), backlog.CompID)
+		ch <- prometheus.MustNewConstMetric(c.m.backlogAge, prometheus.GaugeValue, age, backlog.CompID)
+	}
+}
@@ -0,0 +1,84 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"slices"
+	"stock_exchange/internal/services/order_gateway"
+	"sync"
+	"sync/atomic"
+)
+
+// Server serves /metrics, the liveness probe /healthz and the readiness probe /readyz.
+// It is not ready until SetReady is called, once the state of the engine is recovered
+// and its gateways accept orders, and stops being ready when a check fails, such as
+// the state it recovered from no longer being persisted.
+type Server struct {
+	metrics *Metrics
+	ready   atomic.Bool
+	mux     *http.ServeMux
+
+	mu     sync.Mutex
+	checks []readinessCheck
+}
+
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+func NewServer(app *order_gateway.Application) *Server {
+	s := &Server{metrics: NewMetrics(app), mux: http.NewServeMux()}
+	s.mux.Handle("GET /metrics", promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{}))
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+	s.mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready.Load() {
+			http.Error(w, "recovering", http.StatusServiceUnavailable)
+			return
+		}
+		if err := s.check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "ready")
+	})
+	return s
+}
+
+// SetReady marks the recovery of the engine as complete.
+func (s *Server) SetReady() {
+	s.ready.Store(true)
+}
+
+// AddCheck makes readiness depend on check returning nil.
+func (s *Server) AddCheck(name string, check func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, readinessCheck{name: name, check: check})
+}
+
+// check runs every check and joins the failures.
+func (s *Server) check() error {
+	s.mu.Lock()
+	checks := slices.Clone(s.checks)
+	s.mu.Unlock()
+	var err error
+	for _, c := range checks {
+		if checkErr := c.check(); checkErr != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %w", c.name, checkErr))
+		}
+	}
+	return err
+}
+
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s.mux)
+}
@@ -0,0 +1,93 @@
+package monitoring
+
+import (
+	"errors"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, server *httptest.Server, path string) (int, string) {
+	resp, err := http.Get(server.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestServer_Probes(t *testing.T) {
+	s := NewServer(order_gateway.NewApplication())
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	status, _ := get(t, server, "/healthz")
+	require.Equal(t, http.StatusOK, status)
+	status, body := get(t, server, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Contains(t, body, "recovering")
+
+	var journalErr error
+	s.AddCheck("journal", func() error { return journalErr })
+	s.SetReady()
+	status, _ = get(t, server, "/readyz")
+	require.Equal(t, http.StatusOK, status)
+
+	journalErr = errors.New("disk full")
+	status, body = get(t, server, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Contains(t, body, "journal: disk full")
+}
+
+func TestServer_Metrics(t *testing.T) {
+	app := order_gateway.NewApplication()
+	s := NewServer(app)
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	orders := []struct {
+		sender, clOrdID string
+		side            domain.OrderSide
+		price, qty      int64
+	}{
+		{"A", "s1", domain.SELL, 11, 100},
+		{"A", "s2", domain.SELL, 12, 50},
+		{"A", "s2", domain.SELL, 12, 50},
+		{"B", "b1", domain.BUY, 11, 40},
+	}
+	for _, o := range orders {
+		_, _ = app.Submit(app.NewOrder(o.clOrdID, "VALE3", o.sender, "EX", o.side, enum.OrdType_LIMIT,
+			decimal.NewFromInt(o.price), decimal.NewFromInt(o.qty)))
+	}
+	s.metrics.ExecutionReportSent("B", 3*time.Millisecond)
+	s.metrics.ExecutionReportRetried("B")
+	s.metrics.BacklogAlert("B", 1000)
+
+	status, body := get(t, server, "/metrics")
+	require.Equal(t, http.StatusOK, status)
+	for _, want := range []string{
+		`exchange_orders_received_total{session="A",symbol="VALE3"} 3`,
+		`exchange_orders_received_total{session="B",symbol="VALE3"} 1`,
+		`exchange_orders_rejected_total{session="A",symbol="VALE3"} 1`,
+		`exchange_orders_matched_total{session="A",symbol="VALE3"} 1`,
+		`exchange_orders_matched_total{session="B",symbol="VALE3"} 1`,
+		`exchange_book_depth_quantity{side="ask",symbol="VALE3"} 110`,
+		`exchange_book_depth_orders{side="ask",symbol="VALE3"} 2`,
+		`exchange_book_depth_levels{side="bid",symbol="VALE3"} 0`,
+		`exchange_execution_report_latency_seconds_bucket{session="B",le="0.0032"} 1`,
+		`exchange_execution_report_latency_seconds_count{session="B"} 1`,
+		`exchange_execution_report_retries_total{session="B"} 1`,
+		`exchange_outbound_backlog_alerts_total{session="B"} 1`,
+		`go_goroutines`,
+	} {
+		require.True(t, strings.Contains(body, want), "%s not in\n%s", want, body)
+	}
+}
@@ -0,0 +1,202 @@
+package order_gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"os"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+)
+
+var ErrAccountLimit = errors.New("account limit exceeded")
+
+// orderCapacities names the OrderCapacity (528) values in account configurations.
+var orderCapacities = map[string]enum.OrderCapacity{
+	"agency":                 enum.OrderCapacity_AGENCY,
+	"proprietary":            enum.OrderCapacity_PROPRIETARY,
+	"individual":             enum.OrderCapacity_INDIVIDUAL,
+	"principal":              enum.OrderCapacity_PRINCIPAL,
+	"riskless_principal":     enum.OrderCapacity_RISKLESS_PRINCIPAL,
+	"agent_for_other_member": enum.OrderCapacity_AGENT_FOR_OTHER_MEMBER,
+}
+
+// AccountConfig holds the limits of an account, whichever session trades on it. Zero
+// limits and empty lists restrict nothing.
+type AccountConfig struct {
+	Account          string          `json:"account"`
+	MaxOrderQty      decimal.Decimal `json:"max_order_qty"`
+	MaxOrderNotional decimal.Decimal `json:"max_order_notional"`
+	// MaxPosition bounds the net position in each symbol, long or short, counting what
+	// the open orders of the account would add to it
+	MaxPosition decimal.Decimal `json:"max_position"`
+	// OrderCapacities the account may trade in, by name
+	OrderCapacities []string `json:"order_capacities"`
+	// SubAccounts are the accounts its fills may be allocated to
+	SubAccounts []string `json:"sub_accounts"`
+}
+
+// Accounts maps accounts to their configuration.
+type Accounts map[string]AccountConfig
+
+type accountsFile struct {
+	Accounts []AccountConfig `json:"accounts"`
+}
+
+// LoadAccounts reads a JSON accounts file and validates every entry.
+func LoadAccounts(fileName string) (Accounts, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v, %v", fileName, err)
+	}
+	var f accountsFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading accounts: %s", err)
+	}
+	accounts := make(Accounts, len(f.Accounts))
+	for _, account := range f.Accounts {
+		if account.Account == "" {
+			return nil, fmt.Errorf("account without name")
+		}
+		if _, ok := accounts[account.Account]; ok {
+			return nil, fmt.Errorf("account %s is defined twice", account.Account)
+		}
+		if account.MaxOrderQty.IsNegative() || account.MaxOrderNotional.IsNegative() || account.MaxPosition.IsNegative() {
+			return nil, fmt.Errorf("account %s: negative limit", account.Account)
+		}
+		for _, capacity := range account.OrderCapacities {
+			if _, ok := orderCapacities[capacity]; !ok {
+				return nil, fmt.Errorf("account %s: unknown order capacity %q", account.Account, capacity)
+			}
+		}
+		if slices.Contains(account.SubAccounts, "") || slices.Contains(account.SubAccounts, account.Account) {
+			return nil, fmt.Errorf("account %s: sub accounts must be other, named accounts", account.Account)
+		}
+		accounts[account.Account] = account
+	}
+	return accounts, nil
+}
+
+// WithAccounts enforces the limits of accounts on the orders of every entry protocol.
+func WithAccounts(accounts Accounts) Option {
+	return func(a *Application) {
+		a.accounts = accounts
+	}
+}
+
+// capacityName is how account configurations name an OrderCapacity, "unstated" when empty.
+func capacityName(orderCapacity enum.OrderCapacity) string {
+	for name, c := range orderCapacities {
+		if c == orderCapacity {
+			return name
+		}
+	}
+	return "unstated"
+}
+
+// accountLimitError checks order, which is to have leaves working at price for quantity
+// in all, against the limits of the account its position is kept under. Market orders
+// are checked for their quantity alone. It runs under the engine lock.
+func (a *Application) accountLimitError(order *domain.Order, price, quantity, leaves decimal.Decimal) error {
+	account := positionAccount(order.Account(), order.SenderCompID())
+	limits, ok := a.accounts[account]
+	if !ok {
+		return nil
+	}
+	if capacity := capacityName(order.OrderCapacity()); len(limits.OrderCapacities) > 0 &&
+		!slices.Contains(limits.OrderCapacities, capacity) {
+		return fmt.Errorf("%w: order capacity %s on account %s", ErrNotEntitled, capacity, account)
+	}
+	if limits.MaxOrderQty.IsPositive() && quantity.GreaterThan(limits.MaxOrderQty) {
+		return fmt.Errorf("%w: quantity %s exceeds max order quantity %s of account %s", ErrAccountLimit, quantity,
+			limits.MaxOrderQty, account)
+	}
+	notional := price.Mul(quantity)
+	if limits.MaxOrderNotional.IsPositive() && order.OrdType() != enum.OrdType_MARKET &&
+		notional.GreaterThan(limits.MaxOrderNotional) {
+		return fmt.Errorf("%w: notional %s exceeds max order notional %s of account %s", ErrAccountLimit, notional,
+			limits.MaxOrderNotional, account)
+	}
+	if !limits.MaxPosition.IsPositive() {
+		return nil
+	}
+	exposure := a.exposure(account, order).Add(leaves)
+	if exposure.GreaterThan(limits.MaxPosition) {
+		return fmt.Errorf("%w: position of %s in %s could reach %s, over the max position %s", ErrAccountLimit, account,
+			order.Symbol(), exposure, limits.MaxPosition)
+	}
+	return nil
+}
+
+// exposure is how far account is positioned in the symbol and direction of order, its
+// net position plus the open orders on that side, order itself left out.
+func (a *Application) exposure(account string, order *domain.Order) decimal.Decimal {
+	exposure := a.exposures.working(account, order)
+	if p, ok := a.positions[positionKey{account: account, symbol: order.Symbol()}]; ok {
+		if order.Side() == domain.SELL {
+			return exposure.Sub(p.Quantity)
+		}
+		return exposure.Add(p.Quantity)
+	}
+	return exposure
+}
+
+// exposureKey is a side of a symbol traded on an account.
+type exposureKey struct {
+	account string
+	symbol  string
+	side    domain.OrderSide
+}
+
+// exposures keeps the leaves of the open orders on every account, symbol and side as
+// order events are published, so that limit checks do not go through every order.
+// Its methods run under the engine lock.
+type exposures struct {
+	totals map[exposureKey]decimal.Decimal
+	// open are the open orders counted in totals, and the leaves counted for each
+	open map[string]exposureOrder
+}
+
+type exposureOrder struct {
+	key    exposureKey
+	leaves decimal.Decimal
+}
+
+func newExposures() *exposures {
+	return &exposures{totals: make(map[exposureKey]decimal.Decimal), open: make(map[string]exposureOrder)}
+}
+
+// OnOrderEvent counts the leaves of the order as the event leaves it.
+func (e *exposures) OnOrderEvent(event ExecReportRequiredEvent) {
+	e.update(event.Order)
+}
+
+// update counts the leaves of order, nothing once it is no longer open.
+func (e *exposures) update(order domain.OrderView) {
+	if counted, ok := e.open[order.OrderID]; ok {
+		e.totals[counted.key] = e.totals[counted.key].Sub(counted.leaves)
+		if e.totals[counted.key].IsZero() {
+			delete(e.totals, counted.key)
+		}
+		delete(e.open, order.OrderID)
+	}
+	if order.Status != domain.OrderStatusOpen || !order.LeavesQty.IsPositive() {
+		return
+	}
+	key := exposureKey{account: positionAccount(order.Account, order.SenderCompID), symbol: order.Symbol, side: order.Side}
+	e.totals[key] = e.totals[key].Add(order.LeavesQty)
+	e.open[order.OrderID] = exposureOrder{key: key, leaves: order.LeavesQty}
+}
+
+// working is the leaves of the open orders of account on the symbol and side of order,
+// order itself left out.
+func (e *exposures) working(account string, order *domain.Order) decimal.Decimal {
+	working := e.totals[exposureKey{account: account, symbol: order.Symbol(), side: order.Side()}]
+	if counted, ok := e.open[order.OrderID()]; ok {
+		working = working.Sub(counted.leaves)
+	}
+	return working
+}
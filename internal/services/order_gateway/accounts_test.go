@@ -0,0 +1,203 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix44nos "github.com/quickfixgo/fix44/newordersingle"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+	"time"
+)
+
+func TestLoadAccounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"valid", `{"accounts":[{"account":"BLOCK1","max_order_qty":"1000","max_order_notional":"50000","max_position":"5000",
+			"order_capacities":["agency","riskless_principal"],"sub_accounts":["FUND1","FUND2"]}]}`, ""},
+		{"no name", `{"accounts":[{"max_order_qty":"10"}]}`, "account without name"},
+		{"duplicate", `{"accounts":[{"account":"BLOCK1"},{"account":"BLOCK1"}]}`, "defined twice"},
+		{"negative limit", `{"accounts":[{"account":"BLOCK1","max_position":"-1"}]}`, "negative limit"},
+		{"bad capacity", `{"accounts":[{"account":"BLOCK1","order_capacities":["broker"]}]}`, "unknown order capacity"},
+		{"own sub account", `{"accounts":[{"account":"BLOCK1","sub_accounts":["BLOCK1"]}]}`, "sub accounts must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "accounts.json")
+			require.NoError(t, os.WriteFile(fileName, []byte(tt.content), 0o600))
+			accounts, err := LoadAccounts(fileName)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "5000", accounts["BLOCK1"].MaxPosition.String())
+			require.Equal(t, []string{"FUND1", "FUND2"}, accounts["BLOCK1"].SubAccounts)
+		})
+	}
+}
+
+func TestApplication_AccountLimits(t *testing.T) {
+	app := NewApplication(WithAccounts(Accounts{
+		"ACC1": {Account: "ACC1", MaxOrderQty: decimal.NewFromInt(100), MaxOrderNotional: decimal.NewFromInt(1500),
+			MaxPosition: decimal.NewFromInt(150)},
+		// orders without an account are limited under their CompID
+		"C": {Account: "C", OrderCapacities: []string{"agency"}},
+	}))
+	submit := func(clOrdID, sender, account string, side domain.OrderSide, ordType enum.OrdType, price, qty int64,
+		capacity enum.OrderCapacity) error {
+		order := app.NewOrder(clOrdID, "VALE3", sender, "EX", side, ordType, decimal.NewFromInt(price), decimal.NewFromInt(qty))
+		order.SetAccount(account)
+		order.SetParties(capacity, nil)
+		_, err := app.Submit(order)
+		return err
+	}
+	tests := []struct {
+		name     string
+		clOrdID  string
+		sender   string
+		account  string
+		side     domain.OrderSide
+		ordType  enum.OrdType
+		price    int64
+		qty      int64
+		capacity enum.OrderCapacity
+		err      string
+	}{
+		{"within limits", "b1", "A", "ACC1", domain.BUY, enum.OrdType_LIMIT, 10, 100, "", ""},
+		{"quantity", "b2", "A", "ACC1", domain.BUY, enum.OrdType_LIMIT, 1, 101, "", "max order quantity 100 of account ACC1"},
+		{"notional", "b3", "A", "ACC1", domain.BUY, enum.OrdType_LIMIT, 16, 100, "", "notional 1600 exceeds"},
+		{"market orders have no notional", "m1", "B", "", domain.SELL, enum.OrdType_MARKET, 0, 100, "", ""},
+		// 100 bought and 60 more working would be 160 long
+		{"position", "b4", "A", "ACC1", domain.BUY, enum.OrdType_LIMIT, 9, 60, "", "could reach 160"},
+		{"position other session", "b5", "D", "ACC1", domain.BUY, enum.OrdType_LIMIT, 9, 50, "", ""},
+		{"position full", "b6", "A", "ACC1", domain.BUY, enum.OrdType_LIMIT, 9, 1, "", "could reach 151"},
+		{"selling reduces", "s1", "A", "ACC1", domain.SELL, enum.OrdType_LIMIT, 15, 100, "", ""},
+		{"capacity", "c1", "C", "", domain.BUY, enum.OrdType_LIMIT, 5, 10, enum.OrderCapacity_PRINCIPAL, "order capacity principal"},
+		{"unstated capacity", "c2", "C", "", domain.BUY, enum.OrdType_LIMIT, 5, 10, "", "order capacity unstated"},
+		{"allowed capacity", "c3", "C", "", domain.BUY, enum.OrdType_LIMIT, 5, 10, enum.OrderCapacity_AGENCY, ""},
+		{"unlimited account", "u1", "A", "ACC2", domain.BUY, enum.OrdType_LIMIT, 9, 1000, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := submit(tt.clOrdID, tt.sender, tt.account, tt.side, tt.ordType, tt.price, tt.qty, tt.capacity)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				view, ok := app.LookupOrder(tt.sender, tt.clOrdID)
+				require.True(t, ok)
+				require.EqualValues(t, domain.OrderStatusRejected, view.Status)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	// a replace is checked for what it leaves working
+	_, err := app.Replace("D", "b5", "b5-2", decimal.NewFromInt(9), decimal.NewFromInt(51))
+	require.ErrorIs(t, err, ErrAccountLimit)
+	_, err = app.Replace("D", "b5", "b5-2", decimal.NewFromInt(9), decimal.NewFromInt(40))
+	require.NoError(t, err)
+	// a canceled order no longer counts
+	_, err = app.Cancel("D", "b5-2")
+	require.NoError(t, err)
+	require.NoError(t, submit("b7", "A", "ACC1", domain.BUY, enum.OrdType_LIMIT, 9, 50, ""))
+	require.ErrorContains(t, submit("b8", "A", "ACC1", domain.BUY, enum.OrdType_LIMIT, 9, 1, ""), "could reach 151")
+}
+
+func TestPartiesOf(t *testing.T) {
+	newOrder := func() *quickfix.Message {
+		return fix44nos.New(field.NewClOrdID("N1"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()),
+			field.NewOrdType(enum.OrdType_LIMIT)).ToMessage()
+	}
+	msg := newOrder()
+	capacity, parties, err := partiesOf(msg)
+	require.Nil(t, err)
+	require.Empty(t, capacity)
+	require.Empty(t, parties)
+
+	msg.Body.Set(field.NewOrderCapacity(enum.OrderCapacity_RISKLESS_PRINCIPAL))
+	group := partiesGroup()
+	entry := group.Add()
+	entry.Set(field.NewPartyID("TRADER1"))
+	entry.Set(field.NewPartyIDSource(enum.PartyIDSource_PROPRIETARY))
+	entry.Set(field.NewPartyRole(enum.PartyRole_ENTERING_TRADER))
+	entry = group.Add()
+	entry.Set(field.NewPartyID("CLIENT9"))
+	entry.Set(field.NewPartyRole(enum.PartyRole_CLIENT_ID))
+	msg.Body.SetGroup(group)
+	capacity, parties, err = partiesOf(msg)
+	require.Nil(t, err)
+	require.Equal(t, enum.OrderCapacity_RISKLESS_PRINCIPAL, capacity)
+	require.Equal(t, []domain.Party{{ID: "TRADER1", Source: enum.PartyIDSource_PROPRIETARY, Role: enum.PartyRole_ENTERING_TRADER},
+		{ID: "CLIENT9", Role: enum.PartyRole_CLIENT_ID}}, parties)
+
+	msg = newOrder()
+	msg.Body.SetString(tag.OrderCapacity, "X")
+	_, _, err = partiesOf(msg)
+	require.ErrorContains(t, err, "Value is incorrect")
+
+	msg = newOrder()
+	group = partiesGroup()
+	group.Add().Set(field.NewPartyID("TRADER1"))
+	msg.Body.SetGroup(group)
+	_, _, err = partiesOf(msg)
+	require.ErrorContains(t, err, "Required tag missing")
+}
+
+func TestApplication_OrderParties(t *testing.T) {
+	app, counterparty, sessions := startFIX(t)
+	sell := app.NewOrder("S1", "VALE3", "CLIENT42", "ORDERGATEWAY", domain.SELL, enum.OrdType_LIMIT, decimal.NewFromInt(10),
+		decimal.NewFromInt(100))
+	_, err := app.Submit(sell)
+	require.NoError(t, err)
+	counterparty.next(t)
+
+	nos := fix44nos.New(field.NewClOrdID("B1"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()),
+		field.NewOrdType(enum.OrdType_LIMIT))
+	nos.Set(field.NewSymbol("VALE3"))
+	nos.Set(field.NewOrderQty(decimal.NewFromInt(40), 2))
+	nos.Set(field.NewPrice(decimal.NewFromInt(10), 2))
+	nos.Set(field.NewAccount("BLOCK1"))
+	nos.Set(field.NewOrderCapacity(enum.OrderCapacity_AGENCY))
+	parties := fix44nos.NewNoPartyIDsRepeatingGroup()
+	party := parties.Add()
+	party.SetPartyID("TRADER1")
+	party.SetPartyIDSource(enum.PartyIDSource_PROPRIETARY)
+	party.SetPartyRole(enum.PartyRole_ENTERING_TRADER)
+	nos.SetNoPartyIDs(parties)
+	require.NoError(t, quickfix.SendToTarget(nos, sessions["CLIENT44"]))
+
+	// the new order and its fill echo the capacity and parties, the seller's fill comes in FIX 4.2
+	reports := make(map[string][]*quickfix.Message)
+	for range 3 {
+		report := counterparty.next(t)
+		beginString, err := report.Header.GetString(tag.BeginString)
+		require.Nil(t, err)
+		reports[beginString] = append(reports[beginString], report)
+	}
+	require.Len(t, reports[quickfix.BeginStringFIX44], 2)
+	for i, execType := range []string{"0", "F"} {
+		report := reports[quickfix.BeginStringFIX44][i]
+		requireFields(t, report, map[int]string{150: execType, 1: "BLOCK1", 528: "A", 453: "1"})
+		group := partiesGroup()
+		require.Nil(t, report.Body.GetGroup(group))
+		id, err := group.Get(0).GetString(tag.PartyID)
+		require.Nil(t, err)
+		require.Equal(t, "TRADER1", id)
+	}
+
+	trades := app.Trades("VALE3")
+	require.Len(t, trades, 1)
+	require.Equal(t, TradeParty{CompID: "CLIENT44", Account: "BLOCK1", OrderCapacity: enum.OrderCapacity_AGENCY,
+		Parties: []domain.Party{{ID: "TRADER1", Source: enum.PartyIDSource_PROPRIETARY, Role: enum.PartyRole_ENTERING_TRADER}}},
+		trades[0].Buyer)
+	require.Equal(t, "CLIENT42", trades[0].Seller.CompID)
+}
@@ -0,0 +1,68 @@
+package order_gateway
+
+import (
+	"cmp"
+	"github.com/shopspring/decimal"
+	"slices"
+	"strings"
+)
+
+// FIXSession is the state of a FIX session configured in the acceptor.
+type FIXSession struct {
+	CompID      string
+	BeginString string
+	Firm        string
+	LoggedOn    bool
+}
+
+// FIXSessions lists the FIX sessions of the acceptor, sorted by CompID and BeginString.
+func (a *Application) FIXSessions() []FIXSession {
+	a.sessionsMu.RLock()
+	defer a.sessionsMu.RUnlock()
+	sessions := make([]FIXSession, 0, len(a.fixSessions))
+	for sessionID := range a.fixSessions {
+		compID := sessionID.TargetCompID
+		loggedOn := a.loggedOn[compID] == sessionID
+		sessions = append(sessions, FIXSession{
+			CompID:      compID,
+			BeginString: sessionID.BeginString,
+			Firm:        a.firm(compID),
+			LoggedOn:    loggedOn,
+		})
+	}
+	slices.SortFunc(sessions, func(x, y FIXSession) int {
+		return cmp.Or(strings.Compare(x.CompID, y.CompID), strings.Compare(x.BeginString, y.BeginString))
+	})
+	return sessions
+}
+
+// Stats are totals of the matching engine over the trading date, carried orders included.
+type Stats struct {
+	Books          int
+	Orders         int
+	OpenOrders     int
+	Trades         int
+	TradedQuantity decimal.Decimal
+	TradedNotional decimal.Decimal
+}
+
+// Stats counts the orders and trades of every entry protocol, busted trades left out.
+func (a *Application) Stats() Stats {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	stats := Stats{Books: len(a.OrderBooks()), Orders: len(a.orders), TradedQuantity: decimal.Zero, TradedNotional: decimal.Zero}
+	for _, order := range a.orders {
+		if order.IsOpen() {
+			stats.OpenOrders++
+		}
+	}
+	for _, trade := range a.trades {
+		if trade.Status == TradeBusted {
+			continue
+		}
+		stats.Trades++
+		stats.TradedQuantity = stats.TradedQuantity.Add(trade.Quantity)
+		stats.TradedNotional = stats.TradedNotional.Add(trade.Quantity.Mul(trade.Price))
+	}
+	return stats
+}
@@ -0,0 +1,326 @@
+package order_gateway
+
+import (
+	"errors"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix44ai "github.com/quickfixgo/fix44/allocationinstruction"
+	fix50sp2ai "github.com/quickfixgo/fix50sp2/allocationinstruction"
+	"github.com/quickfixgo/quickfix"
+	"github.com/shopspring/decimal"
+	"log"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"time"
+)
+
+// Fills are allocated post-trade with an AllocationInstruction (35=J), which FIX 4.3
+// introduced, so FIX 4.2 sessions cannot. The orders it lists must be done, and what
+// they executed is moved from their block account to the sub-accounts it names at
+// their average price. It is answered with an AllocationInstructionAck (35=P).
+
+var (
+	ErrDuplicateAllocID    = errors.New("duplicate AllocID")
+	ErrOrderAllocated      = errors.New("order already allocated")
+	ErrAllocationQuantity  = errors.New("allocated quantity differs from the quantity executed")
+	ErrAllocationAvgPx     = errors.New("average price differs from the one executed")
+	ErrAllocationMismatch  = errors.New("orders differ in symbol, side or account")
+	ErrAllocationOrderOpen = errors.New("order is still working")
+)
+
+// AllocationOrder is an order whose fills are allocated, by OrderID, else by ClOrdID.
+type AllocationOrder struct {
+	OrderID string
+	ClOrdID string
+}
+
+// AllocationSplit is the part of a block allocated to a sub-account.
+type AllocationSplit struct {
+	Account  string
+	Quantity decimal.Decimal
+}
+
+// AllocationRequest asks for what orders of CompID executed to be split across
+// sub-accounts. AvgPx is checked against the orders when positive.
+type AllocationRequest struct {
+	AllocID string
+	CompID  string
+	Side    domain.OrderSide
+	Orders  []AllocationOrder
+	Splits  []AllocationSplit
+	AvgPx   decimal.Decimal
+}
+
+// Allocation is an accepted allocation of the fills of a block account.
+type Allocation struct {
+	AllocID  string
+	CompID   string
+	Account  string
+	Symbol   string
+	Side     domain.OrderSide
+	OrderIDs []string
+	Quantity decimal.Decimal
+	AvgPx    decimal.Decimal
+	Splits   []AllocationSplit
+	Time     time.Time
+}
+
+// Allocate books request: the quantity its orders executed leaves their block account
+// for the sub-accounts, at the average price. Allocations last as long as the trading
+// date.
+func (a *Application) Allocate(request AllocationRequest) (Allocation, error) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	for _, allocation := range a.allocations {
+		if allocation.CompID == request.CompID && allocation.AllocID == request.AllocID {
+			return Allocation{}, ErrDuplicateAllocID
+		}
+	}
+	if len(request.Orders) == 0 || len(request.Splits) == 0 {
+		return Allocation{}, fmt.Errorf("%w: no orders or no sub-accounts", ErrAllocationQuantity)
+	}
+	allocation := Allocation{AllocID: request.AllocID, CompID: request.CompID, Side: request.Side,
+		Quantity: decimal.Zero, Splits: slices.Clone(request.Splits), Time: time.Now().UTC()}
+	notional := decimal.Zero
+	for i, ref := range request.Orders {
+		order, err := a.allocationOrder(request.CompID, ref)
+		if err != nil {
+			return Allocation{}, err
+		}
+		account := positionAccount(order.Account(), order.SenderCompID())
+		if i == 0 {
+			allocation.Account, allocation.Symbol = account, order.Symbol()
+		}
+		if order.Side() != request.Side || order.Symbol() != allocation.Symbol || account != allocation.Account {
+			return Allocation{}, fmt.Errorf("%w: order %s", ErrAllocationMismatch, order.OrderID())
+		}
+		if order.IsOpen() {
+			return Allocation{}, fmt.Errorf("%w: order %s", ErrAllocationOrderOpen, order.OrderID())
+		}
+		if a.allocated(order.OrderID()) || slices.Contains(allocation.OrderIDs, order.OrderID()) {
+			return Allocation{}, fmt.Errorf("%w: order %s", ErrOrderAllocated, order.OrderID())
+		}
+		allocation.OrderIDs = append(allocation.OrderIDs, order.OrderID())
+		allocation.Quantity = allocation.Quantity.Add(order.ExecutedQuantity())
+		notional = notional.Add(order.ExecutedNotional())
+	}
+	if !allocation.Quantity.IsPositive() {
+		return Allocation{}, fmt.Errorf("%w: nothing was executed", ErrAllocationQuantity)
+	}
+	allocation.AvgPx = notional.Div(allocation.Quantity)
+	if request.AvgPx.IsPositive() && !request.AvgPx.Round(2).Equal(allocation.AvgPx.Round(2)) {
+		return Allocation{}, fmt.Errorf("%w: %s", ErrAllocationAvgPx, allocation.AvgPx.Round(2))
+	}
+	subAccounts := a.accounts[allocation.Account].SubAccounts
+	allocated := decimal.Zero
+	for _, split := range request.Splits {
+		if split.Account == "" || !split.Quantity.IsPositive() {
+			return Allocation{}, fmt.Errorf("%w: each sub-account needs a name and a positive quantity", ErrAllocationQuantity)
+		}
+		if len(subAccounts) > 0 && !slices.Contains(subAccounts, split.Account) {
+			return Allocation{}, fmt.Errorf("%w: sub-account %s of %s", ErrNotEntitled, split.Account, allocation.Account)
+		}
+		allocated = allocated.Add(split.Quantity)
+	}
+	if !allocated.Equal(allocation.Quantity) {
+		return Allocation{}, fmt.Errorf("%w: %s allocated, %s executed", ErrAllocationQuantity, allocated, allocation.Quantity)
+	}
+	a.allocations = append(a.allocations, &allocation)
+	a.bookAllocation(&allocation)
+	return allocation, nil
+}
+
+// allocationOrder resolves an order of compID an allocation refers to.
+func (a *Application) allocationOrder(compID string, ref AllocationOrder) (*domain.Order, error) {
+	order, ok := a.orders[ref.OrderID]
+	if ref.OrderID == "" {
+		order, ok = a.ordersByClOrdID[orderRef{senderCompID: compID, clOrdID: ref.ClOrdID}]
+	}
+	if !ok || order.SenderCompID() != compID {
+		return nil, ErrUnknownOrder
+	}
+	return order, nil
+}
+
+func (a *Application) allocated(orderID string) bool {
+	return slices.ContainsFunc(a.allocations, func(allocation *Allocation) bool {
+		return slices.Contains(allocation.OrderIDs, orderID)
+	})
+}
+
+// bookAllocation moves the allocated quantity from the block account to the
+// sub-accounts at the average price. Moving a position is no trade, so what the block
+// account bought or sold goes along. It runs under the engine lock.
+func (a *Application) bookAllocation(allocation *Allocation) {
+	block := a.position(allocation.Account, allocation.Symbol, allocation.CompID)
+	opposite := domain.SELL
+	if allocation.Side == domain.SELL {
+		opposite = domain.BUY
+	}
+	block.apply(opposite, allocation.AvgPx, allocation.Quantity)
+	block.BoughtQty = block.BoughtQty.Sub(allocation.Quantity)
+	block.SoldQty = block.SoldQty.Sub(allocation.Quantity)
+	for _, split := range allocation.Splits {
+		a.position(split.Account, allocation.Symbol, allocation.CompID).apply(allocation.Side, allocation.AvgPx, split.Quantity)
+	}
+}
+
+// Allocations lists the allocations of the trading date, in the order they were made.
+func (a *Application) Allocations() []Allocation {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	allocations := make([]Allocation, 0, len(a.allocations))
+	for _, allocation := range a.allocations {
+		allocations = append(allocations, *allocation)
+	}
+	return allocations
+}
+
+type allocationInstructionMessage interface {
+	GetAllocID() (string, quickfix.MessageRejectError)
+	GetAllocTransType() (enum.AllocTransType, quickfix.MessageRejectError)
+	GetSide() (enum.Side, quickfix.MessageRejectError)
+	GetAvgPx() (decimal.Decimal, quickfix.MessageRejectError)
+	GetTradeDate() (string, quickfix.MessageRejectError)
+}
+
+type allocationOrderEntry interface {
+	GetOrderID() (string, quickfix.MessageRejectError)
+	GetClOrdID() (string, quickfix.MessageRejectError)
+}
+
+type allocationEntry interface {
+	GetAllocAccount() (string, quickfix.MessageRejectError)
+	GetAllocQty() (decimal.Decimal, quickfix.MessageRejectError)
+}
+
+func (a *Application) addAllocationRoutes() {
+	a.AddRoute(fix44ai.Route(func(msg fix44ai.AllocationInstruction, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		orders, err := msg.GetNoOrders()
+		if err != nil {
+			return err
+		}
+		allocs, err := msg.GetNoAllocs()
+		if err != nil {
+			return err
+		}
+		return a.onAllocationInstruction(msg, allocationOrders(orders.Len(), orders.Get),
+			allocationSplits(allocs.Len(), allocs.Get), sessionID)
+	}))
+	a.AddRoute(fix50sp2ai.Route(func(msg fix50sp2ai.AllocationInstruction, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		orders, err := msg.GetNoOrders()
+		if err != nil {
+			return err
+		}
+		allocs, err := msg.GetNoAllocs()
+		if err != nil {
+			return err
+		}
+		return a.onAllocationInstruction(msg, allocationOrders(orders.Len(), orders.Get),
+			allocationSplits(allocs.Len(), allocs.Get), sessionID)
+	}))
+}
+
+func allocationOrders[E allocationOrderEntry](n int, get func(int) E) []AllocationOrder {
+	orders := make([]AllocationOrder, 0, n)
+	for i := 0; i < n; i++ {
+		orderID, _ := get(i).GetOrderID()
+		clOrdID, _ := get(i).GetClOrdID()
+		orders = append(orders, AllocationOrder{OrderID: orderID, ClOrdID: clOrdID})
+	}
+	return orders
+}
+
+func allocationSplits[E allocationEntry](n int, get func(int) E) []AllocationSplit {
+	splits := make([]AllocationSplit, 0, n)
+	for i := 0; i < n; i++ {
+		account, _ := get(i).GetAllocAccount()
+		quantity, _ := get(i).GetAllocQty()
+		splits = append(splits, AllocationSplit{Account: account, Quantity: quantity})
+	}
+	return splits
+}
+
+func (a *Application) onAllocationInstruction(msg allocationInstructionMessage, orders []AllocationOrder,
+	splits []AllocationSplit, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+	allocID, err := msg.GetAllocID()
+	if err != nil {
+		return err
+	}
+	transType, err := msg.GetAllocTransType()
+	if err != nil {
+		return err
+	}
+	side, err := msg.GetSide()
+	if err != nil {
+		return err
+	}
+	tradeDate, _ := msg.GetTradeDate()
+	avgPx, _ := msg.GetAvgPx()
+
+	var allocErr error
+	switch {
+	case transType != enum.AllocTransType_NEW:
+		allocErr = fmt.Errorf("only new allocations are supported")
+	case side != enum.Side_BUY && side != enum.Side_SELL:
+		allocErr = fmt.Errorf("%w: side %s", ErrAllocationMismatch, side)
+	default:
+		request := AllocationRequest{AllocID: allocID, CompID: sessionID.TargetCompID, Side: domain.BUY, Orders: orders,
+			Splits: splits, AvgPx: avgPx}
+		if side == enum.Side_SELL {
+			request.Side = domain.SELL
+		}
+		_, allocErr = a.Allocate(request)
+	}
+	if allocErr != nil {
+		log.Printf("allocation %s from %s rejected: %s", allocID, sessionID.TargetCompID, allocErr)
+	}
+	sendErr := quickfix.SendToTarget(allocationInstructionAck(allocID, tradeDate, allocErr, sessionID.BeginString), sessionID)
+	if sendErr != nil {
+		return quickfix.NewMessageRejectError(sendErr.Error(), -1, nil)
+	}
+	return nil
+}
+
+// allocationRejCode is the AllocRejCode of why an allocation was rejected.
+func allocationRejCode(err error) enum.AllocRejCode {
+	switch {
+	case errors.Is(err, ErrUnknownOrder):
+		return enum.AllocRejCode_UNKNOWN_ORDERID
+	case errors.Is(err, ErrNotEntitled):
+		return enum.AllocRejCode_UNKNOWN_ACCOUNT
+	case errors.Is(err, ErrAllocationQuantity):
+		return enum.AllocRejCode_INCORRECT_QUANTITY
+	case errors.Is(err, ErrAllocationAvgPx):
+		return enum.AllocRejCode_INCORRECT_AVERAGEG_PRICE
+	case errors.Is(err, ErrAllocationMismatch):
+		return enum.AllocRejCode_MISMATCHED_DATA
+	default:
+		return enum.AllocRejCode_OTHER_7
+	}
+}
+
+// allocationInstructionAck accepts allocation allocID, or rejects it for cause.
+func allocationInstructionAck(allocID, tradeDate string, cause error, beginString string) *quickfix.Message {
+	msg := quickfix.NewMessage()
+	msg.Header.Set(field.NewBeginString(beginString))
+	msg.Header.Set(field.NewMsgType(enum.MsgType_ALLOCATION_INSTRUCTION_ACK))
+	msg.Body.Set(field.NewAllocID(allocID))
+	msg.Body.Set(field.NewTransactTime(time.Now()))
+	if tradeDate != "" {
+		msg.Body.Set(field.NewTradeDate(tradeDate))
+	}
+	if cause == nil {
+		msg.Body.Set(field.NewAllocStatus(enum.AllocStatus_ACCEPTED))
+		return msg
+	}
+	status := enum.AllocStatus_BLOCK_LEVEL_REJECT
+	if errors.Is(cause, ErrNotEntitled) {
+		status = enum.AllocStatus_ACCOUNT_LEVEL_REJECT
+	}
+	msg.Body.Set(field.NewAllocStatus(status))
+	msg.Body.Set(field.NewAllocRejCode(allocationRejCode(cause)))
+	msg.Body.Set(field.NewText(cause.Error()))
+	return msg
+}
@@ -0,0 +1,184 @@
+package order_gateway
+
+import (
+	"bytes"
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix44ai "github.com/quickfixgo/fix44/allocationinstruction"
+	fix50sp2ai "github.com/quickfixgo/fix50sp2/allocationinstruction"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/quickfix/datadictionary"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+	"time"
+)
+
+func TestApplication_Allocate(t *testing.T) {
+	app := NewApplication(WithAccounts(Accounts{"BLOCK1": {Account: "BLOCK1", SubAccounts: []string{"FUND1", "FUND2"}}}))
+	submit := func(clOrdID, sender, account string, side domain.OrderSide, price, qty int64) {
+		order := app.NewOrder(clOrdID, "VALE3", sender, "EX", side, enum.OrdType_LIMIT, decimal.NewFromInt(price),
+			decimal.NewFromInt(qty))
+		order.SetAccount(account)
+		_, err := app.Submit(order)
+		require.NoError(t, err)
+	}
+	submit("s1", "A", "", domain.SELL, 10, 100)
+	submit("s2", "A", "", domain.SELL, 12, 50)
+	submit("b1", "B", "BLOCK1", domain.BUY, 10, 100)
+	submit("b2", "B", "BLOCK1", domain.BUY, 12, 50)
+	submit("b3", "B", "BLOCK1", domain.BUY, 5, 10)
+
+	blockOrders := []AllocationOrder{{ClOrdID: "b1"}, {ClOrdID: "b2"}}
+	splits := func(fund1, fund2 int64) []AllocationSplit {
+		return []AllocationSplit{{Account: "FUND1", Quantity: decimal.NewFromInt(fund1)},
+			{Account: "FUND2", Quantity: decimal.NewFromInt(fund2)}}
+	}
+	tests := []struct {
+		name   string
+		compID string
+		side   domain.OrderSide
+		orders []AllocationOrder
+		splits []AllocationSplit
+		avgPx  string
+		err    error
+	}{
+		{"unknown order", "B", domain.BUY, []AllocationOrder{{OrderID: "nope"}}, splits(90, 60), "0", ErrUnknownOrder},
+		{"order of another session", "B", domain.BUY, []AllocationOrder{{ClOrdID: "s1"}}, splits(90, 60), "0", ErrUnknownOrder},
+		{"side", "B", domain.SELL, blockOrders, splits(90, 60), "0", ErrAllocationMismatch},
+		{"working order", "B", domain.BUY, []AllocationOrder{{ClOrdID: "b3"}}, splits(5, 5), "0", ErrAllocationOrderOpen},
+		{"quantity", "B", domain.BUY, blockOrders, splits(90, 50), "0", ErrAllocationQuantity},
+		{"average price", "B", domain.BUY, blockOrders, splits(90, 60), "10.5", ErrAllocationAvgPx},
+		{"sub-account", "B", domain.BUY, blockOrders, []AllocationSplit{{Account: "FUND9", Quantity: decimal.NewFromInt(150)}},
+			"0", ErrNotEntitled},
+		{"accepted", "B", domain.BUY, blockOrders, splits(90, 60), "10.67", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := app.Allocate(AllocationRequest{AllocID: "A1", CompID: tt.compID, Side: tt.side, Orders: tt.orders,
+				Splits: tt.splits, AvgPx: decimal.RequireFromString(tt.avgPx)})
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	position := func(account string) Position {
+		positions := app.Positions(account)
+		require.Len(t, positions, 1)
+		return positions[0]
+	}
+	require.True(t, position("BLOCK1").Quantity.IsZero())
+	require.True(t, position("BLOCK1").BoughtQty.IsZero())
+	require.Equal(t, "90", position("FUND1").Quantity.String())
+	require.Equal(t, "10.67", position("FUND1").AvgCost.Round(2).String())
+	require.Equal(t, "60", position("FUND2").Quantity.String())
+
+	_, err := app.Allocate(AllocationRequest{AllocID: "A1", CompID: "B", Side: domain.BUY, Orders: blockOrders, Splits: splits(90, 60)})
+	require.ErrorIs(t, err, ErrDuplicateAllocID)
+	_, err = app.Allocate(AllocationRequest{AllocID: "A2", CompID: "B", Side: domain.BUY, Orders: blockOrders, Splits: splits(90, 60)})
+	require.ErrorIs(t, err, ErrOrderAllocated)
+	require.Len(t, app.Allocations(), 1)
+
+	// a bust after the allocation leaves the block account short of what it gave away
+	for _, trade := range app.Trades("VALE3") {
+		if trade.Quantity.Equal(decimal.NewFromInt(50)) {
+			_, err = app.BustTrade(trade.TradeID, "")
+			require.NoError(t, err)
+		}
+	}
+	require.Equal(t, "-50", position("BLOCK1").Quantity.String())
+	require.Equal(t, "90", position("FUND1").Quantity.String())
+}
+
+func TestApplication_AllocationInstruction(t *testing.T) {
+	app, counterparty, sessions := startFIX(t)
+	app.accounts = Accounts{"BLOCK1": {Account: "BLOCK1", SubAccounts: []string{"FUND1", "FUND2"}}}
+	sell := app.NewOrder("S1", "VALE3", "CLIENT42", "ORDERGATEWAY", domain.SELL, enum.OrdType_LIMIT, decimal.NewFromInt(10),
+		decimal.NewFromInt(100))
+	_, err := app.Submit(sell)
+	require.NoError(t, err)
+	buy := app.NewOrder("B1", "VALE3", "CLIENT44", "ORDERGATEWAY", domain.BUY, enum.OrdType_LIMIT, decimal.NewFromInt(10),
+		decimal.NewFromInt(100))
+	buy.SetAccount("BLOCK1")
+	_, err = app.Submit(buy)
+	require.NoError(t, err)
+	for range 4 {
+		counterparty.next(t)
+	}
+
+	instruction := func(allocID string, fund1, fund2 int64) fix44ai.AllocationInstruction {
+		msg := fix44ai.New(field.NewAllocID(allocID), field.NewAllocTransType(enum.AllocTransType_NEW),
+			field.NewAllocType(enum.AllocType_CALCULATED), field.NewAllocNoOrdersType(enum.AllocNoOrdersType_EXPLICIT_LIST_PROVIDED),
+			field.NewSide(enum.Side_BUY), field.NewQuantity(decimal.NewFromInt(fund1+fund2), 2),
+			field.NewAvgPx(decimal.NewFromInt(10), 2), field.NewTradeDate("20260302"))
+		msg.SetSymbol("VALE3")
+		orders := fix44ai.NewNoOrdersRepeatingGroup()
+		orders.Add().SetClOrdID("B1")
+		msg.SetNoOrders(orders)
+		allocs := fix44ai.NewNoAllocsRepeatingGroup()
+		for _, split := range [][2]any{{"FUND1", fund1}, {"FUND2", fund2}} {
+			alloc := allocs.Add()
+			alloc.SetAllocAccount(split[0].(string))
+			alloc.SetAllocQty(decimal.NewFromInt(split[1].(int64)), 2)
+		}
+		msg.SetNoAllocs(allocs)
+		return msg
+	}
+	require.NoError(t, quickfix.SendToTarget(instruction("A1", 70, 20), sessions["CLIENT44"]))
+	ack := counterparty.next(t)
+	require.True(t, ack.IsMsgTypeOf(string(enum.MsgType_ALLOCATION_INSTRUCTION_ACK)))
+	requireFields(t, ack, map[int]string{70: "A1", 87: "1", 88: "1", 75: "20260302"})
+
+	require.NoError(t, quickfix.SendToTarget(instruction("A2", 70, 30), sessions["CLIENT44"]))
+	requireFields(t, counterparty.next(t), map[int]string{70: "A2", 87: "0"})
+	require.Equal(t, "70", app.Positions("FUND1")[0].Quantity.String())
+
+	require.NoError(t, quickfix.SendToTarget(instruction("A2", 70, 30), sessions["CLIENT44"]))
+	requireFields(t, counterparty.next(t), map[int]string{70: "A2", 87: "1", 88: "7"})
+
+	// CLIENT50 has no order B1
+	msg := fix50sp2ai.New(field.NewAllocID("A3"), field.NewAllocTransType(enum.AllocTransType_NEW),
+		field.NewAllocType(enum.AllocType_CALCULATED), field.NewSide(enum.Side_BUY), field.NewQuantity(decimal.NewFromInt(100), 2),
+		field.NewTradeDate("20260302"))
+	orders := fix50sp2ai.NewNoOrdersRepeatingGroup()
+	orders.Add().SetClOrdID("B1")
+	msg.SetNoOrders(orders)
+	allocs := fix50sp2ai.NewNoAllocsRepeatingGroup()
+	alloc := allocs.Add()
+	alloc.SetAllocAccount("FUND1")
+	alloc.SetAllocQty(decimal.NewFromInt(100), 2)
+	msg.SetNoAllocs(allocs)
+	require.NoError(t, quickfix.SendToTarget(msg, sessions["CLIENT50"]))
+	requireFields(t, counterparty.next(t), map[int]string{70: "A3", 87: "1", 88: "5"})
+}
+
+func TestAllocationInstructionAck_DataDictionary(t *testing.T) {
+	dir := specDir(t)
+	dictionary := func(name string) *datadictionary.DataDictionary {
+		dd, err := datadictionary.Parse(filepath.Join(dir, name))
+		require.NoError(t, err)
+		return dd
+	}
+	settings := quickfix.ValidatorSettings{CheckFieldsOutOfOrder: true, RejectInvalidMessage: true, CheckUserDefinedFields: true}
+	validators := map[string]quickfix.Validator{
+		quickfix.BeginStringFIX44:  quickfix.NewValidator(settings, dictionary("FIX44.xml"), nil),
+		quickfix.BeginStringFIXT11: quickfix.NewValidator(settings, dictionary("FIX50SP2.xml"), dictionary("FIXT11.xml")),
+	}
+	for beginString, validator := range validators {
+		for _, cause := range []error{nil, ErrAllocationQuantity, ErrNotEntitled} {
+			msg := allocationInstructionAck("A1", "20260302", cause, beginString)
+			// the session fills these in when sending
+			msg.Header.SetString(quickfix.Tag(49), "ORDERGATEWAY")
+			msg.Header.SetString(quickfix.Tag(56), "CLIENT44")
+			msg.Header.SetInt(quickfix.Tag(34), 1)
+			msg.Header.SetString(quickfix.Tag(52), time.Now().UTC().Format("20060102-15:04:05.000"))
+			if beginString == quickfix.BeginStringFIXT11 {
+				msg.Header.SetString(quickfix.Tag(1128), string(enum.ApplVerID_FIX50SP2))
+			}
+			parsed := quickfix.NewMessage()
+			require.NoError(t, quickfix.ParseMessage(parsed, bytes.NewBufferString(msg.String())))
+			require.Nil(t, validator.Validate(parsed), "%s %v", beginString, cause)
+		}
+	}
+}
@@ -0,0 +1,580 @@
+package order_gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+	"github.com/shopspring/decimal"
+	"log"
+	"os"
+	"path/filepath"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"sync"
+	"time"
+)
+
+// AuditEvent is what an audit record records.
+type AuditEvent string
+
+const (
+	// AuditReceived is an application message as read from a FIX session, or a request
+	// as read by another order entry gateway.
+	AuditReceived AuditEvent = "received"
+	// AuditValidated is a new order that passed the checks of its entry protocol.
+	AuditValidated AuditEvent = "validated"
+	// AuditRejected is a message or an order that was refused, with the reason in Text.
+	AuditRejected AuditEvent = "rejected"
+	// AuditBooked is an order the engine accepted onto its book.
+	AuditBooked         AuditEvent = "booked"
+	AuditMatched        AuditEvent = "matched"
+	AuditCanceled       AuditEvent = "canceled"
+	AuditAmended        AuditEvent = "amended"
+	AuditExpired        AuditEvent = "expired"
+	AuditTradeBusted    AuditEvent = "trade_busted"
+	AuditTradeCorrected AuditEvent = "trade_corrected"
+	// AuditRecovered is a last record cut short by a crash, as found on open in Message.
+	AuditRecovered AuditEvent = "recovered"
+)
+
+var (
+	// ErrAuditUnavailable rejects new orders once the audit trail can no longer be written.
+	ErrAuditUnavailable = errors.New("audit trail unavailable")
+	// ErrAuditTornRecord is a last line of an audit trail cut short by a crash while it was written.
+	ErrAuditTornRecord = errors.New("torn audit record")
+)
+
+var auditEventOf = map[OrderEventType]AuditEvent{
+	OrderEventNew:            AuditBooked,
+	OrderEventTrade:          AuditMatched,
+	OrderEventCanceled:       AuditCanceled,
+	OrderEventReplaced:       AuditAmended,
+	OrderEventRejected:       AuditRejected,
+	OrderEventExpired:        AuditExpired,
+	OrderEventTradeCanceled:  AuditTradeBusted,
+	OrderEventTradeCorrected: AuditTradeCorrected,
+}
+
+// AuditRecord is an immutable record of one event of an order's lifecycle. Records are
+// numbered per trading date, and each one carries the hash of the one before, so that
+// a record changed or taken out of the file breaks the chain.
+type AuditRecord struct {
+	TradingDate string `json:"trading_date"`
+	Seq         int64  `json:"seq"`
+	// Time has nanosecond precision, when the message was read for AuditReceived
+	Time  time.Time  `json:"time"`
+	Event AuditEvent `json:"event"`
+	// CauseSeq is the record of the message that led to this one, 0 for what the
+	// exchange did on its own or was asked to by other protocols
+	CauseSeq int64  `json:"cause_seq,omitempty"`
+	CompID   string `json:"comp_id"`
+	// Protocol is the gateway of AuditReceived
+	Protocol    domain.EntryProtocol `json:"protocol,omitempty"`
+	MsgType     string               `json:"msg_type,omitempty"`
+	OrderID     string               `json:"order_id,omitempty"`
+	ClOrdID     string               `json:"cl_ord_id,omitempty"`
+	OrigClOrdID string               `json:"orig_cl_ord_id,omitempty"`
+	Account     string               `json:"account,omitempty"`
+	Symbol      string               `json:"symbol,omitempty"`
+	Side        string               `json:"side,omitempty"`
+	OrdType     string               `json:"ord_type,omitempty"`
+	// Price, Quantity, LeavesQty and CumQty are of the order as the event left it
+	Price     decimal.Decimal `json:"price"`
+	Quantity  decimal.Decimal `json:"quantity"`
+	LeavesQty decimal.Decimal `json:"leaves_qty"`
+	CumQty    decimal.Decimal `json:"cum_qty"`
+	LastQty   decimal.Decimal `json:"last_qty"`
+	LastPx    decimal.Decimal `json:"last_px"`
+	Status    string          `json:"status,omitempty"`
+	ExecID    string          `json:"exec_id,omitempty"`
+	// TradeID links the matches of both sides, ContraOrderID is the order on the other one
+	TradeID       string `json:"trade_id,omitempty"`
+	ContraOrderID string `json:"contra_order_id,omitempty"`
+	// ExecRefID is the ExecID of the match a bust or correction restates
+	ExecRefID string `json:"exec_ref_id,omitempty"`
+	Text      string `json:"text,omitempty"`
+	// Message is the message of AuditReceived, byte for byte for FIX and REST, as text
+	// for gRPC and hex for OUCH
+	Message  string `json:"message,omitempty"`
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// digest is the hash of r, its own Hash left out.
+func (r AuditRecord) digest() string {
+	r.Hash = ""
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditTrail appends the audit records of a trading day, one JSON line each, to a file
+// named after the trading date. Records are never rewritten. End of day processing
+// rolls it over to the next trading date. It is safe for concurrent use.
+//
+// Records are synced to disk before the exchange answers the message that led to
+// them: after the events of every engine operation and with every rejection. Once a
+// write or sync fails, nothing more is written and Err stops the intake of new orders.
+type AuditTrail struct {
+	mu   sync.Mutex
+	dir  string
+	date string
+	file *os.File
+	seq  int64
+	hash string
+	// err is the write that failed, after which the trail takes no more records
+	err error
+}
+
+// OpenAuditTrail appends to the audit trail of date in dir, created if need be. A
+// restart during the day carries on the numbering and the hash chain of the file,
+// which must be intact but for a last line torn by a crash: that one is cut and what
+// it held recorded in its place, as an AuditRecovered record.
+func OpenAuditTrail(dir, date string) (*AuditTrail, error) {
+	if _, err := time.Parse(TradingDateLayout, date); err != nil {
+		return nil, fmt.Errorf("invalid trading date %q", date)
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %v, %v", dir, err)
+	}
+	t := &AuditTrail{dir: dir}
+	err = t.open(date)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// AuditFileName is the audit trail of date in dir.
+func AuditFileName(dir, date string) string {
+	return filepath.Join(dir, date+".jsonl")
+}
+
+// WithAuditTrail records every order event, and every FIX message that led to one, to t,
+// and trades on its trading date.
+func WithAuditTrail(t *AuditTrail) Option {
+	return func(a *Application) {
+		a.audit = t
+		a.tradingDate = t.date
+	}
+}
+
+func (t *AuditTrail) open(date string) error {
+	fileName := AuditFileName(t.dir, date)
+	t.seq, t.hash = 0, ""
+	records, torn, err := readAuditTrail(fileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		t.seq, t.hash = last.Seq, last.Hash
+	}
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening %v, %v", fileName, err)
+	}
+	t.date, t.file = date, file
+	if len(torn) > 0 {
+		return t.recoverTorn(fileName, torn)
+	}
+	return nil
+}
+
+// recoverTorn cuts torn off the end of the file and records what it held.
+func (t *AuditTrail) recoverTorn(fileName string, torn []byte) error {
+	info, err := t.file.Stat()
+	if err == nil {
+		err = t.file.Truncate(info.Size() - int64(len(torn)))
+	}
+	if err != nil {
+		return fmt.Errorf("error cutting the torn last record of %v: %s", fileName, err)
+	}
+	line := t.seq + 1
+	log.Printf("ALERT: audit trail %v ended in a record torn at line %d, cut and recorded as recovered", fileName, line)
+	t.record(AuditRecord{Event: AuditRecovered, Text: fmt.Sprintf("%s at line %d cut on open", ErrAuditTornRecord, line),
+		Message: string(torn)})
+	t.sync()
+	return t.err
+}
+
+// Record numbers record, chains it to the one before and appends it, stamped with the
+// current time unless it has one. It returns the Seq of record, 0 when it could not be
+// written.
+func (t *AuditTrail) Record(record AuditRecord) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.record(record)
+}
+
+// record is Record, the caller holds t.mu.
+func (t *AuditTrail) record(record AuditRecord) int64 {
+	if t.err != nil {
+		return 0
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	record.TradingDate, record.Seq, record.PrevHash = t.date, t.seq+1, t.hash
+	record.Hash = record.digest()
+	data, err := json.Marshal(record)
+	if err == nil {
+		_, err = t.file.Write(append(data, '\n'))
+	}
+	if err != nil {
+		log.Printf("ALERT: failed to write the %s audit record of order %s %s, new orders are rejected: %s", record.Event,
+			record.OrderID, record.ClOrdID, err)
+		t.err = err
+		return 0
+	}
+	t.seq, t.hash = record.Seq, record.Hash
+	return record.Seq
+}
+
+// Sync flushes the records written so far to disk.
+func (t *AuditTrail) Sync() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sync()
+}
+
+func (t *AuditTrail) sync() {
+	if t.err != nil {
+		return
+	}
+	if err := t.file.Sync(); err != nil {
+		log.Printf("ALERT: failed to sync the audit trail, new orders are rejected: %s", err)
+		t.err = err
+	}
+}
+
+// Err returns why new orders should no longer be taken: a record that could not be
+// written or synced, after which the audit trail misses what the exchange does.
+func (t *AuditTrail) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return fmt.Errorf("%w: %s", ErrAuditUnavailable, t.err)
+	}
+	return nil
+}
+
+// roll starts the audit trail of date, then closes the one of the day. When date
+// cannot be started the trail stays on the day.
+func (t *AuditTrail) roll(date string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	day, file, seq, hash, failed := t.date, t.file, t.seq, t.hash, t.err
+	err := t.open(date)
+	if err != nil {
+		if t.file != file {
+			_ = t.file.Close()
+		}
+		t.date, t.file, t.seq, t.hash, t.err = day, file, seq, hash, failed
+		return err
+	}
+	if err = errors.Join(file.Sync(), file.Close()); err != nil {
+		log.Printf("ALERT: failed to close the audit trail of %s, new orders are rejected: %s", day, err)
+		if t.err == nil {
+			t.err = err
+		}
+	}
+	return nil
+}
+
+func (t *AuditTrail) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.close()
+}
+
+func (t *AuditTrail) close() error {
+	err := t.file.Sync()
+	return errors.Join(err, t.file.Close())
+}
+
+// ReadAuditTrail reads back the records of fileName, checking that none is missing or
+// was changed since it was written. A last line torn by a crash is left out, with an
+// ErrAuditTornRecord error along with the records before it.
+func ReadAuditTrail(fileName string) ([]AuditRecord, error) {
+	records, torn, err := readAuditTrail(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(torn) > 0 {
+		return records, fmt.Errorf("%w at line %d of %v", ErrAuditTornRecord, len(records)+1, fileName)
+	}
+	return records, nil
+}
+
+// readAuditTrail reads back the records of fileName and what follows the last of
+// them that was written in full, a record torn by a crash.
+func readAuditTrail(fileName string) ([]AuditRecord, []byte, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening %v, %w", fileName, err)
+	}
+	end := bytes.LastIndexByte(data, '\n') + 1
+	records := make([]AuditRecord, 0)
+	hash := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data[:end]))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var record AuditRecord
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading %v line %d: %s", fileName, line, err)
+		}
+		if record.Seq != int64(line) || record.PrevHash != hash || record.Hash != record.digest() {
+			return nil, nil, fmt.Errorf("audit trail %v was tampered with at line %d", fileName, line)
+		}
+		hash = record.Hash
+		records = append(records, record)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading %v, %v", fileName, err)
+	}
+	return records, data[end:], nil
+}
+
+// OrderHistory picks out of records, in the order they were written, the lifecycle of
+// the orders id is the OrderID or one of the ClOrdIDs of, with the messages that led to
+// it. Orders of compID only are looked at when it is not empty, as ClOrdIDs are only
+// unique per CompID.
+func OrderHistory(records []AuditRecord, compID, id string) []AuditRecord {
+	orderIDs := make(map[string]bool)
+	refs := make(map[orderRef]bool)
+	matches := func(r AuditRecord) bool {
+		if compID != "" && r.CompID != compID {
+			return false
+		}
+		return r.OrderID == id || r.ClOrdID == id || r.OrigClOrdID == id || orderIDs[r.OrderID] ||
+			refs[orderRef{senderCompID: r.CompID, clOrdID: r.ClOrdID}] ||
+			refs[orderRef{senderCompID: r.CompID, clOrdID: r.OrigClOrdID}]
+	}
+	// amendments chain ClOrdIDs, so what matches grows until it has them all
+	for grown := true; grown; {
+		grown = false
+		for _, r := range records {
+			if !matches(r) {
+				continue
+			}
+			for _, ref := range []orderRef{{r.CompID, r.ClOrdID}, {r.CompID, r.OrigClOrdID}} {
+				if ref.clOrdID != "" && !refs[ref] {
+					refs[ref], grown = true, true
+				}
+			}
+			if r.OrderID != "" && !orderIDs[r.OrderID] {
+				orderIDs[r.OrderID], grown = true, true
+			}
+		}
+	}
+	type recordRef struct {
+		date string
+		seq  int64
+	}
+	causes := make(map[recordRef]bool)
+	for _, r := range records {
+		if matches(r) && r.CauseSeq != 0 {
+			causes[recordRef{r.TradingDate, r.CauseSeq}] = true
+		}
+	}
+	history := make([]AuditRecord, 0)
+	for _, r := range records {
+		if matches(r) || causes[recordRef{r.TradingDate, r.Seq}] {
+			history = append(history, r)
+		}
+	}
+	return history
+}
+
+// auditErr is why new orders and replaces are refused while the audit trail fails.
+func (a *Application) auditErr() error {
+	if a.audit == nil {
+		return nil
+	}
+	return a.audit.Err()
+}
+
+// auditReceipt is the AuditReceived record of a message being processed.
+type auditReceipt struct {
+	seq         int64
+	clOrdID     string
+	origClOrdID string
+}
+
+// auditReceived records msg as read from the FIX session, before anything is done with it.
+func (a *Application) auditReceived(msg *quickfix.Message, sessionID quickfix.SessionID) auditReceipt {
+	if a.audit == nil {
+		return auditReceipt{}
+	}
+	msgType, _ := msg.MsgType()
+	clOrdID, _ := msg.Body.GetString(tag.ClOrdID)
+	origClOrdID, _ := msg.Body.GetString(tag.OrigClOrdID)
+	seq := a.audit.Record(AuditRecord{Time: msg.ReceiveTime.UTC(), Event: AuditReceived, CompID: sessionID.TargetCompID,
+		Protocol: domain.EntryFIX, MsgType: msgType, ClOrdID: clOrdID, OrigClOrdID: origClOrdID, Message: msg.String()})
+	return auditReceipt{seq: seq, clOrdID: clOrdID, origClOrdID: origClOrdID}
+}
+
+// auditMessageRejected records that the message of receipt was refused before it reached the engine.
+func (a *Application) auditMessageRejected(receipt auditReceipt, msg *quickfix.Message, sessionID quickfix.SessionID,
+	text string) {
+	if a.audit == nil {
+		return
+	}
+	msgType, _ := msg.MsgType()
+	a.audit.Record(AuditRecord{Event: AuditRejected, CauseSeq: receipt.seq, CompID: sessionID.TargetCompID,
+		MsgType: msgType, ClOrdID: receipt.clOrdID, OrigClOrdID: receipt.origClOrdID, Text: text})
+	a.audit.Sync()
+}
+
+// holdReceipt links what the engine does with the ClOrdIDs of compID that receipt
+// names to it, until releaseReceipt.
+func (a *Application) holdReceipt(compID string, receipt auditReceipt) {
+	if receipt.seq == 0 {
+		return
+	}
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+	for _, clOrdID := range []string{receipt.clOrdID, receipt.origClOrdID} {
+		if clOrdID != "" {
+			a.receipts[orderRef{senderCompID: compID, clOrdID: clOrdID}] = receipt
+		}
+	}
+}
+
+func (a *Application) releaseReceipt(compID string, receipt auditReceipt) {
+	if receipt.seq == 0 {
+		return
+	}
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+	for _, clOrdID := range []string{receipt.clOrdID, receipt.origClOrdID} {
+		ref := orderRef{senderCompID: compID, clOrdID: clOrdID}
+		if a.receipts[ref].seq == receipt.seq {
+			delete(a.receipts, ref)
+		}
+	}
+}
+
+// receiptOf is the record of the message being processed that names clOrdID of compID.
+func (a *Application) receiptOf(compID, clOrdID string) auditReceipt {
+	a.sessionsMu.RLock()
+	defer a.sessionsMu.RUnlock()
+	return a.receipts[orderRef{senderCompID: compID, clOrdID: clOrdID}]
+}
+
+// AuditReceipt is the audit record of a request read by an order entry gateway other
+// than FIX. What the engine does with the orders it names is linked to it until Done.
+type AuditReceipt struct {
+	app     *Application
+	compID  string
+	msgType enum.MsgType
+	receipt auditReceipt
+}
+
+// ReceiveRequest records a request of compID as read by the gateway of protocol, before
+// anything is done with it. msgType is the FIX message it stands for, clOrdID and
+// origClOrdID the client order IDs it carries and message the request itself.
+func (a *Application) ReceiveRequest(protocol domain.EntryProtocol, compID string, msgType enum.MsgType,
+	clOrdID, origClOrdID, message string) *AuditReceipt {
+	r := &AuditReceipt{app: a, compID: compID, msgType: msgType}
+	if a.audit == nil {
+		return r
+	}
+	seq := a.audit.Record(AuditRecord{Event: AuditReceived, CompID: compID, Protocol: protocol, MsgType: string(msgType),
+		ClOrdID: clOrdID, OrigClOrdID: origClOrdID, Message: message})
+	r.receipt = auditReceipt{seq: seq, clOrdID: clOrdID, origClOrdID: origClOrdID}
+	a.holdReceipt(compID, r.receipt)
+	return r
+}
+
+// Validated records that order, read from the request, passed the checks of its gateway.
+func (r *AuditReceipt) Validated(order *domain.Order) {
+	r.app.auditValidated(order, r.msgType)
+}
+
+// Rejected records that the request was refused, by its gateway or the engine, for reason.
+func (r *AuditReceipt) Rejected(reason string) {
+	if r.app.audit == nil {
+		return
+	}
+	r.app.audit.Record(AuditRecord{Event: AuditRejected, CauseSeq: r.receipt.seq, CompID: r.compID,
+		MsgType: string(r.msgType), ClOrdID: r.receipt.clOrdID, OrigClOrdID: r.receipt.origClOrdID, Text: reason})
+	r.app.audit.Sync()
+}
+
+// Done unlinks the request once it has been answered.
+func (r *AuditReceipt) Done() {
+	r.app.releaseReceipt(r.compID, r.receipt)
+}
+
+func auditOrderRecord(event AuditEvent, view domain.OrderView) AuditRecord {
+	return AuditRecord{Event: event, CompID: view.SenderCompID, OrderID: view.OrderID, ClOrdID: view.ClOrdID,
+		Account: view.Account, Symbol: view.Symbol, Side: sideName(view.Side), OrdType: ordTypeName(view.OrdType),
+		Price: view.Price, Quantity: view.Quantity, LeavesQty: view.LeavesQty, CumQty: view.ExecutedQuantity,
+		LastQty: decimal.Zero, LastPx: decimal.Zero}
+}
+
+// auditValidated records that order, read from a message of msgType, passed its checks.
+func (a *Application) auditValidated(order *domain.Order, msgType enum.MsgType) {
+	if a.audit == nil {
+		return
+	}
+	record := auditOrderRecord(AuditValidated, order.View())
+	record.CauseSeq = a.receiptOf(order.SenderCompID(), order.ClOrdID()).seq
+	record.MsgType = string(msgType)
+	a.audit.Record(record)
+}
+
+// auditCancelRejected records that a cancel or replace request from FIX was refused.
+func (a *Application) auditCancelRejected(senderCompID, orderID, clOrdID, origClOrdID string,
+	responseTo enum.CxlRejResponseTo, cause error) {
+	if a.audit == nil {
+		return
+	}
+	msgType := enum.MsgType_ORDER_CANCEL_REQUEST
+	if responseTo == enum.CxlRejResponseTo_ORDER_CANCEL_REPLACE_REQUEST {
+		msgType = enum.MsgType_ORDER_CANCEL_REPLACE_REQUEST
+	}
+	if orderID == "NONE" {
+		orderID = ""
+	}
+	a.audit.Record(AuditRecord{Event: AuditRejected, CauseSeq: a.receiptOf(senderCompID, clOrdID).seq, CompID: senderCompID,
+		MsgType: string(msgType), OrderID: orderID, ClOrdID: clOrdID, OrigClOrdID: origClOrdID, Text: cause.Error()})
+	a.audit.Sync()
+}
+
+// auditEvents records the events of the matching path and syncs them, before they are
+// delivered. They are linked to the message being processed that names the order of
+// the first event. It runs under the engine lock.
+func (a *Application) auditEvents(events []ExecReportRequiredEvent) {
+	if a.audit == nil || len(events) == 0 {
+		return
+	}
+	first := events[0]
+	cause := a.receiptOf(first.Order.SenderCompID, first.Order.ClOrdID).seq
+	for _, event := range events {
+		record := auditOrderRecord(auditEventOf[event.Type], event.Order)
+		record.Time, record.CauseSeq = event.TransactTime, cause
+		record.OrigClOrdID, record.ExecID, record.ExecRefID = event.OrigClOrdID, event.ExecID, event.ExecRefID
+		record.LastQty, record.LastPx = event.LastQty, event.LastPx
+		record.Status, record.Text = orderStatusName(event), event.Text
+		record.TradeID = event.TradeID
+		if trade, ok := a.trades[event.TradeID]; ok {
+			record.ContraOrderID = trade.SellOrderID
+			if event.Order.Side == domain.SELL {
+				record.ContraOrderID = trade.BuyOrderID
+			}
+		}
+		a.audit.Record(record)
+	}
+	a.audit.Sync()
+}
@@ -0,0 +1,274 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix44nos "github.com/quickfixgo/fix44/newordersingle"
+	fix44ocrr "github.com/quickfixgo/fix44/ordercancelreplacerequest"
+	fix44ocr "github.com/quickfixgo/fix44/ordercancelrequest"
+	"github.com/quickfixgo/quickfix"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"os"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditTrail(t *testing.T) {
+	dir := t.TempDir()
+	trail, err := OpenAuditTrail(dir, "20260302")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), trail.Record(AuditRecord{Event: AuditReceived, CompID: "A", ClOrdID: "c1"}))
+	require.Equal(t, int64(2), trail.Record(AuditRecord{Event: AuditBooked, CompID: "A", ClOrdID: "c1",
+		Price: decimal.RequireFromString("10.5"), Time: time.Date(2026, 3, 2, 13, 30, 0, 123456789, time.UTC)}))
+	require.NoError(t, trail.Close())
+
+	// a restart carries on the numbering and the chain
+	trail, err = OpenAuditTrail(dir, "20260302")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), trail.Record(AuditRecord{Event: AuditCanceled, CompID: "A", ClOrdID: "c1"}))
+	require.NoError(t, trail.roll("20260303"))
+	require.Equal(t, int64(1), trail.Record(AuditRecord{Event: AuditExpired, CompID: "A", ClOrdID: "c2"}))
+	require.NoError(t, trail.Close())
+
+	fileName := AuditFileName(dir, "20260302")
+	records, err := ReadAuditTrail(fileName)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, "20260302", records[0].TradingDate)
+	require.Equal(t, records[0].Hash, records[1].PrevHash)
+	require.Equal(t, 123456789, records[1].Time.Nanosecond())
+	require.False(t, records[0].Time.IsZero())
+
+	data, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fileName, []byte(strings.Replace(string(data), `"price":"10.5"`, `"price":"9.5"`, 1)), 0o600))
+	_, err = ReadAuditTrail(fileName)
+	require.ErrorContains(t, err, "tampered with at line 2")
+	_, err = OpenAuditTrail(dir, "20260302")
+	require.ErrorContains(t, err, "tampered with")
+
+	lines := strings.SplitAfter(string(data), "\n")
+	require.NoError(t, os.WriteFile(fileName, []byte(lines[0]+lines[2]), 0o600))
+	_, err = ReadAuditTrail(fileName)
+	require.ErrorContains(t, err, "tampered with at line 2")
+
+	// a crash halfway through the last record tears it, unlike a change it is recovered on open
+	torn := lines[2][:len(lines[2])/2]
+	require.NoError(t, os.WriteFile(fileName, []byte(lines[0]+lines[1]+torn), 0o600))
+	records, err = ReadAuditTrail(fileName)
+	require.ErrorIs(t, err, ErrAuditTornRecord)
+	require.ErrorContains(t, err, "at line 3")
+	require.Len(t, records, 2)
+	trail, err = OpenAuditTrail(dir, "20260302")
+	require.NoError(t, err)
+	require.Equal(t, int64(4), trail.Record(AuditRecord{Event: AuditCanceled, CompID: "A", ClOrdID: "c1"}))
+	require.NoError(t, trail.Close())
+	records, err = ReadAuditTrail(fileName)
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	require.Equal(t, AuditRecovered, records[2].Event)
+	require.Equal(t, torn, records[2].Message)
+	require.Equal(t, records[1].Hash, records[2].PrevHash)
+	require.Contains(t, records[2].Text, "line 3")
+}
+
+func TestApplication_AuditTrailUnavailable(t *testing.T) {
+	trail, err := OpenAuditTrail(t.TempDir(), "20260302")
+	require.NoError(t, err)
+	app := NewApplication(WithAuditTrail(trail))
+	_, err = app.Submit(app.NewOrder("B1", "VALE3", "A", "EX", domain.BUY, enum.OrdType_LIMIT, decimal.NewFromInt(10),
+		decimal.NewFromInt(100)))
+	require.NoError(t, err)
+	require.NoError(t, trail.Err())
+
+	// a record that cannot be written stops intake, orders already resting can still be canceled
+	require.NoError(t, trail.file.Close())
+	require.Zero(t, trail.Record(AuditRecord{Event: AuditReceived, CompID: "A", ClOrdID: "B2"}))
+	require.ErrorIs(t, trail.Err(), ErrAuditUnavailable)
+	_, err = app.Submit(app.NewOrder("B2", "VALE3", "A", "EX", domain.BUY, enum.OrdType_LIMIT, decimal.NewFromInt(10),
+		decimal.NewFromInt(100)))
+	require.ErrorIs(t, err, ErrAuditUnavailable)
+	_, err = app.Replace("A", "B1", "B3", decimal.NewFromInt(10), decimal.NewFromInt(50))
+	require.ErrorIs(t, err, ErrAuditUnavailable)
+	_, err = app.Cancel("A", "B1")
+	require.NoError(t, err)
+}
+
+func TestAuditReceipt(t *testing.T) {
+	dir := t.TempDir()
+	trail, err := OpenAuditTrail(dir, "20260302")
+	require.NoError(t, err)
+	app := NewApplication(WithAuditTrail(trail))
+
+	receipt := app.ReceiveRequest(domain.EntryREST, "A", enum.MsgType_ORDER_SINGLE, "R1", "", `POST /orders {"symbol":"VALE3"}`)
+	order := app.NewOrder("R1", "VALE3", "A", "EX", domain.BUY, enum.OrdType_LIMIT, decimal.NewFromInt(10),
+		decimal.NewFromInt(100))
+	receipt.Validated(order)
+	_, err = app.Submit(order)
+	require.NoError(t, err)
+	receipt.Done()
+
+	receipt = app.ReceiveRequest(domain.EntryOUCH, "A", enum.MsgType_ORDER_CANCEL_REQUEST, "", "R9", "58")
+	receipt.Rejected("unknown token")
+	receipt.Done()
+	require.NoError(t, trail.Close())
+
+	records, err := ReadAuditTrail(AuditFileName(dir, "20260302"))
+	require.NoError(t, err)
+	history := OrderHistory(records, "A", "R1")
+	require.Len(t, history, 3)
+	require.Equal(t, []AuditEvent{AuditReceived, AuditValidated, AuditBooked},
+		[]AuditEvent{history[0].Event, history[1].Event, history[2].Event})
+	require.Equal(t, domain.EntryREST, history[0].Protocol)
+	require.Equal(t, history[0].Seq, history[1].CauseSeq)
+	require.Equal(t, history[0].Seq, history[2].CauseSeq)
+
+	refused := OrderHistory(records, "A", "R9")
+	require.Len(t, refused, 2)
+	require.Equal(t, domain.EntryOUCH, refused[0].Protocol)
+	require.Equal(t, AuditRejected, refused[1].Event)
+	require.Equal(t, refused[0].Seq, refused[1].CauseSeq)
+	require.Equal(t, "unknown token", refused[1].Text)
+}
+
+func TestOrderHistory(t *testing.T) {
+	records := []AuditRecord{
+		{TradingDate: "20260302", Seq: 1, Event: AuditReceived, CompID: "A", ClOrdID: "c1"},
+		{TradingDate: "20260302", Seq: 2, Event: AuditValidated, CauseSeq: 1, CompID: "A", OrderID: "O1", ClOrdID: "c1"},
+		{TradingDate: "20260302", Seq: 3, Event: AuditBooked, CauseSeq: 1, CompID: "A", OrderID: "O1", ClOrdID: "c1"},
+		// the same ClOrdID from another session is another order
+		{TradingDate: "20260302", Seq: 4, Event: AuditReceived, CompID: "B", ClOrdID: "c1"},
+		{TradingDate: "20260302", Seq: 5, Event: AuditBooked, CauseSeq: 4, CompID: "B", OrderID: "O2", ClOrdID: "c1"},
+		{TradingDate: "20260302", Seq: 6, Event: AuditReceived, CompID: "A", ClOrdID: "c2", OrigClOrdID: "c1"},
+		{TradingDate: "20260302", Seq: 7, Event: AuditAmended, CauseSeq: 6, CompID: "A", OrderID: "O1", ClOrdID: "c2",
+			OrigClOrdID: "c1"},
+		{TradingDate: "20260302", Seq: 8, Event: AuditReceived, CompID: "A", ClOrdID: "c3", OrigClOrdID: "c2"},
+		{TradingDate: "20260302", Seq: 9, Event: AuditRejected, CauseSeq: 8, CompID: "A", ClOrdID: "c3", OrigClOrdID: "c2"},
+		// a GTC order carried to the next trading date
+		{TradingDate: "20260303", Seq: 1, Event: AuditExpired, CompID: "A", OrderID: "O1", ClOrdID: "c2"},
+	}
+	seqs := func(history []AuditRecord) []string {
+		s := make([]string, 0, len(history))
+		for _, r := range history {
+			s = append(s, r.TradingDate[6:]+"/"+string(rune('0'+r.Seq)))
+		}
+		return s
+	}
+	all := []string{"02/1", "02/2", "02/3", "02/6", "02/7", "02/8", "02/9", "03/1"}
+	require.Equal(t, all, seqs(OrderHistory(records, "A", "c1")))
+	require.Equal(t, all, seqs(OrderHistory(records, "", "O1")))
+	require.Equal(t, all, seqs(OrderHistory(records, "A", "c2")))
+	require.Equal(t, []string{"02/4", "02/5"}, seqs(OrderHistory(records, "B", "c1")))
+	require.Len(t, OrderHistory(records, "", "c1"), 10)
+	require.Empty(t, OrderHistory(records, "", "nope"))
+}
+
+func TestApplication_AuditTrail(t *testing.T) {
+	dir := t.TempDir()
+	trail, err := OpenAuditTrail(dir, "20260302")
+	require.NoError(t, err)
+	app := NewApplication(WithAuditTrail(trail))
+	counterparty, sessions := startFIXSessions(t, app, nil, 3)
+
+	px := field.NewPrice(decimal.NewFromInt(10), 2)
+	nos := fix44nos.New(field.NewClOrdID("B1"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()),
+		field.NewOrdType(enum.OrdType_LIMIT))
+	nos.Set(field.NewSymbol("VALE3"))
+	nos.Set(px)
+	nos.Set(field.NewOrderQty(decimal.NewFromInt(100), 2))
+	require.NoError(t, quickfix.SendToTarget(nos, sessions["CLIENT44"]))
+	counterparty.next(t)
+
+	// a new order without its quantity is refused by the session, before the engine sees it
+	invalid := fix44nos.New(field.NewClOrdID("B9"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()),
+		field.NewOrdType(enum.OrdType_LIMIT))
+	invalid.Set(field.NewSymbol("VALE3"))
+	invalid.Set(px)
+	require.NoError(t, quickfix.SendToTarget(invalid, sessions["CLIENT44"]))
+	require.True(t, counterparty.next(t).IsMsgTypeOf(string(enum.MsgType_BUSINESS_MESSAGE_REJECT)))
+
+	replace := fix44ocrr.New(field.NewOrigClOrdID("B1"), field.NewClOrdID("B2"), field.NewSide(enum.Side_BUY),
+		field.NewTransactTime(time.Now()), field.NewOrdType(enum.OrdType_LIMIT))
+	replace.Set(field.NewSymbol("VALE3"))
+	replace.Set(px)
+	replace.Set(field.NewOrderQty(decimal.NewFromInt(60), 2))
+	require.NoError(t, quickfix.SendToTarget(replace, sessions["CLIENT44"]))
+	counterparty.next(t)
+
+	sell := app.NewOrder("S1", "VALE3", "CLIENT42", "ORDERGATEWAY", domain.SELL, enum.OrdType_LIMIT,
+		decimal.NewFromInt(10), decimal.NewFromInt(100))
+	_, err = app.Submit(sell)
+	require.NoError(t, err)
+	for range 3 {
+		counterparty.next(t)
+	}
+
+	cancel := fix44ocr.New(field.NewOrigClOrdID("B2"), field.NewClOrdID("B3"), field.NewSide(enum.Side_BUY),
+		field.NewTransactTime(time.Now()))
+	require.NoError(t, quickfix.SendToTarget(cancel, sessions["CLIENT44"]))
+	counterparty.next(t)
+	_, err = app.EndOfDay()
+	require.NoError(t, err)
+	require.NoError(t, trail.Close())
+
+	records, err := ReadAuditTrail(AuditFileName(dir, "20260302"))
+	require.NoError(t, err)
+	history := OrderHistory(records, "CLIENT44", "B1")
+	type step struct {
+		event   AuditEvent
+		msgType string
+		clOrdID string
+		status  string
+	}
+	steps := make([]step, 0, len(history))
+	for _, r := range history {
+		steps = append(steps, step{r.Event, r.MsgType, r.ClOrdID, r.Status})
+	}
+	require.Equal(t, []step{
+		{AuditReceived, "D", "B1", ""},
+		{AuditValidated, "D", "B1", ""},
+		{AuditBooked, "", "B1", "open"},
+		{AuditReceived, "G", "B2", ""},
+		{AuditAmended, "", "B2", "open"},
+		{AuditMatched, "", "B2", "filled"},
+		{AuditReceived, "F", "B3", ""},
+		{AuditRejected, "F", "B3", ""},
+	}, steps)
+
+	received, booked, amended, matched, rejected := history[0], history[2], history[4], history[5], history[7]
+	require.Contains(t, received.Message, "\x0135=D\x01")
+	require.Contains(t, received.Message, "\x0111=B1\x01")
+	require.Equal(t, received.Seq, booked.CauseSeq)
+	require.Equal(t, history[3].Seq, amended.CauseSeq)
+	require.Equal(t, "B1", amended.OrigClOrdID)
+	require.Equal(t, booked.OrderID, matched.OrderID)
+	require.Equal(t, sell.OrderID(), matched.ContraOrderID)
+	require.Equal(t, "60", matched.LastQty.String())
+	// the sell came in through no FIX session
+	require.Zero(t, matched.CauseSeq)
+	require.Equal(t, history[6].Seq, rejected.CauseSeq)
+	require.Equal(t, booked.OrderID, rejected.OrderID)
+	require.Contains(t, rejected.Text, "order is not open")
+	for i := 1; i < len(history); i++ {
+		require.False(t, history[i].Time.Before(history[i-1].Time), "records are in time order")
+	}
+
+	// the other side of the match links back through its TradeID, the rest of it expires at end of day
+	contra := OrderHistory(records, "", sell.OrderID())
+	require.Len(t, contra, 3)
+	require.Equal(t, matched.TradeID, contra[1].TradeID)
+	require.Equal(t, AuditExpired, contra[2].Event)
+	require.Equal(t, "expired", contra[2].Status)
+
+	refused := OrderHistory(records, "CLIENT44", "B9")
+	require.Len(t, refused, 2)
+	require.Equal(t, AuditRejected, refused[1].Event)
+	require.Contains(t, refused[1].Text, "Conditionally Required Field Missing (38)")
+
+	next, err := ReadAuditTrail(AuditFileName(dir, "20260303"))
+	require.NoError(t, err)
+	require.Empty(t, next)
+}
@@ -0,0 +1,323 @@
+package order_gateway
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Clearing nets the standing trades of a trading date per clearing firm and symbol,
+// the obligations each clearing firm settles on the instrument's settlement date.
+// The netting is taken from the trade store and checked against the journal.
+
+// NettingRow is what a clearing firm bought and sold of a symbol over a trading date.
+// NetQty is positive when it takes delivery, NetCash positive when it receives cash.
+type NettingRow struct {
+	ClearingFirm   string          `json:"clearing_firm"`
+	Symbol         string          `json:"symbol"`
+	SettlementDate string          `json:"settlement_date"`
+	Executions     int             `json:"executions"`
+	BoughtQty      decimal.Decimal `json:"bought_qty"`
+	BoughtValue    decimal.Decimal `json:"bought_value"`
+	SoldQty        decimal.Decimal `json:"sold_qty"`
+	SoldValue      decimal.Decimal `json:"sold_value"`
+	NetQty         decimal.Decimal `json:"net_qty"`
+	NetCash        decimal.Decimal `json:"net_cash"`
+}
+
+// ClearingBreak is a figure the trade store and the journal disagree on.
+type ClearingBreak struct {
+	ClearingFirm string          `json:"clearing_firm"`
+	Symbol       string          `json:"symbol"`
+	Field        string          `json:"field"`
+	Store        decimal.Decimal `json:"store"`
+	Journal      decimal.Decimal `json:"journal"`
+}
+
+// ClearingReport is the netting of a trading date and its reconciliation.
+type ClearingReport struct {
+	TradingDate string
+	Rows        []NettingRow
+	Breaks      []ClearingBreak
+}
+
+// clearingExecution is one side of a standing trade, as netting needs it.
+type clearingExecution struct {
+	compID   string
+	symbol   string
+	buy      bool
+	quantity decimal.Decimal
+	price    decimal.Decimal
+}
+
+// clearingFirm clears the trades of compID: its clearing firm, else its firm, else itself.
+func (a *Application) clearingFirm(compID string) string {
+	if firm := a.sessions[compID].ClearingFirm; firm != "" {
+		return firm
+	}
+	return a.feeFirm(compID)
+}
+
+// Clearing nets the trade store of the trading date, as it stands.
+func (a *Application) Clearing() []NettingRow {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	return a.netting(a.tradeStoreExecutions(), a.tradingDate)
+}
+
+// tradeStoreExecutions lists both sides of the trades not busted. It runs under the engine lock.
+func (a *Application) tradeStoreExecutions() []clearingExecution {
+	executions := make([]clearingExecution, 0, 2*len(a.trades))
+	for _, trade := range a.trades {
+		if trade.Status == TradeBusted {
+			continue
+		}
+		for i, side := range []tradeSide{trade.buy, trade.sell} {
+			executions = append(executions, clearingExecution{compID: side.order.SenderCompID(), symbol: trade.Symbol,
+				buy: i == 0, quantity: trade.Quantity, price: trade.Price})
+		}
+	}
+	return executions
+}
+
+// journalExecutions lists the executions of a day report not busted.
+func journalExecutions(report DayReport) []clearingExecution {
+	executions := make([]clearingExecution, 0, len(report.Executions))
+	for _, e := range report.Executions {
+		if e.Status == TradeBusted {
+			continue
+		}
+		executions = append(executions, clearingExecution{compID: e.CompID, symbol: e.Symbol, buy: e.Side == "buy",
+			quantity: e.Quantity, price: e.Price})
+	}
+	return executions
+}
+
+// netting sums executions per clearing firm and symbol, sorted by both.
+func (a *Application) netting(executions []clearingExecution, tradingDate string) []NettingRow {
+	rows := make(map[[2]string]*NettingRow)
+	for _, e := range executions {
+		key := [2]string{a.clearingFirm(e.compID), e.symbol}
+		row, ok := rows[key]
+		if !ok {
+			row = &NettingRow{ClearingFirm: key[0], Symbol: key[1],
+				SettlementDate: a.instruments.settlementDate(e.symbol, tradingDate)}
+			rows[key] = row
+		}
+		row.Executions++
+		value := e.quantity.Mul(e.price)
+		if e.buy {
+			row.BoughtQty = row.BoughtQty.Add(e.quantity)
+			row.BoughtValue = row.BoughtValue.Add(value)
+		} else {
+			row.SoldQty = row.SoldQty.Add(e.quantity)
+			row.SoldValue = row.SoldValue.Add(value)
+		}
+		row.NetQty = row.BoughtQty.Sub(row.SoldQty)
+		row.NetCash = row.SoldValue.Sub(row.BoughtValue)
+	}
+	netting := make([]NettingRow, 0, len(rows))
+	for _, row := range rows {
+		netting = append(netting, *row)
+	}
+	slices.SortFunc(netting, func(x, y NettingRow) int {
+		if c := strings.Compare(x.ClearingFirm, y.ClearingFirm); c != 0 {
+			return c
+		}
+		return strings.Compare(x.Symbol, y.Symbol)
+	})
+	return netting
+}
+
+// reconcile lists every figure of the store netting that the journal netting disagrees on,
+// a row missing on either side counting as zero.
+func reconcile(store, journal []NettingRow) []ClearingBreak {
+	type pair struct{ store, journal NettingRow }
+	pairs := make(map[[2]string]*pair)
+	keys := make([][2]string, 0)
+	for i, rows := range [][]NettingRow{store, journal} {
+		for _, row := range rows {
+			key := [2]string{row.ClearingFirm, row.Symbol}
+			p, ok := pairs[key]
+			if !ok {
+				p = &pair{}
+				pairs[key] = p
+				keys = append(keys, key)
+			}
+			if i == 0 {
+				p.store = row
+			} else {
+				p.journal = row
+			}
+		}
+	}
+	slices.SortFunc(keys, func(x, y [2]string) int {
+		if c := strings.Compare(x[0], y[0]); c != 0 {
+			return c
+		}
+		return strings.Compare(x[1], y[1])
+	})
+	breaks := make([]ClearingBreak, 0)
+	for _, key := range keys {
+		p := pairs[key]
+		for _, f := range []struct {
+			name           string
+			store, journal decimal.Decimal
+		}{
+			{"executions", decimal.NewFromInt(int64(p.store.Executions)), decimal.NewFromInt(int64(p.journal.Executions))},
+			{"bought_qty", p.store.BoughtQty, p.journal.BoughtQty},
+			{"bought_value", p.store.BoughtValue, p.journal.BoughtValue},
+			{"sold_qty", p.store.SoldQty, p.journal.SoldQty},
+			{"sold_value", p.store.SoldValue, p.journal.SoldValue},
+		} {
+			if !f.store.Equal(f.journal) {
+				breaks = append(breaks, ClearingBreak{ClearingFirm: key[0], Symbol: key[1], Field: f.name,
+					Store: f.store, Journal: f.journal})
+			}
+		}
+	}
+	return breaks
+}
+
+// clearingReport nets store executions of tradingDate and reconciles them with its day report.
+func (a *Application) clearingReport(tradingDate string, store []clearingExecution, report DayReport) ClearingReport {
+	clearing := ClearingReport{TradingDate: tradingDate, Rows: a.netting(store, tradingDate)}
+	clearing.Breaks = reconcile(clearing.Rows, a.netting(journalExecutions(report), tradingDate))
+	for _, b := range clearing.Breaks {
+		log.Printf("ALERT: clearing break on %s for %s %s: %s is %s in the trade store and %s in the journal",
+			tradingDate, b.ClearingFirm, b.Symbol, b.Field, b.Store, b.Journal)
+	}
+	return clearing
+}
+
+// JournalClearingReport nets the executions of a day report built from the journal, to
+// write the clearing files of a trading date again once the trade store is gone. There
+// is no trade store to reconcile with, so its Breaks are nil.
+func JournalClearingReport(report DayReport, sessions Sessions, firms map[string]string, instruments Instruments) ClearingReport {
+	a := &Application{sessions: sessions, firms: firms, instruments: instruments}
+	return ClearingReport{TradingDate: report.TradingDate, Rows: a.netting(journalExecutions(report), report.TradingDate)}
+}
+
+// Fixed-width clearing file layout, one record per line, every record padded to
+// clearingRecordLength. Amounts carry two implied decimals, signed ones a leading
+// '+' or '-', and are zero padded.
+//
+//	header   H, trading date (8), detail record count (9)
+//	detail   D, clearing firm (12), symbol (12), settlement date (8), executions (9),
+//	         bought qty (15), bought value (18), sold qty (15), sold value (18),
+//	         net qty (+15), net cash (+18)
+//	trailer  T, detail record count (9), total bought qty (15), total sold qty (15),
+//	         total net cash (+18)
+const clearingRecordLength = 160
+
+// FixedWidthClearing formats report as a fixed-width clearing file.
+func FixedWidthClearing(report ClearingReport) ([]byte, error) {
+	var buf bytes.Buffer
+	record := func(fields ...string) {
+		line := strings.Join(fields, "")
+		buf.WriteString(line + strings.Repeat(" ", clearingRecordLength-len(line)) + "\n")
+	}
+	count := fmt.Sprintf("%09d", len(report.Rows))
+	record("H", report.TradingDate, count)
+	var bought, sold, cash decimal.Decimal
+	for _, row := range report.Rows {
+		fields := []string{"D"}
+		for _, f := range []struct {
+			value string
+			width int
+		}{{row.ClearingFirm, 12}, {row.Symbol, 12}} {
+			if len(f.value) > f.width {
+				return nil, fmt.Errorf("%q is longer than %d characters", f.value, f.width)
+			}
+			fields = append(fields, fmt.Sprintf("%-*s", f.width, f.value))
+		}
+		fields = append(fields, row.SettlementDate, fmt.Sprintf("%09d", row.Executions))
+		for _, f := range []struct {
+			value  decimal.Decimal
+			width  int
+			signed bool
+		}{{row.BoughtQty, 15, false}, {row.BoughtValue, 18, false}, {row.SoldQty, 15, false}, {row.SoldValue, 18, false},
+			{row.NetQty, 15, true}, {row.NetCash, 18, true}} {
+			amount, err := fixedWidthAmount(f.value, f.width, f.signed)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %s", row.ClearingFirm, row.Symbol, err)
+			}
+			fields = append(fields, amount)
+		}
+		record(fields...)
+		bought, sold, cash = bought.Add(row.BoughtQty), sold.Add(row.SoldQty), cash.Add(row.NetCash)
+	}
+	fields := []string{"T", count}
+	for _, f := range []struct {
+		value  decimal.Decimal
+		width  int
+		signed bool
+	}{{bought, 15, false}, {sold, 15, false}, {cash, 18, true}} {
+		amount, err := fixedWidthAmount(f.value, f.width, f.signed)
+		if err != nil {
+			return nil, fmt.Errorf("trailer: %s", err)
+		}
+		fields = append(fields, amount)
+	}
+	record(fields...)
+	return buf.Bytes(), nil
+}
+
+// fixedWidthAmount writes value with two implied decimals over width characters,
+// the first of them its sign when signed.
+func fixedWidthAmount(value decimal.Decimal, width int, signed bool) (string, error) {
+	sign := ""
+	if signed {
+		sign, width = "+", width-1
+		if value.IsNegative() {
+			sign = "-"
+		}
+	} else if value.IsNegative() {
+		return "", fmt.Errorf("negative amount %s", value)
+	}
+	digits := value.Abs().Shift(2).Round(0).String()
+	if len(digits) > width {
+		return "", fmt.Errorf("amount %s overflows %d digits", value, width)
+	}
+	return sign + strings.Repeat("0", width-len(digits)) + digits, nil
+}
+
+// WriteClearingReport writes clearing.txt, the fixed-width clearing file, along with
+// clearing.csv/json and the breaks as clearing_breaks.csv/json, in dir/trading date.
+// Without a reconciliation, nil Breaks, the breaks files written at end of day are kept.
+func WriteClearingReport(dir string, report ClearingReport) error {
+	dateDir := filepath.Join(dir, report.TradingDate)
+	rows := make([][]string, 0, len(report.Rows))
+	for _, r := range report.Rows {
+		rows = append(rows, []string{r.ClearingFirm, r.Symbol, r.SettlementDate, strconv.Itoa(r.Executions),
+			r.BoughtQty.String(), r.BoughtValue.String(), r.SoldQty.String(), r.SoldValue.String(), r.NetQty.String(),
+			r.NetCash.String()})
+	}
+	err := writeReport(dateDir, "clearing", []string{"clearing_firm", "symbol", "settlement_date", "executions",
+		"bought_qty", "bought_value", "sold_qty", "sold_value", "net_qty", "net_cash"}, rows, nonNil(report.Rows))
+	if err != nil {
+		return err
+	}
+	if report.Breaks != nil {
+		breaks := make([][]string, 0, len(report.Breaks))
+		for _, b := range report.Breaks {
+			breaks = append(breaks, []string{b.ClearingFirm, b.Symbol, b.Field, b.Store.String(), b.Journal.String()})
+		}
+		err = writeReport(dateDir, "clearing_breaks", []string{"clearing_firm", "symbol", "field", "store", "journal"},
+			breaks, report.Breaks)
+		if err != nil {
+			return err
+		}
+	}
+	data, err := FixedWidthClearing(report)
+	if err != nil {
+		return fmt.Errorf("error writing the clearing file: %s", err)
+	}
+	return os.WriteFile(filepath.Join(dateDir, "clearing.txt"), data, 0o644)
+}
@@ -0,0 +1,176 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strings"
+	"testing"
+)
+
+func TestApplication_Clearing(t *testing.T) {
+	journal, err := OpenJournal(t.TempDir(), "20260305")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = journal.Close() })
+	days := 1
+	app := NewApplication(WithJournal(journal),
+		WithInstruments(Instruments{"DI1F25": {Symbol: "DI1F25", SettlementDays: &days}}),
+		WithSessions(Sessions{"A": {CompID: "A", Firm: "FIRMA", ClearingFirm: "CLR1"}, "B": {CompID: "B", Firm: "FIRMB"}}))
+	submit := func(clOrdID, sender, symbol string, side domain.OrderSide, price, qty int64) {
+		_, err := app.Submit(app.NewOrder(clOrdID, symbol, sender, "EX", side, enum.OrdType_LIMIT, decimal.NewFromInt(price),
+			decimal.NewFromInt(qty)))
+		require.NoError(t, err)
+	}
+	submit("s1", "A", "VALE3", domain.SELL, 10, 100)
+	submit("b1", "B", "VALE3", domain.BUY, 10, 30)
+	submit("b2", "C", "VALE3", domain.BUY, 10, 20)
+	submit("s2", "B", "DI1F25", domain.SELL, 5, 10)
+	submit("b3", "A", "DI1F25", domain.BUY, 5, 10)
+	submit("b4", "B", "VALE3", domain.BUY, 10, 5)
+	for _, trade := range app.Trades("VALE3") {
+		if trade.Quantity.Equal(decimal.NewFromInt(5)) {
+			_, err = app.BustTrade(trade.TradeID, "")
+			require.NoError(t, err)
+		}
+	}
+
+	rows := app.Clearing()
+	require.Len(t, rows, 5)
+	want := []struct {
+		firm, symbol, settles, boughtQty, boughtValue, soldQty, soldValue, netQty, netCash string
+		executions                                                                         int
+	}{
+		// a Thursday: T+1 settles on Friday, T+2 on Monday
+		{"C", "VALE3", "20260309", "20", "200", "0", "0", "20", "-200", 1},
+		{"CLR1", "DI1F25", "20260306", "10", "50", "0", "0", "10", "-50", 1},
+		{"CLR1", "VALE3", "20260309", "0", "0", "50", "500", "-50", "500", 2},
+		{"FIRMB", "DI1F25", "20260306", "0", "0", "10", "50", "-10", "50", 1},
+		{"FIRMB", "VALE3", "20260309", "30", "300", "0", "0", "30", "-300", 1},
+	}
+	for i, w := range want {
+		row := rows[i]
+		require.Equal(t, w.firm, row.ClearingFirm)
+		require.Equal(t, w.symbol, row.Symbol)
+		require.Equal(t, w.settles, row.SettlementDate)
+		require.Equal(t, w.executions, row.Executions)
+		for _, got := range [][2]string{{w.boughtQty, row.BoughtQty.String()}, {w.boughtValue, row.BoughtValue.String()},
+			{w.soldQty, row.SoldQty.String()}, {w.soldValue, row.SoldValue.String()}, {w.netQty, row.NetQty.String()},
+			{w.netCash, row.NetCash.String()}} {
+			require.Equal(t, got[0], got[1], "%s %s", w.firm, w.symbol)
+		}
+	}
+
+	// against a journal without executions, every figure that is not zero breaks
+	store := app.tradeStoreExecutions()
+	app.engineMu.Lock()
+	report := app.clearingReport("20260305", store, DayReport{})
+	app.engineMu.Unlock()
+	require.Len(t, report.Rows, 5)
+	require.Len(t, report.Breaks, 5*3)
+	first := report.Breaks[0]
+	require.Equal(t, [3]string{"C", "VALE3", "executions"}, [3]string{first.ClearingFirm, first.Symbol, first.Field})
+	require.Equal(t, "1", first.Store.String())
+	require.True(t, first.Journal.IsZero())
+
+	// the journal alone nets the same, and writing it again keeps the breaks of end of day
+	events, err := ReadJournal(JournalFileName(journal.dir, "20260305"))
+	require.NoError(t, err)
+	regenerated := JournalClearingReport(BuildDayReport("20260305", events, app.firm), app.sessions, nil, app.instruments)
+	require.Equal(t, rows, regenerated.Rows)
+	require.Nil(t, regenerated.Breaks)
+	dir := t.TempDir()
+	require.NoError(t, WriteClearingReport(dir, report))
+	require.NoError(t, WriteClearingReport(dir, regenerated))
+	breaks, err := os.ReadFile(filepath.Join(dir, "20260305", "clearing_breaks.csv"))
+	require.NoError(t, err)
+	require.Len(t, strings.Split(strings.TrimSpace(string(breaks)), "\n"), 1+5*3)
+}
+
+func TestReconcile(t *testing.T) {
+	row := NettingRow{ClearingFirm: "CLR1", Symbol: "VALE3", Executions: 2, BoughtQty: decimal.NewFromInt(10),
+		BoughtValue: decimal.NewFromInt(100)}
+	require.Empty(t, reconcile([]NettingRow{row}, []NettingRow{row}))
+	journal := row
+	journal.BoughtValue = decimal.NewFromInt(90)
+	breaks := reconcile([]NettingRow{row}, []NettingRow{journal})
+	require.Len(t, breaks, 1)
+	require.Equal(t, "bought_value", breaks[0].Field)
+	require.Equal(t, "100", breaks[0].Store.String())
+	require.Equal(t, "90", breaks[0].Journal.String())
+	breaks = reconcile(nil, []NettingRow{row})
+	require.Len(t, breaks, 3)
+	require.Equal(t, "executions", breaks[0].Field)
+	require.True(t, breaks[0].Store.IsZero())
+}
+
+func TestFixedWidthClearing(t *testing.T) {
+	report := ClearingReport{TradingDate: "20260305", Rows: []NettingRow{
+		{ClearingFirm: "CLR1", Symbol: "VALE3", SettlementDate: "20260309", Executions: 2,
+			BoughtQty: decimal.NewFromInt(30), BoughtValue: decimal.RequireFromString("301.5"),
+			SoldQty: decimal.NewFromInt(50), SoldValue: decimal.NewFromInt(500),
+			NetQty: decimal.NewFromInt(-20), NetCash: decimal.RequireFromString("198.5")},
+		{ClearingFirm: "FIRMB", Symbol: "VALE3", SettlementDate: "20260309", Executions: 1,
+			BoughtQty: decimal.NewFromInt(20), BoughtValue: decimal.NewFromInt(200),
+			SoldQty: decimal.Zero, SoldValue: decimal.Zero,
+			NetQty: decimal.NewFromInt(20), NetCash: decimal.NewFromInt(-200)},
+	}}
+	data, err := FixedWidthClearing(report)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 4)
+	for _, line := range lines {
+		require.Len(t, line, clearingRecordLength)
+	}
+	require.Equal(t, "H20260305000000002", strings.TrimRight(lines[0], " "))
+	require.Equal(t, "DCLR1        VALE3       20260309000000002"+
+		"000000000003000"+"000000000000030150"+"000000000005000"+"000000000000050000"+
+		"-00000000002000"+"+00000000000019850", strings.TrimRight(lines[1], " "))
+	require.Equal(t, "T000000002"+"000000000005000"+"000000000005000"+"-00000000000000150", strings.TrimRight(lines[3], " "))
+
+	report.Rows[0].ClearingFirm = "A VERY LONG FIRM"
+	_, err = FixedWidthClearing(report)
+	require.ErrorContains(t, err, "longer than 12 characters")
+}
+
+func TestFixedWidthAmount(t *testing.T) {
+	tests := []struct {
+		value  string
+		width  int
+		signed bool
+		want   string
+		err    string
+	}{
+		{"12.5", 8, false, "00001250", ""},
+		{"0.005", 4, false, "0001", ""},
+		{"-12.5", 8, true, "-0001250", ""},
+		{"0", 4, true, "+000", ""},
+		{"-1", 8, false, "", "negative amount -1"},
+		{"1000", 5, false, "", "overflows 5 digits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := fixedWidthAmount(decimal.RequireFromString(tt.value), tt.width, tt.signed)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestInstruments_settlementDate(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "instruments.json")
+	require.NoError(t, os.WriteFile(fileName, []byte(`{"instruments": [{"symbol": "CASH", "settlement_days": 0},
+		{"symbol": "DI1F25", "settlement_days": 1}, {"symbol": "VALE3"}]}`), 0o600))
+	instruments, err := LoadInstruments(fileName)
+	require.NoError(t, err)
+	// a Friday
+	for symbol, want := range map[string]string{"CASH": "20260306", "DI1F25": "20260309", "VALE3": "20260310", "PETR4": "20260310"} {
+		require.Equal(t, want, instruments.settlementDate(symbol, "20260306"), symbol)
+	}
+}
@@ -0,0 +1,448 @@
+package order_gateway
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strconv"
+	"time"
+)
+
+// ClosingPrice is the official close of a symbol: the last trade of the day that
+// stands, and the settlement price, the volume weighted average price of the day.
+type ClosingPrice struct {
+	Symbol     string          `json:"symbol"`
+	Open       decimal.Decimal `json:"open"`
+	High       decimal.Decimal `json:"high"`
+	Low        decimal.Decimal `json:"low"`
+	Close      decimal.Decimal `json:"close"`
+	Settlement decimal.Decimal `json:"settlement"`
+	Volume     decimal.Decimal `json:"volume"`
+	Notional   decimal.Decimal `json:"notional"`
+	Trades     int             `json:"trades"`
+}
+
+// ReportOrder is an order as the trading day left it.
+type ReportOrder struct {
+	Firm        string          `json:"firm"`
+	OrderID     string          `json:"order_id"`
+	ClOrdID     string          `json:"cl_ord_id"`
+	CompID      string          `json:"comp_id"`
+	Account     string          `json:"account"`
+	Symbol      string          `json:"symbol"`
+	Side        string          `json:"side"`
+	OrdType     string          `json:"ord_type"`
+	TimeInForce string          `json:"time_in_force"`
+	ExpireDate  string          `json:"expire_date,omitempty"`
+	Price       decimal.Decimal `json:"price"`
+	Quantity    decimal.Decimal `json:"quantity"`
+	ExecutedQty decimal.Decimal `json:"executed_qty"`
+	LeavesQty   decimal.Decimal `json:"leaves_qty"`
+	AvgPx       decimal.Decimal `json:"avg_px"`
+	// Status is open for the orders carried to the next trading date
+	Status string `json:"status"`
+}
+
+// ReportExecution is the side of a trade one order took, as it stands after busts and
+// corrections.
+type ReportExecution struct {
+	Firm    string `json:"firm"`
+	TradeID string `json:"trade_id"`
+	Symbol  string `json:"symbol"`
+	Side    string `json:"side"`
+	OrderID string `json:"order_id"`
+	ClOrdID string `json:"cl_ord_id"`
+	CompID  string `json:"comp_id"`
+	Account string `json:"account"`
+	// Liquidity is maker for the resting order and taker for the incoming one
+	Liquidity string          `json:"liquidity"`
+	Quantity  decimal.Decimal `json:"quantity"`
+	Price     decimal.Decimal `json:"price"`
+	Fee       decimal.Decimal `json:"fee"`
+	Status    TradeStatus     `json:"status"`
+	Time      time.Time       `json:"time"`
+}
+
+// ReportPosition is the position of an account a firm traded, marked to the close.
+type ReportPosition struct {
+	Firm          string          `json:"firm"`
+	Account       string          `json:"account"`
+	Symbol        string          `json:"symbol"`
+	LongQty       decimal.Decimal `json:"long_qty"`
+	ShortQty      decimal.Decimal `json:"short_qty"`
+	AvgCost       decimal.Decimal `json:"avg_cost"`
+	BoughtQty     decimal.Decimal `json:"bought_qty"`
+	SoldQty       decimal.Decimal `json:"sold_qty"`
+	RealizedPnL   decimal.Decimal `json:"realized_pnl"`
+	ClosePrice    decimal.Decimal `json:"close_price"`
+	UnrealizedPnL decimal.Decimal `json:"unrealized_pnl"`
+}
+
+// ReportFees sums up the fees of a firm's executions that stand.
+type ReportFees struct {
+	Firm        string          `json:"firm"`
+	Executions  int             `json:"executions"`
+	MakerVolume decimal.Decimal `json:"maker_volume"`
+	TakerVolume decimal.Decimal `json:"taker_volume"`
+	Fees        decimal.Decimal `json:"fees"`
+	Rebates     decimal.Decimal `json:"rebates"`
+	Net         decimal.Decimal `json:"net"`
+}
+
+// DayReport is what a trading date's journal comes to, sorted by firm where it applies.
+type DayReport struct {
+	TradingDate string
+	Prices      []ClosingPrice
+	Orders      []ReportOrder
+	Executions  []ReportExecution
+	Positions   []ReportPosition
+	Fees        []ReportFees
+}
+
+func sideName(side domain.OrderSide) string {
+	if side == domain.SELL {
+		return "sell"
+	}
+	return "buy"
+}
+
+func ordTypeName(ordType enum.OrdType) string {
+	if ordType == enum.OrdType_MARKET {
+		return "market"
+	}
+	return "limit"
+}
+
+func timeInForceName(timeInForce enum.TimeInForce) string {
+	switch timeInForce {
+	case enum.TimeInForce_GOOD_TILL_CANCEL:
+		return "gtc"
+	case enum.TimeInForce_GOOD_TILL_DATE:
+		return "gtd"
+	default:
+		return "day"
+	}
+}
+
+// orderStatusName names the state event left its order in.
+func orderStatusName(event ExecReportRequiredEvent) string {
+	switch eventOrdStatus(event) {
+	case enum.OrdStatus_EXPIRED:
+		return "expired"
+	case enum.OrdStatus_CANCELED:
+		return "canceled"
+	case enum.OrdStatus_REJECTED:
+		return "rejected"
+	case enum.OrdStatus_FILLED:
+		return "filled"
+	case enum.OrdStatus_DONE_FOR_DAY:
+		return "done for day"
+	default:
+		return "open"
+	}
+}
+
+// BuildDayReport builds the reports of tradingDate from the events of its journal.
+// firm is the firm of a CompID, empty when it has none, which then stands for itself.
+func BuildDayReport(tradingDate string, events []ExecReportRequiredEvent, firm func(compID string) string) DayReport {
+	firmOf := func(compID string) string {
+		if f := firm(compID); f != "" {
+			return f
+		}
+		return compID
+	}
+	type executionKey struct {
+		tradeID string
+		side    domain.OrderSide
+	}
+	lastEvents := make(map[string]ExecReportRequiredEvent)
+	executions := make(map[executionKey]*ReportExecution)
+	for _, event := range events {
+		order := event.Order
+		lastEvents[order.OrderID] = event
+		key := executionKey{tradeID: event.TradeID, side: order.Side}
+		switch event.Type {
+		case OrderEventTrade:
+			liquidity := "maker"
+			if event.Aggressor {
+				liquidity = "taker"
+			}
+			executions[key] = &ReportExecution{Firm: firmOf(order.SenderCompID), TradeID: event.TradeID, Symbol: order.Symbol,
+				Side: sideName(order.Side), OrderID: order.OrderID, ClOrdID: order.ClOrdID, CompID: order.SenderCompID,
+				Account: positionAccount(order.Account, order.SenderCompID), Liquidity: liquidity, Quantity: event.LastQty,
+				Price: event.LastPx, Fee: event.Fee, Status: TradeActive, Time: event.TransactTime}
+		case OrderEventTradeCanceled, OrderEventTradeCorrected:
+			execution, ok := executions[key]
+			if !ok {
+				continue
+			}
+			execution.Fee = event.Fee
+			execution.Status = TradeBusted
+			if event.Type == OrderEventTradeCorrected {
+				execution.Quantity, execution.Price = event.LastQty, event.LastPx
+				execution.Status = TradeCorrected
+			}
+		}
+	}
+
+	report := DayReport{TradingDate: tradingDate}
+	for _, event := range lastEvents {
+		order := event.Order
+		report.Orders = append(report.Orders, ReportOrder{Firm: firmOf(order.SenderCompID), OrderID: order.OrderID,
+			ClOrdID: order.ClOrdID, CompID: order.SenderCompID, Account: order.Account, Symbol: order.Symbol,
+			Side: sideName(order.Side), OrdType: ordTypeName(order.OrdType), TimeInForce: timeInForceName(order.TimeInForce),
+			ExpireDate: order.ExpireDate, Price: order.Price, Quantity: order.Quantity, ExecutedQty: order.ExecutedQuantity,
+			LeavesQty: order.LeavesQty, AvgPx: order.AvgPx(), Status: orderStatusName(event)})
+	}
+	slices.SortFunc(report.Orders, func(x, y ReportOrder) int {
+		return cmp.Or(cmp.Compare(x.Firm, y.Firm), cmp.Compare(x.OrderID, y.OrderID))
+	})
+	for _, execution := range executions {
+		report.Executions = append(report.Executions, *execution)
+	}
+	// trade IDs grow with time, so the executions replay in the order they happened
+	slices.SortFunc(report.Executions, func(x, y ReportExecution) int {
+		return cmp.Or(cmp.Compare(x.TradeID, y.TradeID), cmp.Compare(x.Side, y.Side))
+	})
+	report.Prices = closingPrices(report.Executions)
+	report.Positions = reportPositions(report.Executions, report.Prices)
+	report.Fees = reportFees(report.Executions)
+	slices.SortStableFunc(report.Executions, func(x, y ReportExecution) int {
+		return cmp.Compare(x.Firm, y.Firm)
+	})
+	return report
+}
+
+// closingPrices computes the prices of every symbol with a trade that stands, from its
+// executions in the order they happened.
+func closingPrices(executions []ReportExecution) []ClosingPrice {
+	bySymbol := make(map[string]*ClosingPrice)
+	for _, execution := range executions {
+		// the buy side stands for the trade
+		if execution.Status == TradeBusted || execution.Side != "buy" {
+			continue
+		}
+		p, ok := bySymbol[execution.Symbol]
+		if !ok {
+			p = &ClosingPrice{Symbol: execution.Symbol, Open: execution.Price, High: execution.Price, Low: execution.Price,
+				Volume: decimal.Zero, Notional: decimal.Zero}
+			bySymbol[execution.Symbol] = p
+		}
+		p.High = decimal.Max(p.High, execution.Price)
+		p.Low = decimal.Min(p.Low, execution.Price)
+		p.Close = execution.Price
+		p.Volume = p.Volume.Add(execution.Quantity)
+		p.Notional = p.Notional.Add(execution.Quantity.Mul(execution.Price))
+		p.Trades++
+	}
+	prices := make([]ClosingPrice, 0, len(bySymbol))
+	for _, p := range bySymbol {
+		p.Settlement = p.Notional.Div(p.Volume).Round(2)
+		prices = append(prices, *p)
+	}
+	slices.SortFunc(prices, func(x, y ClosingPrice) int {
+		return cmp.Compare(x.Symbol, y.Symbol)
+	})
+	return prices
+}
+
+// reportPositions replays the executions that stand by firm, account and symbol.
+func reportPositions(executions []ReportExecution, prices []ClosingPrice) []ReportPosition {
+	type key struct {
+		firm string
+		positionKey
+	}
+	positions := make(map[key]*Position)
+	for _, execution := range executions {
+		if execution.Status == TradeBusted {
+			continue
+		}
+		k := key{firm: execution.Firm, positionKey: positionKey{account: execution.Account, symbol: execution.Symbol}}
+		p, ok := positions[k]
+		if !ok {
+			p = &Position{Account: execution.Account, Symbol: execution.Symbol, Quantity: decimal.Zero, AvgCost: decimal.Zero,
+				BoughtQty: decimal.Zero, SoldQty: decimal.Zero, RealizedPnL: decimal.Zero}
+			positions[k] = p
+		}
+		side := domain.BUY
+		if execution.Side == "sell" {
+			side = domain.SELL
+		}
+		p.apply(side, execution.Price, execution.Quantity)
+	}
+	closes := make(map[string]decimal.Decimal)
+	for _, price := range prices {
+		closes[price.Symbol] = price.Close
+	}
+	report := make([]ReportPosition, 0, len(positions))
+	for k, p := range positions {
+		closePrice := closes[p.Symbol]
+		report = append(report, ReportPosition{Firm: k.firm, Account: p.Account, Symbol: p.Symbol, LongQty: p.LongQty(),
+			ShortQty: p.ShortQty(), AvgCost: p.AvgCost, BoughtQty: p.BoughtQty, SoldQty: p.SoldQty, RealizedPnL: p.RealizedPnL,
+			ClosePrice: closePrice, UnrealizedPnL: closePrice.Sub(p.AvgCost).Mul(p.Quantity)})
+	}
+	slices.SortFunc(report, func(x, y ReportPosition) int {
+		return cmp.Or(cmp.Compare(x.Firm, y.Firm), cmp.Compare(x.Account, y.Account), cmp.Compare(x.Symbol, y.Symbol))
+	})
+	return report
+}
+
+// reportFees sums the fees of the executions that stand by firm.
+func reportFees(executions []ReportExecution) []ReportFees {
+	byFirm := make(map[string]*ReportFees)
+	for _, execution := range executions {
+		if execution.Status == TradeBusted {
+			continue
+		}
+		f, ok := byFirm[execution.Firm]
+		if !ok {
+			f = &ReportFees{Firm: execution.Firm, MakerVolume: decimal.Zero, TakerVolume: decimal.Zero, Fees: decimal.Zero,
+				Rebates: decimal.Zero}
+			byFirm[execution.Firm] = f
+		}
+		f.Executions++
+		notional := execution.Quantity.Mul(execution.Price)
+		if execution.Liquidity == "taker" {
+			f.TakerVolume = f.TakerVolume.Add(notional)
+		} else {
+			f.MakerVolume = f.MakerVolume.Add(notional)
+		}
+		if execution.Fee.IsNegative() {
+			f.Rebates = f.Rebates.Sub(execution.Fee)
+		} else {
+			f.Fees = f.Fees.Add(execution.Fee)
+		}
+	}
+	report := make([]ReportFees, 0, len(byFirm))
+	for _, f := range byFirm {
+		f.Net = f.Fees.Sub(f.Rebates)
+		report = append(report, *f)
+	}
+	slices.SortFunc(report, func(x, y ReportFees) int {
+		return cmp.Compare(x.Firm, y.Firm)
+	})
+	return report
+}
+
+// WriteDayReport writes report under dir, in a directory named after its trading date:
+// the closing prices of the exchange, and the orders, trades, positions and fees of
+// each firm in a directory of its own, each as CSV and JSON. It returns the directory
+// of the trading date.
+func WriteDayReport(dir string, report DayReport) (string, error) {
+	dateDir := filepath.Join(dir, report.TradingDate)
+	prices := make([][]string, 0, len(report.Prices))
+	for _, p := range report.Prices {
+		prices = append(prices, []string{p.Symbol, p.Open.String(), p.High.String(), p.Low.String(), p.Close.String(),
+			p.Settlement.String(), p.Volume.String(), p.Notional.String(), strconv.Itoa(p.Trades)})
+	}
+	err := writeReport(dateDir, "prices", []string{"symbol", "open", "high", "low", "close", "settlement", "volume", "notional",
+		"trades"}, prices, report.Prices)
+	if err != nil {
+		return "", err
+	}
+
+	firms := make([]string, 0)
+	orders := make(map[string][]ReportOrder)
+	for _, o := range report.Orders {
+		orders[o.Firm] = append(orders[o.Firm], o)
+		firms = append(firms, o.Firm)
+	}
+	executions := make(map[string][]ReportExecution)
+	for _, e := range report.Executions {
+		executions[e.Firm] = append(executions[e.Firm], e)
+		firms = append(firms, e.Firm)
+	}
+	positions := make(map[string][]ReportPosition)
+	for _, p := range report.Positions {
+		positions[p.Firm] = append(positions[p.Firm], p)
+	}
+	fees := make(map[string][]ReportFees)
+	for _, f := range report.Fees {
+		fees[f.Firm] = append(fees[f.Firm], f)
+	}
+	slices.Sort(firms)
+	for _, firm := range slices.Compact(firms) {
+		firmDir := filepath.Join(dateDir, url.PathEscape(firm))
+		rows := make([][]string, 0, len(orders[firm]))
+		for _, o := range orders[firm] {
+			rows = append(rows, []string{o.OrderID, o.ClOrdID, o.CompID, o.Account, o.Symbol, o.Side, o.OrdType, o.TimeInForce,
+				o.ExpireDate, o.Price.String(), o.Quantity.String(), o.ExecutedQty.String(), o.LeavesQty.String(), o.AvgPx.String(),
+				o.Status})
+		}
+		err = writeReport(firmDir, "orders", []string{"order_id", "cl_ord_id", "comp_id", "account", "symbol", "side", "ord_type",
+			"time_in_force", "expire_date", "price", "quantity", "executed_qty", "leaves_qty", "avg_px", "status"}, rows,
+			nonNil(orders[firm]))
+		if err != nil {
+			return "", err
+		}
+		rows = make([][]string, 0, len(executions[firm]))
+		for _, e := range executions[firm] {
+			rows = append(rows, []string{e.TradeID, e.Symbol, e.Side, e.OrderID, e.ClOrdID, e.CompID, e.Account, e.Liquidity,
+				e.Quantity.String(), e.Price.String(), e.Fee.String(), string(e.Status), e.Time.Format(time.RFC3339Nano)})
+		}
+		err = writeReport(firmDir, "trades", []string{"trade_id", "symbol", "side", "order_id", "cl_ord_id", "comp_id", "account",
+			"liquidity", "quantity", "price", "fee", "status", "time"}, rows, nonNil(executions[firm]))
+		if err != nil {
+			return "", err
+		}
+		rows = make([][]string, 0, len(positions[firm]))
+		for _, p := range positions[firm] {
+			rows = append(rows, []string{p.Account, p.Symbol, p.LongQty.String(), p.ShortQty.String(), p.AvgCost.String(),
+				p.BoughtQty.String(), p.SoldQty.String(), p.RealizedPnL.String(), p.ClosePrice.String(), p.UnrealizedPnL.String()})
+		}
+		err = writeReport(firmDir, "positions", []string{"account", "symbol", "long_qty", "short_qty", "avg_cost", "bought_qty",
+			"sold_qty", "realized_pnl", "close_price", "unrealized_pnl"}, rows, nonNil(positions[firm]))
+		if err != nil {
+			return "", err
+		}
+		rows = make([][]string, 0, len(fees[firm]))
+		for _, f := range fees[firm] {
+			rows = append(rows, []string{strconv.Itoa(f.Executions), f.MakerVolume.String(), f.TakerVolume.String(), f.Fees.String(),
+				f.Rebates.String(), f.Net.String()})
+		}
+		err = writeReport(firmDir, "fees", []string{"executions", "maker_volume", "taker_volume", "fees", "rebates", "net"}, rows,
+			nonNil(fees[firm]))
+		if err != nil {
+			return "", err
+		}
+	}
+	return dateDir, nil
+}
+
+// nonNil makes empty reports a JSON array rather than null.
+func nonNil[T any](rows []T) []T {
+	if rows == nil {
+		return []T{}
+	}
+	return rows
+}
+
+// writeReport writes name.csv with header and rows, and name.json with v, in dir.
+func writeReport(dir, name string, header []string, rows [][]string, v any) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("error creating %v, %v", dir, err)
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(header)
+	_ = w.WriteAll(rows)
+	err = os.WriteFile(filepath.Join(dir, name+".csv"), buf.Bytes(), 0o644)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".json"), append(data, '\n'), 0o644)
+}
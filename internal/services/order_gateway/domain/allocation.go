@@ -0,0 +1,250 @@
+package domain
+
+import (
+	"fmt"
+	"github.com/shopspring/decimal"
+	"slices"
+)
+
+// AllocationPolicy decides how an incoming quantity is split among the resting
+// orders of a single price level. The returned slice is aligned with resting and
+// never allocates more than an order's leaves quantity; when qty covers the
+// whole level every resting order is allocated in full.
+type AllocationPolicy interface {
+	Allocate(qty decimal.Decimal, resting []*Order) []decimal.Decimal
+}
+
+// FIFOAllocation fills resting orders strictly in time priority.
+type FIFOAllocation struct{}
+
+func (FIFOAllocation) Allocate(qty decimal.Decimal, resting []*Order) []decimal.Decimal {
+	allocations := zeroAllocations(len(resting))
+	remaining := qty
+	for i, o := range resting {
+		if !remaining.IsPositive() {
+			break
+		}
+		alloc := decimal.Min(remaining, o.LeavesQty())
+		allocations[i] = alloc
+		remaining = remaining.Sub(alloc)
+	}
+	return allocations
+}
+
+type ProRataRounding int
+
+const (
+	// RoundLeftoverByTime hands leftover lots, one at a time, to resting orders in time priority.
+	RoundLeftoverByTime ProRataRounding = 0
+	// RoundLeftoverBySize hands leftover lots, one at a time, to the largest resting orders first,
+	// breaking ties by time priority.
+	RoundLeftoverBySize ProRataRounding = 1
+)
+
+// ProRataAllocation splits the incoming quantity in proportion to each resting
+// order's leaves quantity. Shares are rounded down to LotSize and shares below
+// MinAllocation are dropped; the resulting leftover is then distributed lot by
+// lot according to Rounding so the level is always allocated deterministically.
+// Leftover lots never leave an order below MinAllocation either; when no order can be
+// lifted to it with what is left, the rest goes whole to the orders in time priority.
+type ProRataAllocation struct {
+	MinAllocation decimal.Decimal
+	LotSize       decimal.Decimal
+	Rounding      ProRataRounding
+}
+
+func (p ProRataAllocation) Allocate(qty decimal.Decimal, resting []*Order) []decimal.Decimal {
+	allocations := zeroAllocations(len(resting))
+	p.allocateInto(qty, resting, allocations)
+	return allocations
+}
+
+func (p ProRataAllocation) lotSize() decimal.Decimal {
+	if p.LotSize.IsPositive() {
+		return p.LotSize
+	}
+	return decimal.NewFromInt(1)
+}
+
+// allocateInto distributes qty over the leaves quantity still unallocated in allocations.
+func (p ProRataAllocation) allocateInto(qty decimal.Decimal, resting []*Order, allocations []decimal.Decimal) decimal.Decimal {
+	available := make([]decimal.Decimal, len(resting))
+	total := decimal.Zero
+	for i, o := range resting {
+		available[i] = o.LeavesQty().Sub(allocations[i])
+		total = total.Add(available[i])
+	}
+	if !qty.IsPositive() || !total.IsPositive() {
+		return qty
+	}
+	if qty.GreaterThanOrEqual(total) {
+		for i := range resting {
+			allocations[i] = allocations[i].Add(available[i])
+		}
+		return qty.Sub(total)
+	}
+	lot := p.lotSize()
+	allocated := decimal.Zero
+	// given is what this pass allocates each order, which MinAllocation applies to
+	given := zeroAllocations(len(resting))
+	for i := range resting {
+		share := qty.Mul(available[i]).Div(total).Div(lot).Floor().Mul(lot)
+		share = decimal.Min(share, available[i])
+		if share.LessThan(p.MinAllocation) {
+			share = decimal.Zero
+		}
+		given[i] = share
+		allocations[i] = allocations[i].Add(share)
+		available[i] = available[i].Sub(share)
+		allocated = allocated.Add(share)
+	}
+	order := p.leftoverOrder(available)
+	leftover := p.distributeLeftover(qty.Sub(allocated), order, available, given, allocations)
+	// only when no order can be lifted to the minimum is the rest handed out below it, for
+	// the level must not keep liquidity the incoming order could take. Spread lot by lot it
+	// would leave every order further below the minimum, so the oldest takes it all.
+	for i := range resting {
+		if !leftover.IsPositive() {
+			break
+		}
+		extra := decimal.Min(available[i], leftover)
+		allocations[i] = allocations[i].Add(extra)
+		available[i] = available[i].Sub(extra)
+		leftover = leftover.Sub(extra)
+	}
+	return leftover
+}
+
+// distributeLeftover hands leftover out lot by lot in order. An order short of
+// MinAllocation takes what it misses at once or nothing.
+func (p ProRataAllocation) distributeLeftover(leftover decimal.Decimal, order []int, available, given,
+	allocations []decimal.Decimal) decimal.Decimal {
+	lot := p.lotSize()
+	for leftover.IsPositive() {
+		progressed := false
+		for _, i := range order {
+			if !leftover.IsPositive() {
+				break
+			}
+			extra := decimal.Min(lot, available[i], leftover)
+			if short := p.MinAllocation.Sub(given[i]); short.GreaterThan(extra) {
+				extra = decimal.Min(short.Div(lot).Ceil().Mul(lot), available[i], leftover)
+				if given[i].Add(extra).LessThan(p.MinAllocation) {
+					continue
+				}
+			}
+			if !extra.IsPositive() {
+				continue
+			}
+			given[i] = given[i].Add(extra)
+			allocations[i] = allocations[i].Add(extra)
+			available[i] = available[i].Sub(extra)
+			leftover = leftover.Sub(extra)
+			progressed = true
+		}
+		if !progressed {
+			break
+		}
+	}
+	return leftover
+}
+
+func (p ProRataAllocation) leftoverOrder(available []decimal.Decimal) []int {
+	order := make([]int, len(available))
+	for i := range order {
+		order[i] = i
+	}
+	if p.Rounding == RoundLeftoverBySize {
+		slices.SortStableFunc(order, func(a, b int) int {
+			return available[b].Cmp(available[a])
+		})
+	}
+	return order
+}
+
+// TopOrderProRataAllocation gives the order at the top of the queue priority up to
+// TopOrderMax (zero means no cap), then allocates each lead market maker, keyed by
+// SenderCompID, its configured fraction of what is left, and finally splits the
+// remainder pro-rata among every order still open at the level.
+type TopOrderProRataAllocation struct {
+	TopOrderMax decimal.Decimal
+	LMMs        map[string]decimal.Decimal
+	ProRata     ProRataAllocation
+}
+
+func (h TopOrderProRataAllocation) Allocate(qty decimal.Decimal, resting []*Order) []decimal.Decimal {
+	allocations := zeroAllocations(len(resting))
+	remaining := qty
+	if len(resting) > 0 && remaining.IsPositive() {
+		top := decimal.Min(remaining, resting[0].LeavesQty())
+		if h.TopOrderMax.IsPositive() {
+			top = decimal.Min(top, h.TopOrderMax)
+		}
+		allocations[0] = top
+		remaining = remaining.Sub(top)
+	}
+	if remaining.IsPositive() && len(h.LMMs) > 0 {
+		lot := h.ProRata.lotSize()
+		base := remaining
+		for i, o := range resting {
+			share, ok := h.LMMs[o.senderCompID]
+			if !ok || !remaining.IsPositive() {
+				continue
+			}
+			alloc := base.Mul(share).Div(lot).Floor().Mul(lot)
+			alloc = decimal.Min(alloc, o.LeavesQty().Sub(allocations[i]), remaining)
+			allocations[i] = allocations[i].Add(alloc)
+			remaining = remaining.Sub(alloc)
+		}
+	}
+	h.ProRata.allocateInto(remaining, resting, allocations)
+	return allocations
+}
+
+func zeroAllocations(n int) []decimal.Decimal {
+	allocations := make([]decimal.Decimal, n)
+	for i := range allocations {
+		allocations[i] = decimal.Zero
+	}
+	return allocations
+}
+
+// AllocationConfig is the serializable description of an AllocationPolicy, used
+// by the per-instrument configuration.
+type AllocationConfig struct {
+	Algorithm     string                     `json:"algorithm"`
+	MinAllocation decimal.Decimal            `json:"min_allocation"`
+	LotSize       decimal.Decimal            `json:"lot_size"`
+	Rounding      string                     `json:"rounding"`
+	TopOrderMax   decimal.Decimal            `json:"top_order_max"`
+	LMMs          map[string]decimal.Decimal `json:"lmms"`
+}
+
+const (
+	AllocationFIFO            = "fifo"
+	AllocationProRata         = "pro_rata"
+	AllocationTopOrderProRata = "top_order_pro_rata"
+)
+
+func (c AllocationConfig) Policy() (AllocationPolicy, error) {
+	var rounding ProRataRounding
+	switch c.Rounding {
+	case "", "time":
+		rounding = RoundLeftoverByTime
+	case "size":
+		rounding = RoundLeftoverBySize
+	default:
+		return nil, fmt.Errorf("unknown pro-rata rounding rule %q", c.Rounding)
+	}
+	proRata := ProRataAllocation{MinAllocation: c.MinAllocation, LotSize: c.LotSize, Rounding: rounding}
+	switch c.Algorithm {
+	case "", AllocationFIFO:
+		return FIFOAllocation{}, nil
+	case AllocationProRata:
+		return proRata, nil
+	case AllocationTopOrderProRata:
+		return TopOrderProRataAllocation{TopOrderMax: c.TopOrderMax, LMMs: c.LMMs, ProRata: proRata}, nil
+	default:
+		return nil, fmt.Errorf("unknown allocation algorithm %q", c.Algorithm)
+	}
+}
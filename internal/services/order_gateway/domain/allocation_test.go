@@ -0,0 +1,219 @@
+package domain
+
+import (
+	"context"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+)
+
+func restingOrders(senders []string, qtys ...int64) []*Order {
+	px := decimal.NewFromInt(10)
+	orders := make([]*Order, 0, len(qtys))
+	for i, q := range qtys {
+		sender := "a"
+		if i < len(senders) {
+			sender = senders[i]
+		}
+		orders = append(orders, NewOrder(strconv.Itoa(i+1), "DI1F25", sender, "b",
+			SELL, enum.OrdType_LIMIT, px, decimal.NewFromInt(q), ""))
+	}
+	return orders
+}
+
+func requireAllocations(t *testing.T, got []decimal.Decimal, want ...int64) {
+	require.Len(t, got, len(want))
+	for i := range want {
+		require.Truef(t, got[i].Equal(decimal.NewFromInt(want[i])),
+			"allocation %d: got %s want %d (all: %v)", i, got[i], want[i], got)
+	}
+}
+
+func TestAllocationPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  AllocationPolicy
+		qty     int64
+		senders []string
+		resting []int64
+		want    []int64
+	}{
+		{
+			name:    "fifo fills in time priority",
+			policy:  FIFOAllocation{},
+			qty:     250,
+			resting: []int64{100, 100, 100},
+			want:    []int64{100, 100, 50},
+		},
+		{
+			name:    "pro-rata exact split",
+			policy:  ProRataAllocation{},
+			qty:     50,
+			resting: []int64{100, 300, 100},
+			want:    []int64{10, 30, 10},
+		},
+		{
+			name:    "pro-rata covers whole level",
+			policy:  ProRataAllocation{},
+			qty:     1000,
+			resting: []int64{100, 300, 100},
+			want:    []int64{100, 300, 100},
+		},
+		{
+			name:    "pro-rata leftover by time",
+			policy:  ProRataAllocation{Rounding: RoundLeftoverByTime},
+			qty:     10,
+			resting: []int64{10, 10, 10},
+			// 3.33 each floors to 3, leftover 1 goes to the oldest order
+			want: []int64{4, 3, 3},
+		},
+		{
+			name:    "pro-rata leftover by size",
+			policy:  ProRataAllocation{Rounding: RoundLeftoverBySize},
+			qty:     7,
+			resting: []int64{10, 20, 15},
+			// 1.55, 3.11, 2.33 floor to 1, 3, 2; leftover 1 goes to the largest order
+			want: []int64{1, 4, 2},
+		},
+		{
+			name:    "pro-rata leftover by size breaks ties by time",
+			policy:  ProRataAllocation{Rounding: RoundLeftoverBySize},
+			qty:     5,
+			resting: []int64{10, 20, 20},
+			// 1, 2, 2 exactly; no leftover
+			want: []int64{1, 2, 2},
+		},
+		{
+			name:    "pro-rata minimum allocation drops small shares",
+			policy:  ProRataAllocation{MinAllocation: decimal.NewFromInt(2), Rounding: RoundLeftoverBySize},
+			qty:     10,
+			resting: []int64{5, 90, 5},
+			// 0.5, 9, 0.5 floor to 0, 9, 0; leftover 1 goes to the largest order
+			want: []int64{0, 10, 0},
+		},
+		{
+			name:    "pro-rata leftover keeps the minimum allocation",
+			policy:  ProRataAllocation{MinAllocation: decimal.NewFromInt(3), Rounding: RoundLeftoverByTime},
+			qty:     5,
+			resting: []int64{10, 10, 2},
+			// 2.27, 2.27, 0.45 are all dropped; lot by lot would give 2, 2, 1, all below the
+			// minimum, so the oldest order is lifted to it and then takes the rest
+			want: []int64{5, 0, 0},
+		},
+		{
+			name:    "pro-rata leftover below any minimum still allocated",
+			policy:  ProRataAllocation{MinAllocation: decimal.NewFromInt(3), Rounding: RoundLeftoverByTime},
+			qty:     2,
+			resting: []int64{10, 10},
+			// no order can be lifted to the minimum, so the oldest takes what is left whole
+			want: []int64{2, 0},
+		},
+		{
+			name:    "pro-rata respects lot size",
+			policy:  ProRataAllocation{LotSize: decimal.NewFromInt(5)},
+			qty:     20,
+			resting: []int64{30, 30, 40},
+			// 6, 6, 8 floor to 5, 5, 5; leftover 5 goes to the oldest order
+			want: []int64{10, 5, 5},
+		},
+		{
+			name:    "pro-rata leftover capped by leaves",
+			policy:  ProRataAllocation{LotSize: decimal.NewFromInt(10)},
+			qty:     30,
+			resting: []int64{5, 45},
+			// 3, 27 floor to 0, 20; leftover 10 - first order can only take 5
+			want: []int64{5, 25},
+		},
+		{
+			name:    "top order priority then pro-rata",
+			policy:  TopOrderProRataAllocation{TopOrderMax: decimal.NewFromInt(10)},
+			qty:     40,
+			resting: []int64{50, 30, 30},
+			// top gets 10, remaining 30 split over 40, 30, 30
+			want: []int64{22, 9, 9},
+		},
+		{
+			name:    "top order uncapped",
+			policy:  TopOrderProRataAllocation{},
+			qty:     40,
+			resting: []int64{30, 30, 30},
+			want:    []int64{30, 5, 5},
+		},
+		{
+			name: "lmm priority then pro-rata",
+			policy: TopOrderProRataAllocation{
+				TopOrderMax: decimal.NewFromInt(1),
+				LMMs:        map[string]decimal.Decimal{"mm": decimal.NewFromFloat(0.4)},
+			},
+			qty:     51,
+			senders: []string{"a", "b", "mm"},
+			resting: []int64{20, 40, 40},
+			// top gets 1, mm gets 40% of 50 = 20, remaining 30 over 19, 40, 20
+			// floors to 7, 15, 7 and the leftover lot goes to the oldest order
+			want: []int64{9, 15, 27},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resting := restingOrders(tt.senders, tt.resting...)
+			got := tt.policy.Allocate(decimal.NewFromInt(tt.qty), resting)
+			requireAllocations(t, got, tt.want...)
+			total := decimal.Zero
+			for _, a := range got {
+				total = total.Add(a)
+			}
+			require.True(t, total.Equal(decimal.NewFromInt(tt.qty)) || tt.qty > sum(tt.resting))
+		})
+	}
+}
+
+func sum(qtys []int64) int64 {
+	var total int64
+	for _, q := range qtys {
+		total += q
+	}
+	return total
+}
+
+func TestOrderBook_MatchProRata(t *testing.T) {
+	px := decimal.NewFromInt(10)
+	book := NewOrderBookWithAllocation("DI1F25", ProRataAllocation{Rounding: RoundLeftoverByTime})
+	for i, q := range []int64{10, 10, 10} {
+		_, err := book.MatchOrAdd(context.Background(), NewOrder(strconv.Itoa(i+1), "DI1F25", "a", "b",
+			SELL, enum.OrdType_LIMIT, px, decimal.NewFromInt(q), ""))
+		require.NoError(t, err)
+	}
+	aggressor := NewOrder("4", "DI1F25", "c", "b", BUY, enum.OrdType_LIMIT, px, decimal.NewFromInt(10), "")
+	matches, err := book.MatchOrAdd(context.Background(), aggressor)
+	require.NoError(t, err)
+	require.Len(t, matches, 3)
+	require.True(t, matches[0].LeavesQty().Equal(decimal.NewFromInt(6)))
+	require.True(t, matches[1].LeavesQty().Equal(decimal.NewFromInt(7)))
+	require.True(t, matches[2].LeavesQty().Equal(decimal.NewFromInt(7)))
+	require.Equal(t, OrderStatus(OrderStatusFilled), aggressor.Status())
+	require.Len(t, aggressor.Executions(), 3)
+
+	sweep := NewOrder("5", "DI1F25", "c", "b", BUY, enum.OrdType_MARKET, decimal.Zero, decimal.NewFromInt(30), "")
+	matches, err = book.MatchOrAdd(context.Background(), sweep)
+	require.NoError(t, err)
+	require.Len(t, matches, 3)
+	require.True(t, sweep.LeavesQty().Equal(decimal.NewFromInt(10)))
+	require.Zero(t, book.askLevels.Len())
+}
+
+func TestAllocationConfig_Policy(t *testing.T) {
+	p, err := AllocationConfig{}.Policy()
+	require.NoError(t, err)
+	require.Equal(t, FIFOAllocation{}, p)
+
+	p, err = AllocationConfig{Algorithm: AllocationProRata, Rounding: "size"}.Policy()
+	require.NoError(t, err)
+	require.Equal(t, ProRataAllocation{Rounding: RoundLeftoverBySize}, p)
+
+	_, err = AllocationConfig{Algorithm: "lottery"}.Policy()
+	require.Error(t, err)
+	_, err = AllocationConfig{Algorithm: AllocationProRata, Rounding: "up"}.Policy()
+	require.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package domain
+
+import "github.com/shopspring/decimal"
+
+type BookEventType int
+
+const (
+	// BookEventAdd is an order coming to rest with Quantity.
+	BookEventAdd BookEventType = 1
+	// BookEventMatch is Quantity of the resting Order executed at Price against Aggressor.
+	BookEventMatch BookEventType = 2
+	// BookEventReduce is Quantity canceled from a resting order that keeps its priority.
+	BookEventReduce BookEventType = 3
+	// BookEventDelete is a resting order canceled.
+	BookEventDelete BookEventType = 4
+	// BookEventReplace is a resting order re-entered at the back of the queue with a new
+	// price and leaves quantity, after whatever it matched when re-entering.
+	BookEventReplace BookEventType = 5
+)
+
+// BookEvent is one change to the orders resting in a book. Order is a copy taken right
+// after the change.
+type BookEvent struct {
+	Type      BookEventType
+	Symbol    string
+	Order     OrderView
+	Aggressor OrderView
+	Quantity  decimal.Decimal
+	Price     decimal.Decimal
+}
+
+// BookListener is notified of every change of a book, in order and while the book
+// lock is held, so implementations must not block nor call back into the book.
+type BookListener interface {
+	OnBookEvent(event BookEvent)
+}
+
+// SetListener registers l for the changes of b, replacing any previous listener.
+func (b *OrderBook) SetListener(l BookListener) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listener = l
+}
+
+func (b *OrderBook) emit(event BookEvent) {
+	if b.listener == nil {
+		return
+	}
+	event.Symbol = b.symbol
+	b.listener.OnBookEvent(event)
+}
+
+// BookListenerFunc adapts a function to a BookListener.
+type BookListenerFunc func(event BookEvent)
+
+func (f BookListenerFunc) OnBookEvent(event BookEvent) {
+	f(event)
+}
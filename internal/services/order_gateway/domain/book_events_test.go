@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"context"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestOrderBook_Events(t *testing.T) {
+	book := NewOrderBook("VALE3")
+	var events []BookEvent
+	book.SetListener(BookListenerFunc(func(event BookEvent) {
+		events = append(events, event)
+	}))
+	limit := func(clOrdID string, side OrderSide, px string, qty int64) {
+		_, err := book.MatchOrAdd(context.Background(), NewOrder(clOrdID, "VALE3", "c", "b", side, enum.OrdType_LIMIT,
+			dec(t, px), decimal.NewFromInt(qty), "ORD"+clOrdID))
+		require.NoError(t, err)
+	}
+
+	limit("1", SELL, "10", 100)
+	limit("2", SELL, "11", 100)
+	limit("3", BUY, "10", 40)
+	_, err := book.Replace("c", "1", "1a", dec(t, "10"), decimal.NewFromInt(90))
+	require.NoError(t, err)
+	_, err = book.Replace("c", "2", "2a", dec(t, "9"), decimal.NewFromInt(100))
+	require.NoError(t, err)
+	limit("4", BUY, "9", 30)
+	_, err = book.Cancel("c", "1a")
+	require.NoError(t, err)
+
+	tests := []struct {
+		eventType BookEventType
+		orderID   string
+		quantity  int64
+	}{
+		{BookEventAdd, "ORD1", 100},
+		{BookEventAdd, "ORD2", 100},
+		{BookEventMatch, "ORD1", 40},
+		{BookEventReduce, "ORD1", 10},
+		{BookEventReplace, "ORD2", 100},
+		{BookEventMatch, "ORD2", 30},
+		{BookEventDelete, "ORD1", 50},
+	}
+	require.Len(t, events, len(tests))
+	for i, tt := range tests {
+		require.Equal(t, tt.eventType, events[i].Type, "event %d", i)
+		require.Equal(t, "VALE3", events[i].Symbol)
+		require.Equal(t, tt.orderID, events[i].Order.OrderID, "event %d", i)
+		require.True(t, events[i].Quantity.Equal(decimal.NewFromInt(tt.quantity)), "event %d", i)
+	}
+	require.Equal(t, "ORD3", events[2].Aggressor.OrderID)
+	require.True(t, events[2].Price.Equal(dec(t, "10")))
+}
@@ -0,0 +1,160 @@
+package domain
+
+import (
+	"github.com/shopspring/decimal"
+	"slices"
+)
+
+// DepthTracker keeps the aggregated (L2) depth of one book up to date from its
+// BookEvents, so that depth subscribers never walk the book on the matching path.
+// It is not safe for concurrent use.
+type DepthTracker struct {
+	symbol string
+	orders map[string]trackedOrder
+	bids   []PriceLevel
+	asks   []PriceLevel
+}
+
+// trackedOrder is what a resting order adds to its level.
+type trackedOrder struct {
+	side   OrderSide
+	price  decimal.Decimal
+	leaves decimal.Decimal
+}
+
+// DepthChange is the state of a price level after an event, a level without orders is gone.
+// Position is where the level is, or was, counting from the best price of its side.
+type DepthChange struct {
+	Side     OrderSide
+	Level    PriceLevel
+	Position int
+}
+
+func NewDepthTracker(symbol string) *DepthTracker {
+	return &DepthTracker{symbol: symbol, orders: make(map[string]trackedOrder)}
+}
+
+// Reset replaces the tracked depth with the resting orders of l3.
+func (t *DepthTracker) Reset(l3 OrderDepth) {
+	t.orders = make(map[string]trackedOrder)
+	t.bids, t.asks = nil, nil
+	for _, levels := range [][]OrderLevel{l3.Bids, l3.Asks} {
+		for _, level := range levels {
+			for _, order := range level.Orders {
+				t.add(order.OrderID, order.Side, level.Price, order.LeavesQty)
+			}
+		}
+	}
+}
+
+// Depth returns the top n levels of each side, or all of them when n is 0.
+func (t *DepthTracker) Depth(n int) Depth {
+	top := func(levels []PriceLevel) []PriceLevel {
+		if n > 0 && n < len(levels) {
+			levels = levels[:n]
+		}
+		return append(make([]PriceLevel, 0, len(levels)), levels...)
+	}
+	return Depth{Symbol: t.symbol, Bids: top(t.bids), Asks: top(t.asks)}
+}
+
+// Apply updates the depth with event and returns the levels it changed, in the order they changed.
+func (t *DepthTracker) Apply(event BookEvent) []DepthChange {
+	order := event.Order
+	var changes []DepthChange
+	switch event.Type {
+	case BookEventAdd:
+		changes = append(changes, t.add(order.OrderID, order.Side, order.Price, event.Quantity))
+	case BookEventMatch, BookEventReduce:
+		changes = append(changes, t.reduce(order.OrderID, event.Quantity)...)
+	case BookEventDelete:
+		changes = append(changes, t.remove(order.OrderID)...)
+	case BookEventReplace:
+		changes = append(changes, t.remove(order.OrderID)...)
+		if event.Quantity.IsPositive() {
+			changes = mergeDepthChanges(changes, t.add(order.OrderID, order.Side, order.Price, event.Quantity))
+		}
+	}
+	return changes
+}
+
+// mergeDepthChanges keeps only the last state of a level changed twice by one event.
+func mergeDepthChanges(changes []DepthChange, change DepthChange) []DepthChange {
+	for i, c := range changes {
+		if c.Side == change.Side && c.Level.Price.Equal(change.Level.Price) {
+			changes[i] = change
+			return changes
+		}
+	}
+	return append(changes, change)
+}
+
+func (t *DepthTracker) levels(side OrderSide) *[]PriceLevel {
+	if side == BUY {
+		return &t.bids
+	}
+	return &t.asks
+}
+
+// find returns where px is, or would be, on side.
+func (t *DepthTracker) find(side OrderSide, px decimal.Decimal) (int, bool) {
+	return slices.BinarySearchFunc(*t.levels(side), px, func(level PriceLevel, px decimal.Decimal) int {
+		if side == BUY {
+			return px.Cmp(level.Price)
+		}
+		return level.Price.Cmp(px)
+	})
+}
+
+func (t *DepthTracker) add(orderID string, side OrderSide, px, qty decimal.Decimal) DepthChange {
+	t.orders[orderID] = trackedOrder{side: side, price: px, leaves: qty}
+	levels := t.levels(side)
+	i, ok := t.find(side, px)
+	if !ok {
+		*levels = slices.Insert(*levels, i, PriceLevel{Price: px, Quantity: decimal.Zero})
+	}
+	level := &(*levels)[i]
+	level.Quantity = level.Quantity.Add(qty)
+	level.Orders++
+	return DepthChange{Side: side, Level: *level, Position: i}
+}
+
+// reduce takes qty off a resting order, which leaves its level once nothing is left of it.
+func (t *DepthTracker) reduce(orderID string, qty decimal.Decimal) []DepthChange {
+	order, ok := t.orders[orderID]
+	if !ok {
+		return nil
+	}
+	order.leaves = order.leaves.Sub(qty)
+	if !order.leaves.IsPositive() {
+		return t.remove(orderID)
+	}
+	t.orders[orderID] = order
+	return []DepthChange{t.update(order.side, order.price, qty.Neg(), 0)}
+}
+
+func (t *DepthTracker) remove(orderID string) []DepthChange {
+	order, ok := t.orders[orderID]
+	if !ok {
+		return nil
+	}
+	delete(t.orders, orderID)
+	return []DepthChange{t.update(order.side, order.price, order.leaves.Neg(), -1)}
+}
+
+func (t *DepthTracker) update(side OrderSide, px, qty decimal.Decimal, orders int) DepthChange {
+	levels := t.levels(side)
+	i, ok := t.find(side, px)
+	if !ok {
+		return DepthChange{Side: side, Level: PriceLevel{Price: px, Quantity: decimal.Zero}, Position: i}
+	}
+	level := &(*levels)[i]
+	level.Quantity = level.Quantity.Add(qty)
+	level.Orders += orders
+	change := DepthChange{Side: side, Level: *level, Position: i}
+	if level.Orders <= 0 {
+		change.Level.Quantity, change.Level.Orders = decimal.Zero, 0
+		*levels = slices.Delete(*levels, i, i+1)
+	}
+	return change
+}
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDepthTracker_FollowsTheBook(t *testing.T) {
+	book := NewOrderBook("VALE3")
+	limit := func(clOrdID string, side OrderSide, px string, qty int64) {
+		_, err := book.MatchOrAdd(context.Background(), NewOrder(clOrdID, "VALE3", "c", "b", side, enum.OrdType_LIMIT,
+			dec(t, px), decimal.NewFromInt(qty), "ORD"+clOrdID))
+		require.NoError(t, err)
+	}
+	limit("1", SELL, "10", 100)
+	limit("2", SELL, "10", 50)
+
+	// a tracker started on a book with resting orders is reset from its L3 view
+	tracker := NewDepthTracker("VALE3")
+	tracker.Reset(book.L3())
+	var changes []DepthChange
+	book.SetListener(BookListenerFunc(func(event BookEvent) {
+		changes = append(changes, tracker.Apply(event)...)
+	}))
+	requireSameDepth := func(step string) {
+		require.Equal(t, levelsString(book.Depth(0)), levelsString(tracker.Depth(0)), step)
+	}
+	requireSameDepth("reset")
+
+	steps := []struct {
+		name string
+		do   func()
+	}{
+		{"add", func() { limit("3", SELL, "11", 30) }},
+		{"partial fill", func() { limit("4", BUY, "10", 40) }},
+		{"sweep", func() { limit("5", BUY, "11", 150) }},
+		{"rest", func() { limit("6", BUY, "9", 70) }},
+		{"reduce", func() {
+			_, err := book.Replace("c", "6", "6a", dec(t, "9"), decimal.NewFromInt(60))
+			require.NoError(t, err)
+		}},
+		{"replace to a new price", func() {
+			_, err := book.Replace("c", "6a", "6b", dec(t, "8"), decimal.NewFromInt(60))
+			require.NoError(t, err)
+		}},
+		{"aggressive replace", func() {
+			limit("7", SELL, "12", 20)
+			_, err := book.Replace("c", "6b", "6c", dec(t, "12"), decimal.NewFromInt(30))
+			require.NoError(t, err)
+		}},
+		{"delete", func() {
+			_, err := book.Cancel("c", "6c")
+			require.NoError(t, err)
+		}},
+	}
+	for _, step := range steps {
+		changes = nil
+		step.do()
+		requireSameDepth(step.name)
+		require.NotEmpty(t, changes, step.name)
+	}
+	require.Len(t, tracker.orders, 1, "the rest of order 5")
+
+	// the last step removed the bid left of the replaced order
+	require.Len(t, changes, 1)
+	require.Equal(t, BUY, changes[0].Side)
+	require.Equal(t, "12", changes[0].Level.Price.String())
+	require.True(t, changes[0].Level.Quantity.IsZero())
+	require.Zero(t, changes[0].Level.Orders)
+}
+
+func levelsString(depth Depth) string {
+	s := depth.Symbol
+	for _, side := range [][]PriceLevel{depth.Bids, depth.Asks} {
+		s += " |"
+		for _, level := range side {
+			s += fmt.Sprintf(" %s:%s/%d", level.Price, level.Quantity, level.Orders)
+		}
+	}
+	return s
+}
+
+func TestDepthTracker_Depth(t *testing.T) {
+	tracker := NewDepthTracker("VALE3")
+	for i, px := range []string{"10", "12", "11"} {
+		change := tracker.Apply(BookEvent{Type: BookEventAdd, Order: OrderView{OrderID: px, Side: BUY, Price: dec(t, px)},
+			Quantity: decimal.NewFromInt(10)})
+		require.Len(t, change, 1)
+		require.Equal(t, []int{0, 0, 1}[i], change[0].Position)
+	}
+	depth := tracker.Depth(2)
+	require.Len(t, depth.Bids, 2)
+	require.Equal(t, "12", depth.Bids[0].Price.String())
+	require.Equal(t, "11", depth.Bids[1].Price.String())
+	// the copy is not changed by later events
+	tracker.Apply(BookEvent{Type: BookEventDelete, Order: OrderView{OrderID: "12"}})
+	require.Equal(t, "12", depth.Bids[0].Price.String())
+	require.Len(t, tracker.Depth(0).Bids, 2)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/quickfixgo/enum"
 	"github.com/shopspring/decimal"
+	"slices"
 	"time"
 )
 
@@ -42,11 +43,34 @@ func (o OrderExecution) IsFill() bool {
 	return o.isFill
 }
 
+// EntryProtocol is the gateway an order was entered through.
+type EntryProtocol string
+
+const (
+	EntryFIX  EntryProtocol = "FIX"
+	EntryREST EntryProtocol = "REST"
+	EntryGRPC EntryProtocol = "GRPC"
+	EntryOUCH EntryProtocol = "OUCH"
+)
+
+// Party is an entry of the PartyIDs group of an order: who acts on it, and as what.
+type Party struct {
+	ID     string
+	Source enum.PartyIDSource
+	Role   enum.PartyRole
+}
+
 type Order struct {
 	clOrdID          string
 	symbol           string
 	senderCompID     string
 	targetCompID     string
+	account          string
+	orderCapacity    enum.OrderCapacity
+	parties          []Party
+	entryProtocol    EntryProtocol
+	timeInForce      enum.TimeInForce
+	expireDate       string
 	side             OrderSide
 	ordType          enum.OrdType
 	price            decimal.Decimal
@@ -60,6 +84,10 @@ type Order struct {
 	status           OrderStatus
 	executions       []*OrderExecution
 	orderId          string
+	// intrusive links into the book level queue the order rests on
+	level *bookLevel
+	prev  *Order
+	next  *Order
 }
 
 func (o *Order) Executions() []*OrderExecution {
@@ -82,6 +110,59 @@ func (o *Order) TargetCompID() string {
 	return o.targetCompID
 }
 
+func (o *Order) Account() string {
+	return o.account
+}
+
+// SetAccount books the order to account; it must be called before the order is submitted.
+func (o *Order) SetAccount(account string) {
+	o.account = account
+}
+
+// OrderCapacity is whether the order is sent as agent, principal or otherwise, empty
+// when unstated.
+func (o *Order) OrderCapacity() enum.OrderCapacity {
+	return o.orderCapacity
+}
+
+func (o *Order) Parties() []Party {
+	return o.parties
+}
+
+// SetParties states the capacity of the order and the parties acting on it; it must be
+// called before the order is submitted.
+func (o *Order) SetParties(orderCapacity enum.OrderCapacity, parties []Party) {
+	o.orderCapacity = orderCapacity
+	o.parties = parties
+}
+
+// EntryProtocol is the gateway the order was entered through, empty when unstated.
+func (o *Order) EntryProtocol() EntryProtocol {
+	return o.entryProtocol
+}
+
+// SetEntryProtocol states the gateway the order was entered through; it must be called
+// before the order is submitted.
+func (o *Order) SetEntryProtocol(entryProtocol EntryProtocol) {
+	o.entryProtocol = entryProtocol
+}
+
+func (o *Order) TimeInForce() enum.TimeInForce {
+	return o.timeInForce
+}
+
+// ExpireDate is the trading date, as YYYYMMDD, at the end of which a GTD order expires.
+func (o *Order) ExpireDate() string {
+	return o.expireDate
+}
+
+// SetTimeInForce makes the order DAY, GTC or GTD until expireDate; it must be called
+// before the order is submitted. Orders are DAY by default.
+func (o *Order) SetTimeInForce(timeInForce enum.TimeInForce, expireDate string) {
+	o.timeInForce = timeInForce
+	o.expireDate = expireDate
+}
+
 func (o *Order) Side() OrderSide {
 	return o.side
 }
@@ -141,6 +222,7 @@ func NewOrder(clOrdID string,
 		symbol:           symbol,
 		senderCompID:     senderCompID,
 		targetCompID:     targetCompID,
+		timeInForce:      enum.TimeInForce_DAY,
 		side:             side,
 		ordType:          ordType,
 		price:            price,
@@ -186,10 +268,109 @@ func (o *Order) Execute(price, quantity decimal.Decimal) error {
 	return nil
 }
 
+// AdjustExecution restates execution i of the order as quantity at price, a zero
+// quantity busting it. What a bust or a smaller correction takes off the executed
+// quantity is not put back to work.
+func (o *Order) AdjustExecution(i int, price, quantity decimal.Decimal) error {
+	if err := o.CheckAdjustment(i, quantity); err != nil {
+		return err
+	}
+	execution := o.executions[i]
+	o.executedQuantity = o.executedQuantity.Sub(execution.quantity).Add(quantity)
+	o.executedNotional = o.executedNotional.Sub(execution.quantity.Mul(execution.price)).Add(quantity.Mul(price))
+	execution.quantity, execution.price = quantity, price
+	return nil
+}
+
+// CheckAdjustment tells why execution i of the order cannot be restated as quantity,
+// nil when AdjustExecution can.
+func (o *Order) CheckAdjustment(i int, quantity decimal.Decimal) error {
+	if i < 0 || i >= len(o.executions) {
+		return fmt.Errorf("order %s has no execution %d", o.orderId, i)
+	}
+	if execution := o.executions[i]; quantity.IsNegative() || quantity.GreaterThan(execution.quantity) {
+		return fmt.Errorf("execution of %s cannot become %s", execution.quantity, quantity)
+	}
+	return nil
+}
+
+// RestoreOrder rebuilds an order as view left it, such as from a journal after a
+// restart. Its executions are known by their totals until RestoreExecution gives
+// them back.
+func RestoreOrder(view OrderView) *Order {
+	return &Order{
+		clOrdID:          view.ClOrdID,
+		symbol:           view.Symbol,
+		senderCompID:     view.SenderCompID,
+		targetCompID:     view.TargetCompID,
+		account:          view.Account,
+		orderCapacity:    view.OrderCapacity,
+		parties:          slices.Clone(view.Parties),
+		entryProtocol:    view.EntryProtocol,
+		timeInForce:      view.TimeInForce,
+		expireDate:       view.ExpireDate,
+		side:             view.Side,
+		ordType:          view.OrdType,
+		price:            view.Price,
+		quantity:         view.Quantity,
+		executedQuantity: view.ExecutedQuantity,
+		leavesQty:        view.LeavesQty,
+		executedNotional: view.ExecutedNotional,
+		createdAt:        view.CreatedAt,
+		status:           view.Status,
+		executions:       make([]*OrderExecution, 0),
+		orderId:          view.OrderID,
+	}
+}
+
+// RestoreExecution gives a restored order back an execution of quantity at price, which
+// the totals it was restored with already count.
+func (o *Order) RestoreExecution(price, quantity decimal.Decimal) {
+	o.executions = append(o.executions, &OrderExecution{quantity: quantity, price: price})
+}
+
 func (o *Order) Cancel() {
 	o.status = OrderStatusCanceled
 }
 
+// amend renames the order and changes its price and total quantity, keeping what was executed.
+func (o *Order) amend(clOrdID string, price, quantity decimal.Decimal) {
+	o.clOrdID = clOrdID
+	o.price = price
+	o.quantity = quantity
+	o.leavesQty = quantity.Sub(o.executedQuantity)
+}
+
+func (o *Order) Reject() {
+	o.status = OrderStatusRejected
+}
+
+// View copies the current state of the order.
+func (o *Order) View() OrderView {
+	return OrderView{
+		OrderID:          o.orderId,
+		ClOrdID:          o.clOrdID,
+		Symbol:           o.symbol,
+		SenderCompID:     o.senderCompID,
+		TargetCompID:     o.targetCompID,
+		Account:          o.account,
+		OrderCapacity:    o.orderCapacity,
+		Parties:          slices.Clone(o.parties),
+		EntryProtocol:    o.entryProtocol,
+		TimeInForce:      o.timeInForce,
+		ExpireDate:       o.expireDate,
+		Side:             o.side,
+		OrdType:          o.ordType,
+		Price:            o.price,
+		Quantity:         o.quantity,
+		LeavesQty:        o.leavesQty,
+		ExecutedQuantity: o.executedQuantity,
+		ExecutedNotional: o.executedNotional,
+		Status:           o.status,
+		CreatedAt:        o.createdAt,
+	}
+}
+
 func (o *Order) OrderID() string {
 	return o.orderId
 }
@@ -5,32 +5,65 @@ import (
 	"fmt"
 	"github.com/quickfixgo/enum"
 	"github.com/shopspring/decimal"
-	"slices"
+	"sync"
 )
 
+// OrderBook is safe for concurrent use: matching and cancels take the write lock,
+// while the query API (see order_book_query.go) reads consistent snapshots under the read lock.
 type OrderBook struct {
-	symbol    string
-	askLevels []*bookLevel
-	bidLevels []*bookLevel
+	mu         sync.RWMutex
+	symbol     string
+	askLevels  *priceLevels
+	bidLevels  *priceLevels
+	orders     map[orderKey]*Order
+	ordersByID map[string]*Order
+	allocation AllocationPolicy
+	listener   BookListener
+}
+
+// orderKey identifies a resting order by the session that sent it and its ClOrdID.
+type orderKey struct {
+	senderCompID string
+	clOrdID      string
 }
 
 func NewOrderBook(symbol string) *OrderBook {
+	return NewOrderBookWithAllocation(symbol, FIFOAllocation{})
+}
+
+// NewOrderBookWithAllocation creates a book whose price levels are allocated with policy.
+func NewOrderBookWithAllocation(symbol string, policy AllocationPolicy) *OrderBook {
 	return &OrderBook{
-		symbol:    symbol,
-		askLevels: make([]*bookLevel, 0),
-		bidLevels: make([]*bookLevel, 0),
+		symbol:     symbol,
+		askLevels:  newAskLevels(),
+		bidLevels:  newBidLevels(),
+		orders:     make(map[orderKey]*Order),
+		ordersByID: make(map[string]*Order),
+		allocation: policy,
 	}
 }
 
+func (b *OrderBook) allocationPolicy() AllocationPolicy {
+	if b.allocation == nil {
+		return FIFOAllocation{}
+	}
+	return b.allocation
+}
+
+// bookLevel is the time-priority queue of a single price, kept as an intrusive
+// doubly linked list through the orders so removals anywhere are O(1).
+// Canceled orders stay linked until FIFO matching reaches them or the level is
+// compacted, see OrderBook.Cancel.
 type bookLevel struct {
-	orders                   []*Order
-	px                       decimal.Decimal
-	sessionAndClOrdIDtoOrder map[string]map[string]*Order
+	px       decimal.Decimal
+	head     *Order
+	tail     *Order
+	count    int
+	canceled int
 }
 
 func newBookLevel(orders []*Order, px decimal.Decimal) *bookLevel {
-	sessionAndClOrdIDtoIndexMap := make(map[string]map[string]*Order)
-	level := bookLevel{px: px, sessionAndClOrdIDtoOrder: sessionAndClOrdIDtoIndexMap}
+	level := bookLevel{px: px}
 	for _, order := range orders {
 		err := level.Add(order)
 		if err != nil {
@@ -41,158 +74,282 @@ func newBookLevel(orders []*Order, px decimal.Decimal) *bookLevel {
 }
 
 func (l *bookLevel) IsEmpty() bool {
-	return len(l.orders) == 0
+	return l.count == 0
 }
 func (l *bookLevel) Price() decimal.Decimal {
 	return l.px
 }
+func (l *bookLevel) Len() int {
+	return l.count
+}
+
+// hasLiveOrders reports whether any order in the queue can still trade.
+func (l *bookLevel) hasLiveOrders() bool {
+	return l.count > l.canceled
+}
+
+// Orders returns the queue in time priority.
+func (l *bookLevel) Orders() []*Order {
+	orders := make([]*Order, 0, l.count)
+	for o := l.head; o != nil; o = o.next {
+		orders = append(orders, o)
+	}
+	return orders
+}
 func (l *bookLevel) Add(o *Order) error {
-	sessionOrders, ok := l.sessionAndClOrdIDtoOrder[o.senderCompID]
-	if !ok {
-		sessionOrders = make(map[string]*Order)
-		l.sessionAndClOrdIDtoOrder[o.senderCompID] = sessionOrders
+	if o.level != nil {
+		return fmt.Errorf("order %s already exists", o.clOrdID)
 	}
-	if _, ok2 := sessionOrders[o.clOrdID]; !ok2 {
-		sessionOrders[o.clOrdID] = o
-		l.orders = append(l.orders, o)
-		return nil
+	o.level = l
+	o.prev = l.tail
+	o.next = nil
+	if l.tail != nil {
+		l.tail.next = o
 	} else {
-		return fmt.Errorf("order %s already exists", o.clOrdID)
+		l.head = o
 	}
+	l.tail = o
+	l.count++
+	return nil
 }
-func (l *bookLevel) Pop(clOrdID string) (*Order, error) {
-	//pop permanently removes the message from the queue, regardless of status
-	if len(l.orders) == 0 {
-		return nil, fmt.Errorf("cannot pop from empty book level")
+func (l *bookLevel) remove(o *Order) error {
+	//remove permanently takes the order out of the queue, wherever it sits
+	if o.level != l {
+		return fmt.Errorf("order %s-%s is not in book level", o.senderCompID, o.clOrdID)
 	}
-	o := l.orders[0]
-	if o.clOrdID != clOrdID {
-		return nil, fmt.Errorf("wrong clOrdID when poping from book level, exp %s, got %s", clOrdID, o.clOrdID)
+	if o.prev != nil {
+		o.prev.next = o.next
+	} else {
+		l.head = o.next
 	}
-	l.orders = l.orders[1:]
-	sessionOrders := l.sessionAndClOrdIDtoOrder[o.senderCompID]
-	delete(sessionOrders, o.clOrdID)
-	if len(sessionOrders) == 0 {
-		delete(l.sessionAndClOrdIDtoOrder, o.senderCompID)
+	if o.next != nil {
+		o.next.prev = o.prev
+	} else {
+		l.tail = o.prev
 	}
-	return o, nil
+	o.prev, o.next, o.level = nil, nil, nil
+	l.count--
+	if o.status == OrderStatusCanceled && l.canceled > 0 {
+		l.canceled--
+	}
+	return nil
+}
+
+// compact unlinks every order that can no longer trade and returns the live queue in time priority.
+func (l *bookLevel) compact() []*Order {
+	live := make([]*Order, 0, l.count-l.canceled)
+	for o := l.head; o != nil; {
+		next := o.next
+		if o.IsOpen() {
+			live = append(live, o)
+		} else {
+			_ = l.remove(o)
+		}
+		o = next
+	}
+	l.canceled = 0
+	return live
+}
+
+func (b *OrderBook) levelsFor(side OrderSide) *priceLevels {
+	if side == BUY {
+		return b.bidLevels
+	}
+	return b.askLevels
+}
+
+func (b *OrderBook) oppositeLevels(side OrderSide) *priceLevels {
+	if side == BUY {
+		return b.askLevels
+	}
+	return b.bidLevels
 }
-func (l *bookLevel) Cancel(o *Order) error {
-	//cancel just sets the order status to be garbage collected later
-	sessionOrders, ok := l.sessionAndClOrdIDtoOrder[o.senderCompID]
+
+func (b *OrderBook) Symbol() string {
+	return b.symbol
+}
+
+// Order looks up a resting order by the session that sent it and its ClOrdID.
+// It returns a snapshot, the order itself is only changed under the book lock.
+func (b *OrderBook) Order(senderCompID, clOrdID string) (OrderView, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	o, ok := b.order(senderCompID, clOrdID)
 	if !ok {
-		return fmt.Errorf("order %s-%s does not exists", o.senderCompID, o.clOrdID)
+		return OrderView{}, false
 	}
-	if ord, ok2 := sessionOrders[o.clOrdID]; !ok2 {
-		return fmt.Errorf("order %s-%s does not exists", o.senderCompID, o.clOrdID)
-	} else {
-		ord.status = OrderStatusCanceled
-		return nil
+	return o.View(), true
+}
+
+func (b *OrderBook) order(senderCompID, clOrdID string) (*Order, bool) {
+	o, ok := b.orders[orderKey{senderCompID: senderCompID, clOrdID: clOrdID}]
+	return o, ok
+}
+
+// OrderByID looks up a resting order by its exchange assigned OrderID and returns a snapshot of it.
+func (b *OrderBook) OrderByID(orderID string) (OrderView, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	o, ok := b.ordersByID[orderID]
+	if !ok {
+		return OrderView{}, false
 	}
+	return o.View(), true
+}
 
+// Cancel marks a resting order as canceled and takes it out of the order index.
+// The order stays linked in its level and is garbage collected lazily: the level is
+// compacted once canceled orders outnumber live ones, or when matching reaches it,
+// and it is pruned from the book as soon as it has no live orders left.
+func (b *OrderBook) Cancel(senderCompID, clOrdID string) (*Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.order(senderCompID, clOrdID)
+	if !ok || !o.IsOpen() {
+		return nil, fmt.Errorf("order %s-%s does not exists", senderCompID, clOrdID)
+	}
+	o.Cancel()
+	b.unindex(o)
+	b.emit(BookEvent{Type: BookEventDelete, Order: o.View(), Quantity: o.leavesQty})
+	level := o.level
+	if level == nil {
+		return o, nil
+	}
+	level.canceled++
+	if !level.hasLiveOrders() {
+		level.compact()
+		b.levelsFor(o.side).Delete(level.px)
+	} else if level.canceled > level.count/2 {
+		level.compact()
+	}
+	return o, nil
+}
+
+// Replace amends the price and quantity of a resting limit order and renames it to clOrdID.
+// Reducing the quantity at the same price keeps time priority; any other change
+// takes the order out of its queue and re-enters it, so it may match right away.
+func (b *OrderBook) Replace(senderCompID, origClOrdID, clOrdID string, price, quantity decimal.Decimal) ([]*Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.order(senderCompID, origClOrdID)
+	if !ok || !o.IsOpen() {
+		return nil, fmt.Errorf("order %s-%s does not exists", senderCompID, origClOrdID)
+	}
+	if _, exists := b.order(senderCompID, clOrdID); exists && clOrdID != origClOrdID {
+		return nil, fmt.Errorf("order %s already exists", clOrdID)
+	}
+	if !price.IsPositive() {
+		return nil, fmt.Errorf("replace price must be positive")
+	}
+	if quantity.LessThanOrEqual(o.executedQuantity) {
+		return nil, fmt.Errorf("replace quantity %s must exceed executed quantity %s", quantity, o.executedQuantity)
+	}
+	keepsPriority := price.Equal(o.price) && quantity.LessThanOrEqual(o.quantity)
+	b.unindex(o)
+	if keepsPriority {
+		reduced := o.quantity.Sub(quantity)
+		o.amend(clOrdID, price, quantity)
+		b.index(o)
+		if reduced.IsPositive() {
+			b.emit(BookEvent{Type: BookEventReduce, Order: o.View(), Quantity: reduced})
+		}
+		return []*Order{}, nil
+	}
+	level := o.level
+	err := level.remove(o)
+	if err != nil {
+		return nil, err
+	}
+	if !level.hasLiveOrders() {
+		level.compact()
+		b.levelsFor(o.side).Delete(level.px)
+	}
+	o.amend(clOrdID, price, quantity)
+	matches, err := b.matchLimitOrder(o)
+	if err != nil {
+		return matches, err
+	}
+	b.emit(BookEvent{Type: BookEventReplace, Order: o.View(), Quantity: o.leavesQty})
+	return matches, nil
+}
+
+func (b *OrderBook) index(o *Order) {
+	b.orders[orderKey{senderCompID: o.senderCompID, clOrdID: o.clOrdID}] = o
+	if o.orderId != "" {
+		b.ordersByID[o.orderId] = o
+	}
+}
+
+func (b *OrderBook) unindex(o *Order) {
+	delete(b.orders, orderKey{senderCompID: o.senderCompID, clOrdID: o.clOrdID})
+	if o.orderId != "" {
+		delete(b.ordersByID, o.orderId)
+	}
 }
 
 func (b *OrderBook) MatchOrAdd(ctx context.Context, order *Order) ([]*Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	switch order.ordType {
 	case enum.OrdType_MARKET:
 		return b.matchMarketOrder(order)
 	case enum.OrdType_LIMIT:
-		return b.matchLimitOrder(order)
+		matches, err := b.matchLimitOrder(order)
+		if order.level != nil {
+			b.emit(BookEvent{Type: BookEventAdd, Order: order.View(), Quantity: order.leavesQty})
+		}
+		return matches, err
 	default:
 		return nil, fmt.Errorf("order type %s is not supported", order.ordType)
 	}
 }
 
+// Restore rests an open limit order at the back of its level without matching it,
+// rebuilding the book in time priority from orders restored in that order.
+func (b *OrderBook) Restore(order *Order) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if order.ordType != enum.OrdType_LIMIT || !order.IsOpen() {
+		return fmt.Errorf("order %s cannot rest on the book", order.orderId)
+	}
+	err := b.add(order)
+	if err != nil {
+		return err
+	}
+	b.emit(BookEvent{Type: BookEventAdd, Order: order.View(), Quantity: order.leavesQty})
+	return nil
+}
+
 func (b *OrderBook) matchMarketOrder(order *Order) ([]*Order, error) {
-	matches := make([]*Order, 0)
-	if order.side == BUY {
-		if len(b.askLevels) == 0 {
+	levels := b.oppositeLevels(order.side)
+	if levels.Len() == 0 {
+		if order.side == BUY {
 			return nil, fmt.Errorf("no sell side orders to match market order")
 		}
-		for len(b.askLevels) > 0 {
-			level := b.askLevels[0]
-			levelMatches, err := matchLevel(order, level)
-			if err != nil {
-				return nil, err
-			}
-			matches = append(matches, levelMatches...)
-			if level.IsEmpty() {
-				b.askLevels = b.askLevels[1:]
-			}
-			if order.Status() == OrderStatusFilled {
-				break
-			}
-
-		}
-	} else {
-		if len(b.bidLevels) == 0 {
-			return nil, fmt.Errorf("no buy side orders to match market order")
-		}
-		for len(b.bidLevels) > 0 {
-			level := b.bidLevels[0]
-			levelMatches, err := matchLevel(order, level)
-			if err != nil {
-				return nil, err
-			}
-			matches = append(matches, levelMatches...)
-			if level.IsEmpty() {
-				b.bidLevels = b.bidLevels[1:]
-			}
-			if order.Status() == OrderStatusFilled {
-				break
-			}
-
-		}
+		return nil, fmt.Errorf("no buy side orders to match market order")
+	}
+	matches, err := b.sweep(order, levels, func(px decimal.Decimal) bool {
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
 	return matches, nil
 }
 
 func (b *OrderBook) matchLimitOrder(order *Order) ([]*Order, error) {
 	limitPrice := order.price
-	matches := make([]*Order, 0)
-	if order.side == BUY {
-		for len(b.askLevels) > 0 {
-			level := b.askLevels[0]
-			levelPx := level.px
-			if levelPx.GreaterThan(limitPrice) {
-				break
-			}
-			levelMatches, err := matchLevel(order, level)
-			if err != nil {
-				return matches, err
-			}
-			matches = append(matches, levelMatches...)
-			if level.IsEmpty() {
-				b.askLevels = b.askLevels[1:]
-			}
-			if order.Status() == OrderStatusFilled {
-				break
-			}
-
-		}
-	} else {
-		for len(b.bidLevels) > 0 {
-			level := b.bidLevels[0]
-			levelPx := level.px
-			if levelPx.LessThan(limitPrice) {
-				break
-			}
-			levelMatches, err := matchLevel(order, level)
-			if err != nil {
-				return matches, err
-			}
-			matches = append(matches, levelMatches...)
-			if level.IsEmpty() {
-				b.bidLevels = b.bidLevels[1:]
-			}
-			if order.Status() == OrderStatusFilled {
-				break
-			}
-
+	matches, err := b.sweep(order, b.oppositeLevels(order.side), func(levelPx decimal.Decimal) bool {
+		if order.side == BUY {
+			return levelPx.LessThanOrEqual(limitPrice)
 		}
+		return levelPx.GreaterThanOrEqual(limitPrice)
+	})
+	if err != nil {
+		return matches, err
 	}
 	if order.Status() != OrderStatusFilled {
-		err := b.add(order)
+		err = b.add(order)
 		if err != nil {
 			return matches, err
 		}
@@ -200,152 +357,121 @@ func (b *OrderBook) matchLimitOrder(order *Order) ([]*Order, error) {
 	return matches, nil
 }
 
-func (b *OrderBook) add(order *Order) error {
-	px := order.price
-	var levels []*bookLevel
-	if order.side == BUY {
-		levels = b.bidLevels
-		for i := 0; i < len(levels); i++ {
-			level := levels[i]
-			if level.px.Equal(px) {
-				err := level.Add(order)
-				if err != nil {
-					return err
-				}
-				break
-			} else if level.px.LessThan(px) {
-				newLevel := newBookLevel([]*Order{}, px)
-				err := newLevel.Add(order)
-				if err != nil {
-					return err
-				}
-				levels = slices.Insert(levels, i, newLevel)
-				break
-			} else if i == len(levels)-1 {
-
-				newLevel := newBookLevel([]*Order{}, px)
-				err := newLevel.Add(order)
-				if err != nil {
-					return err
-				}
-				levels = append(levels, newLevel)
-				break
-			}
+// sweep matches order against levels from the best price while crosses accepts the level price.
+func (b *OrderBook) sweep(order *Order, levels *priceLevels, crosses func(px decimal.Decimal) bool) ([]*Order, error) {
+	matches := make([]*Order, 0)
+	for levels.Len() > 0 {
+		level := levels.Best()
+		if !crosses(level.px) {
+			break
 		}
-		if len(levels) == 0 {
-
-			newLevel := newBookLevel([]*Order{}, px)
-			err := newLevel.Add(order)
-			if err != nil {
-				return err
-			}
-			levels = append(levels, newLevel)
+		levelMatches, err := b.matchLevel(order, level)
+		if err != nil {
+			return matches, err
 		}
-		b.bidLevels = levels
-	} else {
-		levels = b.askLevels
-		for i := 0; i < len(levels); i++ {
-			level := levels[i]
-			if level.px.Equal(px) {
-				err := level.Add(order)
-				if err != nil {
-					return err
-				}
-				break
-			} else if level.px.GreaterThan(px) {
-				newLevel := newBookLevel([]*Order{}, px)
-				err := newLevel.Add(order)
-				if err != nil {
-					return err
-				}
-				levels = slices.Insert(levels, i, newLevel)
-				break
-			} else if i == len(levels)-1 {
-
-				newLevel := newBookLevel([]*Order{}, px)
-				err := newLevel.Add(order)
-				if err != nil {
-					return err
-				}
-				levels = append(levels, newLevel)
-				break
-			}
+		matches = append(matches, levelMatches...)
+		if level.IsEmpty() {
+			levels.Delete(level.px)
 		}
-		if len(levels) == 0 {
-
-			newLevel := newBookLevel([]*Order{}, px)
-			err := newLevel.Add(order)
-			if err != nil {
-				return err
-			}
-			levels = append(levels, newLevel)
+		if order.Status() == OrderStatusFilled {
+			break
 		}
-		b.askLevels = levels
 	}
+	return matches, nil
+}
 
+func (b *OrderBook) add(order *Order) error {
+	if _, ok := b.order(order.senderCompID, order.clOrdID); ok {
+		return fmt.Errorf("order %s already exists", order.clOrdID)
+	}
+	level := b.levelsFor(order.side).GetOrCreate(order.price)
+	err := level.Add(order)
+	if err != nil {
+		return err
+	}
+	b.index(order)
 	return nil
-
 }
 
-func matchLevel(order *Order, level *bookLevel) ([]*Order, error) {
+func (b *OrderBook) matchLevel(order *Order, level *bookLevel) ([]*Order, error) {
+	if _, ok := b.allocationPolicy().(FIFOAllocation); ok {
+		return b.matchLevelFIFO(order, level)
+	}
 	matches := make([]*Order, 0)
-	for len(level.orders) > 0 {
-		bookOrd := level.orders[0]
-		currentLeavesQty := order.LeavesQty()
-		currBookOrdLeaves := bookOrd.LeavesQty()
-		if currBookOrdLeaves.GreaterThanOrEqual(currentLeavesQty) {
-			err := order.Execute(bookOrd.Price(), currentLeavesQty)
-			if err != nil {
-				return matches, err
-			}
-			err = bookOrd.Execute(bookOrd.Price(), currentLeavesQty)
+	resting := level.compact()
+	allocations := b.allocationPolicy().Allocate(order.LeavesQty(), resting)
+	for i, bookOrd := range resting {
+		qty := allocations[i]
+		if !qty.IsPositive() {
+			continue
+		}
+		err := b.fill(order, bookOrd, qty)
+		if err != nil {
+			return matches, err
+		}
+		if bookOrd.Status() == OrderStatusFilled {
+			err = level.remove(bookOrd)
 			if err != nil {
 				return matches, err
 			}
-		} else {
-			err := bookOrd.Execute(bookOrd.Price(), currBookOrdLeaves)
+			b.unindex(bookOrd)
+		}
+		matches = append(matches, bookOrd)
+	}
+	if order.LeavesQty().IsPositive() && !level.IsEmpty() {
+		return matches, fmt.Errorf("allocation policy left level %s partially allocated", level.px)
+	}
+	return matches, nil
+}
 
-			if err != nil {
-				return matches, err
-			}
-			err = order.Execute(bookOrd.Price(), currBookOrdLeaves)
-			if err != nil {
+// matchLevelFIFO fills the level in time priority by walking its queue from the head,
+// unlinking canceled orders on the way, so matching touches only the orders it trades with.
+func (b *OrderBook) matchLevelFIFO(order *Order, level *bookLevel) ([]*Order, error) {
+	matches := make([]*Order, 0)
+	for bookOrd := level.head; bookOrd != nil && order.LeavesQty().IsPositive(); bookOrd = level.head {
+		if !bookOrd.IsOpen() {
+			if err := level.remove(bookOrd); err != nil {
 				return matches, err
 			}
+			continue
 		}
-		if bookOrd.Status() == OrderStatusFilled {
-			_, err := level.Pop(bookOrd.clOrdID)
-			if err != nil {
-				return matches, err
-			}
+		qty := decimal.Min(order.LeavesQty(), bookOrd.LeavesQty())
+		if err := b.fill(order, bookOrd, qty); err != nil {
+			return matches, err
 		}
 		matches = append(matches, bookOrd)
-		if order.Status() == OrderStatusFilled {
+		if bookOrd.Status() != OrderStatusFilled {
 			break
 		}
-
+		if err := level.remove(bookOrd); err != nil {
+			return matches, err
+		}
+		b.unindex(bookOrd)
 	}
 	return matches, nil
 }
 
+// fill executes qty between the incoming order and a resting one at the resting price.
+func (b *OrderBook) fill(order, bookOrd *Order, qty decimal.Decimal) error {
+	if err := bookOrd.Execute(bookOrd.Price(), qty); err != nil {
+		return err
+	}
+	if err := order.Execute(bookOrd.Price(), qty); err != nil {
+		return err
+	}
+	b.emit(BookEvent{Type: BookEventMatch, Order: bookOrd.View(), Aggressor: order.View(), Quantity: qty, Price: bookOrd.Price()})
+	return nil
+}
+
 func (b *OrderBook) Display() string {
+	depth := b.Depth(0)
 	repr := "bid:\n"
-	for i := 0; i < len(b.bidLevels); i++ {
-		level := b.bidLevels[i]
-		qty := decimal.Zero
-		for _, order := range level.orders {
-			qty = qty.Add(order.leavesQty)
-		}
-		repr += fmt.Sprintf("%.2f: %.2f\n", level.px.InexactFloat64(), qty.InexactFloat64())
+	for _, level := range depth.Bids {
+		repr += fmt.Sprintf("%.2f: %.2f\n", level.Price.InexactFloat64(), level.Quantity.InexactFloat64())
 	}
 	repr += "\n=====\nask:\n"
-	for i := 0; i < len(b.askLevels); i++ {
-		level := b.askLevels[i]
-		qty := decimal.Zero
-		for _, order := range level.orders {
-			qty = qty.Add(order.leavesQty)
-		}
-		repr += fmt.Sprintf("%.2f: %.2f\n", level.px.InexactFloat64(), qty.InexactFloat64())
+	for _, level := range depth.Asks {
+		repr += fmt.Sprintf("%.2f: %.2f\n", level.Price.InexactFloat64(), level.Quantity.InexactFloat64())
 	}
 	return repr
 }
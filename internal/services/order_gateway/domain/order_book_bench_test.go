@@ -0,0 +1,269 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// sliceOrderBook is the previous slice based book (linear level scans,
+// slices.Insert and orders[1:] pops), kept only as a benchmark baseline.
+type sliceOrderBook struct {
+	askLevels []*sliceBookLevel
+	bidLevels []*sliceBookLevel
+}
+
+type sliceBookLevel struct {
+	orders []*Order
+	px     decimal.Decimal
+}
+
+func (b *sliceOrderBook) add(order *Order) {
+	levels := b.askLevels
+	better := decimal.Decimal.LessThan
+	if order.side == BUY {
+		levels = b.bidLevels
+		better = decimal.Decimal.GreaterThan
+	}
+	inserted := false
+	for i, level := range levels {
+		if level.px.Equal(order.price) {
+			level.orders = append(level.orders, order)
+			inserted = true
+			break
+		}
+		if better(order.price, level.px) {
+			levels = slices.Insert(levels, i, &sliceBookLevel{orders: []*Order{order}, px: order.price})
+			inserted = true
+			break
+		}
+	}
+	if !inserted {
+		levels = append(levels, &sliceBookLevel{orders: []*Order{order}, px: order.price})
+	}
+	if order.side == BUY {
+		b.bidLevels = levels
+	} else {
+		b.askLevels = levels
+	}
+}
+
+func (b *sliceOrderBook) cancel(order *Order) bool {
+	levels := b.askLevels
+	if order.side == BUY {
+		levels = b.bidLevels
+	}
+	for _, level := range levels {
+		if !level.px.Equal(order.price) {
+			continue
+		}
+		for _, o := range level.orders {
+			if o.senderCompID == order.senderCompID && o.clOrdID == order.clOrdID {
+				o.status = OrderStatusCanceled
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (b *sliceOrderBook) matchLimit(order *Order) {
+	levels := &b.askLevels
+	crosses := decimal.Decimal.LessThanOrEqual
+	if order.side == SELL {
+		levels = &b.bidLevels
+		crosses = decimal.Decimal.GreaterThanOrEqual
+	}
+	for len(*levels) > 0 && order.leavesQty.IsPositive() {
+		level := (*levels)[0]
+		if !crosses(level.px, order.price) {
+			break
+		}
+		for len(level.orders) > 0 && order.leavesQty.IsPositive() {
+			bookOrd := level.orders[0]
+			qty := decimal.Min(bookOrd.leavesQty, order.leavesQty)
+			_ = bookOrd.Execute(bookOrd.price, qty)
+			_ = order.Execute(bookOrd.price, qty)
+			if bookOrd.status == OrderStatusFilled {
+				level.orders = level.orders[1:]
+			}
+		}
+		if len(level.orders) == 0 {
+			*levels = (*levels)[1:]
+		}
+	}
+	if order.leavesQty.IsPositive() {
+		b.add(order)
+	}
+}
+
+// benchBook is the operation set shared by both implementations under benchmark.
+type benchBook interface {
+	add(order *Order)
+	cancel(order *Order)
+	match(order *Order)
+}
+
+type skipListBench struct{ *OrderBook }
+
+func (s skipListBench) add(order *Order) { _ = s.OrderBook.add(order) }
+func (s skipListBench) cancel(order *Order) {
+	_, _ = s.OrderBook.Cancel(order.senderCompID, order.clOrdID)
+}
+func (s skipListBench) match(order *Order) {
+	_, _ = s.OrderBook.MatchOrAdd(context.Background(), order)
+}
+
+type sliceBench struct{ *sliceOrderBook }
+
+func (s sliceBench) add(order *Order)    { s.sliceOrderBook.add(order) }
+func (s sliceBench) cancel(order *Order) { s.sliceOrderBook.cancel(order) }
+func (s sliceBench) match(order *Order)  { s.sliceOrderBook.matchLimit(order) }
+
+var (
+	benchTick     = decimal.New(1, -2)
+	benchMid      = decimal.NewFromInt(1000)
+	benchLevelQty = decimal.NewFromInt(100)
+)
+
+func benchPrice(side OrderSide, level int) decimal.Decimal {
+	offset := benchTick.Mul(decimal.NewFromInt(int64(level + 1)))
+	if side == BUY {
+		return benchMid.Sub(offset)
+	}
+	return benchMid.Add(offset)
+}
+
+// seedBooks fills both implementations with one resting order per level on each side.
+func seedBooks(levels int) (map[string]benchBook, []*Order) {
+	books := map[string]benchBook{
+		"skiplist": skipListBench{NewOrderBook("BENCH")},
+		"slice":    sliceBench{&sliceOrderBook{}},
+	}
+	orders := make([]*Order, 0, 2*levels)
+	for i := 0; i < levels; i++ {
+		for _, side := range []OrderSide{BUY, SELL} {
+			orders = append(orders, NewOrder(fmt.Sprintf("seed-%d-%d", side, i), "BENCH", "a", "b",
+				side, enum.OrdType_LIMIT, benchPrice(side, i), benchLevelQty, ""))
+		}
+	}
+	// levels are generated best price first, so the slice book can be seeded by appending
+	// instead of paying its quadratic insertion cost before the timer even starts
+	slice := books["slice"].(sliceBench)
+	for _, o := range orders {
+		// each implementation rests its own copy so fills don't leak across books
+		c, sc := *o, *o
+		books["skiplist"].add(&c)
+		level := &sliceBookLevel{orders: []*Order{&sc}, px: sc.price}
+		if sc.side == BUY {
+			slice.bidLevels = append(slice.bidLevels, level)
+		} else {
+			slice.askLevels = append(slice.askLevels, level)
+		}
+	}
+	return books, orders
+}
+
+// latencies records per operation latency and reports percentiles next to ns/op.
+type latencies []time.Duration
+
+func (l latencies) report(b *testing.B) {
+	if len(l) == 0 {
+		return
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	b.ReportMetric(float64(l[len(l)*50/100].Nanoseconds()), "p50-ns")
+	b.ReportMetric(float64(l[len(l)*99/100].Nanoseconds()), "p99-ns")
+	b.ReportMetric(float64(l[len(l)-1].Nanoseconds()), "max-ns")
+}
+
+var benchDepths = []int{10_000, 20_000}
+
+// BenchmarkOrderBook_AddPassive inserts passive orders at random depths of a deep book.
+func BenchmarkOrderBook_AddPassive(b *testing.B) {
+	for _, depth := range benchDepths {
+		for _, impl := range []string{"skiplist", "slice"} {
+			b.Run(fmt.Sprintf("%s/levels=%d", impl, depth), func(b *testing.B) {
+				books, _ := seedBooks(depth)
+				book := books[impl]
+				rnd := rand.New(rand.NewPCG(1, 2))
+				orders := make([]*Order, b.N)
+				for i := range orders {
+					side := OrderSide(1 + rnd.IntN(2))
+					orders[i] = NewOrder("add-"+strconv.Itoa(i), "BENCH", "a", "b",
+						side, enum.OrdType_LIMIT, benchPrice(side, rnd.IntN(2*depth)), benchLevelQty, "")
+				}
+				lat := make(latencies, b.N)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					start := time.Now()
+					book.add(orders[i])
+					lat[i] = time.Since(start)
+				}
+				b.StopTimer()
+				lat.report(b)
+			})
+		}
+	}
+}
+
+// BenchmarkOrderBook_Cancel cancels random resting orders of a deep book.
+func BenchmarkOrderBook_Cancel(b *testing.B) {
+	for _, depth := range benchDepths {
+		for _, impl := range []string{"skiplist", "slice"} {
+			b.Run(fmt.Sprintf("%s/levels=%d", impl, depth), func(b *testing.B) {
+				books, seeded := seedBooks(depth)
+				book := books[impl]
+				rnd := rand.New(rand.NewPCG(3, 4))
+				lat := make(latencies, b.N)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					o := seeded[rnd.IntN(len(seeded))]
+					start := time.Now()
+					book.cancel(o)
+					lat[i] = time.Since(start)
+				}
+				b.StopTimer()
+				lat.report(b)
+			})
+		}
+	}
+}
+
+// BenchmarkOrderBook_MatchAndReplenish takes out the top ask level with an
+// aggressive buy and re-adds liquidity at the back of the book, keeping depth constant.
+func BenchmarkOrderBook_MatchAndReplenish(b *testing.B) {
+	for _, depth := range benchDepths {
+		for _, impl := range []string{"skiplist", "slice"} {
+			b.Run(fmt.Sprintf("%s/levels=%d", impl, depth), func(b *testing.B) {
+				books, _ := seedBooks(depth)
+				book := books[impl]
+				aggressors := make([]*Order, b.N)
+				replenish := make([]*Order, b.N)
+				for i := 0; i < b.N; i++ {
+					aggressors[i] = NewOrder("agg-"+strconv.Itoa(i), "BENCH", "c", "b",
+						BUY, enum.OrdType_LIMIT, benchPrice(SELL, i), benchLevelQty, "")
+					replenish[i] = NewOrder("rep-"+strconv.Itoa(i), "BENCH", "a", "b",
+						SELL, enum.OrdType_LIMIT, benchPrice(SELL, depth+i), benchLevelQty, "")
+				}
+				lat := make(latencies, b.N)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					start := time.Now()
+					book.match(aggressors[i])
+					lat[i] = time.Since(start)
+					book.add(replenish[i])
+				}
+				b.StopTimer()
+				lat.report(b)
+			})
+		}
+	}
+}
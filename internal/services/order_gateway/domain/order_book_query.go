@@ -0,0 +1,205 @@
+package domain
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// PriceLevel is the aggregated view of the live orders resting at one price.
+type PriceLevel struct {
+	Price    decimal.Decimal
+	Quantity decimal.Decimal
+	Orders   int
+}
+
+// BBO is the best bid and offer; a side is nil when it has no live orders.
+type BBO struct {
+	Bid *PriceLevel
+	Ask *PriceLevel
+}
+
+// Depth is an aggregated (L2) view of the book, each side from the best price.
+type Depth struct {
+	Symbol string
+	Bids   []PriceLevel
+	Asks   []PriceLevel
+}
+
+// OrderView is a point in time copy of an order, safe to hand to other goroutines.
+type OrderView struct {
+	OrderID          string
+	ClOrdID          string
+	Symbol           string
+	SenderCompID     string
+	TargetCompID     string
+	Account          string
+	OrderCapacity    enum.OrderCapacity
+	Parties          []Party
+	EntryProtocol    EntryProtocol
+	TimeInForce      enum.TimeInForce
+	ExpireDate       string
+	Side             OrderSide
+	OrdType          enum.OrdType
+	Price            decimal.Decimal
+	Quantity         decimal.Decimal
+	LeavesQty        decimal.Decimal
+	ExecutedQuantity decimal.Decimal
+	ExecutedNotional decimal.Decimal
+	Status           OrderStatus
+	CreatedAt        time.Time
+}
+
+// AvgPx is the average execution price, zero while nothing was executed.
+func (v OrderView) AvgPx() decimal.Decimal {
+	if !v.ExecutedQuantity.IsPositive() {
+		return decimal.Zero
+	}
+	return v.ExecutedNotional.Div(v.ExecutedQuantity)
+}
+
+// OrderLevel is one price of the order-by-order (L3) view, orders in time priority.
+type OrderLevel struct {
+	Price  decimal.Decimal
+	Orders []OrderView
+}
+
+// OrderDepth is the order-by-order (L3) view of the book, each side from the best price.
+type OrderDepth struct {
+	Symbol string
+	Bids   []OrderLevel
+	Asks   []OrderLevel
+}
+
+// FillEstimate is the outcome of walking the book for a hypothetical aggressive order.
+type FillEstimate struct {
+	Quantity   decimal.Decimal
+	Notional   decimal.Decimal
+	VWAP       decimal.Decimal
+	WorstPrice decimal.Decimal
+	// Complete is false when the book does not hold enough liquidity for the whole quantity.
+	Complete bool
+}
+
+// aggregate sums the live orders of level, reporting false when none are left.
+func aggregate(level *bookLevel) (PriceLevel, bool) {
+	agg := PriceLevel{Price: level.px, Quantity: decimal.Zero}
+	for o := level.head; o != nil; o = o.next {
+		if !o.IsOpen() {
+			continue
+		}
+		agg.Quantity = agg.Quantity.Add(o.leavesQty)
+		agg.Orders++
+	}
+	return agg, agg.Orders > 0
+}
+
+// topLevels aggregates up to n live levels of one side, all of them when n <= 0.
+func topLevels(levels *priceLevels, n int) []PriceLevel {
+	out := make([]PriceLevel, 0)
+	levels.Ascend(func(level *bookLevel) bool {
+		if agg, ok := aggregate(level); ok {
+			out = append(out, agg)
+		}
+		return n <= 0 || len(out) < n
+	})
+	return out
+}
+
+// BBO returns the best bid and offer.
+func (b *OrderBook) BBO() BBO {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var bbo BBO
+	if bids := topLevels(b.bidLevels, 1); len(bids) > 0 {
+		bbo.Bid = &bids[0]
+	}
+	if asks := topLevels(b.askLevels, 1); len(asks) > 0 {
+		bbo.Ask = &asks[0]
+	}
+	return bbo
+}
+
+// Depth returns the top n aggregated levels of each side, or every level when n <= 0.
+func (b *OrderBook) Depth(n int) Depth {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return Depth{
+		Symbol: b.symbol,
+		Bids:   topLevels(b.bidLevels, n),
+		Asks:   topLevels(b.askLevels, n),
+	}
+}
+
+// L3 returns the full order-by-order view of the book.
+func (b *OrderBook) L3() OrderDepth {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return OrderDepth{
+		Symbol: b.symbol,
+		Bids:   orderLevels(b.bidLevels),
+		Asks:   orderLevels(b.askLevels),
+	}
+}
+
+func orderLevels(levels *priceLevels) []OrderLevel {
+	out := make([]OrderLevel, 0, levels.Len())
+	levels.Ascend(func(level *bookLevel) bool {
+		views := make([]OrderView, 0, level.count)
+		for o := level.head; o != nil; o = o.next {
+			if o.IsOpen() {
+				views = append(views, o.View())
+			}
+		}
+		if len(views) > 0 {
+			out = append(out, OrderLevel{Price: level.px, Orders: views})
+		}
+		return true
+	})
+	return out
+}
+
+// CumulativeDepth returns the live quantity resting on side at prices at least as good as px,
+// i.e. bids priced at or above px, or asks priced at or below it.
+func (b *OrderBook) CumulativeDepth(side OrderSide, px decimal.Decimal) decimal.Decimal {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	levels := b.levelsFor(side)
+	total := decimal.Zero
+	levels.Ascend(func(level *bookLevel) bool {
+		if levels.cmp(level.px, px) > 0 {
+			return false
+		}
+		if agg, ok := aggregate(level); ok {
+			total = total.Add(agg.Quantity)
+		}
+		return true
+	})
+	return total
+}
+
+// FillCost walks the side opposite to an aggressive order of side and qty and returns
+// the quantity it would fill, its notional, the VWAP and the worst price reached.
+func (b *OrderBook) FillCost(side OrderSide, qty decimal.Decimal) FillEstimate {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	estimate := FillEstimate{Quantity: decimal.Zero, Notional: decimal.Zero, VWAP: decimal.Zero, WorstPrice: decimal.Zero}
+	remaining := qty
+	b.oppositeLevels(side).Ascend(func(level *bookLevel) bool {
+		agg, ok := aggregate(level)
+		if !ok {
+			return true
+		}
+		take := decimal.Min(agg.Quantity, remaining)
+		estimate.Quantity = estimate.Quantity.Add(take)
+		estimate.Notional = estimate.Notional.Add(take.Mul(level.px))
+		estimate.WorstPrice = level.px
+		remaining = remaining.Sub(take)
+		return remaining.IsPositive()
+	})
+	estimate.Complete = !remaining.IsPositive()
+	if estimate.Quantity.IsPositive() {
+		estimate.VWAP = estimate.Notional.Div(estimate.Quantity)
+	}
+	return estimate
+}
@@ -0,0 +1,217 @@
+package domain
+
+import (
+	"context"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func dec(t *testing.T, s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	require.NoError(t, err)
+	return d
+}
+
+// newQueryTestBook returns
+//
+//	bid: 46.52 x 300 (2 orders), 46.51 x 100, 46.50 x 50
+//	ask: 46.72 x 200 (2 orders, one more canceled), 46.73 x 100, 46.75 x 400
+func newQueryTestBook(t *testing.T) *OrderBook {
+	book := NewOrderBook("VALE3")
+	for i, o := range []struct {
+		side OrderSide
+		px   string
+		qty  int64
+	}{
+		{BUY, "46.52", 100}, {BUY, "46.52", 200}, {BUY, "46.51", 100}, {BUY, "46.50", 50},
+		{SELL, "46.72", 150}, {SELL, "46.72", 70}, {SELL, "46.72", 50}, {SELL, "46.73", 100}, {SELL, "46.75", 400},
+	} {
+		_, err := book.MatchOrAdd(context.Background(), NewOrder(strconv.Itoa(i+1), "VALE3", "a", "b",
+			o.side, enum.OrdType_LIMIT, dec(t, o.px), decimal.NewFromInt(o.qty), "ORD"+strconv.Itoa(i+1)))
+		require.NoError(t, err)
+	}
+	_, err := book.Cancel("a", "6")
+	require.NoError(t, err)
+	return book
+}
+
+func requireLevel(t *testing.T, got PriceLevel, px string, qty int64, orders int) {
+	require.Truef(t, got.Price.Equal(dec(t, px)), "price: got %s want %s", got.Price, px)
+	require.Truef(t, got.Quantity.Equal(decimal.NewFromInt(qty)), "qty at %s: got %s want %d", px, got.Quantity, qty)
+	require.Equalf(t, orders, got.Orders, "orders at %s", px)
+}
+
+func TestOrderBook_BBO(t *testing.T) {
+	book := NewOrderBook("VALE3")
+	bbo := book.BBO()
+	require.Nil(t, bbo.Bid)
+	require.Nil(t, bbo.Ask)
+
+	book = newQueryTestBook(t)
+	bbo = book.BBO()
+	requireLevel(t, *bbo.Bid, "46.52", 300, 2)
+	requireLevel(t, *bbo.Ask, "46.72", 200, 2)
+}
+
+func TestOrderBook_Depth(t *testing.T) {
+	book := newQueryTestBook(t)
+
+	top2 := book.Depth(2)
+	require.Equal(t, "VALE3", top2.Symbol)
+	require.Len(t, top2.Bids, 2)
+	require.Len(t, top2.Asks, 2)
+	requireLevel(t, top2.Bids[0], "46.52", 300, 2)
+	requireLevel(t, top2.Bids[1], "46.51", 100, 1)
+	requireLevel(t, top2.Asks[0], "46.72", 200, 2)
+	requireLevel(t, top2.Asks[1], "46.73", 100, 1)
+
+	all := book.Depth(0)
+	require.Len(t, all.Bids, 3)
+	require.Len(t, all.Asks, 3)
+	requireLevel(t, all.Bids[2], "46.50", 50, 1)
+	requireLevel(t, all.Asks[2], "46.75", 400, 1)
+}
+
+func TestOrderBook_L3(t *testing.T) {
+	book := newQueryTestBook(t)
+	l3 := book.L3()
+	require.Len(t, l3.Bids, 3)
+	require.Len(t, l3.Asks, 3)
+
+	top := l3.Asks[0]
+	require.True(t, top.Price.Equal(dec(t, "46.72")))
+	require.Len(t, top.Orders, 2)
+	require.Equal(t, "5", top.Orders[0].ClOrdID)
+	require.Equal(t, "ORD5", top.Orders[0].OrderID)
+	require.Equal(t, "7", top.Orders[1].ClOrdID)
+	require.Equal(t, SELL, top.Orders[1].Side)
+	require.True(t, top.Orders[1].LeavesQty.Equal(decimal.NewFromInt(50)))
+
+	_, err := book.MatchOrAdd(context.Background(), NewOrder("10", "VALE3", "c", "b",
+		BUY, enum.OrdType_LIMIT, dec(t, "46.72"), decimal.NewFromInt(100), ""))
+	require.NoError(t, err)
+	top = book.L3().Asks[0]
+	require.True(t, top.Orders[0].LeavesQty.Equal(decimal.NewFromInt(50)))
+	require.True(t, top.Orders[0].Quantity.Equal(decimal.NewFromInt(150)))
+}
+
+func TestOrderBook_CumulativeDepth(t *testing.T) {
+	book := newQueryTestBook(t)
+	tests := []struct {
+		side OrderSide
+		px   string
+		want int64
+	}{
+		{BUY, "46.60", 0},
+		{BUY, "46.52", 300},
+		{BUY, "46.51", 400},
+		{BUY, "46.00", 450},
+		{SELL, "46.71", 0},
+		{SELL, "46.72", 200},
+		{SELL, "46.74", 300},
+		{SELL, "50.00", 700},
+	}
+	for _, tt := range tests {
+		got := book.CumulativeDepth(tt.side, dec(t, tt.px))
+		require.Truef(t, got.Equal(decimal.NewFromInt(tt.want)), "side %d px %s: got %s want %d", tt.side, tt.px, got, tt.want)
+	}
+}
+
+func TestOrderBook_FillCost(t *testing.T) {
+	book := newQueryTestBook(t)
+	tests := []struct {
+		name         string
+		side         OrderSide
+		qty          int64
+		wantQty      int64
+		wantNotional string
+		wantVWAP     string
+		wantWorst    string
+		wantComplete bool
+	}{
+		{name: "inside top level", side: BUY, qty: 100, wantQty: 100, wantNotional: "4672", wantVWAP: "46.72", wantWorst: "46.72", wantComplete: true},
+		{name: "two levels", side: BUY, qty: 250, wantQty: 250, wantNotional: "11680.5", wantVWAP: "46.722", wantWorst: "46.73", wantComplete: true},
+		{name: "sell into bids", side: SELL, qty: 350, wantQty: 350, wantNotional: "16281.5", wantVWAP: "46.5185714285714286", wantWorst: "46.51", wantComplete: true},
+		{name: "not enough liquidity", side: SELL, qty: 1000, wantQty: 450, wantNotional: "20932", wantVWAP: "46.5155555555555556", wantWorst: "46.5", wantComplete: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := book.FillCost(tt.side, decimal.NewFromInt(tt.qty))
+			require.Truef(t, got.Quantity.Equal(decimal.NewFromInt(tt.wantQty)), "qty %s", got.Quantity)
+			require.Truef(t, got.Notional.Equal(dec(t, tt.wantNotional)), "notional %s", got.Notional)
+			require.Truef(t, got.VWAP.Equal(dec(t, tt.wantVWAP)), "vwap %s", got.VWAP)
+			require.Truef(t, got.WorstPrice.Equal(dec(t, tt.wantWorst)), "worst %s", got.WorstPrice)
+			require.Equal(t, tt.wantComplete, got.Complete)
+		})
+	}
+	empty := NewOrderBook("VALE3").FillCost(BUY, decimal.NewFromInt(10))
+	require.False(t, empty.Complete)
+	require.True(t, empty.VWAP.IsZero())
+}
+
+func TestOrderBook_QueriesAreConsistentUnderConcurrentMatching(t *testing.T) {
+	book := NewOrderBook("VALE3")
+	mid := decimal.NewFromInt(100)
+	tick := decimal.New(1, -2)
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for i := 0; i < 2000; i++ {
+			side := BUY
+			px := mid.Sub(tick.Mul(decimal.NewFromInt(int64(i % 7))))
+			if i%2 == 1 {
+				side = SELL
+				px = mid.Add(tick.Mul(decimal.NewFromInt(int64(i%5) - 1)))
+			}
+			clOrdID := strconv.Itoa(i)
+			_, _ = book.MatchOrAdd(context.Background(), NewOrder(clOrdID, "VALE3", "a", "b",
+				side, enum.OrdType_LIMIT, px, decimal.NewFromInt(int64(10+i%30)), ""))
+			if i%3 == 0 {
+				_, _ = book.Cancel("a", strconv.Itoa(i-1))
+			}
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				depth := book.Depth(0)
+				// the book is never crossed after a match completes
+				if len(depth.Bids) > 0 && len(depth.Asks) > 0 && !depth.Bids[0].Price.LessThan(depth.Asks[0].Price) {
+					t.Errorf("crossed book observed: bid %s ask %s", depth.Bids[0].Price, depth.Asks[0].Price)
+					return
+				}
+				for _, side := range [][]PriceLevel{depth.Bids, depth.Asks} {
+					for _, level := range side {
+						if !level.Quantity.IsPositive() || level.Orders == 0 {
+							t.Errorf("empty level observed at %s", level.Price)
+							return
+						}
+					}
+				}
+				for _, level := range book.L3().Asks {
+					if len(level.Orders) == 0 {
+						t.Errorf("empty L3 level observed at %s", level.Price)
+						return
+					}
+				}
+				book.FillCost(BUY, decimal.NewFromInt(100))
+				book.BBO()
+			}
+		}()
+	}
+	wg.Wait()
+}
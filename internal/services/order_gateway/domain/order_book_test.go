@@ -25,11 +25,10 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 		{
 			name: "Market Order empty book",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol:    "VALE3",
-					askLevels: []*bookLevel{},
-					bidLevels: []*bookLevel{},
-				}
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{},
+					[]*bookLevel{},
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				BUY, enum.OrdType_MARKET, decimal.Decimal{}, decimal.NewFromInt(200), ""),
@@ -44,17 +43,13 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 			setup: func(t *testing.T) *OrderBook {
 				px, err := decimal.NewFromString("46.72")
 				require.NoError(t, err)
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
-						{
-							orders: []*Order{NewOrder("2", "VALE3", "a", "b",
-								SELL, enum.OrdType_MARKET, px, decimal.NewFromInt(200), "")},
-							px: px,
-						},
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
+						newBookLevel([]*Order{NewOrder("2", "VALE3", "a", "b",
+							SELL, enum.OrdType_MARKET, px, decimal.NewFromInt(200), "")}, px),
 					},
-					bidLevels: []*bookLevel{},
-				}
+					[]*bookLevel{},
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				SELL, enum.OrdType_MARKET, decimal.Decimal{}, decimal.NewFromInt(200), ""),
@@ -69,16 +64,12 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 			setup: func(t *testing.T) *OrderBook {
 				px, err := decimal.NewFromString("46.72")
 				require.NoError(t, err)
-				return &OrderBook{
-					symbol:    "VALE3",
-					askLevels: []*bookLevel{},
-					bidLevels: []*bookLevel{
-						{
-							orders: []*Order{NewOrder("2", "VALE3", "a", "b",
-								BUY, enum.OrdType_MARKET, px, decimal.NewFromInt(200), "")},
-							px: px,
-						}},
-				}
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{},
+					[]*bookLevel{
+						newBookLevel([]*Order{NewOrder("2", "VALE3", "a", "b",
+							BUY, enum.OrdType_MARKET, px, decimal.NewFromInt(200), "")}, px)},
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				BUY, enum.OrdType_MARKET, decimal.Decimal{}, decimal.NewFromInt(200), ""),
@@ -91,15 +82,14 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 		{
 			name: "SELL Market Order single Level book - equal sze/price",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol:    "VALE3",
-					askLevels: []*bookLevel{},
-					bidLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{},
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("2", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, sellPx, decimal.NewFromInt(200), ""),
 						}, sellPx)},
-				}
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				SELL, enum.OrdType_MARKET, decimal.Decimal{}, decimal.NewFromInt(200), ""),
@@ -133,16 +123,15 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 		{
 			name: "BUY Market Order single Level book - equal sze/price",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("2", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx, decimal.NewFromInt(200), ""),
 						}, sellPx),
 					},
-					bidLevels: []*bookLevel{},
-				}
+					[]*bookLevel{},
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				BUY, enum.OrdType_MARKET, decimal.Decimal{}, decimal.NewFromInt(200), ""),
@@ -176,21 +165,20 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 		{
 			name: "BUY Market Order full single Level book - equal sze/price",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("2", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx, decimal.NewFromInt(200), ""),
 						}, sellPx),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("3", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx, decimal.NewFromInt(150), ""),
 						}, buyPx),
 					},
-				}
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				BUY, enum.OrdType_MARKET, decimal.Decimal{}, decimal.NewFromInt(200), ""),
@@ -224,21 +212,20 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 		{
 			name: "SELL Market Order full single Level book - equal sze/price",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("2", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx, decimal.NewFromInt(200), ""),
 						}, sellPx),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("3", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx, decimal.NewFromInt(150), ""),
 						}, buyPx),
 					},
-				}
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				SELL, enum.OrdType_MARKET, decimal.Decimal{}, decimal.NewFromInt(150), ""),
@@ -272,9 +259,8 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 		{
 			name: "SELL Market Order full book",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("2", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx, decimal.NewFromInt(200), ""),
@@ -290,7 +276,7 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx.Add(decimal.NewFromFloat(0.05)), decimal.NewFromInt(200), ""),
 						}, sellPx),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("8", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx, decimal.NewFromInt(150), ""),
@@ -306,7 +292,7 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx.Sub(decimal.NewFromFloat(0.05)), decimal.NewFromInt(200), ""),
 						}, buyPx),
 					},
-				}
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				SELL, enum.OrdType_MARKET, decimal.Decimal{}, decimal.NewFromInt(525), ""),
@@ -388,9 +374,8 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 			},
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("2", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx, decimal.NewFromInt(200), ""),
@@ -406,7 +391,7 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx.Add(decimal.NewFromFloat(0.05)), decimal.NewFromInt(200), ""),
 						}, sellPx),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							{
 								clOrdID:          "11",
@@ -432,7 +417,7 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx.Sub(decimal.NewFromFloat(0.05)), decimal.NewFromInt(200), ""),
 						}, buyPx),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -458,26 +443,47 @@ func TestOrderBook_MatchOrAddMarketOrder(t *testing.T) {
 	}
 }
 
-func assertBooksEqual(t *testing.T, book *OrderBook, wantBook OrderBook) {
+// newTestOrderBook builds a FIFO book with the given levels, ordered from the best price.
+func newTestOrderBook(symbol string, askLevels []*bookLevel, bidLevels []*bookLevel) *OrderBook {
+	book := NewOrderBook(symbol)
+	for _, side := range []struct {
+		levels    *priceLevels
+		bookLevel []*bookLevel
+	}{{book.askLevels, askLevels}, {book.bidLevels, bidLevels}} {
+		for _, level := range side.bookLevel {
+			dst := side.levels.GetOrCreate(level.px)
+			for _, o := range level.Orders() {
+				_ = level.remove(o)
+				_ = dst.Add(o)
+				book.index(o)
+			}
+		}
+	}
+	return book
+}
+
+func assertBooksEqual(t *testing.T, book *OrderBook, wantBook *OrderBook) {
 	display := book.Display()
 	wantDisplay := wantBook.Display()
 	if display != wantDisplay {
 		t.Errorf("books display differ: want %s got %s", wantDisplay, display)
 	}
-	if len(book.askLevels) != len(wantBook.askLevels) {
-		t.Errorf("book levels differ - ask %d vs %d", len(book.askLevels), len(wantBook.askLevels))
+	if book.askLevels.Len() != wantBook.askLevels.Len() {
+		t.Errorf("book levels differ - ask %d vs %d", book.askLevels.Len(), wantBook.askLevels.Len())
 	}
-	if len(book.bidLevels) != len(wantBook.bidLevels) {
-		t.Errorf("book levels differ - bid %d vs %d", len(book.bidLevels), len(wantBook.bidLevels))
+	if book.bidLevels.Len() != wantBook.bidLevels.Len() {
+		t.Errorf("book levels differ - bid %d vs %d", book.bidLevels.Len(), wantBook.bidLevels.Len())
 	}
-	for i := 0; i < len(book.askLevels); i++ {
-		if !compareOrderSlice(book.askLevels[i].orders, wantBook.askLevels[i].orders) {
-			t.Errorf("book levels differ - ask level %d, got %v want %v", i, book.askLevels[i].orders, wantBook.askLevels[i].orders)
+	askLevels, wantAskLevels := book.askLevels.Levels(), wantBook.askLevels.Levels()
+	for i := 0; i < len(askLevels) && i < len(wantAskLevels); i++ {
+		if !compareOrderSlice(askLevels[i].Orders(), wantAskLevels[i].Orders()) {
+			t.Errorf("book levels differ - ask level %d, got %v want %v", i, askLevels[i].Orders(), wantAskLevels[i].Orders())
 		}
 	}
-	for i := 0; i < len(book.bidLevels); i++ {
-		if !compareOrderSlice(book.bidLevels[i].orders, wantBook.bidLevels[i].orders) {
-			t.Errorf("book levels differ - bid level %d, got %v want %v", i, book.bidLevels[i].orders, wantBook.bidLevels[i].orders)
+	bidLevels, wantBidLevels := book.bidLevels.Levels(), wantBook.bidLevels.Levels()
+	for i := 0; i < len(bidLevels) && i < len(wantBidLevels); i++ {
+		if !compareOrderSlice(bidLevels[i].Orders(), wantBidLevels[i].Orders()) {
+			t.Errorf("book levels differ - bid level %d, got %v want %v", i, bidLevels[i].Orders(), wantBidLevels[i].Orders())
 		}
 	}
 }
@@ -503,11 +509,10 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 		{
 			name: "Limit Order empty book",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol:    "VALE3",
-					askLevels: []*bookLevel{},
-					bidLevels: []*bookLevel{},
-				}
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{},
+					[]*bookLevel{},
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -515,16 +520,15 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol:    "VALE3",
-					askLevels: []*bookLevel{},
-					bidLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{},
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
 						}, buyPx1),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -532,11 +536,10 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 		{
 			name: "SELL Limit Order empty book",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol:    "VALE3",
-					askLevels: []*bookLevel{},
-					bidLevels: []*bookLevel{},
-				}
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{},
+					[]*bookLevel{},
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -544,16 +547,15 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
 						}, sellPx1),
 					},
-					bidLevels: []*bookLevel{},
-				}
+					[]*bookLevel{},
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -563,16 +565,15 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			name: "SELL Limit Order add new level to the bottom",
 			setup: func(t *testing.T) *OrderBook {
 
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
 						}, sellPx1),
 					},
-					bidLevels: []*bookLevel{},
-				}
+					[]*bookLevel{},
+				)
 			},
 			order: NewOrder("2", "VALE3", "a", "b",
 				SELL, enum.OrdType_LIMIT, sellPx2, decimal.NewFromInt(200), ""),
@@ -580,9 +581,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -592,8 +592,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx2, decimal.NewFromInt(200), ""),
 						}, sellPx2),
 					},
-					bidLevels: []*bookLevel{},
-				}
+					[]*bookLevel{},
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -602,16 +602,15 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			name: "SELL Limit Order add new level to the top",
 			setup: func(t *testing.T) *OrderBook {
 
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("2", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx2, decimal.NewFromInt(200), ""),
 						}, sellPx2),
 					},
-					bidLevels: []*bookLevel{},
-				}
+					[]*bookLevel{},
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -619,9 +618,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -631,8 +629,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx2, decimal.NewFromInt(200), ""),
 						}, sellPx2),
 					},
-					bidLevels: []*bookLevel{},
-				}
+					[]*bookLevel{},
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -641,15 +639,14 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			name: "BUY Limit Order add new level to the bottom",
 			setup: func(t *testing.T) *OrderBook {
 
-				return &OrderBook{
-					symbol:    "VALE3",
-					askLevels: []*bookLevel{},
-					bidLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{},
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
 						}, buyPx1)},
-				}
+				)
 			},
 			order: NewOrder("2", "VALE3", "a", "b",
 				BUY, enum.OrdType_LIMIT, buyPx2, decimal.NewFromInt(200), ""),
@@ -657,10 +654,9 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol:    "VALE3",
-					askLevels: []*bookLevel{},
-					bidLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{},
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -670,7 +666,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx2, decimal.NewFromInt(200), ""),
 						}, buyPx2),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -679,15 +675,14 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			name: "BUY Limit Order add new level to the top",
 			setup: func(t *testing.T) *OrderBook {
 
-				return &OrderBook{
-					symbol:    "VALE3",
-					askLevels: []*bookLevel{},
-					bidLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{},
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("2", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx2, decimal.NewFromInt(200), ""),
 						}, buyPx2)},
-				}
+				)
 			},
 			order: NewOrder("1", "VALE3", "a", "b",
 				BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -695,10 +690,9 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol:    "VALE3",
-					askLevels: []*bookLevel{},
-					bidLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{},
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -708,7 +702,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx2, decimal.NewFromInt(200), ""),
 						}, buyPx2),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -717,9 +711,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			name: "BUY Limit Order add new level to the full book",
 			setup: func(t *testing.T) *OrderBook {
 
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -733,7 +726,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("4", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -747,7 +740,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 			},
 			order: NewOrder("7", "VALE3", "a", "b",
 				BUY, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(200), ""),
@@ -755,9 +748,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -771,7 +763,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("7", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(200), ""),
@@ -789,7 +781,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -798,9 +790,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			name: "BUY Limit Order add to existing level to the full book",
 			setup: func(t *testing.T) *OrderBook {
 
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -814,7 +805,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("4", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -828,7 +819,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 			},
 			order: NewOrder("7", "VALE3", "a", "b",
 				BUY, enum.OrdType_LIMIT, buyPx2, decimal.NewFromInt(200), ""),
@@ -836,9 +827,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -852,7 +842,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("4", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -868,7 +858,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -877,9 +867,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			name: "SELL Limit Order add to existing level to the full book",
 			setup: func(t *testing.T) *OrderBook {
 
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -893,7 +882,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("4", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -907,7 +896,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 			},
 			order: NewOrder("7", "VALE3", "a", "b",
 				SELL, enum.OrdType_LIMIT, sellPx2, decimal.NewFromInt(250), ""),
@@ -915,9 +904,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -933,7 +921,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("4", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -947,7 +935,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -956,9 +944,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			name: "SELL Limit Order add new middle level",
 			setup: func(t *testing.T) *OrderBook {
 
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -968,7 +955,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("4", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -982,7 +969,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 			},
 			order: NewOrder("7", "VALE3", "a", "b",
 				SELL, enum.OrdType_LIMIT, sellPx2, decimal.NewFromInt(250), ""),
@@ -990,9 +977,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -1006,7 +992,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("4", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -1020,7 +1006,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -1029,9 +1015,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			name: "BUY Limit Order add new middle level",
 			setup: func(t *testing.T) *OrderBook {
 
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -1045,7 +1030,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("4", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -1055,7 +1040,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 			},
 			order: NewOrder("7", "VALE3", "a", "b",
 				BUY, enum.OrdType_LIMIT, buyPx2, decimal.NewFromInt(200), ""),
@@ -1063,9 +1048,8 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -1079,7 +1063,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("4", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -1093,7 +1077,7 @@ func TestOrderBook_AddLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -1140,9 +1124,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 		{
 			name: "BUY Limit Order filled but partial first level match",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -1156,7 +1139,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("7", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(200), ""),
@@ -1174,7 +1157,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 			},
 			order: NewOrder("11", "VALE3", "a", "b",
 				BUY, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(100), ""),
@@ -1220,9 +1203,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							{
 								clOrdID:          "1",
@@ -1252,7 +1234,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("7", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(200), ""),
@@ -1270,7 +1252,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -1278,9 +1260,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 		{
 			name: "SELL Limit Order filled but partial first level match",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -1294,7 +1275,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("7", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(200), ""),
@@ -1312,7 +1293,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 			},
 			order: NewOrder("11", "VALE3", "a", "b",
 				SELL, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(100), ""),
@@ -1358,9 +1339,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -1374,7 +1354,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							{
 								clOrdID:          "7",
@@ -1408,7 +1388,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -1416,9 +1396,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 		{
 			name: "BUY Limit Order filled but partial first level match - agressive limit",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -1432,7 +1411,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("7", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(200), ""),
@@ -1450,7 +1429,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 			},
 			order: NewOrder("11", "VALE3", "a", "b",
 				BUY, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(100), ""),
@@ -1496,9 +1475,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							{
 								clOrdID:          "1",
@@ -1528,7 +1506,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("7", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(200), ""),
@@ -1546,7 +1524,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -1554,9 +1532,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 		{
 			name: "SELL Limit Order filled but partial first level match - agressive limit",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -1570,7 +1547,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("7", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(200), ""),
@@ -1588,7 +1565,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 			},
 			order: NewOrder("11", "VALE3", "a", "b",
 				SELL, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(100), ""),
@@ -1634,9 +1611,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -1650,7 +1626,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							{
 								clOrdID:          "7",
@@ -1684,7 +1660,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -1692,9 +1668,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 		{
 			name: "BUY Limit Order partial filling whole first level",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -1708,7 +1683,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("7", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(200), ""),
@@ -1726,7 +1701,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 			},
 			order: NewOrder("11", "VALE3", "a", "b",
 				BUY, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(1000), ""),
@@ -1772,9 +1747,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("2", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx2, decimal.NewFromInt(200), ""),
@@ -1784,7 +1758,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{{
 							clOrdID:          "11",
 							symbol:           "VALE3",
@@ -1820,7 +1794,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -1828,9 +1802,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 		{
 			name: "SELL Limit Order partial filling whole first level",
 			setup: func(t *testing.T) *OrderBook {
-				return &OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				return newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("1", "VALE3", "a", "b",
 								SELL, enum.OrdType_LIMIT, sellPx1, decimal.NewFromInt(200), ""),
@@ -1844,7 +1817,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("7", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(200), ""),
@@ -1862,7 +1835,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 			},
 			order: NewOrder("11", "VALE3", "a", "b",
 				SELL, enum.OrdType_LIMIT, buyPxClose, decimal.NewFromInt(1000), ""),
@@ -1908,9 +1881,8 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 			wantErr: false,
 			checkBook: func(t *testing.T, book *OrderBook) {
 
-				wantBook := OrderBook{
-					symbol: "VALE3",
-					askLevels: []*bookLevel{
+				wantBook := newTestOrderBook("VALE3",
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							{
 								clOrdID:          "11",
@@ -1944,7 +1916,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								SELL, enum.OrdType_LIMIT, sellPx3, decimal.NewFromInt(200), ""),
 						}, sellPx3),
 					},
-					bidLevels: []*bookLevel{
+					[]*bookLevel{
 						newBookLevel([]*Order{
 							NewOrder("4", "VALE3", "a", "b",
 								BUY, enum.OrdType_LIMIT, buyPx1, decimal.NewFromInt(200), ""),
@@ -1958,7 +1930,7 @@ func TestOrderBook_MatchLimitOrder(t *testing.T) {
 								BUY, enum.OrdType_LIMIT, buyPx3, decimal.NewFromInt(200), ""),
 						}, buyPx3),
 					},
-				}
+				)
 				assertBooksEqual(t, book, wantBook)
 				return
 			},
@@ -2044,3 +2016,262 @@ func compareOrder(a, b Order) bool {
 	}
 	return true
 }
+
+func TestOrderBook_CancelInterleavedWithAggressiveOrders(t *testing.T) {
+	px, _ := decimal.NewFromString("46.72")
+	px2, _ := decimal.NewFromString("46.73")
+	sell := func(clOrdID string, px decimal.Decimal, qty int64) *Order {
+		return NewOrder(clOrdID, "VALE3", "a", "b", SELL, enum.OrdType_LIMIT, px, decimal.NewFromInt(qty), "")
+	}
+	buy := func(clOrdID string, px decimal.Decimal, qty int64) *Order {
+		return NewOrder(clOrdID, "VALE3", "c", "b", BUY, enum.OrdType_LIMIT, px, decimal.NewFromInt(qty), "")
+	}
+	market := func(clOrdID string, qty int64) *Order {
+		return NewOrder(clOrdID, "VALE3", "c", "b", BUY, enum.OrdType_MARKET, decimal.Decimal{}, decimal.NewFromInt(qty), "")
+	}
+	type step struct {
+		order       *Order
+		cancel      string
+		wantMatches []string
+		wantErr     bool
+	}
+	tests := []struct {
+		name        string
+		steps       []step
+		wantDisplay string
+		wantAsks    int
+	}{
+		{
+			name: "canceled head of queue is skipped",
+			steps: []step{
+				{order: sell("1", px, 100)},
+				{order: sell("2", px, 100)},
+				{cancel: "1"},
+				{order: buy("10", px, 50), wantMatches: []string{"2"}},
+			},
+			wantDisplay: "bid:\n\n=====\nask:\n46.72: 50.00\n",
+			wantAsks:    1,
+		},
+		{
+			name: "fully canceled level is pruned",
+			steps: []step{
+				{order: sell("1", px, 100)},
+				{order: sell("2", px2, 100)},
+				{cancel: "1"},
+				{order: buy("10", px, 50)},
+			},
+			wantDisplay: "bid:\n46.72: 50.00\n\n=====\nask:\n46.73: 100.00\n",
+			wantAsks:    1,
+		},
+		{
+			name: "aggressor sweeps past canceled orders across levels",
+			steps: []step{
+				{order: sell("1", px, 100)},
+				{order: sell("2", px, 100)},
+				{order: sell("3", px, 100)},
+				{order: sell("4", px2, 100)},
+				{order: sell("5", px2, 100)},
+				{cancel: "2"},
+				{cancel: "4"},
+				{order: market("10", 250), wantMatches: []string{"1", "3", "5"}},
+			},
+			wantDisplay: "bid:\n\n=====\nask:\n46.73: 50.00\n",
+			wantAsks:    1,
+		},
+		{
+			name: "cancel after partial fill removes the remainder",
+			steps: []step{
+				{order: sell("1", px, 100)},
+				{order: buy("10", px, 30), wantMatches: []string{"1"}},
+				{cancel: "1"},
+				{order: buy("11", px, 30)},
+			},
+			wantDisplay: "bid:\n46.72: 30.00\n\n=====\nask:\n",
+			wantAsks:    0,
+		},
+		{
+			name: "filled and canceled orders cannot be canceled again",
+			steps: []step{
+				{order: sell("1", px, 100)},
+				{order: sell("2", px, 100)},
+				{order: buy("10", px, 100), wantMatches: []string{"1"}},
+				{cancel: "1", wantErr: true},
+				{cancel: "2"},
+				{cancel: "2", wantErr: true},
+			},
+			wantDisplay: "bid:\n\n=====\nask:\n",
+			wantAsks:    0,
+		},
+		{
+			name: "clOrdID can be reused after cancel",
+			steps: []step{
+				{order: sell("1", px, 100)},
+				{cancel: "1"},
+				{order: sell("1", px2, 40)},
+				{order: buy("10", px2, 100), wantMatches: []string{"1"}},
+			},
+			wantDisplay: "bid:\n46.73: 60.00\n\n=====\nask:\n",
+			wantAsks:    0,
+		},
+		{
+			name: "compaction keeps time priority of live orders",
+			steps: []step{
+				{order: sell("1", px, 10)},
+				{order: sell("2", px, 10)},
+				{order: sell("3", px, 10)},
+				{order: sell("4", px, 10)},
+				{order: sell("5", px, 10)},
+				{cancel: "1"},
+				{cancel: "3"},
+				{cancel: "4"},
+				{order: buy("10", px, 15), wantMatches: []string{"2", "5"}},
+			},
+			wantDisplay: "bid:\n\n=====\nask:\n46.72: 5.00\n",
+			wantAsks:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewOrderBook("VALE3")
+			for i, s := range tt.steps {
+				if s.cancel != "" {
+					_, err := book.Cancel("a", s.cancel)
+					if s.wantErr {
+						require.Errorf(t, err, "step %d", i)
+					} else {
+						require.NoErrorf(t, err, "step %d", i)
+					}
+					continue
+				}
+				matches, err := book.MatchOrAdd(context.Background(), s.order)
+				require.NoErrorf(t, err, "step %d", i)
+				got := make([]string, 0, len(matches))
+				for _, m := range matches {
+					require.NotEqual(t, OrderStatus(OrderStatusCanceled), m.Status())
+					got = append(got, m.ClOrdID())
+				}
+				if s.wantMatches == nil {
+					s.wantMatches = []string{}
+				}
+				require.Equalf(t, s.wantMatches, got, "step %d", i)
+			}
+			require.Equal(t, tt.wantDisplay, book.Display())
+			require.Equal(t, tt.wantAsks, book.askLevels.Len())
+			book.askLevels.Ascend(func(level *bookLevel) bool {
+				require.True(t, level.hasLiveOrders())
+				return true
+			})
+		})
+	}
+}
+
+func TestOrderBook_MatchFIFOWalksQueueHead(t *testing.T) {
+	px := decimal.NewFromInt(10)
+	book := NewOrderBook("VALE3")
+	for _, clOrdID := range []string{"1", "2", "3", "4", "5", "6"} {
+		_, err := book.MatchOrAdd(context.Background(), NewOrder(clOrdID, "VALE3", "a", "b", SELL, enum.OrdType_LIMIT, px,
+			decimal.NewFromInt(10), ""))
+		require.NoError(t, err)
+	}
+	for _, clOrdID := range []string{"1", "5"} {
+		_, err := book.Cancel("a", clOrdID)
+		require.NoError(t, err)
+	}
+	matches, err := book.MatchOrAdd(context.Background(), NewOrder("10", "VALE3", "c", "b", BUY, enum.OrdType_LIMIT, px,
+		decimal.NewFromInt(15), ""))
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	// the canceled head and the filled order are unlinked, the canceled order past the match is left for later
+	level := book.askLevels.Best()
+	require.Equal(t, []string{"3", "4", "5", "6"}, clOrdIDs(level.Orders()))
+	require.Equal(t, 1, level.canceled)
+	require.Equal(t, "5", level.head.LeavesQty().String())
+}
+
+func clOrdIDs(orders []*Order) []string {
+	ids := make([]string, 0, len(orders))
+	for _, o := range orders {
+		ids = append(ids, o.ClOrdID())
+	}
+	return ids
+}
+
+func TestOrderBook_Replace(t *testing.T) {
+	px, _ := decimal.NewFromString("46.72")
+	px2, _ := decimal.NewFromString("46.73")
+	sell := func(clOrdID string, px decimal.Decimal, qty int64) *Order {
+		return NewOrder(clOrdID, "VALE3", "a", "b", SELL, enum.OrdType_LIMIT, px, decimal.NewFromInt(qty), "")
+	}
+	setup := func(t *testing.T) *OrderBook {
+		book := NewOrderBook("VALE3")
+		for _, o := range []*Order{sell("1", px, 100), sell("2", px, 100), sell("3", px2, 100)} {
+			_, err := book.MatchOrAdd(context.Background(), o)
+			require.NoError(t, err)
+		}
+		return book
+	}
+	queue := func(book *OrderBook, px decimal.Decimal) []string {
+		ids := make([]string, 0)
+		for _, o := range book.askLevels.Get(px).Orders() {
+			ids = append(ids, o.ClOrdID())
+		}
+		return ids
+	}
+
+	t.Run("quantity reduction keeps priority", func(t *testing.T) {
+		book := setup(t)
+		matches, err := book.Replace("a", "1", "1b", px, decimal.NewFromInt(60))
+		require.NoError(t, err)
+		require.Empty(t, matches)
+		require.Equal(t, []string{"1b", "2"}, queue(book, px))
+		_, ok := book.Order("a", "1")
+		require.False(t, ok)
+		o, ok := book.Order("a", "1b")
+		require.True(t, ok)
+		require.True(t, o.LeavesQty.Equal(decimal.NewFromInt(60)))
+	})
+	t.Run("quantity increase loses priority", func(t *testing.T) {
+		book := setup(t)
+		_, err := book.Replace("a", "1", "1b", px, decimal.NewFromInt(150))
+		require.NoError(t, err)
+		require.Equal(t, []string{"2", "1b"}, queue(book, px))
+	})
+	t.Run("price change moves level and prunes the old one", func(t *testing.T) {
+		book := setup(t)
+		_, err := book.Replace("a", "3", "3b", px, decimal.NewFromInt(100))
+		require.NoError(t, err)
+		require.Nil(t, book.askLevels.Get(px2))
+		require.Equal(t, []string{"1", "2", "3b"}, queue(book, px))
+	})
+	t.Run("replace into the other side matches", func(t *testing.T) {
+		book := setup(t)
+		bid := NewOrder("10", "VALE3", "c", "b", BUY, enum.OrdType_LIMIT, px.Sub(decimal.NewFromInt(1)), decimal.NewFromInt(150), "")
+		_, err := book.MatchOrAdd(context.Background(), bid)
+		require.NoError(t, err)
+		matches, err := book.Replace("c", "10", "10b", px, decimal.NewFromInt(150))
+		require.NoError(t, err)
+		require.Len(t, matches, 2)
+		require.True(t, bid.ExecutedQuantity().Equal(decimal.NewFromInt(150)))
+		require.Equal(t, "bid:\n\n=====\nask:\n46.72: 50.00\n46.73: 100.00\n", book.Display())
+	})
+	t.Run("partially filled order keeps executed quantity", func(t *testing.T) {
+		book := setup(t)
+		_, err := book.MatchOrAdd(context.Background(), NewOrder("10", "VALE3", "c", "b", BUY, enum.OrdType_LIMIT, px, decimal.NewFromInt(40), ""))
+		require.NoError(t, err)
+		_, err = book.Replace("a", "1", "1b", px, decimal.NewFromInt(40))
+		require.Error(t, err)
+		_, err = book.Replace("a", "1", "1b", px, decimal.NewFromInt(50))
+		require.NoError(t, err)
+		o, _ := book.Order("a", "1b")
+		require.True(t, o.LeavesQty.Equal(decimal.NewFromInt(10)))
+	})
+	t.Run("invalid replaces", func(t *testing.T) {
+		book := setup(t)
+		_, err := book.Replace("a", "9", "9b", px, decimal.NewFromInt(10))
+		require.Error(t, err)
+		_, err = book.Replace("a", "1", "2", px, decimal.NewFromInt(10))
+		require.Error(t, err)
+		_, err = book.Replace("a", "1", "1b", decimal.Zero, decimal.NewFromInt(10))
+		require.Error(t, err)
+	})
+}
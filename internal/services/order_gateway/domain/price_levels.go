@@ -0,0 +1,160 @@
+package domain
+
+import (
+	"github.com/shopspring/decimal"
+	"math/rand/v2"
+)
+
+const (
+	maxSkipListHeight = 24
+	skipListBranching = 4
+)
+
+// priceLevels is a skip list of book levels ordered from the best price to the
+// worst one, so the top of book is always the first node. Lookups, inserts and
+// removals are O(log n) in the number of price levels.
+type priceLevels struct {
+	head   *skipNode
+	height int
+	length int
+	cmp    func(a, b decimal.Decimal) int
+	rnd    *rand.Rand
+}
+
+type skipNode struct {
+	level *bookLevel
+	next  []*skipNode
+}
+
+func newPriceLevels(cmp func(a, b decimal.Decimal) int) *priceLevels {
+	return &priceLevels{
+		head:   &skipNode{next: make([]*skipNode, maxSkipListHeight)},
+		height: 1,
+		cmp:    cmp,
+		// a fixed seed keeps the shape of the list, and therefore benchmarks, reproducible
+		rnd: rand.New(rand.NewPCG(0x5eed, 0xb00c)),
+	}
+}
+
+// newAskLevels orders levels by ascending price.
+func newAskLevels() *priceLevels {
+	return newPriceLevels(func(a, b decimal.Decimal) int {
+		return a.Cmp(b)
+	})
+}
+
+// newBidLevels orders levels by descending price.
+func newBidLevels() *priceLevels {
+	return newPriceLevels(func(a, b decimal.Decimal) int {
+		return b.Cmp(a)
+	})
+}
+
+func (p *priceLevels) Len() int {
+	return p.length
+}
+
+// Best returns the level at the top of the book, or nil when the side is empty.
+func (p *priceLevels) Best() *bookLevel {
+	first := p.head.next[0]
+	if first == nil {
+		return nil
+	}
+	return first.level
+}
+
+// Get returns the level at px, or nil when there is none.
+func (p *priceLevels) Get(px decimal.Decimal) *bookLevel {
+	node := p.head
+	for h := p.height - 1; h >= 0; h-- {
+		for node.next[h] != nil && p.cmp(node.next[h].level.px, px) < 0 {
+			node = node.next[h]
+		}
+	}
+	node = node.next[0]
+	if node != nil && p.cmp(node.level.px, px) == 0 {
+		return node.level
+	}
+	return nil
+}
+
+// GetOrCreate returns the level at px, inserting an empty one if needed.
+func (p *priceLevels) GetOrCreate(px decimal.Decimal) *bookLevel {
+	update := make([]*skipNode, maxSkipListHeight)
+	node := p.head
+	for h := p.height - 1; h >= 0; h-- {
+		for node.next[h] != nil && p.cmp(node.next[h].level.px, px) < 0 {
+			node = node.next[h]
+		}
+		update[h] = node
+	}
+	if next := node.next[0]; next != nil && p.cmp(next.level.px, px) == 0 {
+		return next.level
+	}
+	height := p.randomHeight()
+	for h := p.height; h < height; h++ {
+		update[h] = p.head
+	}
+	if height > p.height {
+		p.height = height
+	}
+	level := newBookLevel(nil, px)
+	inserted := &skipNode{level: level, next: make([]*skipNode, height)}
+	for h := 0; h < height; h++ {
+		inserted.next[h] = update[h].next[h]
+		update[h].next[h] = inserted
+	}
+	p.length++
+	return level
+}
+
+// Delete removes the level at px and reports whether it was present.
+func (p *priceLevels) Delete(px decimal.Decimal) bool {
+	update := make([]*skipNode, maxSkipListHeight)
+	node := p.head
+	for h := p.height - 1; h >= 0; h-- {
+		for node.next[h] != nil && p.cmp(node.next[h].level.px, px) < 0 {
+			node = node.next[h]
+		}
+		update[h] = node
+	}
+	target := node.next[0]
+	if target == nil || p.cmp(target.level.px, px) != 0 {
+		return false
+	}
+	for h := 0; h < len(target.next); h++ {
+		update[h].next[h] = target.next[h]
+	}
+	for p.height > 1 && p.head.next[p.height-1] == nil {
+		p.height--
+	}
+	p.length--
+	return true
+}
+
+// Ascend calls fn for every level from the best price to the worst until fn returns false.
+func (p *priceLevels) Ascend(fn func(level *bookLevel) bool) {
+	for node := p.head.next[0]; node != nil; node = node.next[0] {
+		if !fn(node.level) {
+			return
+		}
+	}
+}
+
+// Levels returns a snapshot of the levels from the best price to the worst.
+func (p *priceLevels) Levels() []*bookLevel {
+	levels := make([]*bookLevel, 0, p.length)
+	p.Ascend(func(level *bookLevel) bool {
+		levels = append(levels, level)
+		return true
+	})
+	return levels
+}
+
+func (p *priceLevels) randomHeight() int {
+	height := 1
+	for height < maxSkipListHeight && p.rnd.IntN(skipListBranching) == 0 {
+		height++
+	}
+	return height
+}
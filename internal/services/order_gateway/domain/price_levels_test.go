@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestPriceLevels_MatchesSortedReference(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		levels *priceLevels
+		less   func(a, b int64) int
+	}{
+		{name: "asks ascending", levels: newAskLevels(), less: func(a, b int64) int { return int(a - b) }},
+		{name: "bids descending", levels: newBidLevels(), less: func(a, b int64) int { return int(b - a) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewPCG(7, 11))
+			reference := make(map[int64]bool)
+			for i := 0; i < 5000; i++ {
+				px := rnd.Int64N(800)
+				if rnd.IntN(3) == 0 {
+					require.Equal(t, reference[px], tt.levels.Delete(decimal.New(px, -2)))
+					delete(reference, px)
+					continue
+				}
+				level := tt.levels.GetOrCreate(decimal.New(px, -2))
+				require.True(t, level.Price().Equal(decimal.New(px, -2)))
+				reference[px] = true
+			}
+			want := make([]int64, 0, len(reference))
+			for px := range reference {
+				want = append(want, px)
+			}
+			slices.SortFunc(want, tt.less)
+
+			got := tt.levels.Levels()
+			require.Equal(t, len(want), tt.levels.Len())
+			require.Len(t, got, len(want))
+			for i, px := range want {
+				require.Truef(t, got[i].Price().Equal(decimal.New(px, -2)), "level %d: got %s want %d", i, got[i].Price(), px)
+				require.Same(t, got[i], tt.levels.Get(decimal.New(px, -2)))
+			}
+			require.Same(t, got[0], tt.levels.Best())
+			require.Nil(t, tt.levels.Get(decimal.New(-1, 0)))
+		})
+	}
+}
+
+func TestBookLevel_RemoveAnywhere(t *testing.T) {
+	orders := restingOrders(nil, 1, 2, 3, 4)
+	level := newBookLevel(orders, decimal.NewFromInt(10))
+	require.Error(t, level.Add(orders[0]))
+
+	require.NoError(t, level.remove(orders[2]))
+	require.NoError(t, level.remove(orders[0]))
+	require.Error(t, level.remove(orders[0]))
+	require.Equal(t, []*Order{orders[1], orders[3]}, level.Orders())
+
+	require.NoError(t, level.remove(orders[3]))
+	require.NoError(t, level.remove(orders[1]))
+	require.True(t, level.IsEmpty())
+	require.Empty(t, level.Orders())
+}
@@ -0,0 +1,318 @@
+package order_gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"time"
+)
+
+var (
+	ErrDuplicateClOrdID = errors.New("duplicate ClOrdID")
+	ErrUnknownOrder     = errors.New("unknown order")
+	ErrOrderNotOpen     = errors.New("order is not open")
+)
+
+// orderRef identifies an order by the CompID that sent it and one of its ClOrdIDs.
+type orderRef struct {
+	senderCompID string
+	clOrdID      string
+}
+
+// AddListener registers l for every event of the matching path.
+func (a *Application) AddListener(l OrderEventListener) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	a.listeners = append(a.listeners, l)
+}
+
+// AddBookListener registers l for every change of every book, including books created later.
+// Book events are delivered before the order events of the same operation.
+func (a *Application) AddBookListener(l domain.BookListener) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	a.bookListeners = append(a.bookListeners, l)
+}
+
+// AddTradingDayListener registers l for every trading date end of day processing starts.
+func (a *Application) AddTradingDayListener(l TradingDayListener) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	a.dayListeners = append(a.dayListeners, l)
+}
+
+// AddDeliveryObserver registers o for every execution report sent to a FIX session.
+func (a *Application) AddDeliveryObserver(o DeliveryObserver) {
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+	a.deliveryObservers = append(a.deliveryObservers, o)
+}
+
+// Quiesce runs fn while the matching path is idle, so that the books and what every
+// listener has been told so far agree.
+func (a *Application) Quiesce(fn func()) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	fn()
+}
+
+// NewOrder builds a domain order with a fresh OrderID, for any entry protocol.
+func (a *Application) NewOrder(clOrdID, symbol, senderCompID, targetCompID string, side domain.OrderSide,
+	ordType enum.OrdType, price, quantity decimal.Decimal) *domain.Order {
+	return domain.NewOrder(clOrdID, symbol, senderCompID, targetCompID, side, ordType, price, quantity, a.nextID())
+}
+
+func (a *Application) newEvent(eventType OrderEventType, view domain.OrderView) ExecReportRequiredEvent {
+	return ExecReportRequiredEvent{
+		Type:         eventType,
+		ExecID:       a.nextID(),
+		Order:        view,
+		TransactTime: time.Now().UTC(),
+		LastQty:      decimal.Zero,
+		LastPx:       decimal.Zero,
+	}
+}
+
+// Submit is the matching path shared by every entry protocol: it acknowledges
+// order, matches it against its book (resting whatever a limit order has left)
+// and publishes the resulting events for both sides of every trade. Orders that
+// cannot be accepted, duplicates, orders the session is not entitled to, orders
+// under a halt or orders that IDs or the audit trail are not available for, are
+// rejected with an event as well as an error.
+func (a *Application) Submit(order *domain.Order) ([]ExecReportRequiredEvent, error) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	ref := orderRef{senderCompID: order.SenderCompID(), clOrdID: order.ClOrdID()}
+	if _, exists := a.ordersByClOrdID[ref]; exists {
+		order.Reject()
+		rejected := a.newEvent(OrderEventRejected, order.View())
+		rejected.Text, rejected.Reason = ErrDuplicateClOrdID.Error(), EventReasonDuplicateClOrdID
+		a.publish([]ExecReportRequiredEvent{rejected})
+		return []ExecReportRequiredEvent{rejected}, ErrDuplicateClOrdID
+	}
+	a.ordersByClOrdID[ref] = order
+	a.orders[order.OrderID()] = order
+	err := a.entitlementError(order, order.Quantity())
+	if err == nil {
+		err = a.accountLimitError(order, order.Price(), order.Quantity(), order.Quantity())
+	}
+	if err == nil {
+		err = a.haltError(order.SenderCompID(), order.Symbol())
+	}
+	if err == nil {
+		err = a.ids.Err()
+	}
+	if err == nil {
+		err = a.auditErr()
+	}
+	if err != nil {
+		order.Reject()
+		rejected := a.newEvent(OrderEventRejected, order.View())
+		rejected.Text, rejected.Reason = err.Error(), eventReason(err)
+		a.publish([]ExecReportRequiredEvent{rejected})
+		return []ExecReportRequiredEvent{rejected}, err
+	}
+
+	book := a.getOrCreateOrderBook(order.Symbol())
+	matches, err := book.MatchOrAdd(context.TODO(), order)
+	if err != nil && len(matches) == 0 {
+		order.Reject()
+		rejected := a.newEvent(OrderEventRejected, order.View())
+		rejected.Text = err.Error()
+		a.publish([]ExecReportRequiredEvent{rejected})
+		return []ExecReportRequiredEvent{rejected}, nil
+	}
+	events := []ExecReportRequiredEvent{a.newEvent(OrderEventNew, viewAfter(order, 0))}
+	events = append(events, a.tradeEvents(order, 0, matches)...)
+	if order.OrdType() == enum.OrdType_MARKET && order.IsOpen() {
+		// market orders never rest, whatever the book could not fill is canceled
+		order.Cancel()
+		events = append(events, a.newEvent(OrderEventCanceled, order.View()))
+	}
+	a.publish(events)
+	return events, nil
+}
+
+// tradeEvents reports every match of aggressor, whose executions before matching were executedBefore.
+func (a *Application) tradeEvents(aggressor *domain.Order, executedBefore int, matches []*domain.Order) []ExecReportRequiredEvent {
+	events := make([]ExecReportRequiredEvent, 0, 2*len(matches))
+	for i, matched := range matches {
+		tradeID := a.nextID()
+		matchedExecutions := matched.Executions()
+		matchedEvent := a.newEvent(OrderEventTrade, matched.View())
+		matchedEvent.TradeID = tradeID
+		lastExecution := matchedExecutions[len(matchedExecutions)-1]
+		matchedEvent.LastQty = lastExecution.Quantity()
+		matchedEvent.LastPx = lastExecution.Price()
+
+		n := executedBefore + i + 1
+		aggressorEvent := a.newEvent(OrderEventTrade, viewAfter(aggressor, n))
+		aggressorEvent.LastQty = aggressor.Executions()[n-1].Quantity()
+		aggressorEvent.LastPx = aggressor.Executions()[n-1].Price()
+		aggressorEvent.TradeID = tradeID
+		aggressorEvent.Aggressor = true
+		trade := a.recordTrade(matchedEvent, aggressorEvent, matched, aggressor, len(matchedExecutions)-1, n-1)
+		matchedEvent.Fee, matchedEvent.FeeRate = trade.side(matched).fee, trade.side(matched).feeRate
+		aggressorEvent.Fee, aggressorEvent.FeeRate = trade.side(aggressor).fee, trade.side(aggressor).feeRate
+		events = append(events, matchedEvent, aggressorEvent)
+	}
+	return events
+}
+
+// viewAfter copies order as it was right after its first n executions, taking the
+// later ones off its totals, which also count executions a restored order has no
+// record of.
+func viewAfter(order *domain.Order, n int) domain.OrderView {
+	view := order.View()
+	executions := order.Executions()
+	if n >= len(executions) {
+		return view
+	}
+	executed, notional := view.ExecutedQuantity, view.ExecutedNotional
+	for _, execution := range executions[n:] {
+		executed = executed.Sub(execution.Quantity())
+		notional = notional.Sub(execution.Quantity().Mul(execution.Price()))
+	}
+	view.ExecutedQuantity = executed
+	view.ExecutedNotional = notional
+	view.LeavesQty = view.Quantity.Sub(executed)
+	if view.Status == domain.OrderStatusFilled {
+		view.Status = domain.OrderStatusOpen
+	}
+	return view
+}
+
+// Cancel cancels the resting order senderCompID sent as origClOrdID.
+func (a *Application) Cancel(senderCompID, origClOrdID string) (ExecReportRequiredEvent, error) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	order, ok := a.ordersByClOrdID[orderRef{senderCompID: senderCompID, clOrdID: origClOrdID}]
+	if !ok {
+		return ExecReportRequiredEvent{}, ErrUnknownOrder
+	}
+	if !order.IsOpen() {
+		return ExecReportRequiredEvent{}, ErrOrderNotOpen
+	}
+	book, ok := a.OrderBook(order.Symbol())
+	if !ok {
+		return ExecReportRequiredEvent{}, ErrUnknownOrder
+	}
+	_, err := book.Cancel(senderCompID, order.ClOrdID())
+	if err != nil {
+		return ExecReportRequiredEvent{}, fmt.Errorf("%w: %s", ErrOrderNotOpen, err)
+	}
+	event := a.newEvent(OrderEventCanceled, order.View())
+	event.OrigClOrdID = origClOrdID
+	a.publish([]ExecReportRequiredEvent{event})
+	return event, nil
+}
+
+// Replace amends price and quantity of the resting order senderCompID sent as
+// origClOrdID, renaming it clOrdID; the amended order may trade right away.
+func (a *Application) Replace(senderCompID, origClOrdID, clOrdID string, price, quantity decimal.Decimal) ([]ExecReportRequiredEvent, error) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	order, ok := a.ordersByClOrdID[orderRef{senderCompID: senderCompID, clOrdID: origClOrdID}]
+	if !ok {
+		return nil, ErrUnknownOrder
+	}
+	if !order.IsOpen() {
+		return nil, ErrOrderNotOpen
+	}
+	newRef := orderRef{senderCompID: senderCompID, clOrdID: clOrdID}
+	if _, exists := a.ordersByClOrdID[newRef]; exists {
+		return nil, ErrDuplicateClOrdID
+	}
+	if err := a.entitlementError(order, quantity); err != nil {
+		return nil, err
+	}
+	if err := a.accountLimitError(order, price, quantity, quantity.Sub(order.ExecutedQuantity())); err != nil {
+		return nil, err
+	}
+	if err := a.haltError(senderCompID, order.Symbol()); err != nil {
+		return nil, err
+	}
+	if err := a.ids.Err(); err != nil {
+		return nil, err
+	}
+	if err := a.auditErr(); err != nil {
+		return nil, err
+	}
+	book, ok := a.OrderBook(order.Symbol())
+	if !ok {
+		return nil, ErrUnknownOrder
+	}
+	executedBefore := len(order.Executions())
+	matches, err := book.Replace(senderCompID, order.ClOrdID(), clOrdID, price, quantity)
+	if err != nil {
+		return nil, err
+	}
+	a.ordersByClOrdID[newRef] = order
+	replaced := a.newEvent(OrderEventReplaced, viewAfter(order, executedBefore))
+	replaced.OrigClOrdID = origClOrdID
+	events := []ExecReportRequiredEvent{replaced}
+	events = append(events, a.tradeEvents(order, executedBefore, matches)...)
+	a.publish(events)
+	return events, nil
+}
+
+// LookupOrder returns the current state of the order senderCompID sent as clOrdID,
+// or replaced into clOrdID.
+func (a *Application) LookupOrder(senderCompID, clOrdID string) (domain.OrderView, bool) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	order, ok := a.ordersByClOrdID[orderRef{senderCompID: senderCompID, clOrdID: clOrdID}]
+	if !ok {
+		return domain.OrderView{}, false
+	}
+	return order.View(), true
+}
+
+// LookupOrderByID returns the current state of an order by its OrderID.
+func (a *Application) LookupOrderByID(orderID string) (domain.OrderView, bool) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	order, ok := a.orders[orderID]
+	if !ok {
+		return domain.OrderView{}, false
+	}
+	return order.View(), true
+}
+
+// OpenOrders lists the orders of senderCompID still working, or of every CompID when it is empty.
+func (a *Application) OpenOrders(senderCompID string) []domain.OrderView {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	views := make([]domain.OrderView, 0)
+	for _, order := range a.orders {
+		if order.IsOpen() && (senderCompID == "" || order.SenderCompID() == senderCompID) {
+			views = append(views, order.View())
+		}
+	}
+	slices.SortFunc(views, func(x, y domain.OrderView) int {
+		return x.CreatedAt.Compare(y.CreatedAt)
+	})
+	return views
+}
+
+// publishBookEvent runs under the book lock, itself only taken on the matching path.
+func (a *Application) publishBookEvent(event domain.BookEvent) {
+	for _, l := range a.bookListeners {
+		l.OnBookEvent(event)
+	}
+}
+
+// publish audits events and hands them to every listener and to the FIX session of each order owner.
+func (a *Application) publish(events []ExecReportRequiredEvent) {
+	a.auditEvents(events)
+	for _, event := range events {
+		for _, l := range a.listeners {
+			l.OnOrderEvent(event)
+		}
+	}
+	a.deliverFIX(events)
+}
@@ -0,0 +1,86 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+)
+
+type recordingListener struct {
+	events []ExecReportRequiredEvent
+}
+
+func (l *recordingListener) OnOrderEvent(event ExecReportRequiredEvent) {
+	l.events = append(l.events, event)
+}
+
+func (l *recordingListener) types() []OrderEventType {
+	types := make([]OrderEventType, 0, len(l.events))
+	for _, event := range l.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestApplication_Submit(t *testing.T) {
+	app := NewApplication()
+	listener := &recordingListener{}
+	app.AddListener(listener)
+
+	sell := app.NewOrder("s1", "VALE3", "A", "EX", domain.SELL, enum.OrdType_LIMIT, decimal.NewFromInt(10), decimal.NewFromInt(100))
+	_, err := app.Submit(sell)
+	require.NoError(t, err)
+	buy := app.NewOrder("b1", "VALE3", "B", "EX", domain.BUY, enum.OrdType_MARKET, decimal.Zero, decimal.NewFromInt(150))
+	_, err = app.Submit(buy)
+	require.NoError(t, err)
+
+	require.Equal(t, []OrderEventType{OrderEventNew, OrderEventNew, OrderEventTrade, OrderEventTrade, OrderEventCanceled}, listener.types())
+	require.Equal(t, "s1", listener.events[2].Order.ClOrdID)
+	require.True(t, listener.events[2].IsFill())
+	aggressorTrade := listener.events[3]
+	require.Equal(t, "b1", aggressorTrade.Order.ClOrdID)
+	require.False(t, aggressorTrade.IsFill())
+	require.True(t, aggressorTrade.LastQty.Equal(decimal.NewFromInt(100)))
+	require.True(t, aggressorTrade.Order.LeavesQty.Equal(decimal.NewFromInt(50)))
+	require.Equal(t, domain.OrderStatus(domain.OrderStatusCanceled), listener.events[4].Order.Status)
+
+	execIDs := make(map[string]bool)
+	for _, event := range listener.events {
+		require.False(t, execIDs[event.ExecID], "exec id %s reused", event.ExecID)
+		execIDs[event.ExecID] = true
+	}
+
+	dup := app.NewOrder("s1", "VALE3", "A", "EX", domain.SELL, enum.OrdType_LIMIT, decimal.NewFromInt(10), decimal.NewFromInt(1))
+	_, err = app.Submit(dup)
+	require.ErrorIs(t, err, ErrDuplicateClOrdID)
+	require.Equal(t, OrderEventRejected, listener.events[len(listener.events)-1].Type)
+}
+
+func TestApplication_CancelAndReplace(t *testing.T) {
+	app := NewApplication()
+	order := app.NewOrder("o1", "VALE3", "A", "EX", domain.BUY, enum.OrdType_LIMIT, decimal.NewFromInt(10), decimal.NewFromInt(100))
+	_, err := app.Submit(order)
+	require.NoError(t, err)
+
+	events, err := app.Replace("A", "o1", "o2", decimal.NewFromInt(11), decimal.NewFromInt(100))
+	require.NoError(t, err)
+	require.Equal(t, OrderEventReplaced, events[0].Type)
+	require.Equal(t, "o1", events[0].OrigClOrdID)
+	_, err = app.Replace("A", "o2", "o1", decimal.NewFromInt(11), decimal.NewFromInt(100))
+	require.ErrorIs(t, err, ErrDuplicateClOrdID)
+
+	view, ok := app.LookupOrder("A", "o1")
+	require.True(t, ok)
+	require.Equal(t, "o2", view.ClOrdID)
+
+	_, err = app.Cancel("A", "missing")
+	require.ErrorIs(t, err, ErrUnknownOrder)
+	event, err := app.Cancel("A", "o2")
+	require.NoError(t, err)
+	require.Equal(t, OrderEventCanceled, event.Type)
+	_, err = app.Cancel("A", "o2")
+	require.ErrorIs(t, err, ErrOrderNotOpen)
+	require.Empty(t, app.OpenOrders("A"))
+}
@@ -0,0 +1,186 @@
+package order_gateway
+
+import (
+	"errors"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"log"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+)
+
+// End of day processing expires the DAY orders and the GTD orders due, carries the
+// others to the next trading date and rolls the journal and the audit trail over to it. The day's reports
+// are built from its journal alone, so that they can be built again from the file,
+// but for the clearing netting, which is taken from the trade store and reconciled
+// with the journal.
+
+// EndOfDayResult is what the end of a trading date came to.
+type EndOfDayResult struct {
+	TradingDate     string
+	NextTradingDate string
+	Expired         int
+	Carried         int
+	Prices          []ClosingPrice
+	// Clearing is the netting of the trade store, reconciled with the journal when there is one
+	Clearing ClearingReport
+	// ReportDir is where the reports were written, empty without a journal or reports directory
+	ReportDir string
+}
+
+// TradingDayListener is told of the trading date end of day processing starts, once the
+// orders of the date closed were expired. It runs under the engine lock.
+type TradingDayListener interface {
+	OnTradingDay(date string)
+}
+
+// WithReportsDir writes the end of day reports of every trading date under dir.
+func WithReportsDir(dir string) Option {
+	return func(a *Application) {
+		a.reportsDir = dir
+	}
+}
+
+// TradingDate is the trading date orders are taken for, as YYYYMMDD.
+func (a *Application) TradingDate() string {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	return a.tradingDate
+}
+
+// EndOfDay closes the trading date: the orders it ends are expired and reported to
+// their owners, and the next trading date starts with the GTC and GTD orders left and
+// the positions open, without the trades of the day closed. Its reports are then written
+// from its journal, and its settlement prices become the prior settlement prices of
+// position reports. Its trades are netted for clearing before they are forgotten.
+// When the journal or the audit trail cannot be rolled over the trading date stays
+// open, its orders expired, for EndOfDay to be run again.
+func (a *Application) EndOfDay() (EndOfDayResult, error) {
+	a.engineMu.Lock()
+	date := a.tradingDate
+	result := EndOfDayResult{TradingDate: date, NextTradingDate: nextTradingDate(date)}
+	expired := a.expireOrders(date)
+	a.publish(expired)
+	result.Expired = len(expired)
+	for _, order := range a.orders {
+		if order.IsOpen() {
+			result.Carried++
+		}
+	}
+	store := a.tradeStoreExecutions()
+	var rollErr error
+	if a.journal != nil {
+		rollErr = a.journal.roll(result.NextTradingDate, a.restingOrders(), a.openPositions())
+	}
+	if rollErr == nil && a.audit != nil {
+		rollErr = a.audit.roll(result.NextTradingDate)
+		if rollErr != nil && a.journal != nil {
+			rollErr = errors.Join(rollErr, a.journal.unroll(date))
+		}
+	}
+	if rollErr != nil {
+		a.engineMu.Unlock()
+		return result, fmt.Errorf("error rolling the journal or audit trail over to %s, trading date %s stays open: %s",
+			result.NextTradingDate, date, rollErr)
+	}
+	a.startTradingDay(result.NextTradingDate)
+	for _, l := range a.dayListeners {
+		l.OnTradingDay(result.NextTradingDate)
+	}
+	a.engineMu.Unlock()
+	if err := a.volumes.Flush(); err != nil {
+		return result, fmt.Errorf("error saving the monthly volumes: %s", err)
+	}
+	if a.journal == nil {
+		result.Clearing = ClearingReport{TradingDate: date, Rows: a.netting(store, date)}
+		return result, nil
+	}
+
+	events, err := ReadJournal(JournalFileName(a.journal.dir, date))
+	if err != nil {
+		return result, err
+	}
+	report := BuildDayReport(date, events, a.firm)
+	result.Prices = report.Prices
+	result.Clearing = a.clearingReport(date, store, report)
+	a.engineMu.Lock()
+	for _, price := range report.Prices {
+		a.settlements[price.Symbol] = price.Settlement
+	}
+	a.engineMu.Unlock()
+	if a.reportsDir == "" {
+		return result, nil
+	}
+	result.ReportDir, err = WriteDayReport(a.reportsDir, report)
+	if err != nil {
+		return result, err
+	}
+	return result, WriteClearingReport(a.reportsDir, result.Clearing)
+}
+
+// expires reports whether order stops working at the end of trading date.
+func expires(order *domain.Order, date string) bool {
+	switch order.TimeInForce() {
+	case enum.TimeInForce_GOOD_TILL_CANCEL:
+		return false
+	case enum.TimeInForce_GOOD_TILL_DATE:
+		return order.ExpireDate() <= date
+	default:
+		return true
+	}
+}
+
+// expireOrders takes the orders that end with trading date off their books, in the
+// order they were sent. It runs under the engine lock.
+func (a *Application) expireOrders(date string) []ExecReportRequiredEvent {
+	orders := make([]*domain.Order, 0)
+	for _, order := range a.orders {
+		if order.IsOpen() && expires(order, date) {
+			orders = append(orders, order)
+		}
+	}
+	slices.SortFunc(orders, func(x, y *domain.Order) int {
+		return x.CreatedAt().Compare(y.CreatedAt())
+	})
+	events := make([]ExecReportRequiredEvent, 0, len(orders))
+	for _, order := range orders {
+		book, ok := a.OrderBook(order.Symbol())
+		if !ok {
+			continue
+		}
+		if _, err := book.Cancel(order.SenderCompID(), order.ClOrdID()); err != nil {
+			log.Printf("failed to expire order %s at end of day: %s", order.OrderID(), err)
+			continue
+		}
+		event := a.newEvent(OrderEventExpired, order.View())
+		event.Text = "end of trading date " + date
+		events = append(events, event)
+	}
+	return events
+}
+
+// startTradingDay forgets the orders done, the trades and allocations of the day closed
+// and the positions it closed, carries the open ones with their daily quantities and
+// realized P&L reset, and starts the IDs of date over. ClOrdIDs of the orders done may
+// be sent again. It runs under the engine lock.
+func (a *Application) startTradingDay(date string) {
+	a.tradingDate = date
+	a.ids.startDay(a.journal, date)
+	a.volumes.startDay(date)
+	for orderID, order := range a.orders {
+		if !order.IsOpen() {
+			delete(a.orders, orderID)
+		}
+	}
+	for ref, order := range a.ordersByClOrdID {
+		if !order.IsOpen() {
+			delete(a.ordersByClOrdID, ref)
+		}
+	}
+	a.trades = make(map[string]*Trade)
+	a.symbolTrades = make(map[string][]*Trade)
+	a.lastPrices = make(map[string]decimal.Decimal)
+	a.carryPositions(a.openPositions())
+	a.allocations = nil
+}
@@ -0,0 +1,354 @@
+package order_gateway
+
+import (
+	"encoding/json"
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix44nos "github.com/quickfixgo/fix44/newordersingle"
+	"github.com/quickfixgo/quickfix"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+type eventRecorder []ExecReportRequiredEvent
+
+func (r *eventRecorder) OnOrderEvent(event ExecReportRequiredEvent) {
+	*r = append(*r, event)
+}
+
+func TestApplication_EndOfDay(t *testing.T) {
+	journalDir, reportsDir := t.TempDir(), t.TempDir()
+	// a Friday, followed by the Monday
+	journal, err := OpenJournal(journalDir, "20260306")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = journal.Close() })
+	app := NewApplication(WithJournal(journal), WithReportsDir(reportsDir), WithSessions(Sessions{"A": {CompID: "A", Firm: "FIRMA"}}))
+	var events eventRecorder
+	app.AddListener(&events)
+	submit := func(clOrdID, sender string, side domain.OrderSide, price, qty int64, timeInForce enum.TimeInForce, expireDate string) {
+		order := app.NewOrder(clOrdID, "VALE3", sender, "EX", side, enum.OrdType_LIMIT, decimal.NewFromInt(price), decimal.NewFromInt(qty))
+		order.SetTimeInForce(timeInForce, expireDate)
+		_, err := app.Submit(order)
+		require.NoError(t, err)
+	}
+	submit("s1", "A", domain.SELL, 10, 100, enum.TimeInForce_DAY, "")
+	submit("s2", "A", domain.SELL, 12, 50, enum.TimeInForce_GOOD_TILL_CANCEL, "")
+	submit("b1", "B", domain.BUY, 10, 40, enum.TimeInForce_DAY, "")
+	submit("b2", "B", domain.BUY, 12, 70, enum.TimeInForce_DAY, "")
+	_, err = app.CorrectTrade(app.Trades("")[0].TradeID, decimal.NewFromInt(10), decimal.NewFromInt(30), "")
+	require.NoError(t, err)
+	submit("b3", "B", domain.BUY, 9, 10, enum.TimeInForce_GOOD_TILL_DATE, "20260306")
+	submit("b4", "B", domain.BUY, 8, 10, enum.TimeInForce_GOOD_TILL_DATE, "20260310")
+	submit("b5", "B", domain.BUY, 7, 10, enum.TimeInForce_DAY, "")
+
+	events = nil
+	result, err := app.EndOfDay()
+	require.NoError(t, err)
+	require.Equal(t, "20260306", result.TradingDate)
+	require.Equal(t, "20260309", result.NextTradingDate)
+	require.Equal(t, 2, result.Expired)
+	require.Equal(t, 2, result.Carried)
+	require.Equal(t, filepath.Join(reportsDir, "20260306"), result.ReportDir)
+	require.Len(t, events, 2)
+	for i, clOrdID := range []string{"b3", "b5"} {
+		require.Equal(t, OrderEventExpired, events[i].Type)
+		require.Equal(t, clOrdID, events[i].Order.ClOrdID)
+		require.Equal(t, "end of trading date 20260306", events[i].Text)
+	}
+	// trades of 30 and 60 at 10, and 10 at 12
+	require.Len(t, result.Prices, 1)
+	price := result.Prices[0]
+	for _, want := range [][2]string{{"10", price.Open.String()}, {"12", price.High.String()}, {"10", price.Low.String()},
+		{"12", price.Close.String()}, {"10.2", price.Settlement.String()}, {"100", price.Volume.String()}} {
+		require.Equal(t, want[0], want[1])
+	}
+	require.Equal(t, 3, price.Trades)
+	// the trade store agrees with the journal, the correction included
+	require.Empty(t, result.Clearing.Breaks)
+	require.Len(t, result.Clearing.Rows, 2)
+	require.Equal(t, "B", result.Clearing.Rows[0].ClearingFirm)
+	require.Equal(t, "1020", result.Clearing.Rows[0].BoughtValue.String())
+	require.Equal(t, "20260310", result.Clearing.Rows[0].SettlementDate)
+	require.Equal(t, "-100", result.Clearing.Rows[1].NetQty.String())
+
+	// the correction left s1 done for day, and the next trading date starts with the orders and
+	// positions carried, without the trades nor what the day closed bought, sold and realized
+	require.Equal(t, "20260309", app.TradingDate())
+	require.Empty(t, app.Trades(""))
+	carried := app.Positions("")
+	require.Len(t, carried, 2)
+	require.Equal(t, "-100", carried[0].Quantity.String())
+	require.Equal(t, "100", carried[1].Quantity.String())
+	require.Equal(t, "10.2", carried[1].AvgCost.String())
+	require.True(t, carried[1].BoughtQty.IsZero())
+	require.True(t, carried[1].RealizedPnL.IsZero())
+	open := app.OpenOrders("")
+	require.Len(t, open, 2)
+	require.Equal(t, "s2", open[0].ClOrdID)
+	require.Equal(t, "40", open[0].LeavesQty.String())
+	require.Equal(t, "b4", open[1].ClOrdID)
+	submit("b1", "B", domain.BUY, 12, 5, enum.TimeInForce_DAY, "")
+	positions := app.Positions("B")
+	require.Len(t, positions, 1)
+	require.Equal(t, "10.2", positions[0].PriorSettlPrice.String())
+	require.Equal(t, "105", positions[0].Quantity.String())
+	require.Equal(t, "5", positions[0].BoughtQty.String())
+
+	// a restart carries the positions in again from the journal
+	restartJournal, err := OpenJournal(journalDir, "20260309")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = restartJournal.Close() })
+	restarted := NewApplication(WithJournal(restartJournal))
+	_, err = restarted.RecoverOrders()
+	require.NoError(t, err)
+	want, got := app.Positions(""), restarted.Positions("")
+	require.Len(t, got, len(want))
+	for i := range want {
+		require.Equal(t, want[i].Account, got[i].Account)
+		require.Equal(t, want[i].Quantity.String(), got[i].Quantity.String())
+		require.Equal(t, want[i].AvgCost.String(), got[i].AvgCost.String())
+		require.Equal(t, want[i].BoughtQty.String(), got[i].BoughtQty.String())
+		require.Equal(t, want[i].SoldQty.String(), got[i].SoldQty.String())
+		require.Equal(t, want[i].RealizedPnL.String(), got[i].RealizedPnL.String())
+	}
+
+	// a bust of the day goes back to the position carried
+	_, err = app.BustTrade(app.Trades("")[0].TradeID, "")
+	require.NoError(t, err)
+	positions = app.Positions("B")
+	require.Equal(t, "100", positions[0].Quantity.String())
+	require.Equal(t, "10.2", positions[0].AvgCost.String())
+	require.True(t, positions[0].BoughtQty.IsZero())
+	_, err = os.Stat(JournalFileName(journalDir, "20260309"))
+	require.NoError(t, err)
+
+	prices, err := os.ReadFile(filepath.Join(result.ReportDir, "prices.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "symbol,open,high,low,close,settlement,volume,notional,trades\nVALE3,10,12,10,12,10.2,100,1020,3\n", string(prices))
+	clearing, err := os.ReadFile(filepath.Join(result.ReportDir, "clearing.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "clearing_firm,symbol,settlement_date,executions,bought_qty,bought_value,sold_qty,sold_value,net_qty,net_cash\n"+
+		"B,VALE3,20260310,3,100,1020,0,0,100,-1020\nFIRMA,VALE3,20260310,3,0,0,100,1020,-100,1020\n", string(clearing))
+	for _, name := range []string{"clearing.txt", "clearing.json", "clearing_breaks.csv", "clearing_breaks.json"} {
+		_, err = os.Stat(filepath.Join(result.ReportDir, name))
+		require.NoError(t, err)
+	}
+	orders, err := os.ReadFile(filepath.Join(result.ReportDir, "FIRMA", "orders.csv"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(orders)), "\n")
+	require.Len(t, lines, 3)
+	require.True(t, strings.HasSuffix(lines[1], ",s1,A,,VALE3,sell,limit,day,,10,100,90,0,10,done for day"), lines[1])
+	require.True(t, strings.HasSuffix(lines[2], ",s2,A,,VALE3,sell,limit,gtc,,12,50,10,40,12,open"), lines[2])
+
+	var executions []ReportExecution
+	data, err := os.ReadFile(filepath.Join(result.ReportDir, "B", "trades.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &executions))
+	require.Len(t, executions, 3)
+	require.Equal(t, TradeCorrected, executions[0].Status)
+	require.Equal(t, "30", executions[0].Quantity.String())
+	require.Equal(t, "taker", executions[0].Liquidity)
+
+	var positionReport []ReportPosition
+	data, err = os.ReadFile(filepath.Join(result.ReportDir, "FIRMA", "positions.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &positionReport))
+	require.Len(t, positionReport, 1)
+	require.Equal(t, "100", positionReport[0].ShortQty.String())
+	require.Equal(t, "10.2", positionReport[0].AvgCost.String())
+	require.Equal(t, "-180", positionReport[0].UnrealizedPnL.String())
+	for _, firm := range []string{"FIRMA", "B"} {
+		for _, name := range []string{"orders", "trades", "positions", "fees"} {
+			for _, ext := range []string{".csv", ".json"} {
+				_, err = os.Stat(filepath.Join(result.ReportDir, firm, name+ext))
+				require.NoError(t, err)
+			}
+		}
+	}
+}
+
+func TestTimeInForceOf(t *testing.T) {
+	tests := []struct {
+		name        string
+		fields      []quickfix.FieldWriter
+		timeInForce enum.TimeInForce
+		expireDate  string
+		err         string
+	}{
+		{"absent", nil, enum.TimeInForce_DAY, "", ""},
+		{"gtc", []quickfix.FieldWriter{field.NewTimeInForce(enum.TimeInForce_GOOD_TILL_CANCEL)},
+			enum.TimeInForce_GOOD_TILL_CANCEL, "", ""},
+		{"gtd date", []quickfix.FieldWriter{field.NewTimeInForce(enum.TimeInForce_GOOD_TILL_DATE), field.NewExpireDate("20260310")},
+			enum.TimeInForce_GOOD_TILL_DATE, "20260310", ""},
+		{"gtd time", []quickfix.FieldWriter{field.NewTimeInForce(enum.TimeInForce_GOOD_TILL_DATE),
+			field.NewExpireTime(time.Date(2026, 3, 10, 23, 30, 0, 0, time.UTC))}, enum.TimeInForce_GOOD_TILL_DATE, "20260310", ""},
+		{"gtd bad date", []quickfix.FieldWriter{field.NewTimeInForce(enum.TimeInForce_GOOD_TILL_DATE),
+			field.NewExpireDate("10/03/2026")}, "", "", "Value is incorrect"},
+		{"gtd without expiry", []quickfix.FieldWriter{field.NewTimeInForce(enum.TimeInForce_GOOD_TILL_DATE)}, "", "",
+			"Required tag missing"},
+		{"ioc", []quickfix.FieldWriter{field.NewTimeInForce(enum.TimeInForce_IMMEDIATE_OR_CANCEL)}, "", "", "Value is incorrect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nos := fix44nos.New(field.NewClOrdID("N1"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()),
+				field.NewOrdType(enum.OrdType_LIMIT))
+			for _, f := range tt.fields {
+				nos.Set(f)
+			}
+			timeInForce, expireDate, err := timeInForceOf(nos)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.timeInForce, timeInForce)
+			require.Equal(t, tt.expireDate, expireDate)
+		})
+	}
+}
+
+func TestNextTradingDate(t *testing.T) {
+	require.Equal(t, "20260303", nextTradingDate("20260302"))
+	require.Equal(t, "20260309", nextTradingDate("20260306"))
+	require.Equal(t, "20260309", nextTradingDate("20260307"))
+}
+
+func TestApplication_RecoverOrders(t *testing.T) {
+	journalDir := t.TempDir()
+	journal, err := OpenJournal(journalDir, "20260306")
+	require.NoError(t, err)
+	app := NewApplication(WithJournal(journal))
+	submit := func(app *Application, clOrdID string, side domain.OrderSide, price, qty int64, timeInForce enum.TimeInForce, expireDate string) error {
+		order := app.NewOrder(clOrdID, "VALE3", "A", "EX", side, enum.OrdType_LIMIT, decimal.NewFromInt(price), decimal.NewFromInt(qty))
+		order.SetTimeInForce(timeInForce, expireDate)
+		_, err := app.Submit(order)
+		return err
+	}
+	require.NoError(t, submit(app, "s1", domain.SELL, 12, 50, enum.TimeInForce_GOOD_TILL_CANCEL, ""))
+	require.NoError(t, submit(app, "s2", domain.SELL, 12, 30, enum.TimeInForce_GOOD_TILL_CANCEL, ""))
+	require.NoError(t, submit(app, "b1", domain.BUY, 9, 10, enum.TimeInForce_GOOD_TILL_DATE, "20260310"))
+	require.NoError(t, submit(app, "b2", domain.BUY, 8, 10, enum.TimeInForce_DAY, ""))
+	result, err := app.EndOfDay()
+	require.NoError(t, err)
+	require.Equal(t, 3, result.Carried)
+
+	// on the next trading date s1 loses its place to a larger quantity, s3 is done and s4 rests
+	_, err = app.Replace("A", "s1", "s1a", decimal.NewFromInt(12), decimal.NewFromInt(60))
+	require.NoError(t, err)
+	require.NoError(t, submit(app, "s3", domain.SELL, 9, 4, enum.TimeInForce_DAY, ""))
+	require.NoError(t, submit(app, "s4", domain.SELL, 13, 5, enum.TimeInForce_DAY, ""))
+	require.NoError(t, journal.Close())
+
+	date, ok, err := LatestTradingDate(journalDir)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "20260309", date)
+	journal, err = OpenJournal(journalDir, date)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = journal.Close() })
+	restarted := NewApplication(WithJournal(journal))
+	n, err := restarted.RecoverOrders()
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	want, got := app.OpenOrders(""), restarted.OpenOrders("")
+	require.Len(t, got, len(want))
+	for i := range want {
+		require.Equal(t, want[i].OrderID, got[i].OrderID)
+		require.Equal(t, want[i].ClOrdID, got[i].ClOrdID)
+		require.Equal(t, want[i].LeavesQty.String(), got[i].LeavesQty.String())
+		require.Equal(t, want[i].TimeInForce, got[i].TimeInForce)
+	}
+	book, ok := restarted.OrderBook("VALE3")
+	require.True(t, ok)
+	depth := book.L3()
+	require.Len(t, depth.Asks, 2)
+	require.Equal(t, "s2", depth.Asks[0].Orders[0].ClOrdID)
+	require.Equal(t, "s1a", depth.Asks[0].Orders[1].ClOrdID)
+	require.Equal(t, "6", depth.Bids[0].Orders[0].LeavesQty.String())
+	for _, clOrdID := range []string{"s1", "s1a", "s3"} {
+		require.ErrorIs(t, submit(restarted, clOrdID, domain.SELL, 14, 1, enum.TimeInForce_DAY, ""), ErrDuplicateClOrdID)
+	}
+	require.NoError(t, submit(restarted, "b2", domain.BUY, 8, 10, enum.TimeInForce_DAY, ""))
+
+	// the trade of s3 and the position it made are back, and can be busted
+	trades := restarted.Trades("VALE3")
+	require.Len(t, trades, 1)
+	require.Equal(t, app.Trades("VALE3")[0].TradeID, trades[0].TradeID)
+	require.Equal(t, "4", trades[0].Quantity.String())
+	positions := restarted.Positions("A")
+	require.Len(t, positions, 1)
+	require.Equal(t, "4", positions[0].BoughtQty.String())
+	require.Equal(t, "9", positions[0].MarkPrice.String())
+
+	// b1 sweeps two levels, its first fill counting the 4 it had before the restart
+	events, err := restarted.Replace("A", "b1", "b1a", decimal.NewFromInt(12), decimal.NewFromInt(40))
+	require.NoError(t, err)
+	fills := make([]domain.OrderView, 0)
+	for _, event := range events {
+		if event.Type == OrderEventTrade && event.Aggressor {
+			fills = append(fills, event.Order)
+		}
+	}
+	require.Len(t, fills, 2)
+	require.Equal(t, "34", fills[0].ExecutedQuantity.String())
+	require.Equal(t, "6", fills[0].LeavesQty.String())
+	require.Equal(t, "40", fills[1].ExecutedQuantity.String())
+
+	_, err = restarted.BustTrade(trades[0].TradeID, "")
+	require.NoError(t, err)
+	order, ok := restarted.LookupOrder("A", "b1a")
+	require.True(t, ok)
+	require.Equal(t, "36", order.ExecutedQuantity.String())
+
+	// the trade store nets the trades of before the restart as the journal does
+	result, err = restarted.EndOfDay()
+	require.NoError(t, err)
+	require.Empty(t, result.Clearing.Breaks)
+}
+
+func TestApplication_EndOfDayRollFailure(t *testing.T) {
+	journalDir, auditDir := t.TempDir(), t.TempDir()
+	journal, err := OpenJournal(journalDir, "20260306")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = journal.Close() })
+	trail, err := OpenAuditTrail(auditDir, "20260306")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = trail.Close() })
+	app := NewApplication(WithJournal(journal), WithAuditTrail(trail))
+	submit := func(clOrdID string) {
+		order := app.NewOrder(clOrdID, "VALE3", "A", "EX", domain.BUY, enum.OrdType_LIMIT, decimal.NewFromInt(10), decimal.NewFromInt(10))
+		order.SetTimeInForce(enum.TimeInForce_GOOD_TILL_CANCEL, "")
+		_, err := app.Submit(order)
+		require.NoError(t, err)
+	}
+	submit("b1")
+
+	// neither the journal nor the audit trail of the next trading date can be started
+	for _, fileName := range []string{JournalFileName(journalDir, "20260309"), AuditFileName(auditDir, "20260309")} {
+		require.NoError(t, os.Mkdir(fileName, 0o755))
+		_, err = app.EndOfDay()
+		require.ErrorContains(t, err, "trading date 20260306 stays open")
+		require.Equal(t, "20260306", app.TradingDate())
+		require.NoError(t, os.Remove(fileName))
+		_, err = os.Stat(JournalFileName(journalDir, "20260309"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+	submit("b2")
+	events, err := ReadJournal(JournalFileName(journalDir, "20260306"))
+	require.NoError(t, err)
+	require.Equal(t, "b2", events[len(events)-1].Order.ClOrdID)
+	records, err := ReadAuditTrail(AuditFileName(auditDir, "20260306"))
+	require.NoError(t, err)
+	require.Equal(t, "b2", records[len(records)-1].ClOrdID)
+
+	result, err := app.EndOfDay()
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Carried)
+	require.Equal(t, "20260309", app.TradingDate())
+}
@@ -0,0 +1,120 @@
+package order_gateway
+
+import (
+	"errors"
+	"github.com/shopspring/decimal"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"time"
+)
+
+type OrderEventType int
+
+const (
+	OrderEventNew      OrderEventType = 1
+	OrderEventTrade    OrderEventType = 2
+	OrderEventCanceled OrderEventType = 3
+	OrderEventReplaced OrderEventType = 4
+	OrderEventRejected OrderEventType = 5
+	OrderEventExpired  OrderEventType = 6
+	// OrderEventTradeCanceled and OrderEventTradeCorrected restate a trade of the order after the fact.
+	OrderEventTradeCanceled  OrderEventType = 7
+	OrderEventTradeCorrected OrderEventType = 8
+)
+
+func (t OrderEventType) String() string {
+	switch t {
+	case OrderEventNew:
+		return "new"
+	case OrderEventTrade:
+		return "trade"
+	case OrderEventCanceled:
+		return "canceled"
+	case OrderEventReplaced:
+		return "replaced"
+	case OrderEventRejected:
+		return "rejected"
+	case OrderEventExpired:
+		return "expired"
+	case OrderEventTradeCanceled:
+		return "trade canceled"
+	case OrderEventTradeCorrected:
+		return "trade corrected"
+	default:
+		return "unknown"
+	}
+}
+
+// EventReason classifies why the engine rejected or canceled an order, for entry
+// protocols that report a code rather than a text.
+type EventReason string
+
+const (
+	EventReasonDuplicateClOrdID EventReason = "duplicate_clordid"
+	EventReasonNotEntitled      EventReason = "not_entitled"
+	EventReasonAccountLimit     EventReason = "account_limit"
+	EventReasonHalted           EventReason = "halted"
+)
+
+// eventReason classifies err, empty when it is none of the reasons.
+func eventReason(err error) EventReason {
+	switch {
+	case errors.Is(err, ErrDuplicateClOrdID):
+		return EventReasonDuplicateClOrdID
+	case errors.Is(err, ErrNotEntitled):
+		return EventReasonNotEntitled
+	case errors.Is(err, ErrAccountLimit):
+		return EventReasonAccountLimit
+	case errors.Is(err, ErrHalted):
+		return EventReasonHalted
+	default:
+		return ""
+	}
+}
+
+// ExecReportRequiredEvent is something that happened to an order on the matching
+// path. Order is a copy taken right after the event, so it can be reported from any
+// goroutine and by any entry protocol.
+type ExecReportRequiredEvent struct {
+	Type         OrderEventType
+	ExecID       string
+	Order        domain.OrderView
+	TransactTime time.Time
+	LastQty      decimal.Decimal
+	LastPx       decimal.Decimal
+	OrigClOrdID  string
+	Text         string
+	// Reason classifies the Text of rejects and of cancels the engine decided.
+	Reason EventReason
+	// TradeID is shared by the trade events of both sides of a match.
+	TradeID string
+	// ExecRefID is the ExecID of the trade a bust or correction restates.
+	ExecRefID string
+	// Aggressor is set on the trade event of the incoming side of a match.
+	Aggressor bool
+	// Fee is what a trade costs the order's firm, negative for a rebate. After a bust
+	// or correction it is the fee of the trade as it now stands.
+	Fee decimal.Decimal
+	// FeeRate is the rate in basis points the trade was charged at, which a bust or
+	// correction charges it at again.
+	FeeRate decimal.Decimal
+}
+
+// IsFill reports whether a trade event completed the order.
+func (e ExecReportRequiredEvent) IsFill() bool {
+	return e.Type == OrderEventTrade && !e.Order.LeavesQty.IsPositive()
+}
+
+// OrderEventListener is notified of every event of the matching path, in order and
+// while the engine lock is held, so implementations must not block.
+type OrderEventListener interface {
+	OnOrderEvent(event ExecReportRequiredEvent)
+}
+
+// DeliveryObserver is told how execution reports reach FIX sessions, from a goroutine
+// of their own. Latency runs from reading the message that caused the report.
+type DeliveryObserver interface {
+	ExecutionReportSent(compID string, latency time.Duration)
+	ExecutionReportRetried(compID string)
+	// BacklogAlert is called when the reports waiting for a session reach the alert threshold.
+	BacklogAlert(compID string, depth int)
+}
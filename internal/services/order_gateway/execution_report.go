@@ -0,0 +1,230 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix42er "github.com/quickfixgo/fix42/executionreport"
+	fix44er "github.com/quickfixgo/fix44/executionreport"
+	fix50sp2er "github.com/quickfixgo/fix50sp2/executionreport"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+	"github.com/shopspring/decimal"
+	"stock_exchange/internal/services/order_gateway/domain"
+)
+
+// Execution reports are a pure mapping of an ExecReportRequiredEvent, whatever the
+// session it goes to: the event carries the order as it was right after it happened.
+
+// fixOrdStatus is the OrdStatus of an order view in every supported version.
+func fixOrdStatus(order domain.OrderView) enum.OrdStatus {
+	switch order.Status {
+	case domain.OrderStatusCanceled:
+		return enum.OrdStatus_CANCELED
+	case domain.OrderStatusRejected:
+		return enum.OrdStatus_REJECTED
+	case domain.OrderStatusFilled:
+		// a bust or correction may leave less executed, and nothing more to execute
+		if order.ExecutedQuantity.LessThan(order.Quantity) {
+			return enum.OrdStatus_DONE_FOR_DAY
+		}
+		return enum.OrdStatus_FILLED
+	default:
+		if order.ExecutedQuantity.IsPositive() {
+			return enum.OrdStatus_PARTIALLY_FILLED
+		}
+		return enum.OrdStatus_NEW
+	}
+}
+
+// eventOrdStatus is the OrdStatus reported with event. Expired orders are canceled
+// off their book but reported as expired.
+func eventOrdStatus(event ExecReportRequiredEvent) enum.OrdStatus {
+	if event.Type == OrderEventExpired {
+		return enum.OrdStatus_EXPIRED
+	}
+	return fixOrdStatus(event.Order)
+}
+
+// fixExecType maps an event to its ExecType. FIX 4.2 reports trades as partial fills
+// and fills, FIX 4.3 replaced both with ExecType Trade. Busts and corrections are
+// ExecTransType Cancel and Correct in FIX 4.2, reported with the order's state.
+func fixExecType(event ExecReportRequiredEvent, beginString string) enum.ExecType {
+	restatesTrade := event.Type == OrderEventTradeCanceled || event.Type == OrderEventTradeCorrected
+	if restatesTrade && beginString == quickfix.BeginStringFIX42 {
+		switch fixOrdStatus(event.Order) {
+		case enum.OrdStatus_FILLED:
+			return enum.ExecType_FILL
+		case enum.OrdStatus_PARTIALLY_FILLED:
+			return enum.ExecType_PARTIAL_FILL
+		case enum.OrdStatus_CANCELED:
+			return enum.ExecType_CANCELED
+		case enum.OrdStatus_DONE_FOR_DAY:
+			return enum.ExecType_DONE_FOR_DAY
+		default:
+			return enum.ExecType_NEW
+		}
+	}
+	switch event.Type {
+	case OrderEventTrade:
+		if beginString != quickfix.BeginStringFIX42 {
+			return enum.ExecType_TRADE
+		}
+		if event.IsFill() {
+			return enum.ExecType_FILL
+		}
+		return enum.ExecType_PARTIAL_FILL
+	case OrderEventCanceled:
+		return enum.ExecType_CANCELED
+	case OrderEventReplaced:
+		return enum.ExecType_REPLACED
+	case OrderEventRejected:
+		return enum.ExecType_REJECTED
+	case OrderEventExpired:
+		return enum.ExecType_EXPIRED
+	case OrderEventTradeCanceled:
+		return enum.ExecType_TRADE_CANCEL
+	case OrderEventTradeCorrected:
+		return enum.ExecType_TRADE_CORRECT
+	default:
+		return enum.ExecType_NEW
+	}
+}
+
+// fixExecTransType is the ExecTransType of FIX 4.2 execution reports.
+func fixExecTransType(event ExecReportRequiredEvent) enum.ExecTransType {
+	switch event.Type {
+	case OrderEventTradeCanceled:
+		return enum.ExecTransType_CANCEL
+	case OrderEventTradeCorrected:
+		return enum.ExecTransType_CORRECT
+	default:
+		return enum.ExecTransType_NEW
+	}
+}
+
+// closes reports whether the order is done after event, nothing of it left to execute.
+func closes(event ExecReportRequiredEvent) bool {
+	switch event.Type {
+	case OrderEventCanceled, OrderEventRejected, OrderEventExpired:
+		return true
+	}
+	return event.Order.Status == domain.OrderStatusCanceled || event.Order.Status == domain.OrderStatusRejected
+}
+
+// generateExecutionReport builds the execution report of event for a session of beginString.
+func generateExecutionReport(event ExecReportRequiredEvent, beginString string) *quickfix.Message {
+	order := event.Order
+	orderIDField := field.NewOrderID(order.OrderID)
+	execIDField := field.NewExecID(event.ExecID)
+	execTypeField := field.NewExecType(fixExecType(event, beginString))
+	ordStatusField := field.NewOrdStatus(eventOrdStatus(event))
+	side := enum.Side_BUY
+	if order.Side == domain.SELL {
+		side = enum.Side_SELL
+	}
+	sideField := field.NewSide(side)
+	leavesQty := order.LeavesQty
+	if closes(event) {
+		leavesQty = decimal.Zero
+	}
+	leavesQtyField := field.NewLeavesQty(leavesQty, 2)
+	cumQtyField := field.NewCumQty(order.ExecutedQuantity, 2)
+	avgPxField := field.NewAvgPx(order.AvgPx(), 2)
+
+	var msg *quickfix.Message
+	switch beginString {
+	case quickfix.BeginStringFIX42:
+		msg = fix42er.New(orderIDField, execIDField, field.NewExecTransType(fixExecTransType(event)), execTypeField,
+			ordStatusField, field.NewSymbol(order.Symbol), sideField, leavesQtyField, cumQtyField, avgPxField).ToMessage()
+	case quickfix.BeginStringFIXT11:
+		er := fix50sp2er.New(orderIDField, execIDField, execTypeField, ordStatusField, sideField, leavesQtyField, cumQtyField)
+		er.Set(avgPxField)
+		msg = er.ToMessage()
+	default:
+		msg = fix44er.New(orderIDField, execIDField, execTypeField, ordStatusField, sideField, leavesQtyField, cumQtyField,
+			avgPxField).ToMessage()
+	}
+	// the order came from its SenderCompID to the exchange as TargetCompID
+	if order.TargetCompID != "" && order.SenderCompID != "" {
+		msg.Header.Set(field.NewSenderCompID(order.TargetCompID))
+		msg.Header.Set(field.NewTargetCompID(order.SenderCompID))
+	}
+	msg.Body.Set(field.NewClOrdID(order.ClOrdID))
+	if event.OrigClOrdID != "" {
+		msg.Body.Set(field.NewOrigClOrdID(event.OrigClOrdID))
+	}
+	if order.Account != "" {
+		msg.Body.Set(field.NewAccount(order.Account))
+	}
+	if beginString != quickfix.BeginStringFIX42 {
+		setParties(msg, order)
+	}
+	msg.Body.Set(field.NewSymbol(order.Symbol))
+	msg.Body.Set(field.NewOrdType(order.OrdType))
+	if order.OrdType != enum.OrdType_MARKET {
+		msg.Body.Set(field.NewPrice(order.Price, 2))
+	}
+	msg.Body.Set(field.NewOrderQty(order.Quantity, 2))
+	// LastQty shares tag 32 with the LastShares of FIX 4.2
+	switch event.Type {
+	case OrderEventTrade, OrderEventTradeCanceled, OrderEventTradeCorrected:
+		msg.Body.Set(field.NewLastQty(event.LastQty, 2))
+		msg.Body.Set(field.NewLastPx(event.LastPx, 2))
+		// TrdMatchID joined the execution report in FIX 5.0
+		if beginString == quickfix.BeginStringFIXT11 && event.TradeID != "" {
+			msg.Body.Set(field.NewTrdMatchID(event.TradeID))
+		}
+	}
+	// Commission carries the exchange fee, itemized as the single MiscFees entry from
+	// FIX 4.3 on
+	if !event.Fee.IsZero() {
+		msg.Body.Set(field.NewCommission(event.Fee, 2))
+		msg.Body.Set(field.NewCommType(enum.CommType_ABSOLUTE))
+	}
+	if !event.Fee.IsZero() && beginString != quickfix.BeginStringFIX42 {
+		miscFees := quickfix.NewRepeatingGroup(tag.NoMiscFees,
+			quickfix.GroupTemplate{quickfix.GroupElement(tag.MiscFeeAmt), quickfix.GroupElement(tag.MiscFeeType)})
+		entry := miscFees.Add()
+		entry.Set(field.NewMiscFeeAmt(event.Fee, 2))
+		entry.Set(field.NewMiscFeeType(enum.MiscFeeType_EXCHANGE_FEES))
+		msg.Body.SetGroup(miscFees)
+	}
+	if event.ExecRefID != "" {
+		msg.Body.Set(field.NewExecRefID(event.ExecRefID))
+	}
+	if !event.TransactTime.IsZero() {
+		msg.Body.Set(field.NewTransactTime(event.TransactTime))
+	}
+	if event.Text != "" {
+		msg.Body.Set(field.NewText(event.Text))
+	}
+	return msg
+}
+
+// partiesGroup is the PartyIDs group of the Parties component, alike in FIX 4.4 and 5.0.
+func partiesGroup() *quickfix.RepeatingGroup {
+	subIDs := quickfix.NewRepeatingGroup(tag.NoPartySubIDs,
+		quickfix.GroupTemplate{quickfix.GroupElement(tag.PartySubID), quickfix.GroupElement(tag.PartySubIDType)})
+	return quickfix.NewRepeatingGroup(tag.NoPartyIDs, quickfix.GroupTemplate{quickfix.GroupElement(tag.PartyID),
+		quickfix.GroupElement(tag.PartyIDSource), quickfix.GroupElement(tag.PartyRole), subIDs})
+}
+
+// setParties echoes the OrderCapacity and PartyIDs of order, which FIX 4.2 has neither of.
+func setParties(msg *quickfix.Message, order domain.OrderView) {
+	if order.OrderCapacity != "" {
+		msg.Body.Set(field.NewOrderCapacity(order.OrderCapacity))
+	}
+	if len(order.Parties) == 0 {
+		return
+	}
+	group := partiesGroup()
+	for _, party := range order.Parties {
+		entry := group.Add()
+		entry.Set(field.NewPartyID(party.ID))
+		if party.Source != "" {
+			entry.Set(field.NewPartyIDSource(party.Source))
+		}
+		entry.Set(field.NewPartyRole(party.Role))
+	}
+	msg.Body.SetGroup(group)
+}
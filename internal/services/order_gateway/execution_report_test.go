@@ -0,0 +1,165 @@
+package order_gateway
+
+import (
+	"bytes"
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/quickfix/datadictionary"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"os/exec"
+	"path/filepath"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reportEvents are an order of 100 @ 10.50 through its life, each event with the order as it was right after it.
+func reportEvents() map[string]ExecReportRequiredEvent {
+	at := time.Date(2026, 3, 2, 13, 30, 0, 0, time.UTC)
+	order := func(status domain.OrderStatus, executed, leaves int64) domain.OrderView {
+		return domain.OrderView{OrderID: "7", ClOrdID: "C1", Symbol: "VALE3", SenderCompID: "CLIENT44",
+			TargetCompID: "ORDERGATEWAY", Account: "ACC1", Side: domain.BUY, OrdType: enum.OrdType_LIMIT,
+			Price: decimal.RequireFromString("10.5"), Quantity: decimal.NewFromInt(100), Status: status,
+			ExecutedQuantity: decimal.NewFromInt(executed), ExecutedNotional: decimal.RequireFromString("10.5").Mul(decimal.NewFromInt(executed)),
+			LeavesQty: decimal.NewFromInt(leaves)}
+	}
+	event := func(eventType OrderEventType, view domain.OrderView) ExecReportRequiredEvent {
+		return ExecReportRequiredEvent{Type: eventType, ExecID: "E1", Order: view, TransactTime: at,
+			LastQty: decimal.Zero, LastPx: decimal.Zero}
+	}
+	partial := event(OrderEventTrade, order(domain.OrderStatusOpen, 40, 60))
+	partial.LastQty, partial.LastPx = decimal.NewFromInt(40), decimal.RequireFromString("10.5")
+	fill := event(OrderEventTrade, order(domain.OrderStatusFilled, 100, 0))
+	fill.LastQty, fill.LastPx, fill.TradeID = decimal.NewFromInt(60), decimal.RequireFromString("10.5"), "T1"
+	canceled := event(OrderEventCanceled, order(domain.OrderStatusCanceled, 40, 60))
+	canceled.OrigClOrdID = "C1"
+	replaced := event(OrderEventReplaced, order(domain.OrderStatusOpen, 40, 60))
+	replaced.Order.ClOrdID, replaced.OrigClOrdID = "C2", "C1"
+	rejected := event(OrderEventRejected, order(domain.OrderStatusRejected, 0, 100))
+	rejected.Text = "duplicate ClOrdID"
+	busted := event(OrderEventTradeCanceled, order(domain.OrderStatusOpen, 0, 60))
+	busted.ExecID, busted.ExecRefID, busted.TradeID, busted.Text = "E2", "E1", "T1", "erroneous"
+	busted.LastQty, busted.LastPx = decimal.NewFromInt(40), decimal.RequireFromString("10.5")
+	corrected := event(OrderEventTradeCorrected, order(domain.OrderStatusOpen, 30, 60))
+	corrected.ExecID, corrected.ExecRefID, corrected.TradeID = "E2", "E1", "T1"
+	corrected.LastQty, corrected.LastPx = decimal.NewFromInt(30), decimal.RequireFromString("10.5")
+	charged := partial
+	charged.Fee = decimal.RequireFromString("-0.21")
+	parties := event(OrderEventNew, order(domain.OrderStatusOpen, 0, 100))
+	parties.Order.OrderCapacity = enum.OrderCapacity_AGENCY
+	parties.Order.Parties = []domain.Party{{ID: "TRADER1", Source: enum.PartyIDSource_PROPRIETARY, Role: enum.PartyRole_ENTERING_TRADER},
+		{ID: "FIRMA", Role: enum.PartyRole_EXECUTING_FIRM}}
+	return map[string]ExecReportRequiredEvent{
+		"new":       event(OrderEventNew, order(domain.OrderStatusOpen, 0, 100)),
+		"partial":   partial,
+		"fill":      fill,
+		"canceled":  canceled,
+		"replaced":  replaced,
+		"rejected":  rejected,
+		"expired":   event(OrderEventExpired, order(domain.OrderStatusCanceled, 40, 60)),
+		"charged":   charged,
+		"busted":    busted,
+		"corrected": corrected,
+		"parties":   parties,
+	}
+}
+
+func TestGenerateExecutionReport_Golden(t *testing.T) {
+	tests := []struct {
+		event, beginString string
+		want               string
+	}{
+		{"new", quickfix.BeginStringFIX44, "8=FIX.4.4|9=157|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=0.00|11=C1|14=0.00|17=E1|" +
+			"37=7|38=100.00|39=0|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=0|151=100.00|10=193|"},
+		{"partial", quickfix.BeginStringFIX44, "8=FIX.4.4|9=176|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|14=40.00|17=E1|" +
+			"31=10.50|32=40.00|37=7|38=100.00|39=1|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=F|151=60.00|10=067|"},
+		{"fill", quickfix.BeginStringFIX44, "8=FIX.4.4|9=176|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|14=100.00|17=E1|" +
+			"31=10.50|32=60.00|37=7|38=100.00|39=2|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=F|151=0.00|10=061|"},
+		{"canceled", quickfix.BeginStringFIX44, "8=FIX.4.4|9=163|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|14=40.00|17=E1|" +
+			"37=7|38=100.00|39=4|40=2|41=C1|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=4|151=0.00|10=230|"},
+		{"replaced", quickfix.BeginStringFIX44, "8=FIX.4.4|9=164|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C2|14=40.00|17=E1|" +
+			"37=7|38=100.00|39=1|40=2|41=C1|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=5|151=60.00|10=028|"},
+		{"rejected", quickfix.BeginStringFIX44, "8=FIX.4.4|9=176|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=0.00|11=C1|14=0.00|17=E1|" +
+			"37=7|38=100.00|39=8|40=2|44=10.50|54=1|55=VALE3|58=duplicate ClOrdID|60=20260302-13:30:00.000|150=8|151=0.00|10=088|"},
+		{"expired", quickfix.BeginStringFIX44, "8=FIX.4.4|9=157|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|14=40.00|17=E1|" +
+			"37=7|38=100.00|39=C|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=C|151=0.00|10=240|"},
+		{"charged", quickfix.BeginStringFIX44, "8=FIX.4.4|9=212|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|12=-0.21|13=3|14=40.00|" +
+			"17=E1|31=10.50|32=40.00|37=7|38=100.00|39=1|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|136=1|137=-0.21|139=4|" +
+			"150=F|151=60.00|10=125|"},
+		{"busted", quickfix.BeginStringFIX44, "8=FIX.4.4|9=193|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=0.00|11=C1|14=0.00|17=E2|19=E1|" +
+			"31=10.50|32=40.00|37=7|38=100.00|39=0|40=2|44=10.50|54=1|55=VALE3|58=erroneous|60=20260302-13:30:00.000|150=H|151=60.00|10=133|"},
+		{"corrected", quickfix.BeginStringFIX44, "8=FIX.4.4|9=182|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|14=30.00|17=E2|19=E1|" +
+			"31=10.50|32=30.00|37=7|38=100.00|39=1|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=G|151=60.00|10=094|"},
+		{"parties", quickfix.BeginStringFIX44, "8=FIX.4.4|9=210|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=0.00|11=C1|14=0.00|17=E1|" +
+			"37=7|38=100.00|39=0|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=0|151=100.00|" +
+			"453=2|448=TRADER1|447=D|452=36|448=FIRMA|452=1|528=A|10=108|"},
+		{"partial", quickfix.BeginStringFIX42, "8=FIX.4.2|9=181|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|14=40.00|17=E1|" +
+			"20=0|31=10.50|32=40.00|37=7|38=100.00|39=1|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=1|151=60.00|10=248|"},
+		{"fill", quickfix.BeginStringFIX42, "8=FIX.4.2|9=181|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|14=100.00|17=E1|" +
+			"20=0|31=10.50|32=60.00|37=7|38=100.00|39=2|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=2|151=0.00|10=243|"},
+		{"charged", quickfix.BeginStringFIX42, "8=FIX.4.2|9=195|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|12=-0.21|13=3|14=40.00|" +
+			"17=E1|20=0|31=10.50|32=40.00|37=7|38=100.00|39=1|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=1|151=60.00|10=097|"},
+		{"busted", quickfix.BeginStringFIX42, "8=FIX.4.2|9=198|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=0.00|11=C1|14=0.00|17=E2|19=E1|" +
+			"20=1|31=10.50|32=40.00|37=7|38=100.00|39=0|40=2|44=10.50|54=1|55=VALE3|58=erroneous|60=20260302-13:30:00.000|150=0|151=60.00|10=065|"},
+		{"corrected", quickfix.BeginStringFIX42, "8=FIX.4.2|9=187|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|14=30.00|17=E2|19=E1|" +
+			"20=2|31=10.50|32=30.00|37=7|38=100.00|39=1|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=1|151=60.00|10=029|"},
+		{"fill", quickfix.BeginStringFIXT11, "8=FIXT.1.1|9=183|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|14=100.00|17=E1|" +
+			"31=10.50|32=60.00|37=7|38=100.00|39=2|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=F|151=0.00|880=T1|10=236|"},
+		{"corrected", quickfix.BeginStringFIXT11, "8=FIXT.1.1|9=189|35=8|49=ORDERGATEWAY|56=CLIENT44|1=ACC1|6=10.50|11=C1|14=30.00|17=E2|19=E1|" +
+			"31=10.50|32=30.00|37=7|38=100.00|39=1|40=2|44=10.50|54=1|55=VALE3|60=20260302-13:30:00.000|150=G|151=60.00|880=T1|10=022|"},
+	}
+	events := reportEvents()
+	for _, tt := range tests {
+		got := strings.ReplaceAll(generateExecutionReport(events[tt.event], tt.beginString).String(), "\x01", "|")
+		require.Equal(t, tt.want, got, "%s %s", tt.event, tt.beginString)
+	}
+}
+
+func TestGenerateExecutionReport_MarketOrder(t *testing.T) {
+	event := reportEvents()["canceled"]
+	event.Order.OrdType = enum.OrdType_MARKET
+	event.Order.Price = decimal.Zero
+	msg := generateExecutionReport(event, quickfix.BeginStringFIX44)
+	requireFields(t, msg, map[int]string{40: "1", 39: "4"})
+	require.False(t, msg.Body.Has(44), "market orders have no Price")
+}
+
+// specDir is where the quickfix module ships the FIX data dictionaries.
+func specDir(t *testing.T) string {
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "github.com/quickfixgo/quickfix").Output()
+	if err != nil {
+		t.Skipf("quickfix data dictionaries not found: %s", err)
+	}
+	return filepath.Join(strings.TrimSpace(string(out)), "spec")
+}
+
+func TestGenerateExecutionReport_DataDictionary(t *testing.T) {
+	dir := specDir(t)
+	dictionary := func(name string) *datadictionary.DataDictionary {
+		dd, err := datadictionary.Parse(filepath.Join(dir, name))
+		require.NoError(t, err)
+		return dd
+	}
+	settings := quickfix.ValidatorSettings{CheckFieldsOutOfOrder: true, RejectInvalidMessage: true, CheckUserDefinedFields: true}
+	validators := map[string]quickfix.Validator{
+		quickfix.BeginStringFIX42:  quickfix.NewValidator(settings, dictionary("FIX42.xml"), nil),
+		quickfix.BeginStringFIX44:  quickfix.NewValidator(settings, dictionary("FIX44.xml"), nil),
+		quickfix.BeginStringFIXT11: quickfix.NewValidator(settings, dictionary("FIX50SP2.xml"), dictionary("FIXT11.xml")),
+	}
+	for name, event := range reportEvents() {
+		for beginString, validator := range validators {
+			msg := generateExecutionReport(event, beginString)
+			// the session fills these in when sending
+			msg.Header.SetInt(quickfix.Tag(34), 1)
+			msg.Header.SetString(quickfix.Tag(52), "20260302-13:30:00.000")
+			if beginString == quickfix.BeginStringFIXT11 {
+				msg.Header.SetString(quickfix.Tag(1128), string(enum.ApplVerID_FIX50SP2))
+			}
+			parsed := quickfix.NewMessage()
+			require.NoError(t, quickfix.ParseMessage(parsed, bytes.NewBufferString(msg.String())))
+			require.Nil(t, validator.Validate(parsed), "%s %s", name, beginString)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package order_gateway
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+var basisPoint = decimal.New(1, -4)
+
+// FeeTier is a volume tier, reached once a firm's month-to-date traded notional is at
+// least MinMonthlyVolume.
+type FeeTier struct {
+	Name             string          `json:"name"`
+	MinMonthlyVolume decimal.Decimal `json:"min_monthly_volume"`
+}
+
+// FeeRule prices the executions it matches in basis points of their notional: the
+// resting side is paid the maker rebate and the incoming side charged the taker fee.
+// Symbol, Firm and Tier match anything when empty.
+type FeeRule struct {
+	Symbol         string          `json:"symbol"`
+	Firm           string          `json:"firm"`
+	Tier           string          `json:"tier"`
+	MakerRebateBps decimal.Decimal `json:"maker_rebate_bps"`
+	TakerFeeBps    decimal.Decimal `json:"taker_fee_bps"`
+}
+
+// FeeSchedule picks the most specific rule matching an execution, a firm beating a
+// symbol and a symbol beating a tier, the first one on a tie. Executions no rule
+// matches are free.
+type FeeSchedule struct {
+	Tiers []FeeTier `json:"tiers"`
+	// FirmTiers pins firms, such as market makers, to a tier whatever their volume
+	FirmTiers map[string]string `json:"firm_tiers"`
+	Rules     []FeeRule         `json:"rules"`
+}
+
+// LoadFeeSchedule reads a JSON fee schedule and validates it.
+func LoadFeeSchedule(fileName string) (FeeSchedule, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return FeeSchedule{}, fmt.Errorf("error opening %v, %v", fileName, err)
+	}
+	var s FeeSchedule
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return FeeSchedule{}, fmt.Errorf("error reading fee schedule: %s", err)
+	}
+	tiers := make(map[string]bool)
+	for _, tier := range s.Tiers {
+		if tier.Name == "" {
+			return FeeSchedule{}, fmt.Errorf("fee tier without name")
+		}
+		if tiers[tier.Name] {
+			return FeeSchedule{}, fmt.Errorf("fee tier %s is defined twice", tier.Name)
+		}
+		if tier.MinMonthlyVolume.IsNegative() {
+			return FeeSchedule{}, fmt.Errorf("fee tier %s: negative min_monthly_volume", tier.Name)
+		}
+		tiers[tier.Name] = true
+	}
+	for firm, tier := range s.FirmTiers {
+		if !tiers[tier] {
+			return FeeSchedule{}, fmt.Errorf("firm %s: unknown fee tier %q", firm, tier)
+		}
+	}
+	for i, rule := range s.Rules {
+		if rule.Tier != "" && !tiers[rule.Tier] {
+			return FeeSchedule{}, fmt.Errorf("fee rule %d: unknown fee tier %q", i+1, rule.Tier)
+		}
+	}
+	// the highest tier a firm reaches is the last one
+	slices.SortStableFunc(s.Tiers, func(x, y FeeTier) int {
+		return x.MinMonthlyVolume.Cmp(y.MinMonthlyVolume)
+	})
+	return s, nil
+}
+
+// WithFeeSchedule charges the executions of every entry protocol according to s.
+func WithFeeSchedule(s FeeSchedule) Option {
+	return func(a *Application) {
+		a.fees = &s
+	}
+}
+
+// tier is the tier of firm for a month-to-date volume.
+func (s *FeeSchedule) tier(firm string, volume decimal.Decimal) string {
+	if tier, ok := s.FirmTiers[firm]; ok {
+		return tier
+	}
+	tier := ""
+	for _, t := range s.Tiers {
+		if volume.GreaterThanOrEqual(t.MinMonthlyVolume) {
+			tier = t.Name
+		}
+	}
+	return tier
+}
+
+// rate is the fee of an execution in basis points, negative for a rebate.
+func (s *FeeSchedule) rate(symbol, firm, tier string, maker bool) decimal.Decimal {
+	best, bestScore := -1, -1
+	for i, rule := range s.Rules {
+		if (rule.Symbol != "" && rule.Symbol != symbol) || (rule.Firm != "" && rule.Firm != firm) ||
+			(rule.Tier != "" && rule.Tier != tier) {
+			continue
+		}
+		score := 0
+		if rule.Firm != "" {
+			score += 4
+		}
+		if rule.Symbol != "" {
+			score += 2
+		}
+		if rule.Tier != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return decimal.Zero
+	}
+	if maker {
+		return s.Rules[best].MakerRebateBps.Neg()
+	}
+	return s.Rules[best].TakerFeeBps
+}
+
+// fee is what notional at rate basis points comes to, rounded to the cent.
+func fee(notional, rate decimal.Decimal) decimal.Decimal {
+	return notional.Mul(rate).Mul(basisPoint).Round(2)
+}
+
+// MonthlyVolumes is the notional each firm traded in the month of the trading date,
+// which volume tiers go by. Trades are written back to its file in the background,
+// and flushed at end of day, so that it survives restarts.
+type MonthlyVolumes struct {
+	mu       sync.Mutex
+	fileName string
+	month    string
+	volumes  map[string]decimal.Decimal
+	dirty    chan struct{}
+	// changed tells the volumes differ from the file
+	changed bool
+	// closed stops the background saves, done is closed once the last one is over
+	closed bool
+	done   chan struct{}
+	// saveMu serializes the writes to the file, which are made without holding mu
+	saveMu sync.Mutex
+}
+
+type monthlyVolumesFile struct {
+	Month   string                     `json:"month"`
+	Volumes map[string]decimal.Decimal `json:"volumes"`
+}
+
+// NewMonthlyVolumes keeps the volumes in memory only.
+func NewMonthlyVolumes() *MonthlyVolumes {
+	return &MonthlyVolumes{volumes: make(map[string]decimal.Decimal), dirty: make(chan struct{}, 1)}
+}
+
+// LoadMonthlyVolumes reads the volumes saved in fileName, none when it does not exist yet.
+func LoadMonthlyVolumes(fileName string) (*MonthlyVolumes, error) {
+	v := NewMonthlyVolumes()
+	v.fileName = fileName
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		v.start()
+		return v, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v, %v", fileName, err)
+	}
+	var f monthlyVolumesFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading monthly volumes: %s", err)
+	}
+	if _, err = time.Parse("2006-01", f.Month); err != nil {
+		return nil, fmt.Errorf("error reading monthly volumes: invalid month %q", f.Month)
+	}
+	v.month = f.Month
+	if f.Volumes != nil {
+		v.volumes = f.Volumes
+	}
+	v.start()
+	return v, nil
+}
+
+// WithMonthlyVolumes resumes the month-to-date volumes of v and saves every trade to it.
+func WithMonthlyVolumes(v *MonthlyVolumes) Option {
+	return func(a *Application) {
+		a.volumes = v
+	}
+}
+
+// startDay starts the volumes over when the trading date is in another month.
+func (v *MonthlyVolumes) startDay(date string) {
+	day, err := time.Parse(TradingDateLayout, date)
+	if err != nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if month := day.Format("2006-01"); month != v.month {
+		v.month = month
+		v.volumes = make(map[string]decimal.Decimal)
+		v.markDirty()
+	}
+}
+
+func (v *MonthlyVolumes) volume(firm string) decimal.Decimal {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.volumes[firm]
+}
+
+// add books notional, negative for busts, to the volume of every firm given.
+func (v *MonthlyVolumes) add(notional decimal.Decimal, firms ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, firm := range firms {
+		v.volumes[firm] = v.volumes[firm].Add(notional)
+	}
+	v.markDirty()
+}
+
+// markDirty has the volumes saved in the background, the caller holds v.mu.
+func (v *MonthlyVolumes) markDirty() {
+	v.changed = true
+	if v.closed {
+		return
+	}
+	select {
+	case v.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// start saves the volumes in the background until Close.
+func (v *MonthlyVolumes) start() {
+	v.done = make(chan struct{})
+	go v.persist()
+}
+
+// persist saves the volumes whenever they changed, as many changes at once as came in meanwhile.
+func (v *MonthlyVolumes) persist() {
+	defer close(v.done)
+	for range v.dirty {
+		err := v.Flush()
+		if err != nil {
+			log.Printf("ALERT: failed to save monthly volumes, fee tiers may be wrong after a restart: %s", err)
+		}
+	}
+}
+
+// Flush saves the volumes as they stand, replacing the file atomically so that a crash
+// leaves either state on disk.
+func (v *MonthlyVolumes) Flush() error {
+	if v.fileName == "" {
+		return nil
+	}
+	v.saveMu.Lock()
+	defer v.saveMu.Unlock()
+	v.mu.Lock()
+	data, err := json.MarshalIndent(monthlyVolumesFile{Month: v.month, Volumes: v.volumes}, "", "  ")
+	v.changed = false
+	v.mu.Unlock()
+	if err == nil {
+		err = v.write(data)
+	}
+	if err != nil {
+		v.mu.Lock()
+		v.changed = true
+		v.mu.Unlock()
+	}
+	return err
+}
+
+func (v *MonthlyVolumes) write(data []byte) error {
+	err := os.MkdirAll(filepath.Dir(v.fileName), 0o755)
+	if err != nil {
+		return err
+	}
+	tmp := v.fileName + ".tmp"
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, v.fileName)
+}
+
+// Close stops saving the volumes in the background and saves what changed since.
+func (v *MonthlyVolumes) Close() error {
+	v.mu.Lock()
+	if !v.closed {
+		v.closed = true
+		close(v.dirty)
+	}
+	v.mu.Unlock()
+	if v.done != nil {
+		<-v.done
+	}
+	v.mu.Lock()
+	changed := v.changed
+	v.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return v.Flush()
+}
+
+// feeFirm is who pays the fees of compID: its firm, or itself without one.
+func (a *Application) feeFirm(compID string) string {
+	if firm := a.firm(compID); firm != "" {
+		return firm
+	}
+	return compID
+}
+
+// chargeFees prices both sides of trade at the tier their firm reached before it, then
+// books its notional to their volumes. It runs under the engine lock.
+func (a *Application) chargeFees(trade *Trade) {
+	if a.fees == nil {
+		return
+	}
+	notional := trade.Price.Mul(trade.Quantity)
+	firms := make([]string, 0, 2)
+	for _, side := range []*tradeSide{&trade.buy, &trade.sell} {
+		firm := a.feeFirm(side.order.SenderCompID())
+		maker := side.order.Side() != trade.AggressorSide
+		side.feeRate = a.fees.rate(trade.Symbol, firm, a.fees.tier(firm, a.volumes.volume(firm)), maker)
+		side.fee = fee(notional, side.feeRate)
+		if !slices.Contains(firms, firm) {
+			firms = append(firms, firm)
+		}
+	}
+	a.volumes.add(notional, firms...)
+}
+
+// rechargeFees prices both sides of trade again after a bust or correction, at the
+// rates it was first charged, and books the change of notional to their volumes.
+func (a *Application) rechargeFees(trade *Trade, previousNotional decimal.Decimal) {
+	if a.fees == nil {
+		return
+	}
+	notional := trade.Price.Mul(trade.Quantity)
+	if trade.Status == TradeBusted {
+		notional = decimal.Zero
+	}
+	firms := make([]string, 0, 2)
+	for _, side := range []*tradeSide{&trade.buy, &trade.sell} {
+		side.fee = fee(notional, side.feeRate)
+		if firm := a.feeFirm(side.order.SenderCompID()); !slices.Contains(firms, firm) {
+			firms = append(firms, firm)
+		}
+	}
+	a.volumes.add(notional.Sub(previousNotional), firms...)
+}
+
+// FirmFees sums up what a firm was charged and paid for the day's executions.
+type FirmFees struct {
+	Firm          string
+	Tier          string
+	MonthlyVolume decimal.Decimal
+	Executions    int
+	MakerVolume   decimal.Decimal
+	TakerVolume   decimal.Decimal
+	Fees          decimal.Decimal
+	Rebates       decimal.Decimal
+	// Net is the fees less the rebates, negative when the firm is paid
+	Net decimal.Decimal
+}
+
+// FeeSummary sums the fees of the trades that stand by firm, sorted by firm.
+func (a *Application) FeeSummary() []FirmFees {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	byFirm := make(map[string]*FirmFees)
+	for _, trade := range a.trades {
+		if trade.Status == TradeBusted {
+			continue
+		}
+		notional := trade.Price.Mul(trade.Quantity)
+		for _, side := range []tradeSide{trade.buy, trade.sell} {
+			firm := a.feeFirm(side.order.SenderCompID())
+			f, ok := byFirm[firm]
+			if !ok {
+				f = &FirmFees{Firm: firm, MakerVolume: decimal.Zero, TakerVolume: decimal.Zero, Fees: decimal.Zero,
+					Rebates: decimal.Zero}
+				byFirm[firm] = f
+			}
+			f.Executions++
+			if side.order.Side() == trade.AggressorSide {
+				f.TakerVolume = f.TakerVolume.Add(notional)
+			} else {
+				f.MakerVolume = f.MakerVolume.Add(notional)
+			}
+			if side.fee.IsNegative() {
+				f.Rebates = f.Rebates.Sub(side.fee)
+			} else {
+				f.Fees = f.Fees.Add(side.fee)
+			}
+		}
+	}
+	summary := make([]FirmFees, 0, len(byFirm))
+	for _, f := range byFirm {
+		f.Net = f.Fees.Sub(f.Rebates)
+		f.MonthlyVolume = a.volumes.volume(f.Firm)
+		if a.fees != nil {
+			f.Tier = a.fees.tier(f.Firm, f.MonthlyVolume)
+		}
+		summary = append(summary, *f)
+	}
+	slices.SortFunc(summary, func(x, y FirmFees) int {
+		return cmp.Compare(x.Firm, y.Firm)
+	})
+	return summary
+}
@@ -0,0 +1,189 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+	"time"
+)
+
+func TestLoadFeeSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"valid", `{"tiers":[{"name":"gold","min_monthly_volume":"10000"},{"name":"base","min_monthly_volume":"0"}],
+			"firm_tiers":{"MM":"gold"},"rules":[{"tier":"gold","maker_rebate_bps":"3","taker_fee_bps":"2"}]}`, ""},
+		{"unnamed tier", `{"tiers":[{"min_monthly_volume":"0"}]}`, "fee tier without name"},
+		{"duplicate tier", `{"tiers":[{"name":"base"},{"name":"base"}]}`, "defined twice"},
+		{"negative volume", `{"tiers":[{"name":"base","min_monthly_volume":"-1"}]}`, "negative min_monthly_volume"},
+		{"unknown firm tier", `{"firm_tiers":{"MM":"gold"}}`, `firm MM: unknown fee tier "gold"`},
+		{"unknown rule tier", `{"rules":[{"tier":"gold"}]}`, `fee rule 1: unknown fee tier "gold"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "fees.json")
+			require.NoError(t, os.WriteFile(fileName, []byte(tt.content), 0o600))
+			s, err := LoadFeeSchedule(fileName)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "base", s.Tiers[0].Name, "tiers are sorted by volume")
+			require.Equal(t, "gold", s.tier("MM", decimal.Zero))
+			require.Equal(t, "base", s.tier("A", decimal.NewFromInt(9999)))
+			require.Equal(t, "gold", s.tier("A", decimal.NewFromInt(10000)))
+		})
+	}
+}
+
+func TestFeeSchedule_Rate(t *testing.T) {
+	s := FeeSchedule{Rules: []FeeRule{
+		{MakerRebateBps: decimal.NewFromInt(2), TakerFeeBps: decimal.NewFromInt(3)},
+		{Tier: "gold", MakerRebateBps: decimal.NewFromInt(3), TakerFeeBps: decimal.NewFromInt(2)},
+		{Symbol: "PETR4", TakerFeeBps: decimal.NewFromInt(5)},
+		{Firm: "FIRMA", TakerFeeBps: decimal.NewFromInt(1)},
+	}}
+	tests := []struct {
+		symbol, firm, tier string
+		maker              bool
+		want               string
+	}{
+		{"VALE3", "B", "", false, "3"},
+		{"VALE3", "B", "", true, "-2"},
+		{"VALE3", "B", "gold", true, "-3"},
+		// a symbol beats a tier, a firm beats both
+		{"PETR4", "B", "gold", false, "5"},
+		{"PETR4", "B", "gold", true, "0"},
+		{"PETR4", "FIRMA", "gold", false, "1"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, s.rate(tt.symbol, tt.firm, tt.tier, tt.maker).String(), "%+v", tt)
+	}
+	require.True(t, (&FeeSchedule{}).rate("VALE3", "B", "", false).IsZero(), "executions no rule matches are free")
+}
+
+func TestApplication_Fees(t *testing.T) {
+	schedule := FeeSchedule{
+		Tiers:     []FeeTier{{Name: "base", MinMonthlyVolume: decimal.Zero}, {Name: "gold", MinMonthlyVolume: decimal.NewFromInt(10000)}},
+		FirmTiers: map[string]string{"MM": "gold"},
+		Rules: []FeeRule{
+			{MakerRebateBps: decimal.NewFromInt(2), TakerFeeBps: decimal.NewFromInt(3)},
+			{Tier: "gold", MakerRebateBps: decimal.NewFromInt(3), TakerFeeBps: decimal.NewFromInt(2)},
+		},
+	}
+	volumes, err := LoadMonthlyVolumes(filepath.Join(t.TempDir(), "monthly_volumes.json"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, volumes.Close()) })
+	app := NewApplication(WithFeeSchedule(schedule), WithMonthlyVolumes(volumes), WithSessions(Sessions{
+		"MM": {CompID: "MM", Firm: "MM"},
+		"A":  {CompID: "A", Firm: "FIRMA"},
+	}))
+	// fees maps the ClOrdIDs of the orders a submit traded to the fee of their execution
+	submit := func(clOrdID, sender string, side domain.OrderSide, qty int64) (map[string]string, string) {
+		events, err := app.Submit(app.NewOrder(clOrdID, "VALE3", sender, "EX", side, enum.OrdType_LIMIT, decimal.NewFromInt(10),
+			decimal.NewFromInt(qty)))
+		require.NoError(t, err)
+		fees, tradeID := make(map[string]string), ""
+		for _, event := range events {
+			if event.Type == OrderEventTrade {
+				fees[event.Order.ClOrdID] = event.Fee.String()
+				tradeID = event.TradeID
+			}
+		}
+		return fees, tradeID
+	}
+	fees, _ := submit("m1", "MM", domain.SELL, 2000)
+	require.Empty(t, fees)
+	// FIRMA reaches gold with its first trade, and is charged the gold rate from the next one
+	fees, _ = submit("a1", "A", domain.BUY, 1000)
+	require.Equal(t, map[string]string{"m1": "-3", "a1": "3"}, fees)
+	fees, second := submit("a2", "A", domain.BUY, 100)
+	require.Equal(t, map[string]string{"m1": "-0.3", "a2": "0.2"}, fees)
+	// B trades without a firm, under its CompID
+	fees, third := submit("b1", "B", domain.BUY, 100)
+	require.Equal(t, map[string]string{"m1": "-0.3", "b1": "0.3"}, fees)
+
+	summary := app.FeeSummary()
+	require.Len(t, summary, 3)
+	b, firmA, mm := summary[0], summary[1], summary[2]
+	require.Equal(t, "B", b.Firm)
+	require.Equal(t, "base", b.Tier)
+	require.Equal(t, "1000", b.TakerVolume.String())
+	require.True(t, b.MakerVolume.IsZero())
+	require.Equal(t, "0.3", b.Net.String())
+	require.Equal(t, "gold", firmA.Tier)
+	require.Equal(t, "11000", firmA.MonthlyVolume.String())
+	require.Equal(t, "3.2", firmA.Fees.String())
+	require.Equal(t, 3, mm.Executions)
+	require.Equal(t, "12000", mm.MakerVolume.String())
+	require.Equal(t, "3.6", mm.Rebates.String())
+	require.Equal(t, "-3.6", mm.Net.String())
+
+	// a bust refunds the fees and takes the notional off the volumes, a correction charges the rest
+	events, err := app.BustTrade(second, "erroneous")
+	require.NoError(t, err)
+	for _, event := range events {
+		require.True(t, event.Fee.IsZero())
+	}
+	events, err = app.CorrectTrade(third, decimal.NewFromInt(10), decimal.NewFromInt(50), "")
+	require.NoError(t, err)
+	for _, event := range events {
+		require.Equal(t, map[string]string{"m1": "-0.15", "b1": "0.15"}[event.Order.ClOrdID], event.Fee.String())
+	}
+	summary = app.FeeSummary()
+	b, firmA, mm = summary[0], summary[1], summary[2]
+	require.Equal(t, "500", b.MonthlyVolume.String())
+	require.Equal(t, "0.15", b.Net.String())
+	require.Equal(t, 1, firmA.Executions)
+	require.Equal(t, "10000", firmA.MonthlyVolume.String())
+	require.Equal(t, "3", firmA.Fees.String())
+	require.Equal(t, "10500", mm.MonthlyVolume.String())
+	require.Equal(t, "3.15", mm.Rebates.String())
+}
+
+func TestLoadMonthlyVolumes(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "state", "monthly_volumes.json")
+	volumes, err := LoadMonthlyVolumes(fileName)
+	require.NoError(t, err)
+	volumes.startDay("20260331")
+	volumes.add(decimal.NewFromInt(500), "FIRMA", "MM")
+	volumes.add(decimal.NewFromInt(250), "FIRMA")
+	require.NoError(t, volumes.Close())
+
+	// after a restart on the same trading date
+	volumes, err = LoadMonthlyVolumes(fileName)
+	require.NoError(t, err)
+	volumes.startDay("20260331")
+	require.Equal(t, "750", volumes.volume("FIRMA").String())
+	require.Equal(t, "500", volumes.volume("MM").String())
+
+	// and on the first trading date of the next month, whatever the clock says
+	volumes.startDay("20260401")
+	require.True(t, volumes.volume("FIRMA").IsZero())
+	require.NoError(t, volumes.Close())
+
+	// trades are saved in the background
+	otherFileName := filepath.Join(filepath.Dir(fileName), "other_volumes.json")
+	volumes, err = LoadMonthlyVolumes(otherFileName)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, volumes.Close()) })
+	volumes.startDay("20260401")
+	volumes.add(decimal.NewFromInt(100), "MM")
+	require.Eventually(t, func() bool {
+		restored, err := LoadMonthlyVolumes(otherFileName)
+		require.NoError(t, err)
+		defer func() { _ = restored.Close() }()
+		return restored.month == "2026-04" && restored.volume("MM").String() == "100"
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(fileName, []byte(`{"month":"March","volumes":{}}`), 0o600))
+	_, err = LoadMonthlyVolumes(fileName)
+	require.ErrorContains(t, err, `invalid month "March"`)
+}
@@ -0,0 +1,110 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix42nos "github.com/quickfixgo/fix42/newordersingle"
+	fix42ocj "github.com/quickfixgo/fix42/ordercancelreject"
+	fix42ocrr "github.com/quickfixgo/fix42/ordercancelreplacerequest"
+	fix42ocr "github.com/quickfixgo/fix42/ordercancelrequest"
+	fix44nos "github.com/quickfixgo/fix44/newordersingle"
+	fix44ocj "github.com/quickfixgo/fix44/ordercancelreject"
+	fix44ocrr "github.com/quickfixgo/fix44/ordercancelreplacerequest"
+	fix44ocr "github.com/quickfixgo/fix44/ordercancelrequest"
+	fix50sp2nos "github.com/quickfixgo/fix50sp2/newordersingle"
+	fix50sp2ocj "github.com/quickfixgo/fix50sp2/ordercancelreject"
+	fix50sp2ocrr "github.com/quickfixgo/fix50sp2/ordercancelreplacerequest"
+	fix50sp2ocr "github.com/quickfixgo/fix50sp2/ordercancelrequest"
+	"github.com/quickfixgo/quickfix"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// Order entry is version neutral: the FIX 4.2, 4.4 and 5.0 SP2 (over FIXT.1.1) messages
+// share the tags the engine reads, so each version's generated type is handled through
+// the getters below. Responses are built in the version of the session they go to.
+
+type newOrderSingleMessage interface {
+	GetClOrdID() (string, quickfix.MessageRejectError)
+	GetAccount() (string, quickfix.MessageRejectError)
+	GetSymbol() (string, quickfix.MessageRejectError)
+	GetSide() (enum.Side, quickfix.MessageRejectError)
+	GetOrdType() (enum.OrdType, quickfix.MessageRejectError)
+	GetPrice() (decimal.Decimal, quickfix.MessageRejectError)
+	GetOrderQty() (decimal.Decimal, quickfix.MessageRejectError)
+	GetTimeInForce() (enum.TimeInForce, quickfix.MessageRejectError)
+	GetExpireDate() (string, quickfix.MessageRejectError)
+	GetExpireTime() (time.Time, quickfix.MessageRejectError)
+	ToMessage() *quickfix.Message
+}
+
+type orderCancelRequestMessage interface {
+	GetClOrdID() (string, quickfix.MessageRejectError)
+	GetOrigClOrdID() (string, quickfix.MessageRejectError)
+}
+
+type orderCancelReplaceRequestMessage interface {
+	orderCancelRequestMessage
+	GetPrice() (decimal.Decimal, quickfix.MessageRejectError)
+	GetOrderQty() (decimal.Decimal, quickfix.MessageRejectError)
+}
+
+func (a *Application) addOrderEntryRoutes() {
+	a.AddRoute(fix42nos.Route(func(msg fix42nos.NewOrderSingle, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onNewOrderSingle(msg, sessionID)
+	}))
+	a.AddRoute(fix42ocr.Route(func(msg fix42ocr.OrderCancelRequest, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onOrderCancelRequest(msg, sessionID)
+	}))
+	a.AddRoute(fix42ocrr.Route(func(msg fix42ocrr.OrderCancelReplaceRequest, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onOrderCancelReplaceRequest(msg, sessionID)
+	}))
+
+	a.AddRoute(fix44nos.Route(func(msg fix44nos.NewOrderSingle, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onNewOrderSingle(msg, sessionID)
+	}))
+	a.AddRoute(fix44ocr.Route(func(msg fix44ocr.OrderCancelRequest, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onOrderCancelRequest(msg, sessionID)
+	}))
+	a.AddRoute(fix44ocrr.Route(func(msg fix44ocrr.OrderCancelReplaceRequest, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onOrderCancelReplaceRequest(msg, sessionID)
+	}))
+
+	a.AddRoute(fix50sp2nos.Route(func(msg fix50sp2nos.NewOrderSingle, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onNewOrderSingle(msg, sessionID)
+	}))
+	a.AddRoute(fix50sp2ocr.Route(func(msg fix50sp2ocr.OrderCancelRequest, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onOrderCancelRequest(msg, sessionID)
+	}))
+	a.AddRoute(fix50sp2ocrr.Route(func(msg fix50sp2ocrr.OrderCancelReplaceRequest, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onOrderCancelReplaceRequest(msg, sessionID)
+	}))
+}
+
+// generateCancelReject builds an OrderCancelReject for a session of beginString. FIX 4.2
+// has no reason for duplicate ClOrdIDs nor an Other reason, both become Broker Option.
+func generateCancelReject(beginString, orderID, clOrdID, origClOrdID string, ordStatus enum.OrdStatus,
+	responseTo enum.CxlRejResponseTo, reason enum.CxlRejReason, text string) *quickfix.Message {
+	orderIDField := field.NewOrderID(orderID)
+	clOrdIDField := field.NewClOrdID(clOrdID)
+	origClOrdIDField := field.NewOrigClOrdID(origClOrdID)
+	ordStatusField := field.NewOrdStatus(ordStatus)
+	responseToField := field.NewCxlRejResponseTo(responseTo)
+
+	var msg *quickfix.Message
+	switch beginString {
+	case quickfix.BeginStringFIX42:
+		msg = fix42ocj.New(orderIDField, clOrdIDField, origClOrdIDField, ordStatusField, responseToField).ToMessage()
+		if reason != enum.CxlRejReason_TOO_LATE_TO_CANCEL && reason != enum.CxlRejReason_UNKNOWN_ORDER {
+			reason = enum.CxlRejReason_BROKER
+		}
+	case quickfix.BeginStringFIXT11:
+		msg = fix50sp2ocj.New(orderIDField, clOrdIDField, ordStatusField, responseToField).ToMessage()
+		msg.Body.Set(origClOrdIDField)
+	default:
+		msg = fix44ocj.New(orderIDField, clOrdIDField, origClOrdIDField, ordStatusField, responseToField).ToMessage()
+	}
+	msg.Body.Set(field.NewCxlRejReason(reason))
+	msg.Body.Set(field.NewText(text))
+	return msg
+}
@@ -0,0 +1,298 @@
+package order_gateway
+
+import (
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix42nos "github.com/quickfixgo/fix42/newordersingle"
+	fix42ocr "github.com/quickfixgo/fix42/ordercancelrequest"
+	fix44nos "github.com/quickfixgo/fix44/newordersingle"
+	fix44ocr "github.com/quickfixgo/fix44/ordercancelrequest"
+	fix50sp2nos "github.com/quickfixgo/fix50sp2/newordersingle"
+	fix50sp2ocrr "github.com/quickfixgo/fix50sp2/ordercancelreplacerequest"
+	"github.com/quickfixgo/quickfix"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"net"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCounterparty is the initiator side of the FIX sessions, collecting what the exchange sends.
+type testCounterparty struct {
+	logons   chan quickfix.SessionID
+	logouts  chan quickfix.SessionID
+	received chan *quickfix.Message
+	// admin are the Logouts received, the others admin messages being left out
+	admin chan *quickfix.Message
+	// passwords sent in the Logon of each CompID, as username and password
+	passwords map[string][2]string
+}
+
+func (c *testCounterparty) OnCreate(quickfix.SessionID)          {}
+func (c *testCounterparty) OnLogon(sessionID quickfix.SessionID) { c.logons <- sessionID }
+func (c *testCounterparty) OnLogout(sessionID quickfix.SessionID) {
+	select {
+	case c.logouts <- sessionID:
+	default:
+	}
+}
+func (c *testCounterparty) ToAdmin(msg *quickfix.Message, sessionID quickfix.SessionID) {
+	if credentials, ok := c.passwords[sessionID.SenderCompID]; ok && msg.IsMsgTypeOf(string(enum.MsgType_LOGON)) {
+		msg.Body.Set(field.NewUsername(credentials[0]))
+		msg.Body.Set(field.NewPassword(credentials[1]))
+	}
+}
+func (c *testCounterparty) ToApp(*quickfix.Message, quickfix.SessionID) error { return nil }
+func (c *testCounterparty) FromAdmin(msg *quickfix.Message, _ quickfix.SessionID) quickfix.MessageRejectError {
+	if msg.IsMsgTypeOf(string(enum.MsgType_LOGOUT)) {
+		select {
+		case c.admin <- msg:
+		default:
+		}
+	}
+	return nil
+}
+func (c *testCounterparty) FromApp(msg *quickfix.Message, _ quickfix.SessionID) quickfix.MessageRejectError {
+	c.received <- msg
+	return nil
+}
+
+func fixSettings(t *testing.T, port int, acceptor bool) *quickfix.Settings {
+	sessions := []struct {
+		beginString, compID, extra string
+	}{
+		{quickfix.BeginStringFIX42, "CLIENT42", ""},
+		{quickfix.BeginStringFIX44, "CLIENT44", ""},
+		{quickfix.BeginStringFIXT11, "CLIENT50", "DefaultApplVerID=FIX.5.0SP2\n"},
+	}
+	var cfg strings.Builder
+	if acceptor {
+		fmt.Fprintf(&cfg, "[DEFAULT]\nSocketAcceptPort=%d\nSenderCompID=ORDERGATEWAY\nResetOnLogon=Y\n", port)
+	} else {
+		fmt.Fprintf(&cfg, "[DEFAULT]\nSocketConnectHost=127.0.0.1\nSocketConnectPort=%d\nTargetCompID=ORDERGATEWAY\n"+
+			"HeartBtInt=30\nReconnectInterval=1\nResetOnLogon=Y\n", port)
+	}
+	for _, s := range sessions {
+		if acceptor {
+			fmt.Fprintf(&cfg, "[SESSION]\nBeginString=%s\nTargetCompID=%s\n%s", s.beginString, s.compID, s.extra)
+		} else {
+			fmt.Fprintf(&cfg, "[SESSION]\nBeginString=%s\nSenderCompID=%s\n%s", s.beginString, s.compID, s.extra)
+		}
+	}
+	settings, err := quickfix.ParseSettings(strings.NewReader(cfg.String()))
+	require.NoError(t, err)
+	return settings
+}
+
+// startFIX runs the exchange acceptor and a counterparty logged on in FIX 4.2, 4.4 and 5.0 SP2.
+func startFIX(t *testing.T) (*Application, *testCounterparty, map[string]quickfix.SessionID) {
+	app := NewApplication()
+	counterparty, sessions := startFIXSessions(t, app, nil, 3)
+	return app, counterparty, sessions
+}
+
+// startFIXSessions connects the counterparty to app and waits for logons of its sessions.
+func startFIXSessions(t *testing.T, app *Application, passwords map[string][2]string, logons int) (*testCounterparty, map[string]quickfix.SessionID) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := lis.Addr().(*net.TCPAddr).Port
+	require.NoError(t, lis.Close())
+
+	acceptor, err := quickfix.NewAcceptor(app, quickfix.NewMemoryStoreFactory(), fixSettings(t, port, true), quickfix.NewNullLogFactory())
+	require.NoError(t, err)
+	require.NoError(t, acceptor.Start())
+	t.Cleanup(acceptor.Stop)
+
+	counterparty := &testCounterparty{logons: make(chan quickfix.SessionID, 3), logouts: make(chan quickfix.SessionID, 3), received: make(chan *quickfix.Message, 100),
+		admin: make(chan *quickfix.Message, 10), passwords: passwords}
+	initiator, err := quickfix.NewInitiator(counterparty, quickfix.NewMemoryStoreFactory(), fixSettings(t, port, false), quickfix.NewNullLogFactory())
+	require.NoError(t, err)
+	require.NoError(t, initiator.Start())
+	t.Cleanup(initiator.Stop)
+
+	sessions := make(map[string]quickfix.SessionID)
+	for len(sessions) < logons {
+		select {
+		case sessionID := <-counterparty.logons:
+			sessions[sessionID.SenderCompID] = sessionID
+		case <-time.After(5 * time.Second):
+			t.Fatal("counterparty sessions did not log on")
+		}
+	}
+	return counterparty, sessions
+}
+
+func (c *testCounterparty) next(t *testing.T) *quickfix.Message {
+	select {
+	case msg := <-c.received:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+func requireFields(t *testing.T, msg *quickfix.Message, want map[int]string) {
+	for tag, value := range want {
+		got, err := msg.Body.GetString(quickfix.Tag(tag))
+		require.NoError(t, err, "tag %d", tag)
+		require.Equal(t, value, got, "tag %d", tag)
+	}
+}
+
+func TestApplication_FIXVersions(t *testing.T) {
+	app, counterparty, sessions := startFIX(t)
+	px := field.NewPrice(decimal.RequireFromString("10.5"), 2)
+	qty := field.NewOrderQty(decimal.NewFromInt(100), 0)
+
+	// a FIX 4.2 sell rests
+	sell := fix42nos.New(field.NewClOrdID("S1"), field.NewHandlInst(enum.HandlInst_AUTOMATED_EXECUTION_ORDER_PRIVATE_NO_BROKER_INTERVENTION),
+		field.NewSymbol("VALE3"), field.NewSide(enum.Side_SELL), field.NewTransactTime(time.Now()), field.NewOrdType(enum.OrdType_LIMIT))
+	sell.Set(px)
+	sell.Set(qty)
+	require.NoError(t, quickfix.SendToTarget(sell, sessions["CLIENT42"]))
+	er := counterparty.next(t)
+	require.Equal(t, quickfix.BeginStringFIX42, beginString(t, er))
+	requireFields(t, er, map[int]string{20: "0", 150: "0", 39: "0", 11: "S1", 55: "VALE3", 54: "2", 151: "100.00",
+		38: "100.00", 40: "2", 44: "10.50"})
+	require.True(t, er.Body.Has(60), "TransactTime")
+
+	// a FIX 5.0 SP2 buy takes 40
+	buy := fix50sp2nos.New(field.NewClOrdID("B1"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()),
+		field.NewOrdType(enum.OrdType_LIMIT))
+	buy.Set(field.NewSymbol("VALE3"))
+	buy.Set(px)
+	buy.Set(field.NewOrderQty(decimal.NewFromInt(40), 0))
+	require.NoError(t, quickfix.SendToTarget(buy, sessions["CLIENT50"]))
+	reports := map[string][]*quickfix.Message{}
+	for i := 0; i < 3; i++ {
+		msg := counterparty.next(t)
+		reports[beginString(t, msg)] = append(reports[beginString(t, msg)], msg)
+	}
+	require.Len(t, reports[quickfix.BeginStringFIXT11], 2)
+	requireFields(t, reports[quickfix.BeginStringFIXT11][0], map[int]string{150: "0", 11: "B1"})
+	requireFields(t, reports[quickfix.BeginStringFIXT11][1], map[int]string{150: "F", 39: "2", 32: "40.00", 31: "10.50"})
+	require.False(t, reports[quickfix.BeginStringFIXT11][1].Body.Has(20), "ExecTransType is gone after FIX 4.2")
+	require.Len(t, reports[quickfix.BeginStringFIX42], 1)
+	requireFields(t, reports[quickfix.BeginStringFIX42][0], map[int]string{20: "0", 150: "1", 39: "1", 32: "40.00", 151: "60.00"})
+
+	// the FIX 5.0 SP2 side replaces nothing left, a cancel reject in its own version
+	replace := fix50sp2ocrr.New(field.NewClOrdID("B2"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()),
+		field.NewOrdType(enum.OrdType_LIMIT))
+	replace.SetOrigClOrdID("B1")
+	replace.Set(px)
+	replace.Set(qty)
+	require.NoError(t, quickfix.SendToTarget(replace, sessions["CLIENT50"]))
+	reject := counterparty.next(t)
+	require.Equal(t, quickfix.BeginStringFIXT11, beginString(t, reject))
+	requireFields(t, reject, map[int]string{11: "B2", 41: "B1", 434: "2", 102: "0", 39: "2"})
+
+	// FIX 4.2 cancels the rest, then cancels again: too late in 4.2 terms
+	for _, clOrdID := range []string{"S2", "S3"} {
+		cancel := fix42ocr.New(field.NewOrigClOrdID("S1"), field.NewClOrdID(clOrdID), field.NewSymbol("VALE3"),
+			field.NewSide(enum.Side_SELL), field.NewTransactTime(time.Now()))
+		require.NoError(t, quickfix.SendToTarget(cancel, sessions["CLIENT42"]))
+	}
+	// execution reports are sent asynchronously, the reject may overtake the canceled report
+	byType := map[string]*quickfix.Message{}
+	for i := 0; i < 2; i++ {
+		msg := counterparty.next(t)
+		msgType, err := msg.MsgType()
+		require.NoError(t, err)
+		byType[msgType] = msg
+	}
+	requireFields(t, byType["8"], map[int]string{150: "4", 39: "4", 151: "0.00", 41: "S1"})
+	require.Equal(t, quickfix.BeginStringFIX42, beginString(t, byType["9"]))
+	requireFields(t, byType["9"], map[int]string{11: "S3", 102: "0", 434: "1"})
+
+	// FIX 4.4 keeps working, an unknown order is rejected with its 4.4 reason
+	nos := fix44nos.New(field.NewClOrdID("N1"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()),
+		field.NewOrdType(enum.OrdType_LIMIT))
+	nos.Set(field.NewSymbol("PETR4"))
+	nos.Set(px)
+	nos.Set(qty)
+	require.NoError(t, quickfix.SendToTarget(nos, sessions["CLIENT44"]))
+	er = counterparty.next(t)
+	require.Equal(t, quickfix.BeginStringFIX44, beginString(t, er))
+	requireFields(t, er, map[int]string{150: "0", 39: "0", 11: "N1"})
+	cancel := fix44ocr.New(field.NewOrigClOrdID("NOPE"), field.NewClOrdID("N2"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()))
+	require.NoError(t, quickfix.SendToTarget(cancel, sessions["CLIENT44"]))
+	reject = counterparty.next(t)
+	requireFields(t, reject, map[int]string{102: "1", 434: "1"})
+
+	view, ok := app.LookupOrder("CLIENT42", "S1")
+	require.True(t, ok)
+	require.Equal(t, "ORDERGATEWAY", view.TargetCompID)
+}
+
+func TestGenerateCancelReject_FIX42Reasons(t *testing.T) {
+	tests := []struct {
+		beginString string
+		reason      enum.CxlRejReason
+		want        string
+	}{
+		{quickfix.BeginStringFIX42, enum.CxlRejReason_DUPLICATE_CLORDID, "2"},
+		{quickfix.BeginStringFIX42, enum.CxlRejReason_OTHER, "2"},
+		{quickfix.BeginStringFIX42, enum.CxlRejReason_UNKNOWN_ORDER, "1"},
+		{quickfix.BeginStringFIX44, enum.CxlRejReason_DUPLICATE_CLORDID, "6"},
+		{quickfix.BeginStringFIXT11, enum.CxlRejReason_OTHER, "99"},
+	}
+	for _, tt := range tests {
+		msg := generateCancelReject(tt.beginString, "1", "C2", "C1", enum.OrdStatus_NEW,
+			enum.CxlRejResponseTo_ORDER_CANCEL_REQUEST, tt.reason, "text")
+		requireFields(t, msg, map[int]string{102: tt.want, 41: "C1"})
+	}
+}
+
+func beginString(t *testing.T, msg *quickfix.Message) string {
+	v, err := msg.Header.GetString(quickfix.Tag(8))
+	require.NoError(t, err)
+	return v
+}
+
+type recordingObserver struct {
+	sent   chan string
+	alerts []int
+}
+
+func (o *recordingObserver) ExecutionReportSent(compID string, latency time.Duration) {
+	if latency > 0 {
+		o.sent <- compID
+	}
+}
+
+func (o *recordingObserver) ExecutionReportRetried(string) {}
+
+func (o *recordingObserver) BacklogAlert(_ string, depth int) {
+	o.alerts = append(o.alerts, depth)
+}
+
+func TestApplication_DeliveryObserver(t *testing.T) {
+	app, counterparty, sessions := startFIX(t)
+	observer := &recordingObserver{sent: make(chan string, 10)}
+	app.AddDeliveryObserver(observer)
+
+	nos := fix44nos.New(field.NewClOrdID("O1"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()),
+		field.NewOrdType(enum.OrdType_LIMIT))
+	nos.SetSymbol("VALE3")
+	nos.Set(field.NewPrice(decimal.NewFromInt(10), 2))
+	nos.Set(field.NewOrderQty(decimal.NewFromInt(100), 0))
+	require.NoError(t, quickfix.SendToTarget(nos, sessions["CLIENT44"]))
+	counterparty.next(t)
+	select {
+	case compID := <-observer.sent:
+		require.Equal(t, "CLIENT44", compID)
+	case <-time.After(time.Second):
+		t.Fatal("execution report latency not observed")
+	}
+
+	// orders of other protocols have no FIX message to measure from
+	_, err := app.Submit(app.NewOrder("O2", "VALE3", "CLIENT44", "ORDERGATEWAY", domain.BUY, enum.OrdType_LIMIT,
+		decimal.NewFromInt(10), decimal.NewFromInt(1)))
+	require.NoError(t, err)
+	counterparty.next(t)
+	require.Empty(t, observer.sent)
+}
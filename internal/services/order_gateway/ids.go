@@ -0,0 +1,137 @@
+package order_gateway
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+const (
+	// MaxInstance is the highest engine instance number an ID can encode.
+	MaxInstance = 99
+	// maxSequence is how many IDs an instance hands out per trading date.
+	maxSequence = 999_999_999
+	// idBlock is how many sequence numbers are reserved in the journal at a time.
+	idBlock = 10_000
+)
+
+// ErrIDsUnavailable rejects new orders once IDs can no longer be handed out safely.
+var ErrIDsUnavailable = errors.New("IDs unavailable")
+
+// IDGenerator hands out the OrderIDs, ExecIDs and TradeIDs of an engine instance from
+// a single sequence. IDs are 19 digits, YYYYMMDD trading date, 2 digit instance and 9
+// digit sequence, so they sort the same as strings and as numbers and still fit the
+// 64 bit order references and match numbers of the binary protocols.
+//
+// With a journal, blocks of sequence numbers are recorded in the journal of the
+// trading date before any of them is handed out, so a restart resumes after the last
+// block and never repeats an ID. The next block is reserved once half of the current
+// one is used: when that fails, or the sequence of the day runs out, Err stops the
+// intake of new orders and the rest of the block finishes the operations under way.
+type IDGenerator struct {
+	mu       sync.Mutex
+	instance int
+	journal  *Journal
+	date     string
+	next     uint64
+	reserved uint64
+	// err is the reservation that failed, after which no further block is reserved
+	err error
+}
+
+// idReservation is a journal line recording the sequence numbers of instance used up to Reserved.
+type idReservation struct {
+	Instance    int    `json:"instance"`
+	TradingDate string `json:"trading_date"`
+	Reserved    uint64 `json:"reserved"`
+}
+
+// NewIDGenerator hands out the IDs of instance, reserving them in the journal of the
+// application it is given to, if any.
+func NewIDGenerator(instance int) (*IDGenerator, error) {
+	if instance < 0 || instance > MaxInstance {
+		return nil, fmt.Errorf("engine instance %d out of range 0-%d", instance, MaxInstance)
+	}
+	return &IDGenerator{instance: instance, next: 1}, nil
+}
+
+// WithIDGenerator draws every OrderID, ExecID and TradeID from g.
+func WithIDGenerator(g *IDGenerator) Option {
+	return func(a *Application) {
+		a.ids = g
+	}
+}
+
+// startDay starts the sequence of date over, after the block last reserved in the
+// journal of date when there is one.
+func (g *IDGenerator) startDay(journal *Journal, date string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.journal, g.date, g.reserved = journal, date, 0
+	if journal != nil {
+		g.reserved = journal.reservedIDs(g.instance, date)
+	}
+	g.next = g.reserved + 1
+}
+
+// Next returns a fresh ID of the trading date, or ErrIDsUnavailable once the IDs
+// reserved are used up.
+func (g *IDGenerator) Next() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err == nil && g.reserved < maxSequence && g.next+idBlock/2 > g.reserved {
+		reserved := min(g.reserved+idBlock, maxSequence)
+		err := g.save(reserved)
+		if err != nil {
+			log.Printf("ALERT: failed to reserve IDs, new orders are rejected: %s", err)
+			g.err = err
+		} else {
+			g.reserved = reserved
+		}
+	}
+	if g.next > g.reserved {
+		return "", g.unavailable()
+	}
+	id := fmt.Sprintf("%s%02d%09d", g.date, g.instance, g.next)
+	g.next++
+	return id, nil
+}
+
+// Err returns why new orders should no longer be taken: the reservation that failed
+// or the sequence of the trading date running out.
+func (g *IDGenerator) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.unavailable()
+}
+
+// unavailable is Err, the caller holds g.mu.
+func (g *IDGenerator) unavailable() error {
+	switch {
+	case g.err != nil:
+		return fmt.Errorf("%w: reserving IDs failed: %s", ErrIDsUnavailable, g.err)
+	case g.reserved == maxSequence && g.next+idBlock/2 > g.reserved:
+		return fmt.Errorf("%w: IDs of trading date %s exhausted", ErrIDsUnavailable, g.date)
+	default:
+		return nil
+	}
+}
+
+// save records in the journal that the sequence numbers up to reserved may be in use.
+func (g *IDGenerator) save(reserved uint64) error {
+	if g.journal == nil {
+		return nil
+	}
+	return g.journal.reserveIDs(idReservation{Instance: g.instance, TradingDate: g.date, Reserved: reserved})
+}
+
+// nextID draws an ID for an operation under way. Intake stops while enough IDs are
+// left to finish those, so it only comes back empty when one outlasts them.
+func (a *Application) nextID() string {
+	id, err := a.ids.Next()
+	if err != nil {
+		log.Printf("ALERT: %s", err)
+	}
+	return id
+}
@@ -0,0 +1,104 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+)
+
+func TestIDGenerator_Next(t *testing.T) {
+	dir := t.TempDir()
+	start := func(date string) (*Journal, *IDGenerator, *Application) {
+		j, err := OpenJournal(dir, date)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = j.Close() })
+		g, err := NewIDGenerator(7)
+		require.NoError(t, err)
+		return j, g, NewApplication(WithJournal(j), WithIDGenerator(g))
+	}
+	next := func(g *IDGenerator) string {
+		id, err := g.Next()
+		require.NoError(t, err)
+		return id
+	}
+
+	_, g, _ := start("20260302")
+	require.Equal(t, "2026030207000000001", next(g))
+	require.Equal(t, "2026030207000000002", next(g))
+
+	// a restart resumes after the block reserved in the journal
+	j, g, app := start("20260302")
+	require.Equal(t, "2026030207000010001", next(g))
+	events, err := ReadJournal(JournalFileName(dir, "20260302"))
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	// the sequence starts over on the next trading date
+	require.NoError(t, j.roll("20260303", nil, nil))
+	app.startTradingDay("20260303")
+	require.Equal(t, "2026030307000000001", next(g))
+
+	// once a block cannot be reserved, the rest of the current one is still handed out
+	// but new orders are rejected
+	require.NoError(t, j.file.Close())
+	for range idBlock / 2 {
+		next(g)
+	}
+	require.ErrorIs(t, g.Err(), ErrIDsUnavailable)
+	events, err = app.Submit(app.NewOrder("o1", "VALE3", "A", "EX", domain.SELL, enum.OrdType_LIMIT,
+		decimal.NewFromInt(10), decimal.NewFromInt(100)))
+	require.ErrorIs(t, err, ErrIDsUnavailable)
+	require.Equal(t, OrderEventRejected, events[0].Type)
+	for g.next <= g.reserved {
+		next(g)
+	}
+	_, err = g.Next()
+	require.ErrorIs(t, err, ErrIDsUnavailable)
+
+	// the sequence of a trading date running out stops new orders the same way
+	g, err = NewIDGenerator(7)
+	require.NoError(t, err)
+	g.startDay(nil, "20260303")
+	g.next, g.reserved = maxSequence-idBlock/2, maxSequence
+	require.NoError(t, g.Err())
+	require.Equal(t, "2026030307999994999", next(g))
+	require.ErrorContains(t, g.Err(), "IDs of trading date 20260303 exhausted")
+	g.next = maxSequence
+	require.Equal(t, "2026030307999999999", next(g))
+	_, err = g.Next()
+	require.ErrorIs(t, err, ErrIDsUnavailable)
+
+	_, err = NewIDGenerator(100)
+	require.EqualError(t, err, "engine instance 100 out of range 0-99")
+}
+
+func TestApplication_IDs(t *testing.T) {
+	ids, err := NewIDGenerator(3)
+	require.NoError(t, err)
+	app := NewApplication(WithIDGenerator(ids))
+	_, err = app.Submit(app.NewOrder("s1", "VALE3", "A", "EX", domain.SELL, enum.OrdType_LIMIT,
+		decimal.NewFromInt(10), decimal.NewFromInt(100)))
+	require.NoError(t, err)
+	events, err := app.Submit(app.NewOrder("b1", "VALE3", "B", "EX", domain.BUY, enum.OrdType_LIMIT,
+		decimal.NewFromInt(10), decimal.NewFromInt(40)))
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	// both sides of the match share the TradeID, and no other ID repeats it
+	require.Equal(t, OrderEventTrade, events[1].Type)
+	require.NotEmpty(t, events[1].TradeID)
+	require.Equal(t, events[1].TradeID, events[2].TradeID)
+	seen := []string{events[0].Order.OrderID, events[1].Order.OrderID, events[1].TradeID}
+	for _, event := range events {
+		seen = append(seen, event.ExecID)
+	}
+	for _, id := range seen {
+		require.Len(t, id, 19)
+		require.Equal(t, "03", id[8:10], "instance of %s", id)
+	}
+	require.Len(t, slices.Compact(slices.Sorted(slices.Values(seen))), len(seen))
+	require.True(t, events[0].ExecID < events[1].ExecID && events[1].ExecID < events[2].ExecID, "ExecIDs sort in order")
+}
@@ -0,0 +1,84 @@
+package order_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"stock_exchange/internal/services/order_gateway/domain"
+)
+
+// DefaultSettlementDays is the settlement cycle of instruments configured without one, T+2.
+const DefaultSettlementDays = 2
+
+// Instrument holds the per-symbol settings of the matching engine.
+type Instrument struct {
+	Symbol     string                  `json:"symbol"`
+	Allocation domain.AllocationConfig `json:"allocation"`
+	// SettlementDays is N of the T+N settlement cycle, DefaultSettlementDays when not set
+	SettlementDays *int `json:"settlement_days,omitempty"`
+}
+
+type Instruments map[string]Instrument
+
+type instrumentsFile struct {
+	Instruments []Instrument `json:"instruments"`
+}
+
+// LoadInstruments reads a JSON instruments file and validates every entry.
+func LoadInstruments(fileName string) (Instruments, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v, %v", fileName, err)
+	}
+	var f instrumentsFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading instruments: %s", err)
+	}
+	instruments := make(Instruments, len(f.Instruments))
+	for _, instrument := range f.Instruments {
+		if instrument.Symbol == "" {
+			return nil, fmt.Errorf("instrument without symbol")
+		}
+		if _, ok := instruments[instrument.Symbol]; ok {
+			return nil, fmt.Errorf("instrument %s is defined twice", instrument.Symbol)
+		}
+		if instrument.SettlementDays != nil && *instrument.SettlementDays < 0 {
+			return nil, fmt.Errorf("instrument %s: negative settlement_days", instrument.Symbol)
+		}
+		_, err = instrument.Allocation.Policy()
+		if err != nil {
+			return nil, fmt.Errorf("instrument %s: %s", instrument.Symbol, err)
+		}
+		instruments[instrument.Symbol] = instrument
+	}
+	return instruments, nil
+}
+
+// newOrderBook creates the book for symbol using its configured allocation policy,
+// falling back to FIFO for unknown instruments.
+func (i Instruments) newOrderBook(symbol string) *domain.OrderBook {
+	instrument, ok := i[symbol]
+	if !ok {
+		return domain.NewOrderBook(symbol)
+	}
+	policy, err := instrument.Allocation.Policy()
+	if err != nil {
+		return domain.NewOrderBook(symbol)
+	}
+	return domain.NewOrderBookWithAllocation(symbol, policy)
+}
+
+// settlementDate is when the trades of symbol on tradingDate settle, N trading dates
+// later, on tradingDate itself for T+0.
+func (i Instruments) settlementDate(symbol, tradingDate string) string {
+	days := DefaultSettlementDays
+	if n := i[symbol].SettlementDays; n != nil {
+		days = *n
+	}
+	date := tradingDate
+	for range days {
+		date = nextTradingDate(date)
+	}
+	return date
+}
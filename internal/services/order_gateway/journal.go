@@ -0,0 +1,315 @@
+package order_gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TradingDateLayout is how trading dates are written, in file names and FIX dates alike.
+const TradingDateLayout = "20060102"
+
+// Journal records every order event of a trading day, one JSON line each, to a file
+// named after the trading date. End of day processing rolls it over to the next
+// trading date, and builds the day's reports from it. It also records the blocks of
+// IDs reserved on the day.
+type Journal struct {
+	// mu guards the file, written to under the engine lock and by the IDGenerator
+	mu   sync.Mutex
+	dir  string
+	date string
+	file *os.File
+	// reserved are the IDs reserved by each engine instance in the journal of date
+	reserved map[int]uint64
+	// err is the first write that failed, after which the journal misses events
+	errMu sync.Mutex
+	err   error
+}
+
+// OpenJournal appends to the journal of date in dir, created if need be, so that a
+// restart during the day keeps adding to the same file.
+func OpenJournal(dir, date string) (*Journal, error) {
+	if _, err := time.Parse(TradingDateLayout, date); err != nil {
+		return nil, fmt.Errorf("invalid trading date %q", date)
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %v, %v", dir, err)
+	}
+	j := &Journal{dir: dir}
+	err = j.open(date)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// LatestTradingDate is the trading date of the latest journal in dir, which end of day
+// processing starts as it closes the one before, and false without any journal.
+func LatestTradingDate(dir string) (string, bool, error) {
+	fileNames, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return "", false, err
+	}
+	var latest string
+	for _, fileName := range fileNames {
+		date := strings.TrimSuffix(filepath.Base(fileName), ".jsonl")
+		if _, err := time.Parse(TradingDateLayout, date); err == nil && date > latest {
+			latest = date
+		}
+	}
+	return latest, latest != "", nil
+}
+
+// JournalFileName is the journal of date in dir.
+func JournalFileName(dir, date string) string {
+	return filepath.Join(dir, date+".jsonl")
+}
+
+// WithJournal records every order event to j and trades on its trading date.
+func WithJournal(j *Journal) Option {
+	return func(a *Application) {
+		a.journal = j
+		a.tradingDate = j.date
+	}
+}
+
+// journalLine is a line of the journal: an order event, a block of IDs reserved, or an
+// order or a position carried over from the previous trading date.
+type journalLine struct {
+	ExecReportRequiredEvent
+	IDs      *idReservation    `json:"ids,omitempty"`
+	Carried  *domain.OrderView `json:"carried,omitempty"`
+	Position *carriedPosition  `json:"position,omitempty"`
+}
+
+// isEvent reports whether the line is an order event.
+func (l journalLine) isEvent() bool {
+	return l.IDs == nil && l.Carried == nil && l.Position == nil
+}
+
+// open appends to the journal of date, picking up the IDs reserved in it so far.
+func (j *Journal) open(date string) error {
+	fileName := JournalFileName(j.dir, date)
+	reserved := make(map[int]uint64)
+	err := readJournal(fileName, func(line journalLine) {
+		if line.IDs != nil && line.IDs.TradingDate == date {
+			reserved[line.IDs.Instance] = max(reserved[line.IDs.Instance], line.IDs.Reserved)
+		}
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening %v, %v", fileName, err)
+	}
+	j.date, j.file, j.reserved = date, file, reserved
+	return nil
+}
+
+// reservedIDs is the last block of IDs instance reserved on date.
+func (j *Journal) reservedIDs(instance int, date string) uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if date != j.date {
+		return 0
+	}
+	return j.reserved[instance]
+}
+
+// reserveIDs records r and syncs it to disk before any of its IDs is handed out.
+// Reservations of a trading date already rolled over are not needed any more.
+func (j *Journal) reserveIDs(r idReservation) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if r.TradingDate != j.date {
+		return nil
+	}
+	data, err := json.Marshal(struct {
+		IDs idReservation `json:"ids"`
+	}{r})
+	if err != nil {
+		return err
+	}
+	_, err = j.file.Write(append(data, '\n'))
+	if err == nil {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		return err
+	}
+	j.reserved[r.Instance] = r.Reserved
+	return nil
+}
+
+// carry records the orders carried into the trading date, in time priority, and the
+// positions, and syncs them to disk. The caller holds j.mu.
+func (j *Journal) carry(orders []domain.OrderView, positions []carriedPosition) error {
+	var data []byte
+	for i := range orders {
+		line, err := json.Marshal(struct {
+			Carried domain.OrderView `json:"carried"`
+		}{orders[i]})
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	for i := range positions {
+		line, err := json.Marshal(struct {
+			Position carriedPosition `json:"position"`
+		}{positions[i]})
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	_, err := j.file.Write(data)
+	if err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// OnOrderEvent appends event to the journal of the trading day.
+func (j *Journal) OnOrderEvent(event ExecReportRequiredEvent) {
+	data, err := json.Marshal(event)
+	if err == nil {
+		j.mu.Lock()
+		_, err = j.file.Write(append(data, '\n'))
+		j.mu.Unlock()
+	}
+	if err != nil {
+		log.Printf("ALERT: failed to journal %s event %s of order %s, end of day reports will miss it: %s",
+			event.Type, event.ExecID, event.Order.OrderID, err)
+		j.fail(err)
+	}
+}
+
+func (j *Journal) fail(err error) {
+	j.errMu.Lock()
+	defer j.errMu.Unlock()
+	if j.err == nil {
+		j.err = err
+	}
+}
+
+// Err returns the first write that failed, after which the journal no longer holds
+// every event of the day.
+func (j *Journal) Err() error {
+	j.errMu.Lock()
+	defer j.errMu.Unlock()
+	return j.err
+}
+
+// roll starts the journal of date with the orders and positions carried into it, then closes the
+// journal of the day. When date cannot be started the journal stays on the day, the
+// file of date removed unless it was there before.
+func (j *Journal) roll(date string, carried []domain.OrderView, positions []carriedPosition) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	day, file, reserved := j.date, j.file, j.reserved
+	fileName := JournalFileName(j.dir, date)
+	_, statErr := os.Stat(fileName)
+	err := j.open(date)
+	if err == nil {
+		err = j.carry(carried, positions)
+	}
+	if err != nil {
+		if j.file != file {
+			_ = j.file.Close()
+			if errors.Is(statErr, os.ErrNotExist) {
+				_ = os.Remove(fileName)
+			}
+		}
+		j.date, j.file, j.reserved = day, file, reserved
+		return err
+	}
+	if err = errors.Join(file.Sync(), file.Close()); err != nil {
+		log.Printf("ALERT: failed to close the journal of %s, it may miss its last events: %s", day, err)
+		j.fail(err)
+	}
+	return nil
+}
+
+// unroll goes back to the journal of date from the one roll just started, which is removed.
+func (j *Journal) unroll(date string) error {
+	fileName := JournalFileName(j.dir, j.date)
+	err := j.roll(date, nil, nil)
+	if err != nil {
+		return err
+	}
+	return os.Remove(fileName)
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.close()
+}
+
+func (j *Journal) close() error {
+	err := j.file.Sync()
+	return errors.Join(err, j.file.Close())
+}
+
+// ReadJournal reads back the events journaled to fileName, in the order they happened.
+func ReadJournal(fileName string) ([]ExecReportRequiredEvent, error) {
+	events := make([]ExecReportRequiredEvent, 0)
+	err := readJournal(fileName, func(line journalLine) {
+		if line.isEvent() {
+			events = append(events, line.ExecReportRequiredEvent)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// readJournal calls fn with every line of fileName.
+func readJournal(fileName string, fn func(line journalLine)) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("error opening %v, %w", fileName, err)
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		var line journalLine
+		err = json.Unmarshal(scanner.Bytes(), &line)
+		if err != nil {
+			return fmt.Errorf("error reading %v line %d: %s", fileName, n, err)
+		}
+		fn(line)
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("error reading %v, %v", fileName, err)
+	}
+	return nil
+}
+
+// nextTradingDate is the weekday after date.
+func nextTradingDate(date string) string {
+	day, err := time.Parse(TradingDateLayout, date)
+	if err != nil {
+		return date
+	}
+	day = day.AddDate(0, 0, 1)
+	for day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day.Format(TradingDateLayout)
+}
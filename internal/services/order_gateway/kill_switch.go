@@ -0,0 +1,354 @@
+package order_gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix42ss "github.com/quickfixgo/fix42/securitystatus"
+	fix42tss "github.com/quickfixgo/fix42/tradingsessionstatus"
+	fix44ss "github.com/quickfixgo/fix44/securitystatus"
+	fix44tss "github.com/quickfixgo/fix44/tradingsessionstatus"
+	fix50sp2ss "github.com/quickfixgo/fix50sp2/securitystatus"
+	fix50sp2tss "github.com/quickfixgo/fix50sp2/tradingsessionstatus"
+	"github.com/quickfixgo/quickfix"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"time"
+)
+
+var (
+	ErrHalted    = errors.New("trading halted")
+	ErrNotHalted = errors.New("not halted")
+)
+
+// HaltScope is what a kill switch stops trading for.
+type HaltScope string
+
+const (
+	HaltExchange HaltScope = "exchange"
+	HaltFirm     HaltScope = "firm"
+	HaltSession  HaltScope = "session"
+	HaltSymbol   HaltScope = "symbol"
+)
+
+// tradingSessionID names the single trading session of the exchange in status messages.
+const tradingSessionID = "DAY"
+
+// Halt is a kill switch in force. Target is the firm, CompID or symbol halted and is
+// empty for the whole exchange.
+type Halt struct {
+	Scope  HaltScope `json:"scope"`
+	Target string    `json:"target"`
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+}
+
+func (h Halt) validate() error {
+	switch h.Scope {
+	case HaltExchange:
+		if h.Target != "" {
+			return fmt.Errorf("an exchange halt has no target")
+		}
+	case HaltFirm, HaltSession, HaltSymbol:
+		if h.Target == "" {
+			return fmt.Errorf("a %s halt needs a target", h.Scope)
+		}
+	default:
+		return fmt.Errorf("unknown halt scope %q", h.Scope)
+	}
+	return nil
+}
+
+func (h Halt) String() string {
+	if h.Scope == HaltExchange {
+		return string(h.Scope)
+	}
+	return string(h.Scope) + " " + h.Target
+}
+
+// KillSwitches are the halts in force, written back to their file on every change so
+// that they survive restarts. They are guarded by the engine lock.
+type KillSwitches struct {
+	fileName string
+	halts    []Halt
+}
+
+type killSwitchesFile struct {
+	Halts []Halt `json:"halts"`
+}
+
+// LoadKillSwitches reads the halts saved in fileName, none when it does not exist yet.
+func LoadKillSwitches(fileName string) (*KillSwitches, error) {
+	k := &KillSwitches{fileName: fileName}
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v, %v", fileName, err)
+	}
+	var f killSwitchesFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading kill switches: %s", err)
+	}
+	for _, halt := range f.Halts {
+		err = halt.validate()
+		if err != nil {
+			return nil, fmt.Errorf("kill switch %s: %s", halt, err)
+		}
+	}
+	k.halts = f.Halts
+	return k, nil
+}
+
+// save replaces the file atomically, so that a crash leaves either state on disk.
+func (k *KillSwitches) save() error {
+	if k.fileName == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(killSwitchesFile{Halts: k.halts}, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(k.fileName), 0o755)
+	if err != nil {
+		return err
+	}
+	tmp := k.fileName + ".tmp"
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.fileName)
+}
+
+func (k *KillSwitches) index(scope HaltScope, target string) int {
+	return slices.IndexFunc(k.halts, func(h Halt) bool { return h.Scope == scope && h.Target == target })
+}
+
+// set adds halt, or updates the reason of the same halt, and saves the result.
+func (k *KillSwitches) set(halt Halt) error {
+	previous := slices.Clone(k.halts)
+	if i := k.index(halt.Scope, halt.Target); i >= 0 {
+		halt.Since = k.halts[i].Since
+		k.halts[i] = halt
+	} else {
+		k.halts = append(k.halts, halt)
+	}
+	err := k.save()
+	if err != nil {
+		k.halts = previous
+	}
+	return err
+}
+
+func (k *KillSwitches) remove(scope HaltScope, target string) error {
+	i := k.index(scope, target)
+	if i < 0 {
+		return ErrNotHalted
+	}
+	previous := slices.Clone(k.halts)
+	k.halts = slices.Delete(k.halts, i, i+1)
+	err := k.save()
+	if err != nil {
+		k.halts = previous
+	}
+	return err
+}
+
+// WithKillSwitches restores the halts in force and saves every later change to them.
+func WithKillSwitches(k *KillSwitches) Option {
+	return func(a *Application) {
+		a.killSwitches = k
+	}
+}
+
+// firm returns the firm of the session of compID, or the one configured for a CompID
+// without a session, empty when there is neither.
+func (a *Application) firm(compID string) string {
+	if session, ok := a.sessions[compID]; ok {
+		return session.Firm
+	}
+	return a.firms[compID]
+}
+
+// affects reports whether halt stops the orders of compID in symbol.
+func (a *Application) affects(halt Halt, compID, symbol string) bool {
+	switch halt.Scope {
+	case HaltExchange:
+		return true
+	case HaltFirm:
+		return a.firm(compID) == halt.Target
+	case HaltSession:
+		return compID == halt.Target
+	case HaltSymbol:
+		return symbol == halt.Target
+	}
+	return false
+}
+
+// haltError returns why compID may not trade symbol, if a halt is in force for it.
+func (a *Application) haltError(compID, symbol string) error {
+	for _, halt := range a.killSwitches.halts {
+		if a.affects(halt, compID, symbol) {
+			return fmt.Errorf("%w: %s: %s", ErrHalted, halt, halt.Reason)
+		}
+	}
+	return nil
+}
+
+// Halt blocks new orders and amendments in scope, cancelling the resting orders when
+// cancelResting is set, and tells the FIX sessions concerned. Cancels are still accepted.
+func (a *Application) Halt(scope HaltScope, target, reason string, cancelResting bool) ([]ExecReportRequiredEvent, error) {
+	halt := Halt{Scope: scope, Target: target, Reason: reason, Since: time.Now().UTC()}
+	if err := halt.validate(); err != nil {
+		return nil, err
+	}
+	events, err := func() ([]ExecReportRequiredEvent, error) {
+		a.engineMu.Lock()
+		defer a.engineMu.Unlock()
+		err := a.killSwitches.set(halt)
+		if err != nil {
+			return nil, err
+		}
+		if !cancelResting {
+			return nil, nil
+		}
+		events := a.cancelHalted(halt)
+		a.publish(events)
+		return events, nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("%s halted: %s, %d orders canceled", halt, reason, len(events))
+	a.broadcastHalt(halt, true)
+	return events, nil
+}
+
+// Resume lifts the halt of scope and target. Orders canceled by the halt stay canceled.
+func (a *Application) Resume(scope HaltScope, target string) error {
+	halt := Halt{Scope: scope, Target: target}
+	err := func() error {
+		a.engineMu.Lock()
+		defer a.engineMu.Unlock()
+		return a.killSwitches.remove(scope, target)
+	}()
+	if err != nil {
+		return err
+	}
+	log.Printf("%s resumed", halt)
+	a.broadcastHalt(halt, false)
+	return nil
+}
+
+// Halts lists the halts in force, oldest first.
+func (a *Application) Halts() []Halt {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	return slices.Clone(a.killSwitches.halts)
+}
+
+// cancelHalted cancels every open order halt applies to, in the order they were sent.
+func (a *Application) cancelHalted(halt Halt) []ExecReportRequiredEvent {
+	orders := make([]*domain.Order, 0)
+	for _, order := range a.orders {
+		if order.IsOpen() && a.affects(halt, order.SenderCompID(), order.Symbol()) {
+			orders = append(orders, order)
+		}
+	}
+	slices.SortFunc(orders, func(x, y *domain.Order) int {
+		return x.CreatedAt().Compare(y.CreatedAt())
+	})
+	events := make([]ExecReportRequiredEvent, 0, len(orders))
+	for _, order := range orders {
+		book, ok := a.OrderBook(order.Symbol())
+		if !ok {
+			continue
+		}
+		if _, err := book.Cancel(order.SenderCompID(), order.ClOrdID()); err != nil {
+			log.Printf("failed to cancel order %s on halt: %s", order.OrderID(), err)
+			continue
+		}
+		event := a.newEvent(OrderEventCanceled, order.View())
+		event.Text, event.Reason = fmt.Sprintf("%s: %s: %s", ErrHalted, halt, halt.Reason), EventReasonHalted
+		events = append(events, event)
+	}
+	return events
+}
+
+// broadcastHalt sends a SecurityStatus for symbol halts, and a TradingSessionStatus
+// otherwise, to every logged on session the halt applies to.
+func (a *Application) broadcastHalt(halt Halt, halted bool) {
+	a.sessionsMu.RLock()
+	recipients := make([]quickfix.SessionID, 0, len(a.loggedOn))
+	for compID, sessionID := range a.loggedOn {
+		if halt.Scope == HaltSymbol || a.affects(halt, compID, "") {
+			recipients = append(recipients, sessionID)
+		}
+	}
+	a.sessionsMu.RUnlock()
+	for _, sessionID := range recipients {
+		var msg *quickfix.Message
+		if halt.Scope == HaltSymbol {
+			msg = generateSecurityStatus(sessionID.BeginString, halt.Target, halted, halt.Reason)
+		} else {
+			msg = generateTradingSessionStatus(sessionID.BeginString, halted, halt.Reason)
+		}
+		err := quickfix.SendToTarget(msg, sessionID)
+		if err != nil {
+			log.Printf("failed to send %s halt status to %s: %s", halt, sessionID, err)
+		}
+	}
+}
+
+func generateTradingSessionStatus(beginString string, halted bool, text string) *quickfix.Message {
+	sessionIDField := field.NewTradingSessionID(tradingSessionID)
+	statusField := field.NewTradSesStatus(enum.TradSesStatus_OPEN)
+	if halted {
+		statusField = field.NewTradSesStatus(enum.TradSesStatus_HALTED)
+	}
+	var msg *quickfix.Message
+	switch beginString {
+	case quickfix.BeginStringFIX42:
+		msg = fix42tss.New(sessionIDField, statusField).ToMessage()
+	case quickfix.BeginStringFIXT11:
+		msg = fix50sp2tss.New(sessionIDField, statusField).ToMessage()
+	default:
+		msg = fix44tss.New(sessionIDField, statusField).ToMessage()
+	}
+	if text != "" {
+		msg.Body.Set(field.NewText(text))
+	}
+	return msg
+}
+
+func generateSecurityStatus(beginString, symbol string, halted bool, text string) *quickfix.Message {
+	status := enum.SecurityTradingStatus_RESUME
+	if halted {
+		status = enum.SecurityTradingStatus_TRADING_HALT
+	}
+	var msg *quickfix.Message
+	switch beginString {
+	case quickfix.BeginStringFIX42:
+		msg = fix42ss.New(field.NewSymbol(symbol)).ToMessage()
+	case quickfix.BeginStringFIXT11:
+		msg = fix50sp2ss.New().ToMessage()
+		msg.Body.Set(field.NewSymbol(symbol))
+	default:
+		msg = fix44ss.New().ToMessage()
+		msg.Body.Set(field.NewSymbol(symbol))
+	}
+	msg.Body.Set(field.NewSecurityTradingStatus(status))
+	msg.Body.Set(field.NewTradingSessionID(tradingSessionID))
+	if text != "" {
+		msg.Body.Set(field.NewText(text))
+	}
+	return msg
+}
@@ -0,0 +1,165 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/quickfix"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+)
+
+func TestApplication_Halt(t *testing.T) {
+	sessions := Sessions{
+		"A1": {CompID: "A1", Firm: "FIRM1"},
+		"A2": {CompID: "A2", Firm: "FIRM1"},
+		"B1": {CompID: "B1", Firm: "FIRM2"},
+	}
+	resting := []struct {
+		sender, clOrdID, symbol string
+	}{
+		{"A1", "a1", "VALE3"},
+		{"A2", "a2", "PETR4"},
+		{"B1", "b1", "VALE3"},
+		{"RESTUSER", "r1", "PETR4"},
+		// an API key user of FIRM1
+		{"APIUSER", "p1", "VALE3"},
+	}
+	tests := []struct {
+		name   string
+		scope  HaltScope
+		target string
+		// halted lists the resting orders, by ClOrdID, the halt applies to
+		halted []string
+	}{
+		{"exchange", HaltExchange, "", []string{"a1", "a2", "b1", "r1", "p1"}},
+		{"firm", HaltFirm, "FIRM1", []string{"a1", "a2", "p1"}},
+		{"session", HaltSession, "B1", []string{"b1"}},
+		{"symbol", HaltSymbol, "PETR4", []string{"a2", "r1"}},
+		{"unknown firm", HaltFirm, "FIRM9", []string{}},
+	}
+	for _, tt := range tests {
+		for _, cancelResting := range []bool{true, false} {
+			app := NewApplication(WithSessions(sessions), WithFirms(map[string]string{"APIUSER": "FIRM1"}))
+			for _, r := range resting {
+				_, err := app.Submit(app.NewOrder(r.clOrdID, r.symbol, r.sender, "EX", domain.BUY, enum.OrdType_LIMIT,
+					decimal.NewFromInt(10), decimal.NewFromInt(100)))
+				require.NoError(t, err)
+			}
+
+			events, err := app.Halt(tt.scope, tt.target, "runaway algo", cancelResting)
+			require.NoError(t, err)
+			canceled := make([]string, 0, len(events))
+			for _, event := range events {
+				require.Equal(t, OrderEventCanceled, event.Type)
+				require.Equal(t, domain.OrderStatus(domain.OrderStatusCanceled), event.Order.Status)
+				require.Contains(t, event.Text, "trading halted: ")
+				require.Equal(t, EventReasonHalted, event.Reason)
+				canceled = append(canceled, event.Order.ClOrdID)
+			}
+			if cancelResting {
+				require.Equal(t, tt.halted, canceled, tt.name)
+			} else {
+				require.Empty(t, canceled, tt.name)
+			}
+			require.Len(t, app.Halts(), 1)
+
+			for _, r := range resting {
+				halted := slices.Contains(tt.halted, r.clOrdID)
+				events, err := app.Submit(app.NewOrder(r.clOrdID+"-new", r.symbol, r.sender, "EX", domain.SELL, enum.OrdType_LIMIT,
+					decimal.NewFromInt(20), decimal.NewFromInt(1)))
+				_, replaceErr := app.Replace(r.sender, r.clOrdID, r.clOrdID+"-amended", decimal.NewFromInt(10), decimal.NewFromInt(50))
+				if !halted {
+					require.NoError(t, err, "%s %s", tt.name, r.clOrdID)
+					require.NoError(t, replaceErr, "%s %s", tt.name, r.clOrdID)
+					continue
+				}
+				require.ErrorIs(t, err, ErrHalted, "%s %s", tt.name, r.clOrdID)
+				require.Equal(t, OrderEventRejected, events[0].Type)
+				require.Equal(t, EventReasonHalted, events[0].Reason)
+				if cancelResting {
+					require.ErrorIs(t, replaceErr, ErrOrderNotOpen)
+					continue
+				}
+				require.ErrorIs(t, replaceErr, ErrHalted)
+				// cancels are still accepted
+				_, err = app.Cancel(r.sender, r.clOrdID)
+				require.NoError(t, err)
+			}
+
+			require.ErrorIs(t, app.Resume(tt.scope, tt.target+"X"), ErrNotHalted)
+			require.NoError(t, app.Resume(tt.scope, tt.target))
+			require.Empty(t, app.Halts())
+			for _, r := range resting {
+				_, err = app.Submit(app.NewOrder(r.clOrdID+"-resumed", r.symbol, r.sender, "EX", domain.BUY, enum.OrdType_LIMIT,
+					decimal.NewFromInt(10), decimal.NewFromInt(1)))
+				require.NoError(t, err)
+			}
+		}
+	}
+
+	app := NewApplication()
+	_, err := app.Halt(HaltExchange, "VALE3", "", false)
+	require.ErrorContains(t, err, "an exchange halt has no target")
+	_, err = app.Halt(HaltSymbol, "", "", false)
+	require.ErrorContains(t, err, "a symbol halt needs a target")
+	_, err = app.Halt("market", "X", "", false)
+	require.ErrorContains(t, err, "unknown halt scope")
+}
+
+func TestLoadKillSwitches(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "state", "kill_switches.json")
+	killSwitches, err := LoadKillSwitches(fileName)
+	require.NoError(t, err)
+	app := NewApplication(WithKillSwitches(killSwitches))
+	_, err = app.Halt(HaltSymbol, "VALE3", "corporate action", false)
+	require.NoError(t, err)
+	_, err = app.Halt(HaltFirm, "FIRM1", "margin call", false)
+	require.NoError(t, err)
+	require.NoError(t, app.Resume(HaltSymbol, "VALE3"))
+
+	// after a restart
+	killSwitches, err = LoadKillSwitches(fileName)
+	require.NoError(t, err)
+	app = NewApplication(WithKillSwitches(killSwitches))
+	halts := app.Halts()
+	require.Len(t, halts, 1)
+	require.Equal(t, HaltFirm, halts[0].Scope)
+	require.Equal(t, "FIRM1", halts[0].Target)
+	require.Equal(t, "margin call", halts[0].Reason)
+	require.False(t, halts[0].Since.IsZero())
+
+	require.NoError(t, os.WriteFile(fileName, []byte(`{"halts":[{"scope":"desk","target":"X"}]}`), 0o600))
+	_, err = LoadKillSwitches(fileName)
+	require.ErrorContains(t, err, "unknown halt scope")
+}
+
+func TestApplication_HaltBroadcast(t *testing.T) {
+	app, counterparty, sessions := startFIX(t)
+
+	_, err := app.Halt(HaltSymbol, "VALE3", "volatility", false)
+	require.NoError(t, err)
+	for range sessions {
+		msg := counterparty.next(t)
+		require.True(t, msg.IsMsgTypeOf(string(enum.MsgType_SECURITY_STATUS)))
+		requireFields(t, msg, map[int]string{55: "VALE3", 326: "2", 58: "volatility"})
+	}
+
+	// a session halt only goes to that session
+	_, err = app.Halt(HaltSession, "CLIENT50", "runaway algo", false)
+	require.NoError(t, err)
+	msg := counterparty.next(t)
+	require.True(t, msg.IsMsgTypeOf(string(enum.MsgType_TRADING_SESSION_STATUS)))
+	requireFields(t, msg, map[int]string{336: "DAY", 340: "1", 58: "runaway algo"})
+	require.Equal(t, quickfix.BeginStringFIXT11, beginString(t, msg))
+
+	require.NoError(t, app.Resume(HaltSymbol, "VALE3"))
+	for range sessions {
+		msg := counterparty.next(t)
+		requireFields(t, msg, map[int]string{55: "VALE3", 326: "3"})
+	}
+	require.Empty(t, counterparty.received)
+}
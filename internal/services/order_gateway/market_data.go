@@ -0,0 +1,265 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix42mdr "github.com/quickfixgo/fix42/marketdatarequest"
+	fix44mdr "github.com/quickfixgo/fix44/marketdatarequest"
+	fix50sp2mdr "github.com/quickfixgo/fix50sp2/marketdatarequest"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+	"log"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"sync"
+)
+
+// A MarketDataRequest (35=V) is answered with a MarketDataSnapshotFullRefresh (35=W) of the
+// aggregated book of each requested symbol, MarketDepth levels deep (0 means the full book).
+// SubscriptionRequestType 0 asks for the snapshot only, 1 for the snapshot and a fresh one
+// each time the book changes, until a request of type 2 with the same MDReqID unsubscribes.
+// Refreshes are built off the matching path: book changes only mark their symbol, and a
+// goroutine sends the snapshots of the marked symbols.
+
+type marketDataRequestMessage interface {
+	GetMDReqID() (string, quickfix.MessageRejectError)
+	GetSubscriptionRequestType() (enum.SubscriptionRequestType, quickfix.MessageRejectError)
+	GetMarketDepth() (int, quickfix.MessageRejectError)
+	ToMessage() *quickfix.Message
+}
+
+func (a *Application) addMarketDataRoutes() {
+	a.AddRoute(fix42mdr.Route(func(msg fix42mdr.MarketDataRequest, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onMarketDataRequest(msg, sessionID)
+	}))
+	a.AddRoute(fix44mdr.Route(func(msg fix44mdr.MarketDataRequest, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onMarketDataRequest(msg, sessionID)
+	}))
+	a.AddRoute(fix50sp2mdr.Route(func(msg fix50sp2mdr.MarketDataRequest, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onMarketDataRequest(msg, sessionID)
+	}))
+}
+
+// marketDataSubscription is what a session subscribed to as one MDReqID.
+type marketDataSubscription struct {
+	symbols []string
+	depth   int
+}
+
+// marketDataSubscriptions are the subscriptions of every session and the symbols whose
+// book changed since their last refresh.
+type marketDataSubscriptions struct {
+	mu      sync.Mutex
+	subs    map[quickfix.SessionID]map[string]marketDataSubscription
+	changed map[string]struct{}
+	wake    chan struct{}
+	started bool
+}
+
+func newMarketDataSubscriptions() *marketDataSubscriptions {
+	return &marketDataSubscriptions{
+		subs:    make(map[quickfix.SessionID]map[string]marketDataSubscription),
+		changed: make(map[string]struct{}),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// subscribe registers sub as mdReqID of sessionID, false when the session already uses mdReqID.
+func (s *marketDataSubscriptions) subscribe(sessionID quickfix.SessionID, mdReqID string, sub marketDataSubscription) (bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bySession, ok := s.subs[sessionID]
+	if !ok {
+		bySession = make(map[string]marketDataSubscription)
+		s.subs[sessionID] = bySession
+	}
+	if _, ok := bySession[mdReqID]; ok {
+		return false, false
+	}
+	bySession[mdReqID] = sub
+	start := !s.started
+	s.started = true
+	return true, start
+}
+
+// unsubscribe removes mdReqID of sessionID, false when there was no such subscription.
+func (s *marketDataSubscriptions) unsubscribe(sessionID quickfix.SessionID, mdReqID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[sessionID][mdReqID]; !ok {
+		return false
+	}
+	delete(s.subs[sessionID], mdReqID)
+	return true
+}
+
+// drop removes every subscription of sessionID, whose counterparty logged out.
+func (s *marketDataSubscriptions) drop(sessionID quickfix.SessionID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subs, sessionID)
+}
+
+// OnBookEvent marks the symbol of event for a refresh, it runs under the book lock.
+func (s *marketDataSubscriptions) OnBookEvent(event domain.BookEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subs) == 0 {
+		return
+	}
+	s.changed[event.Symbol] = struct{}{}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// marketDataRefresh is one snapshot to send for a subscription.
+type marketDataRefresh struct {
+	sessionID quickfix.SessionID
+	mdReqID   string
+	symbol    string
+	depth     int
+}
+
+// refreshes takes the symbols marked so far and lists the snapshots their subscribers are owed.
+func (s *marketDataSubscriptions) refreshes() []marketDataRefresh {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshes := make([]marketDataRefresh, 0)
+	for sessionID, bySession := range s.subs {
+		for mdReqID, sub := range bySession {
+			for _, symbol := range sub.symbols {
+				if _, ok := s.changed[symbol]; ok {
+					refreshes = append(refreshes, marketDataRefresh{sessionID, mdReqID, symbol, sub.depth})
+				}
+			}
+		}
+	}
+	clear(s.changed)
+	return refreshes
+}
+
+// publishMarketData sends the refreshes of subscribed books as they change.
+func (a *Application) publishMarketData() {
+	for range a.marketData.wake {
+		for _, r := range a.marketData.refreshes() {
+			err := quickfix.SendToTarget(marketDataSnapshot(r.mdReqID, a.depth(r.symbol, r.depth), r.sessionID.BeginString), r.sessionID)
+			if err != nil {
+				log.Printf("failed to send market data %s of %s to %s: %s", r.mdReqID, r.symbol, r.sessionID, err)
+			}
+		}
+	}
+}
+
+func (a *Application) depth(symbol string, levels int) domain.Depth {
+	if book, ok := a.OrderBook(symbol); ok {
+		return book.Depth(levels)
+	}
+	return domain.Depth{Symbol: symbol}
+}
+
+func (a *Application) onMarketDataRequest(msg marketDataRequestMessage, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+	mdReqID, err := msg.GetMDReqID()
+	if err != nil {
+		return err
+	}
+	subscriptionType, err := msg.GetSubscriptionRequestType()
+	if err != nil {
+		return err
+	}
+	if subscriptionType == enum.SubscriptionRequestType_DISABLE_PREVIOUS_SNAPSHOT_PLUS_UPDATE_REQUEST {
+		if !a.marketData.unsubscribe(sessionID, mdReqID) {
+			return a.sendMarketDataReject(sessionID, mdReqID, "", "unknown MDReqID")
+		}
+		return nil
+	}
+	marketDepth, err := msg.GetMarketDepth()
+	if err != nil {
+		return err
+	}
+	symbols, err := requestedSymbols(msg.ToMessage())
+	if err != nil {
+		return err
+	}
+	switch subscriptionType {
+	case enum.SubscriptionRequestType_SNAPSHOT:
+	case enum.SubscriptionRequestType_SNAPSHOT_PLUS_UPDATES:
+		subscribed, start := a.marketData.subscribe(sessionID, mdReqID, marketDataSubscription{symbols: symbols, depth: marketDepth})
+		if !subscribed {
+			return a.sendMarketDataReject(sessionID, mdReqID, enum.MDReqRejReason_DUPLICATE_MDREQID, "duplicate MDReqID")
+		}
+		if start {
+			go a.publishMarketData()
+		}
+	default:
+		return quickfix.ValueIsIncorrect(tag.SubscriptionRequestType)
+	}
+	for _, symbol := range symbols {
+		sendErr := quickfix.SendToTarget(marketDataSnapshot(mdReqID, a.depth(symbol, marketDepth), sessionID.BeginString), sessionID)
+		if sendErr != nil {
+			return quickfix.NewMessageRejectError(sendErr.Error(), -1, nil)
+		}
+	}
+	return nil
+}
+
+// requestedSymbols reads the Symbol of each entry of the NoRelatedSym group (146).
+func requestedSymbols(msg *quickfix.Message) ([]string, quickfix.MessageRejectError) {
+	group := quickfix.NewRepeatingGroup(tag.NoRelatedSym, quickfix.GroupTemplate{quickfix.GroupElement(tag.Symbol)})
+	if err := msg.Body.GetGroup(group); err != nil {
+		return nil, err
+	}
+	symbols := make([]string, 0, group.Len())
+	for i := 0; i < group.Len(); i++ {
+		symbol, err := group.Get(i).GetString(tag.Symbol)
+		if err != nil {
+			return nil, quickfix.RequiredTagMissing(tag.Symbol)
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, nil
+}
+
+func (a *Application) sendMarketDataReject(sessionID quickfix.SessionID, mdReqID string, reason enum.MDReqRejReason,
+	text string) quickfix.MessageRejectError {
+	msg := quickfix.NewMessage()
+	msg.Header.Set(field.NewBeginString(sessionID.BeginString))
+	msg.Header.Set(field.NewMsgType(enum.MsgType_MARKET_DATA_REQUEST_REJECT))
+	msg.Body.Set(field.NewMDReqID(mdReqID))
+	if reason != "" {
+		msg.Body.Set(field.NewMDReqRejReason(reason))
+	}
+	msg.Body.Set(field.NewText(text))
+	if err := quickfix.SendToTarget(msg, sessionID); err != nil {
+		return quickfix.NewMessageRejectError(err.Error(), -1, nil)
+	}
+	return nil
+}
+
+// marketDataSnapshot builds the MarketDataSnapshotFullRefresh of depth for a session of beginString.
+func marketDataSnapshot(mdReqID string, depth domain.Depth, beginString string) *quickfix.Message {
+	msg := quickfix.NewMessage()
+	msg.Header.Set(field.NewBeginString(beginString))
+	msg.Header.Set(field.NewMsgType(enum.MsgType_MARKET_DATA_SNAPSHOT_FULL_REFRESH))
+	msg.Body.Set(field.NewMDReqID(mdReqID))
+	msg.Body.Set(field.NewSymbol(depth.Symbol))
+	entries := quickfix.NewRepeatingGroup(tag.NoMDEntries, quickfix.GroupTemplate{
+		quickfix.GroupElement(tag.MDEntryType), quickfix.GroupElement(tag.MDEntryPx), quickfix.GroupElement(tag.MDEntrySize),
+		quickfix.GroupElement(tag.NumberOfOrders), quickfix.GroupElement(tag.MDEntryPositionNo),
+	})
+	for _, side := range []struct {
+		entryType enum.MDEntryType
+		levels    []domain.PriceLevel
+	}{{enum.MDEntryType_BID, depth.Bids}, {enum.MDEntryType_OFFER, depth.Asks}} {
+		for i, level := range side.levels {
+			entry := entries.Add()
+			entry.Set(field.NewMDEntryType(side.entryType))
+			entry.Set(field.NewMDEntryPx(level.Price, 2))
+			entry.Set(field.NewMDEntrySize(level.Quantity, 2))
+			entry.Set(field.NewNumberOfOrders(level.Orders))
+			entry.Set(field.NewMDEntryPositionNo(i + 1))
+		}
+	}
+	msg.Body.SetGroup(entries)
+	return msg
+}
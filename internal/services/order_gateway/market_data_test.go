@@ -0,0 +1,80 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix42mdr "github.com/quickfixgo/fix42/marketdatarequest"
+	fix50sp2mdr "github.com/quickfixgo/fix50sp2/marketdatarequest"
+	"github.com/quickfixgo/quickfix"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+	"time"
+)
+
+func TestApplication_MarketDataRequest(t *testing.T) {
+	app, counterparty, sessions := startFIX(t)
+	request42 := func(mdReqID string, subscriptionType enum.SubscriptionRequestType) *quickfix.Message {
+		msg := fix42mdr.New(field.NewMDReqID(mdReqID), field.NewSubscriptionRequestType(subscriptionType), field.NewMarketDepth(0))
+		entryTypes := fix42mdr.NewNoMDEntryTypesRepeatingGroup()
+		entryTypes.Add().SetMDEntryType(enum.MDEntryType_BID)
+		msg.SetNoMDEntryTypes(entryTypes)
+		symbols := fix42mdr.NewNoRelatedSymRepeatingGroup()
+		symbols.Add().SetSymbol("VALE3")
+		msg.SetNoRelatedSym(symbols)
+		return msg.ToMessage()
+	}
+	submit := func(clOrdID string) {
+		// a sender without a FIX session, so only market data reaches the counterparty
+		order := app.NewOrder(clOrdID, "VALE3", "REST1", "EX", domain.BUY, enum.OrdType_LIMIT, decimal.NewFromInt(10),
+			decimal.NewFromInt(100))
+		_, err := app.Submit(order)
+		require.NoError(t, err)
+	}
+	requireSnapshot := func(mdReqID string, entries string) {
+		msg := counterparty.next(t)
+		require.True(t, msg.IsMsgTypeOf(string(enum.MsgType_MARKET_DATA_SNAPSHOT_FULL_REFRESH)))
+		requireFields(t, msg, map[int]string{262: mdReqID, 55: "VALE3", 268: entries})
+	}
+	requireNothing := func() {
+		select {
+		case msg := <-counterparty.received:
+			t.Fatalf("unexpected message %s", msg)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	require.NoError(t, quickfix.SendToTarget(request42("M1", enum.SubscriptionRequestType_SNAPSHOT_PLUS_UPDATES), sessions["CLIENT42"]))
+	requireSnapshot("M1", "0")
+	snapshot := fix50sp2mdr.New(field.NewMDReqID("M2"), field.NewSubscriptionRequestType(enum.SubscriptionRequestType_SNAPSHOT),
+		field.NewMarketDepth(1))
+	symbols := fix50sp2mdr.NewNoRelatedSymRepeatingGroup()
+	symbols.Add().SetSymbol("VALE3")
+	snapshot.SetNoRelatedSym(symbols)
+	require.NoError(t, quickfix.SendToTarget(snapshot, sessions["CLIENT50"]))
+	requireSnapshot("M2", "0")
+
+	// only the subscription is refreshed
+	submit("B1")
+	requireSnapshot("M1", "1")
+	requireNothing()
+
+	require.NoError(t, quickfix.SendToTarget(request42("M1", enum.SubscriptionRequestType_SNAPSHOT_PLUS_UPDATES), sessions["CLIENT42"]))
+	reject := counterparty.next(t)
+	require.True(t, reject.IsMsgTypeOf(string(enum.MsgType_MARKET_DATA_REQUEST_REJECT)))
+	requireFields(t, reject, map[int]string{262: "M1", 281: string(enum.MDReqRejReason_DUPLICATE_MDREQID)})
+
+	require.NoError(t, quickfix.SendToTarget(request42("M1", enum.SubscriptionRequestType_DISABLE_PREVIOUS_SNAPSHOT_PLUS_UPDATE_REQUEST),
+		sessions["CLIENT42"]))
+	// a snapshot behind the unsubscribe on the same session shows it was processed
+	require.NoError(t, quickfix.SendToTarget(request42("M3", enum.SubscriptionRequestType_SNAPSHOT), sessions["CLIENT42"]))
+	requireSnapshot("M3", "1")
+	submit("B2")
+	requireNothing()
+	require.NoError(t, quickfix.SendToTarget(request42("M1", enum.SubscriptionRequestType_DISABLE_PREVIOUS_SNAPSHOT_PLUS_UPDATE_REQUEST),
+		sessions["CLIENT42"]))
+	reject = counterparty.next(t)
+	require.True(t, reject.IsMsgTypeOf(string(enum.MsgType_MARKET_DATA_REQUEST_REJECT)))
+	requireFields(t, reject, map[int]string{262: "M1", 58: "unknown MDReqID"})
+}
@@ -1,74 +1,208 @@
 package order_gateway
 
 import (
-	"context"
-	"fmt"
+	"errors"
 	"github.com/quickfixgo/enum"
-	"github.com/quickfixgo/field"
-	"github.com/quickfixgo/fix44/executionreport"
-	"github.com/quickfixgo/fix44/marketdatarequest"
 	"github.com/quickfixgo/fix44/newordercross"
-	"github.com/quickfixgo/fix44/newordersingle"
-	"github.com/quickfixgo/fix44/ordercancelrequest"
 	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
 	"github.com/shopspring/decimal"
 	"log"
+	"slices"
 	"stock_exchange/internal/services/order_gateway/domain"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Application struct {
 	*quickfix.MessageRouter
-	execID            int
-	orderID           int
+	ids               *IDGenerator
+	booksMu           sync.RWMutex
 	orderBookBySymbol map[string]*domain.OrderBook
+	instruments       Instruments
+	sessions          Sessions
+	accounts          Accounts
+	// firms are the firms of the CompIDs without a FIX session
+	firms        map[string]string
+	throttles    map[string]*sessionThrottle
+	killSwitches *KillSwitches
+	// engineMu serializes the matching path across entry protocols
+	engineMu        sync.Mutex
+	orders          map[string]*domain.Order
+	ordersByClOrdID map[orderRef]*domain.Order
+	trades          map[string]*Trade
+	// symbolTrades are the trades of each symbol in the order they happened, and
+	// lastPrices the price of the last of them that stands
+	symbolTrades map[string][]*Trade
+	lastPrices   map[string]decimal.Decimal
+	positions    map[positionKey]*Position
+	// carriedPositions are the positions the trading date started with
+	carriedPositions []carriedPosition
+	exposures        *exposures
+	allocations      []*Allocation
+	fees             *FeeSchedule
+	volumes          *MonthlyVolumes
+	// tradingDate is the YYYYMMDD date orders are taken for until end of day processing
+	tradingDate string
+	journal     *Journal
+	audit       *AuditTrail
+	reportsDir  string
+	// settlements are the settlement prices of the last end of day each symbol traded
+	settlements   map[string]decimal.Decimal
+	listeners     []OrderEventListener
+	bookListeners []domain.BookListener
+	dayListeners  []TradingDayListener
+	sessionsMu    sync.RWMutex
+	fixSessions   map[quickfix.SessionID]struct{}
+	loggedOn      map[string]quickfix.SessionID
+	// receivedAt is when the message a session's handler is processing was read
+	receivedAt map[string]time.Time
+	// receipts are the audit records of the messages being processed, by the orders they name
+	receipts              map[orderRef]auditReceipt
+	deliveryObservers     []DeliveryObserver
+	marketData            *marketDataSubscriptions
+	outbox                *Outbox
+	backlogAlertThreshold int
 }
 
-func NewApplication() *Application {
+type Option func(*Application)
+
+// WithInstruments configures per-symbol settings such as the book allocation policy.
+func WithInstruments(instruments Instruments) Option {
+	return func(a *Application) {
+		a.instruments = instruments
+	}
+}
+
+// WithSessions authenticates FIX Logons and restricts what each configured session may trade.
+func WithSessions(sessions Sessions) Option {
+	return func(a *Application) {
+		a.sessions = sessions
+	}
+}
+
+// WithFirms sets the firm of CompIDs without a FIX session, such as the API key users of
+// the other gateways, for firm halts, fees and drop copies alike.
+func WithFirms(firms map[string]string) Option {
+	return func(a *Application) {
+		a.firms = firms
+	}
+}
+
+func NewApplication(opts ...Option) *Application {
 	app := &Application{
-		MessageRouter:     quickfix.NewMessageRouter(),
-		execID:            0,
-		orderBookBySymbol: make(map[string]*domain.OrderBook),
+		MessageRouter:         quickfix.NewMessageRouter(),
+		ids:                   &IDGenerator{next: 1},
+		orderBookBySymbol:     make(map[string]*domain.OrderBook),
+		instruments:           make(Instruments),
+		orders:                make(map[string]*domain.Order),
+		ordersByClOrdID:       make(map[orderRef]*domain.Order),
+		trades:                make(map[string]*Trade),
+		symbolTrades:          make(map[string][]*Trade),
+		lastPrices:            make(map[string]decimal.Decimal),
+		positions:             make(map[positionKey]*Position),
+		exposures:             newExposures(),
+		volumes:               NewMonthlyVolumes(),
+		tradingDate:           time.Now().Format(TradingDateLayout),
+		settlements:           make(map[string]decimal.Decimal),
+		fixSessions:           make(map[quickfix.SessionID]struct{}),
+		loggedOn:              make(map[string]quickfix.SessionID),
+		receivedAt:            make(map[string]time.Time),
+		receipts:              make(map[orderRef]auditReceipt),
+		killSwitches:          &KillSwitches{},
+		outbox:                NewOutbox(),
+		marketData:            newMarketDataSubscriptions(),
+		backlogAlertThreshold: DefaultBacklogAlertThreshold,
+	}
+	for _, opt := range opts {
+		opt(app)
+	}
+	app.listeners = append(app.listeners, app.exposures)
+	if app.journal != nil {
+		app.listeners = append(app.listeners, app.journal)
 	}
-	app.AddRoute(newordersingle.Route(app.onNewOrderSingle))
-	app.AddRoute(ordercancelrequest.Route(app.onOrderCancelRequest))
-	app.AddRoute(marketdatarequest.Route(app.onMarketDataRequest))
+	app.ids.startDay(app.journal, app.tradingDate)
+	app.volumes.startDay(app.tradingDate)
+	app.bookListeners = append(app.bookListeners, app.marketData)
+	app.throttles = newThrottles(app.sessions)
+	app.startDelivery()
+	app.addOrderEntryRoutes()
+	app.addPositionRoutes()
+	app.addAllocationRoutes()
+	app.addMarketDataRoutes()
 	app.AddRoute(newordercross.Route(app.onNewOrderCross))
 
 	return app
 }
 
-// OnCreate implemented as part of Application interface
-func (a Application) OnCreate(sessionID quickfix.SessionID) {}
+// OnCreate implemented as part of Application interface, remembers the session of each counterparty
+func (a *Application) OnCreate(sessionID quickfix.SessionID) {
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+	a.fixSessions[sessionID] = struct{}{}
+}
 
-// OnLogon implemented as part of Application interface
-func (a Application) OnLogon(sessionID quickfix.SessionID) {}
+// OnLogon implemented as part of Application interface, tracks who status messages are
+// broadcast to and resumes the delivery of the execution reports queued meanwhile
+func (a *Application) OnLogon(sessionID quickfix.SessionID) {
+	a.sessionsMu.Lock()
+	a.loggedOn[sessionID.TargetCompID] = sessionID
+	a.sessionsMu.Unlock()
+	a.wakeDelivery(sessionID.TargetCompID)
+}
 
 // OnLogout implemented as part of Application interface
-func (a Application) OnLogout(sessionID quickfix.SessionID) {}
+func (a *Application) OnLogout(sessionID quickfix.SessionID) {
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+	delete(a.loggedOn, sessionID.TargetCompID)
+	a.marketData.drop(sessionID)
+}
 
 // ToAdmin implemented as part of Application interface
-func (a Application) ToAdmin(msg *quickfix.Message, sessionID quickfix.SessionID) {}
+func (a *Application) ToAdmin(msg *quickfix.Message, sessionID quickfix.SessionID) {}
 
 // ToApp implemented as part of Application interface
-func (a Application) ToApp(msg *quickfix.Message, sessionID quickfix.SessionID) error {
+func (a *Application) ToApp(msg *quickfix.Message, sessionID quickfix.SessionID) error {
 	return nil
 }
 
-// FromAdmin implemented as part of Application interface
-func (a Application) FromAdmin(msg *quickfix.Message, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+// FromAdmin implemented as part of Application interface, authenticates Logons
+func (a *Application) FromAdmin(msg *quickfix.Message, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+	if msg.IsMsgTypeOf(string(enum.MsgType_LOGON)) {
+		return a.onLogon(msg, sessionID)
+	}
 	return nil
 }
 
-// FromApp implemented as part of Application interface, uses Router on incoming application messages
+// FromApp implemented as part of Application interface, audits and throttles then uses Router on incoming
+// application messages
 func (a *Application) FromApp(msg *quickfix.Message, sessionID quickfix.SessionID) (reject quickfix.MessageRejectError) {
-	return a.Route(msg, sessionID)
+	receipt := a.auditReceived(msg, sessionID)
+	admitted, reject := a.throttle(msg, sessionID)
+	if !admitted {
+		a.auditMessageRejected(receipt, msg, sessionID, "throttle exceeded")
+		return reject
+	}
+	a.sessionsMu.Lock()
+	a.receivedAt[sessionID.TargetCompID] = msg.ReceiveTime
+	a.sessionsMu.Unlock()
+	a.holdReceipt(sessionID.TargetCompID, receipt)
+	defer func() {
+		a.releaseReceipt(sessionID.TargetCompID, receipt)
+		a.sessionsMu.Lock()
+		delete(a.receivedAt, sessionID.TargetCompID)
+		a.sessionsMu.Unlock()
+	}()
+	reject = a.Route(msg, sessionID)
+	if reject != nil {
+		a.auditMessageRejected(receipt, msg, sessionID, reject.Error())
+	}
+	return reject
 }
 
-func (a *Application) newOrderSingleToDomain(msg newordersingle.NewOrderSingle) (*domain.Order, quickfix.MessageRejectError) {
-	a.orderID += 1
-	orderID := a.orderID
+func (a *Application) newOrderSingleToDomain(msg newOrderSingleMessage, sessionID quickfix.SessionID) (*domain.Order, quickfix.MessageRejectError) {
 	clOrdID, err := msg.GetClOrdID()
 	if err != nil {
 		return nil, err
@@ -79,16 +213,6 @@ func (a *Application) newOrderSingleToDomain(msg newordersingle.NewOrderSingle)
 		return nil, err
 	}
 
-	senderCompID, err := msg.Header.GetSenderCompID()
-	if err != nil {
-		return nil, err
-	}
-
-	targetCompID, err := msg.Header.GetTargetCompID()
-	if err != nil {
-		return nil, err
-	}
-
 	side, err := msg.GetSide()
 	if err != nil {
 		return nil, err
@@ -99,9 +223,12 @@ func (a *Application) newOrderSingleToDomain(msg newordersingle.NewOrderSingle)
 		return nil, err
 	}
 
-	price, err := msg.GetPrice()
-	if err != nil {
-		return nil, err
+	price := decimal.Zero
+	if ordType != enum.OrdType_MARKET {
+		price, err = msg.GetPrice()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	orderQty, err := msg.GetOrderQty()
@@ -115,220 +242,244 @@ func (a *Application) newOrderSingleToDomain(msg newordersingle.NewOrderSingle)
 	case enum.Side_SELL:
 		domainSide = domain.SELL
 	}
-	order := domain.NewOrder(clOrdID, symbol, senderCompID, targetCompID, domainSide, ordType, price, orderQty, strconv.Itoa(orderID))
+	// the counterparty of the session is the SenderCompID of every message it sends
+	order := a.NewOrder(clOrdID, symbol, sessionID.TargetCompID, sessionID.SenderCompID, domainSide, ordType, price, orderQty)
+	order.SetEntryProtocol(domain.EntryFIX)
+	if account, err := msg.GetAccount(); err == nil {
+		order.SetAccount(account)
+	}
+	timeInForce, expireDate, err := timeInForceOf(msg)
+	if err != nil {
+		return nil, err
+	}
+	order.SetTimeInForce(timeInForce, expireDate)
+	orderCapacity, parties, err := partiesOf(msg.ToMessage())
+	if err != nil {
+		return nil, err
+	}
+	order.SetParties(orderCapacity, parties)
 	return order, nil
 }
 
+// timeInForceOf reads how long an order works: DAY when absent, GTC, or GTD until the
+// end of its ExpireDate, or of the UTC date of its ExpireTime.
+func timeInForceOf(msg newOrderSingleMessage) (enum.TimeInForce, string, quickfix.MessageRejectError) {
+	timeInForce, err := msg.GetTimeInForce()
+	if err != nil {
+		return enum.TimeInForce_DAY, "", nil
+	}
+	switch timeInForce {
+	case enum.TimeInForce_DAY, enum.TimeInForce_GOOD_TILL_CANCEL:
+		return timeInForce, "", nil
+	case enum.TimeInForce_GOOD_TILL_DATE:
+		if expireDate, err := msg.GetExpireDate(); err == nil {
+			if _, parseErr := time.Parse(TradingDateLayout, expireDate); parseErr != nil {
+				return "", "", quickfix.ValueIsIncorrect(tag.ExpireDate)
+			}
+			return timeInForce, expireDate, nil
+		}
+		if expireTime, err := msg.GetExpireTime(); err == nil {
+			return timeInForce, expireTime.UTC().Format(TradingDateLayout), nil
+		}
+		return "", "", quickfix.RequiredTagMissing(tag.ExpireDate)
+	default:
+		return "", "", quickfix.ValueIsIncorrect(tag.TimeInForce)
+	}
+}
+
+// partiesOf reads the OrderCapacity (528) of an order and the parties of its PartyIDs
+// group (453), which FIX 4.3 introduced. Each party needs a PartyID and a PartyRole.
+func partiesOf(msg *quickfix.Message) (enum.OrderCapacity, []domain.Party, quickfix.MessageRejectError) {
+	var orderCapacity enum.OrderCapacity
+	if msg.Body.Has(tag.OrderCapacity) {
+		value, err := msg.Body.GetString(tag.OrderCapacity)
+		if err != nil {
+			return "", nil, err
+		}
+		orderCapacity = enum.OrderCapacity(value)
+		if capacityName(orderCapacity) == "unstated" {
+			return "", nil, quickfix.ValueIsIncorrect(tag.OrderCapacity)
+		}
+	}
+	if !msg.Body.Has(tag.NoPartyIDs) {
+		return orderCapacity, nil, nil
+	}
+	group := partiesGroup()
+	if err := msg.Body.GetGroup(group); err != nil {
+		return "", nil, err
+	}
+	parties := make([]domain.Party, 0, group.Len())
+	for i := 0; i < group.Len(); i++ {
+		entry := group.Get(i)
+		id, err := entry.GetString(tag.PartyID)
+		if err != nil || id == "" {
+			return "", nil, quickfix.RequiredTagMissing(tag.PartyID)
+		}
+		role, err := entry.GetString(tag.PartyRole)
+		if err != nil {
+			return "", nil, quickfix.RequiredTagMissing(tag.PartyRole)
+		}
+		source, _ := entry.GetString(tag.PartyIDSource)
+		parties = append(parties, domain.Party{ID: id, Source: enum.PartyIDSource(source), Role: enum.PartyRole(role)})
+	}
+	return orderCapacity, parties, nil
+}
+
 func (a *Application) onNewOrderCross(msg newordercross.NewOrderCross, sessionID quickfix.SessionID) quickfix.MessageRejectError {
 	panic("implement me")
 }
-func (a *Application) onNewOrderSingle(msg newordersingle.NewOrderSingle, sessionID quickfix.SessionID) quickfix.MessageRejectError {
-	order, err := a.newOrderSingleToDomain(msg)
+func (a *Application) onNewOrderSingle(msg newOrderSingleMessage, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+	order, err := a.newOrderSingleToDomain(msg, sessionID)
 	if err != nil {
 		return err
 	}
-	symbol := order.Symbol()
-	book, ok := a.orderBookBySymbol[symbol]
-	if !ok {
-		book = domain.NewOrderBook(symbol)
-		a.orderBookBySymbol[symbol] = book
-	}
-	a.execID += 1
-	execID := a.execID
-	event := ExecReportRequiredEvent{
-		order:     order,
-		execution: &domain.OrderExecution{},
-	}
-	er := generateExecutionReport(execID, &event)
-	msgNew := er.ToMessage()
-	rejErr := quickfix.SendToTarget(msgNew, sessionID)
-	if rejErr != nil {
-		return quickfix.NewMessageRejectError(rejErr.Error(), -1, nil)
-	}
-	matches, err2 := book.MatchOrAdd(context.TODO(), order)
-	if err2 != nil {
-		panic(err2)
-	}
-	log.Printf("%v", matches)
-	log.Printf("%s", book.Display())
-	events := make([]*ExecReportRequiredEvent, 0)
-	for i := 0; i < len(matches); i++ {
-		matched := matches[i]
-		event := &ExecReportRequiredEvent{
-			order:     matched,
-			execution: matched.Executions()[len(matched.Executions())-1],
-		}
-		events = append(events, event)
-		events = append(events, &ExecReportRequiredEvent{
-			order:     order,
-			execution: order.Executions()[i],
-		})
-
+	a.auditValidated(order, enum.MsgType_ORDER_SINGLE)
+	events, submitErr := a.Submit(order)
+	if submitErr != nil {
+		log.Printf("order %s from %s rejected: %s", order.ClOrdID(), order.SenderCompID(), submitErr)
+		return nil
 	}
-	go func() {
-		_ = a.sendExecutionReports(events)
-
-	}()
+	log.Printf("%d events for order %s", len(events), order.ClOrdID())
 	return nil
 }
 
-func (a *Application) sendExecutionReports(events []*ExecReportRequiredEvent) error {
+// deliverFIX queues the execution reports of events for the FIX session of each order
+// owner and its drop copies, which are sent in order once logged on. Orders that came
+// in through other protocols have no FIX session of their own. Events of a single
+// request all stem from the message of the first event's sender.
+func (a *Application) deliverFIX(events []ExecReportRequiredEvent) {
+	if len(events) == 0 {
+		return
+	}
+	type delivery struct {
+		compID string
+		event  ExecReportRequiredEvent
+	}
+	a.sessionsMu.RLock()
+	receivedAt := a.receivedAt[events[0].Order.SenderCompID]
+	deliveries := make([]delivery, 0, len(events))
 	for _, event := range events {
-		log.Printf("%v", event)
-		a.execID += 1
-		execID := a.execID
-		er := generateExecutionReport(execID, event)
-		msg := er.ToMessage()
-		var err error
-		for i := 0; i < 25; i++ {
-			err = quickfix.SendToTarget(msg, quickfix.SessionID{
-				BeginString:  quickfix.BeginStringFIX44,
-				TargetCompID: event.order.SenderCompID(),
-				SenderCompID: event.order.TargetCompID(),
-			})
-			if err == nil {
-				break
+		owner := event.Order.SenderCompID
+		for _, compID := range append([]string{owner}, a.dropCopies(owner)...) {
+			if a.hasFIXSession(compID) {
+				deliveries = append(deliveries, delivery{compID: compID, event: event})
 			}
-			time.Sleep(5 * time.Millisecond)
 		}
-		if err != nil {
-			return err
+	}
+	a.sessionsMu.RUnlock()
+	for _, d := range deliveries {
+		a.enqueue(d.compID, d.event, receivedAt)
+	}
+}
+
+// hasFIXSession reports whether the acceptor has a session with compID, the caller holds sessionsMu.
+func (a *Application) hasFIXSession(compID string) bool {
+	for sessionID := range a.fixSessions {
+		if sessionID.TargetCompID == compID {
+			return true
 		}
 	}
-	return nil
+	return false
 }
 
-func generateExecutionReport(execID int, event *ExecReportRequiredEvent) executionreport.ExecutionReport {
-	ordIDField := field.NewOrderID(event.order.OrderID())
-	execIDField := field.NewExecID(strconv.Itoa(execID))
-	execType := enum.ExecType_PARTIAL_FILL
-	if event.execution.Quantity().Equal(decimal.Zero) {
-		execType = enum.ExecType_NEW
-	}
-	if event.execution.IsFill() {
-		execType = enum.ExecType_FILL
-	}
-	execTypeField := field.NewExecType(execType)
-	var ordStatus enum.OrdStatus
-	if event.order.ExecutedQuantity().Equal(decimal.Zero) {
-		ordStatus = enum.OrdStatus_NEW
-	} else if event.order.Status() == domain.OrderStatusFilled {
-		ordStatus = enum.OrdStatus_FILLED
-	} else if event.order.Status() == domain.OrderStatusOpen {
-		ordStatus = enum.OrdStatus_PARTIALLY_FILLED
-	}
-	switch event.order.Status() {
-	case domain.OrderStatusOpen:
-	case domain.OrderStatusFilled:
-	case domain.OrderStatusCanceled:
-		break
-	case domain.OrderStatusRejected:
-		break
-	}
-	OrdStatusField := field.NewOrdStatus(ordStatus)
-	var side enum.Side
-	switch event.order.Side() {
-	case domain.BUY:
-		side = enum.Side_BUY
-	case domain.SELL:
-		side = enum.Side_SELL
-	}
-	sideField := field.NewSide(side)
-	leavesQtyField := field.NewLeavesQty(event.order.LeavesQty(), 2)
-	cumQtyField := field.NewCumQty(event.order.ExecutedQuantity(), 2)
-	avgPx := decimal.Zero
-	if event.order.ExecutedQuantity().GreaterThan(decimal.Zero) {
-		avgPx = event.order.ExecutedNotional().Div(event.order.ExecutedQuantity())
-	}
-	avgPxField := field.NewAvgPx(avgPx, 2)
-	er := executionreport.New(ordIDField, execIDField, execTypeField, OrdStatusField, sideField, leavesQtyField, cumQtyField, avgPxField)
-	er.SetLastQty(event.execution.Quantity(), 2)
-	er.SetLastPx(event.execution.Price(), 2)
-	return er
+func (a *Application) onOrderCancelRequest(msg orderCancelRequestMessage, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+	origClOrdID, err := msg.GetOrigClOrdID()
+	if err != nil {
+		return err
+	}
+	clOrdID, err := msg.GetClOrdID()
+	if err != nil {
+		return err
+	}
+	senderCompID := sessionID.TargetCompID
+	_, cancelErr := a.Cancel(senderCompID, origClOrdID)
+	if cancelErr != nil {
+		return a.sendCancelReject(sessionID, senderCompID, clOrdID, origClOrdID, enum.CxlRejResponseTo_ORDER_CANCEL_REQUEST, cancelErr)
+	}
+	return nil
 }
 
-func (a *Application) onOrderCancelRequest(msg ordercancelrequest.OrderCancelRequest, sessionID quickfix.SessionID) quickfix.MessageRejectError {
-	//origClOrdID, err := msg.GetOrigClOrdID()
-	//if err != nil {
-	//	return err
-	//}
-	//
-	//symbol, err := msg.GetSymbol()
-	//if err != nil {
-	//	return err
-	//}
-	//
-	//side, err := msg.GetSide()
-	//if err != nil {
-	//	return err
-	//}
-	//
-	//order := a.Cancel(origClOrdID, symbol, side)
-	//if order != nil {
-	//	a.cancelOrder(*order)
-	//}
+func (a *Application) onOrderCancelReplaceRequest(msg orderCancelReplaceRequestMessage, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+	origClOrdID, err := msg.GetOrigClOrdID()
+	if err != nil {
+		return err
+	}
+	clOrdID, err := msg.GetClOrdID()
+	if err != nil {
+		return err
+	}
+	senderCompID := sessionID.TargetCompID
+	price, err := msg.GetPrice()
+	if err != nil {
+		return err
+	}
+	orderQty, err := msg.GetOrderQty()
+	if err != nil {
+		return err
+	}
+	_, replaceErr := a.Replace(senderCompID, origClOrdID, clOrdID, price, orderQty)
+	if replaceErr != nil {
+		return a.sendCancelReject(sessionID, senderCompID, clOrdID, origClOrdID, enum.CxlRejResponseTo_ORDER_CANCEL_REPLACE_REQUEST, replaceErr)
+	}
+	return nil
+}
 
+func (a *Application) sendCancelReject(sessionID quickfix.SessionID, senderCompID, clOrdID, origClOrdID string,
+	responseTo enum.CxlRejResponseTo, cause error) quickfix.MessageRejectError {
+	orderID := "NONE"
+	ordStatus := enum.OrdStatus_REJECTED
+	reason := enum.CxlRejReason_OTHER
+	switch {
+	case errors.Is(cause, ErrUnknownOrder):
+		reason = enum.CxlRejReason_UNKNOWN_ORDER
+	case errors.Is(cause, ErrOrderNotOpen):
+		reason = enum.CxlRejReason_TOO_LATE_TO_CANCEL
+	case errors.Is(cause, ErrDuplicateClOrdID):
+		reason = enum.CxlRejReason_DUPLICATE_CLORDID
+	}
+	if view, ok := a.LookupOrder(senderCompID, origClOrdID); ok {
+		orderID = view.OrderID
+		ordStatus = fixOrdStatus(view)
+	}
+	a.auditCancelRejected(senderCompID, orderID, clOrdID, origClOrdID, responseTo, cause)
+	reject := generateCancelReject(sessionID.BeginString, orderID, clOrdID, origClOrdID, ordStatus, responseTo, reason, cause.Error())
+	sendErr := quickfix.SendToTarget(reject, sessionID)
+	if sendErr != nil {
+		return quickfix.NewMessageRejectError(sendErr.Error(), -1, nil)
+	}
 	return nil
 }
 
-func (a *Application) onMarketDataRequest(msg marketdatarequest.MarketDataRequest, sessionID quickfix.SessionID) (err quickfix.MessageRejectError) {
-	fmt.Printf("%+v\n", msg)
-	return
+// OrderBook returns the book of symbol, if any order was ever sent for it.
+func (a *Application) OrderBook(symbol string) (*domain.OrderBook, bool) {
+	a.booksMu.RLock()
+	defer a.booksMu.RUnlock()
+	book, ok := a.orderBookBySymbol[symbol]
+	return book, ok
+}
+
+// OrderBooks returns every book created so far, sorted by symbol.
+func (a *Application) OrderBooks() []*domain.OrderBook {
+	a.booksMu.RLock()
+	defer a.booksMu.RUnlock()
+	books := make([]*domain.OrderBook, 0, len(a.orderBookBySymbol))
+	for _, book := range a.orderBookBySymbol {
+		books = append(books, book)
+	}
+	slices.SortFunc(books, func(x, y *domain.OrderBook) int {
+		return strings.Compare(x.Symbol(), y.Symbol())
+	})
+	return books
 }
 
-//	func (a *Application) acceptOrder(order internal.Order) {
-//		a.updateOrder(order, enum.OrdStatus_NEW)
-//	}
-//
-//	func (a *Application) fillOrder(order internal.Order) {
-//		status := enum.OrdStatus_FILLED
-//		if !order.IsClosed() {
-//			status = enum.OrdStatus_PARTIALLY_FILLED
-//		}
-//		a.updateOrder(order, status)
-//	}
-//
-//	func (a *Application) cancelOrder(order internal.Order) {
-//		a.updateOrder(order, enum.OrdStatus_CANCELED)
-//	}
-//
-//	func (a *Application) genExecID() string {
-//		a.execID++
-//		return strconv.Itoa(a.execID)
-//	}
-//
-//	func (a *Application) updateOrder(order internal.Order, status enum.OrdStatus) {
-//		execReport := executionreport.New(
-//			field.NewOrderID(order.ClOrdID),
-//			field.NewExecID(a.genExecID()),
-//			field.NewExecTransType(enum.ExecTransType_NEW),
-//			field.NewExecType(enum.ExecType(status)),
-//			field.NewOrdStatus(status),
-//			field.NewSymbol(order.Symbol),
-//			field.NewSide(order.Side),
-//			field.NewLeavesQty(order.OpenQuantity(), 2),
-//			field.NewCumQty(order.ExecutedQuantity, 2),
-//			field.NewAvgPx(order.AvgPx, 2),
-//		)
-//		execReport.SetOrderQty(order.Quantity, 2)
-//		execReport.SetClOrdID(order.ClOrdID)
-//
-//		switch status {
-//		case enum.OrdStatus_FILLED, enum.OrdStatus_PARTIALLY_FILLED:
-//			execReport.SetLastShares(order.LastExecutedQuantity, 2)
-//			execReport.SetLastPx(order.LastExecutedPrice, 2)
-//		}
-//
-//		execReport.Header.SetTargetCompID(order.SenderCompID)
-//		execReport.Header.SetSenderCompID(order.TargetCompID)
-//
-//		sendErr := quickfix.Send(execReport)
-//		if sendErr != nil {
-//			fmt.Println(sendErr)
-//		}
-//
-// }
-type ExecReportRequiredEvent struct {
-	order     *domain.Order
-	execution *domain.OrderExecution
+func (a *Application) getOrCreateOrderBook(symbol string) *domain.OrderBook {
+	a.booksMu.Lock()
+	defer a.booksMu.Unlock()
+	book, ok := a.orderBookBySymbol[symbol]
+	if !ok {
+		book = a.instruments.newOrderBook(symbol)
+		book.SetListener(domain.BookListenerFunc(a.publishBookEvent))
+		a.orderBookBySymbol[symbol] = book
+	}
+	return book
 }
@@ -0,0 +1,498 @@
+package order_gateway
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"github.com/quickfixgo/field"
+	"github.com/quickfixgo/quickfix"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBacklogAlertThreshold is the backlog depth of a session that raises an alert.
+const DefaultBacklogAlertThreshold = 1000
+
+// outboundCompactionAcks is how many acknowledgements a session's journal collects,
+// and at least as many as reports still pending, before it is rewritten with only the
+// pending reports.
+const outboundCompactionAcks = 1000
+
+// Outbox holds the execution reports of every FIX session until they are sent, in
+// order and only while the session is logged on. With a directory, each session's
+// reports are journaled to a file of their own so that they survive restarts. The
+// journal is written and synced in the background, off the engine's critical path.
+type Outbox struct {
+	dir    string
+	mu     sync.Mutex
+	queues map[string]*outboundQueue
+}
+
+// outboundReport is an execution report waiting for its session.
+type outboundReport struct {
+	Seq      uint64                  `json:"seq"`
+	Event    ExecReportRequiredEvent `json:"event"`
+	QueuedAt time.Time               `json:"queued_at"`
+	// receivedAt is when the message that caused the report was read, unknown after a restart
+	receivedAt time.Time
+}
+
+// outboundRecord is a line of a session's journal: a queued report or the
+// acknowledgement that the report of sequence number Ack was sent.
+type outboundRecord struct {
+	Report *outboundReport `json:"report,omitempty"`
+	Ack    uint64          `json:"ack,omitempty"`
+}
+
+type outboundQueue struct {
+	compID  string
+	mu      sync.Mutex
+	pending []outboundReport
+	// dropped are the slots sent reports left before pending in its array, see dropHead
+	dropped int
+	nextSeq uint64
+	wake    chan struct{}
+	alerted bool
+	// unwritten are the journal records not written yet, and acks how many acknowledgements the journal holds
+	unwritten []outboundRecord
+	acks      int
+	dirty     chan struct{}
+	// fileMu serializes the writes to file, which are made without holding mu
+	fileMu   sync.Mutex
+	fileName string
+	file     *os.File
+	// err is the first journal write that failed, after which a restart may lose or resend reports
+	err error
+}
+
+func newOutboundQueue(compID string) *outboundQueue {
+	return &outboundQueue{compID: compID, nextSeq: 1, wake: make(chan struct{}, 1), dirty: make(chan struct{}, 1)}
+}
+
+// NewOutbox keeps undelivered reports in memory only.
+func NewOutbox() *Outbox {
+	return &Outbox{queues: make(map[string]*outboundQueue)}
+}
+
+// LoadOutbox restores the reports journaled in dir that were not sent yet.
+func LoadOutbox(dir string) (*Outbox, error) {
+	o := &Outbox{dir: dir, queues: make(map[string]*outboundQueue)}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %v, %v", dir, err)
+	}
+	fileNames, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	for _, fileName := range fileNames {
+		compID, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(fileName), ".jsonl"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %v, %v", fileName, err)
+		}
+		q, err := o.open(compID)
+		if err != nil {
+			return nil, err
+		}
+		o.queues[compID] = q
+	}
+	return o, nil
+}
+
+// open replays the journal of compID, if any, keeps it open for appending and starts
+// writing it in the background.
+func (o *Outbox) open(compID string) (*outboundQueue, error) {
+	q := newOutboundQueue(compID)
+	if o.dir == "" {
+		return q, nil
+	}
+	fileName := filepath.Join(o.dir, url.PathEscape(compID)+".jsonl")
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v, %v", fileName, err)
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	// acks only move forward, so the reports up to the latest one are dropped from the head
+	var acked uint64
+	for line := 1; scanner.Scan(); line++ {
+		var record outboundRecord
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("error reading %v line %d: %s", fileName, line, err)
+		}
+		switch {
+		case record.Report != nil:
+			q.pending = append(q.pending, *record.Report)
+			q.nextSeq = record.Report.Seq + 1
+		case record.Ack != 0:
+			acked = max(acked, record.Ack)
+			q.acks++
+		}
+		for len(q.pending) > 0 && q.pending[0].Seq <= acked {
+			q.dropHead()
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("error reading %v, %v", fileName, err)
+	}
+	_, err = file.Seek(0, io.SeekEnd)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	q.fileName = fileName
+	q.file = file
+	go q.persist()
+	return q, nil
+}
+
+func (o *Outbox) queue(compID string) (*outboundQueue, bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if q, ok := o.queues[compID]; ok {
+		return q, false, nil
+	}
+	q, err := o.open(compID)
+	if err != nil {
+		return nil, false, err
+	}
+	o.queues[compID] = q
+	return q, true, nil
+}
+
+func (o *Outbox) all() []*outboundQueue {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	queues := make([]*outboundQueue, 0, len(o.queues))
+	for _, q := range o.queues {
+		queues = append(queues, q)
+	}
+	return queues
+}
+
+// record queues a journal record to be written in the background, the caller holds q.mu.
+func (q *outboundQueue) record(record outboundRecord) {
+	if q.fileName == "" {
+		return
+	}
+	q.unwritten = append(q.unwritten, record)
+	if record.Ack != 0 {
+		q.acks++
+	}
+	select {
+	case q.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// persist writes the journal whenever records are queued.
+func (q *outboundQueue) persist() {
+	for range q.dirty {
+		q.flush()
+	}
+}
+
+// flush writes and syncs the queued journal records. Once the journal collected enough
+// acknowledgements, it is rewritten with the pending reports instead.
+func (q *outboundQueue) flush() {
+	q.fileMu.Lock()
+	defer q.fileMu.Unlock()
+	q.mu.Lock()
+	records := q.unwritten
+	q.unwritten = nil
+	var pending []outboundReport
+	compact := q.acks > 0 && (len(q.pending) == 0 || q.acks >= max(outboundCompactionAcks, len(q.pending)))
+	if compact {
+		pending = slices.Clone(q.pending)
+		q.acks = 0
+	}
+	q.mu.Unlock()
+	if len(records) == 0 && !compact {
+		return
+	}
+
+	var err error
+	if compact {
+		err = q.compact(pending)
+	} else {
+		err = q.write(records)
+	}
+	if err != nil {
+		log.Printf("failed to journal the outbound queue of %s, a restart may lose or resend execution reports: %s", q.compID, err)
+		q.mu.Lock()
+		q.err = cmp.Or(q.err, err)
+		q.mu.Unlock()
+	}
+}
+
+func (q *outboundQueue) write(records []outboundRecord) error {
+	var data []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	_, err := q.file.Write(data)
+	if err != nil {
+		return err
+	}
+	return q.file.Sync()
+}
+
+// compact replaces the journal with one holding only pending, the caller holds q.fileMu.
+func (q *outboundQueue) compact(pending []outboundReport) error {
+	tmp := q.fileName + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	q.file, file = file, q.file
+	records := make([]outboundRecord, 0, len(pending))
+	for i := range pending {
+		records = append(records, outboundRecord{Report: &pending[i]})
+	}
+	err = q.write(records)
+	if err == nil {
+		err = os.Rename(tmp, q.fileName)
+	}
+	if err != nil {
+		// keep appending to the journal as it was
+		_ = q.file.Close()
+		q.file = file
+		return err
+	}
+	_ = file.Close()
+	dir, err := os.Open(filepath.Dir(q.fileName))
+	if err != nil {
+		return err
+	}
+	defer func(dir *os.File) {
+		_ = dir.Close()
+	}(dir)
+	return dir.Sync()
+}
+
+// push queues event and returns the backlog depth, and whether it just reached alertThreshold.
+func (q *outboundQueue) push(event ExecReportRequiredEvent, receivedAt time.Time, alertThreshold int) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	report := outboundReport{Seq: q.nextSeq, Event: event, QueuedAt: time.Now().UTC(), receivedAt: receivedAt}
+	q.nextSeq++
+	q.pending = append(q.pending, report)
+	q.record(outboundRecord{Report: &report})
+	alert := len(q.pending) >= alertThreshold && !q.alerted
+	if alert {
+		q.alerted = true
+	}
+	return len(q.pending), alert
+}
+
+func (q *outboundQueue) head() (outboundReport, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return outboundReport{}, false
+	}
+	return q.pending[0], true
+}
+
+// pop removes the sent head of the queue.
+func (q *outboundQueue) pop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	sent := q.pending[0]
+	q.dropHead()
+	if len(q.pending) == 0 {
+		q.alerted = false
+	}
+	q.record(outboundRecord{Ack: sent.Seq})
+}
+
+// dropHead takes the head off pending and clears its slot. The reports left are moved
+// to an array of their own once the slots dropped outnumber them, so that a long-lived
+// session does not keep every report it was sent. The caller holds q.mu.
+func (q *outboundQueue) dropHead() {
+	q.pending[0] = outboundReport{}
+	q.pending = q.pending[1:]
+	q.dropped++
+	if q.dropped > len(q.pending) {
+		q.pending = slices.Clone(q.pending)
+		q.dropped = 0
+	}
+}
+
+// Flush writes and syncs the journal of every session, as on shutdown.
+func (o *Outbox) Flush() {
+	for _, q := range o.all() {
+		if q.fileName != "" {
+			q.flush()
+		}
+	}
+}
+
+// Err returns the first journal write of any session that failed, after which its
+// queue would not be restored as it stands.
+func (o *Outbox) Err() error {
+	for _, q := range o.all() {
+		q.mu.Lock()
+		err := q.err
+		q.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("outbound queue of %s: %w", q.compID, err)
+		}
+	}
+	return nil
+}
+
+func (q *outboundQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Backlog is what a FIX session has not been sent yet.
+type Backlog struct {
+	CompID string
+	Depth  int
+	// Oldest is when the oldest report still waiting was queued, zero without backlog
+	Oldest time.Time
+}
+
+// WithOutbox delivers execution reports through o, typically restored by LoadOutbox.
+func WithOutbox(o *Outbox) Option {
+	return func(a *Application) {
+		a.outbox = o
+	}
+}
+
+// WithBacklogAlertThreshold sets the backlog depth of a session that raises an alert.
+func WithBacklogAlertThreshold(depth int) Option {
+	return func(a *Application) {
+		a.backlogAlertThreshold = depth
+	}
+}
+
+// OutboundBacklog reports the reports still waiting for each FIX session, sorted by CompID.
+func (a *Application) OutboundBacklog() []Backlog {
+	queues := a.outbox.all()
+	backlogs := make([]Backlog, 0, len(queues))
+	for _, q := range queues {
+		q.mu.Lock()
+		backlog := Backlog{CompID: q.compID, Depth: len(q.pending)}
+		if len(q.pending) > 0 {
+			backlog.Oldest = q.pending[0].QueuedAt
+		}
+		q.mu.Unlock()
+		backlogs = append(backlogs, backlog)
+	}
+	slices.SortFunc(backlogs, func(x, y Backlog) int {
+		return strings.Compare(x.CompID, y.CompID)
+	})
+	return backlogs
+}
+
+// wakeDelivery resumes the delivery to compID, once it logged on.
+func (a *Application) wakeDelivery(compID string) {
+	a.outbox.mu.Lock()
+	q, ok := a.outbox.queues[compID]
+	a.outbox.mu.Unlock()
+	if ok {
+		q.notify()
+	}
+}
+
+// startDelivery runs the delivery of the reports restored from a previous run.
+func (a *Application) startDelivery() {
+	for _, q := range a.outbox.all() {
+		go a.deliver(q)
+		q.notify()
+	}
+}
+
+// enqueue queues event for the FIX session of compID.
+func (a *Application) enqueue(compID string, event ExecReportRequiredEvent, receivedAt time.Time) {
+	q, created, err := a.outbox.queue(compID)
+	if err != nil {
+		log.Printf("failed to queue execution report %s for %s: %s", event.ExecID, compID, err)
+		return
+	}
+	if created {
+		go a.deliver(q)
+	}
+	depth, alert := q.push(event, receivedAt, a.backlogAlertThreshold)
+	if alert {
+		log.Printf("ALERT: %d execution reports waiting for %s", depth, compID)
+		for _, o := range a.observers() {
+			o.BacklogAlert(compID, depth)
+		}
+	}
+	q.notify()
+}
+
+func (a *Application) observers() []DeliveryObserver {
+	a.sessionsMu.RLock()
+	defer a.sessionsMu.RUnlock()
+	return a.deliveryObservers
+}
+
+// loggedOnSession returns the session of compID while it is logged on.
+func (a *Application) loggedOnSession(compID string) (quickfix.SessionID, bool) {
+	a.sessionsMu.RLock()
+	defer a.sessionsMu.RUnlock()
+	sessionID, ok := a.loggedOn[compID]
+	return sessionID, ok
+}
+
+// deliver sends the reports of q in order whenever woken, until the queue is empty or
+// the session is logged out. Logons wake it up again.
+func (a *Application) deliver(q *outboundQueue) {
+	for range q.wake {
+		retry := 5 * time.Millisecond
+		for {
+			report, ok := q.head()
+			if !ok {
+				break
+			}
+			sessionID, ok := a.loggedOnSession(q.compID)
+			if !ok {
+				break
+			}
+			msg := generateExecutionReport(report.Event, sessionID.BeginString)
+			// a report for a session other than the order owner's is a drop copy, flagged from FIX 4.4 on
+			if report.Event.Order.SenderCompID != q.compID && sessionID.BeginString != quickfix.BeginStringFIX42 {
+				msg.Body.Set(field.NewCopyMsgIndicator(true))
+			}
+			err := quickfix.SendToTarget(msg, sessionID)
+			if err != nil {
+				log.Printf("failed to send execution report %s to %s, retrying: %s", report.Event.ExecID, q.compID, err)
+				for _, o := range a.observers() {
+					o.ExecutionReportRetried(q.compID)
+				}
+				time.Sleep(retry)
+				retry = min(2*retry, time.Second)
+				continue
+			}
+			retry = 5 * time.Millisecond
+			q.pop()
+			if !report.receivedAt.IsZero() {
+				for _, o := range a.observers() {
+					o.ExecutionReportSent(q.compID, time.Since(report.receivedAt))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/quickfix"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// submitLoggedOut queues the execution reports of orders from CLIENT44, whose session exists but is not logged on.
+func submitLoggedOut(t *testing.T, app *Application, clOrdIDs ...string) {
+	app.OnCreate(quickfix.SessionID{BeginString: quickfix.BeginStringFIX44, SenderCompID: "ORDERGATEWAY", TargetCompID: "CLIENT44"})
+	for i, clOrdID := range clOrdIDs {
+		_, err := app.Submit(app.NewOrder(clOrdID, "VALE3", "CLIENT44", "ORDERGATEWAY", domain.BUY, enum.OrdType_LIMIT,
+			decimal.NewFromInt(int64(10+i)), decimal.NewFromInt(100)))
+		require.NoError(t, err)
+	}
+}
+
+func TestLoadOutbox(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := LoadOutbox(dir)
+	require.NoError(t, err)
+	app := NewApplication(WithOutbox(outbox))
+	submitLoggedOut(t, app, "O1", "O2", "O3")
+	// only FIX sessions get a queue
+	_, err = app.Submit(app.NewOrder("R1", "VALE3", "REST", "ORDERGATEWAY", domain.BUY, enum.OrdType_LIMIT,
+		decimal.NewFromInt(10), decimal.NewFromInt(1)))
+	require.NoError(t, err)
+
+	backlog := app.OutboundBacklog()
+	require.Len(t, backlog, 1)
+	require.Equal(t, "CLIENT44", backlog[0].CompID)
+	require.Equal(t, 3, backlog[0].Depth)
+	require.False(t, backlog[0].Oldest.IsZero())
+
+	// O1 was sent before the restart
+	q, _, err := outbox.queue("CLIENT44")
+	require.NoError(t, err)
+	q.pop()
+	outbox.Flush()
+
+	restored, err := LoadOutbox(dir)
+	require.NoError(t, err)
+	q, _, err = restored.queue("CLIENT44")
+	require.NoError(t, err)
+	require.Len(t, q.pending, 2)
+	require.Equal(t, "O2", q.pending[0].Event.Order.ClOrdID)
+	require.Equal(t, "O3", q.pending[1].Event.Order.ClOrdID)
+	require.Equal(t, uint64(4), q.nextSeq)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "BROKEN.jsonl"), []byte("{\n"), 0o600))
+	_, err = LoadOutbox(dir)
+	require.ErrorContains(t, err, "BROKEN.jsonl line 1")
+}
+
+func TestOutbox_Compaction(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "CLIENT44.jsonl")
+	outbox, err := LoadOutbox(dir)
+	require.NoError(t, err)
+	q, _, err := outbox.queue("CLIENT44")
+	require.NoError(t, err)
+	lines := func() int {
+		data, err := os.ReadFile(fileName)
+		require.NoError(t, err)
+		return strings.Count(string(data), "\n")
+	}
+
+	reports := 2*outboundCompactionAcks + 10
+	for i := range reports {
+		q.push(ExecReportRequiredEvent{ExecID: strconv.Itoa(i)}, time.Time{}, DefaultBacklogAlertThreshold)
+	}
+	for range outboundCompactionAcks {
+		q.pop()
+	}
+	outbox.Flush()
+	// the acks do not outnumber the pending reports yet
+	require.Equal(t, reports+outboundCompactionAcks, lines())
+
+	// once they do, the journal is rewritten with the pending reports alone
+	q.fileMu.Lock()
+	for range outboundCompactionAcks {
+		q.pop()
+	}
+	q.fileMu.Unlock()
+	outbox.Flush()
+	require.Equal(t, 10, lines())
+	// the queue keeps no more slots of the reports sent than it has reports pending
+	require.LessOrEqual(t, q.dropped, len(q.pending))
+
+	restored, err := LoadOutbox(dir)
+	require.NoError(t, err)
+	q, _, err = restored.queue("CLIENT44")
+	require.NoError(t, err)
+	require.Len(t, q.pending, 10)
+	require.Equal(t, strconv.Itoa(2*outboundCompactionAcks), q.pending[0].Event.ExecID)
+	require.Equal(t, uint64(reports+1), q.nextSeq)
+}
+
+func TestApplication_OutboundDeliveryOnLogon(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := LoadOutbox(dir)
+	require.NoError(t, err)
+	submitLoggedOut(t, NewApplication(WithOutbox(outbox)), "O1", "O2", "O3")
+	outbox.Flush()
+
+	// the reports queued before the restart are sent once the session logs on, ahead of new ones
+	outbox, err = LoadOutbox(dir)
+	require.NoError(t, err)
+	app := NewApplication(WithOutbox(outbox))
+	counterparty, _ := startFIXSessions(t, app, nil, 3)
+	for _, clOrdID := range []string{"O1", "O2", "O3"} {
+		msg := counterparty.next(t)
+		require.True(t, msg.IsMsgTypeOf(string(enum.MsgType_EXECUTION_REPORT)))
+		requireFields(t, msg, map[int]string{11: clOrdID})
+	}
+	_, err = app.Submit(app.NewOrder("O4", "VALE3", "CLIENT44", "ORDERGATEWAY", domain.BUY, enum.OrdType_LIMIT,
+		decimal.NewFromInt(10), decimal.NewFromInt(1)))
+	require.NoError(t, err)
+	requireFields(t, counterparty.next(t), map[int]string{11: "O4"})
+
+	require.Eventually(t, func() bool {
+		backlog := app.OutboundBacklog()
+		return len(backlog) == 1 && backlog[0].Depth == 0
+	}, time.Second, 10*time.Millisecond)
+	outbox.Flush()
+	info, err := os.Stat(filepath.Join(dir, "CLIENT44.jsonl"))
+	require.NoError(t, err)
+	require.Zero(t, info.Size())
+}
+
+func TestApplication_BacklogAlert(t *testing.T) {
+	observer := &recordingObserver{}
+	app := NewApplication(WithBacklogAlertThreshold(2))
+	app.AddDeliveryObserver(observer)
+	submitLoggedOut(t, app, "O1", "O2", "O3")
+	require.Equal(t, []int{2}, observer.alerts)
+}
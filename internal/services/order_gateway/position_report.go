@@ -0,0 +1,200 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix44rfp "github.com/quickfixgo/fix44/requestforpositions"
+	fix50sp2rfp "github.com/quickfixgo/fix50sp2/requestforpositions"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+	"github.com/shopspring/decimal"
+	"slices"
+)
+
+// Positions are requested with RequestForPositions (35=AN), which FIX 4.3 introduced,
+// so FIX 4.2 sessions cannot. The request is acknowledged with a RequestForPositionsAck
+// (35=AO) followed by one PositionReport (35=AP) per position: the net position as
+// LongQty or ShortQty of an electronic trade quantity, the mark price as a theoretical
+// SettlPrice, and the realized and unrealized P&L as the trade variation and
+// incremental mark to market amounts.
+
+type requestForPositionsMessage interface {
+	GetPosReqID() (string, quickfix.MessageRejectError)
+	GetPosReqType() (enum.PosReqType, quickfix.MessageRejectError)
+	GetAccount() (string, quickfix.MessageRejectError)
+	GetAccountType() (enum.AccountType, quickfix.MessageRejectError)
+	GetClearingBusinessDate() (string, quickfix.MessageRejectError)
+	GetSymbol() (string, quickfix.MessageRejectError)
+}
+
+func (a *Application) addPositionRoutes() {
+	a.AddRoute(fix44rfp.Route(func(msg fix44rfp.RequestForPositions, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onRequestForPositions(msg, sessionID)
+	}))
+	a.AddRoute(fix50sp2rfp.Route(func(msg fix50sp2rfp.RequestForPositions, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+		return a.onRequestForPositions(msg, sessionID)
+	}))
+}
+
+// positionRequest is what a RequestForPositions asks for and its answers echo.
+type positionRequest struct {
+	posReqID     string
+	account      string
+	accountType  enum.AccountType
+	businessDate string
+	symbol       string
+}
+
+func (a *Application) onRequestForPositions(msg requestForPositionsMessage, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+	var req positionRequest
+	var err quickfix.MessageRejectError
+	req.posReqID, err = msg.GetPosReqID()
+	if err != nil {
+		return err
+	}
+	posReqType, err := msg.GetPosReqType()
+	if err != nil {
+		return err
+	}
+	req.businessDate, err = msg.GetClearingBusinessDate()
+	if err != nil {
+		return err
+	}
+	// Account and AccountType are only required up to FIX 4.4
+	req.account, _ = msg.GetAccount()
+	req.accountType, _ = msg.GetAccountType()
+	if req.accountType == "" {
+		req.accountType = enum.AccountType_ACCOUNT_IS_CARRIED_ON_CUSTOMER_SIDE_OF_THE_BOOKS
+	}
+	req.symbol, _ = msg.GetSymbol()
+
+	compID := sessionID.TargetCompID
+	var positions []Position
+	result := enum.PosReqResult_VALID_REQUEST
+	switch {
+	case posReqType != enum.PosReqType_POSITIONS:
+		result = enum.PosReqResult_REQUEST_FOR_POSITION_NOT_SUPPORTED
+	case req.account != "" && !a.entitledAccount(compID, req.account):
+		result = enum.PosReqResult_NOT_AUTHORIZED_TO_REQUEST_POSITIONS
+	default:
+		positions = a.sessionPositions(compID, req.account, req.symbol)
+		if len(positions) == 0 {
+			result = enum.PosReqResult_NO_POSITIONS_FOUND_THAT_MATCH_CRITERIA
+		}
+	}
+	messages := []*quickfix.Message{a.requestForPositionsAck(req, result, len(positions), sessionID.BeginString)}
+	for _, position := range positions {
+		messages = append(messages, a.positionReport(req, position, len(positions), sessionID.BeginString))
+	}
+	for _, m := range messages {
+		sendErr := quickfix.SendToTarget(m, sessionID)
+		if sendErr != nil {
+			return quickfix.NewMessageRejectError(sendErr.Error(), -1, nil)
+		}
+	}
+	return nil
+}
+
+// entitledAccount reports whether the session of compID may see the positions of
+// account: one of its configured accounts, one it traded on, or one traded by a
+// session it receives drop copies of.
+func (a *Application) entitledAccount(compID, account string) bool {
+	if slices.Contains(a.sessions[compID].Accounts, account) {
+		return true
+	}
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	for key, p := range a.positions {
+		if key.account == account && a.sees(compID, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// sees reports whether compID traded on the account of p or copies a session that did.
+func (a *Application) sees(compID string, p *Position) bool {
+	for _, trader := range p.traders {
+		if trader == compID || slices.Contains(a.dropCopies(trader), compID) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionPositions lists the positions the session of compID may see, of account and
+// symbol only when given.
+func (a *Application) sessionPositions(compID, account, symbol string) []Position {
+	accounts := a.sessions[compID].Accounts
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	return a.markedPositions(func(p *Position) bool {
+		if (account != "" && p.Account != account) || (symbol != "" && p.Symbol != symbol) {
+			return false
+		}
+		return slices.Contains(accounts, p.Account) || a.sees(compID, p)
+	})
+}
+
+// positionHeader sets the fields the ack and the reports of a request share.
+func positionHeader(msg *quickfix.Message, beginString string, req positionRequest, result enum.PosReqResult, total int) {
+	msg.Header.Set(field.NewBeginString(beginString))
+	msg.Body.Set(field.NewPosReqID(req.posReqID))
+	msg.Body.Set(field.NewPosReqResult(result))
+	msg.Body.Set(field.NewTotalNumPosReports(total))
+	if req.account != "" {
+		msg.Body.Set(field.NewAccount(req.account))
+		msg.Body.Set(field.NewAccountType(req.accountType))
+	}
+}
+
+func (a *Application) requestForPositionsAck(req positionRequest, result enum.PosReqResult, total int, beginString string) *quickfix.Message {
+	msg := quickfix.NewMessage()
+	msg.Header.Set(field.NewMsgType(enum.MsgType_REQUEST_FOR_POSITIONS_ACK))
+	positionHeader(msg, beginString, req, result, total)
+	msg.Body.Set(field.NewPosMaintRptID(a.nextID()))
+	status := enum.PosReqStatus_COMPLETED
+	if result != enum.PosReqResult_VALID_REQUEST && result != enum.PosReqResult_NO_POSITIONS_FOUND_THAT_MATCH_CRITERIA {
+		status = enum.PosReqStatus_REJECTED
+	}
+	msg.Body.Set(field.NewPosReqStatus(status))
+	return msg
+}
+
+func (a *Application) positionReport(req positionRequest, position Position, total int, beginString string) *quickfix.Message {
+	msg := quickfix.NewMessage()
+	msg.Header.Set(field.NewMsgType(enum.MsgType_POSITION_REPORT))
+	req.account = position.Account
+	positionHeader(msg, beginString, req, enum.PosReqResult_VALID_REQUEST, total)
+	msg.Body.Set(field.NewPosMaintRptID(a.nextID()))
+	msg.Body.Set(field.NewPosReqType(enum.PosReqType_POSITIONS))
+	msg.Body.Set(field.NewClearingBusinessDate(req.businessDate))
+	msg.Body.Set(field.NewSymbol(position.Symbol))
+	msg.Body.Set(field.NewSettlPrice(position.MarkPrice, 2))
+	msg.Body.Set(field.NewSettlPriceType(enum.SettlPriceType_THEORETICAL))
+	msg.Body.Set(field.NewPriorSettlPrice(position.PriorSettlPrice, 2))
+
+	positions := quickfix.NewRepeatingGroup(tag.NoPositions,
+		quickfix.GroupTemplate{quickfix.GroupElement(tag.PosType), quickfix.GroupElement(tag.LongQty), quickfix.GroupElement(tag.ShortQty)})
+	qty := positions.Add()
+	qty.Set(field.NewPosType(enum.PosType_ELECTRONIC_TRADE_QTY))
+	qty.Set(field.NewLongQty(position.LongQty(), 2))
+	qty.Set(field.NewShortQty(position.ShortQty(), 2))
+	msg.Body.SetGroup(positions)
+
+	amounts := quickfix.NewRepeatingGroup(tag.NoPosAmt,
+		quickfix.GroupTemplate{quickfix.GroupElement(tag.PosAmtType), quickfix.GroupElement(tag.PosAmt)})
+	for _, amount := range []struct {
+		amtType enum.PosAmtType
+		amt     decimal.Decimal
+	}{
+		{enum.PosAmtType_TRADE_VARIATION_AMOUNT, position.RealizedPnL},
+		{enum.PosAmtType_INCREMENTAL_MARK_TO_MARKET_AMOUNT, position.UnrealizedPnL},
+	} {
+		entry := amounts.Add()
+		entry.Set(field.NewPosAmtType(amount.amtType))
+		entry.Set(field.NewPosAmt(amount.amt, 2))
+	}
+	msg.Body.SetGroup(amounts)
+	return msg
+}
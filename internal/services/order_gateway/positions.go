@@ -0,0 +1,230 @@
+package order_gateway
+
+import (
+	"cmp"
+	"github.com/shopspring/decimal"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+)
+
+// Position is what an account holds of a symbol at average cost, carried from the
+// trading dates before and moved by the day's trades. BoughtQty, SoldQty and RealizedPnL
+// are of the day. Orders without an account are kept under the CompID that sent them.
+type Position struct {
+	Account string
+	Symbol  string
+	// Quantity is the net position, positive when long and negative when short
+	Quantity  decimal.Decimal
+	AvgCost   decimal.Decimal
+	BoughtQty decimal.Decimal
+	SoldQty   decimal.Decimal
+	// RealizedPnL is what closing trades made against the average cost
+	RealizedPnL decimal.Decimal
+	// MarkPrice is the last trade of the symbol, or the mid of its book when every
+	// trade was busted, and UnrealizedPnL the open quantity marked to it
+	MarkPrice     decimal.Decimal
+	UnrealizedPnL decimal.Decimal
+	// PriorSettlPrice is the settlement price of the symbol at the last end of day it
+	// traded, else the mark
+	PriorSettlPrice decimal.Decimal
+	// traders are the CompIDs that traded on the account
+	traders []string
+}
+
+type positionKey struct {
+	account, symbol string
+}
+
+// carriedPosition is an open position carried into a trading date by end of day processing.
+type carriedPosition struct {
+	Account  string          `json:"account"`
+	Symbol   string          `json:"symbol"`
+	Quantity decimal.Decimal `json:"quantity"`
+	AvgCost  decimal.Decimal `json:"avg_cost"`
+	Traders  []string        `json:"traders"`
+}
+
+func (p Position) LongQty() decimal.Decimal {
+	return decimal.Max(p.Quantity, decimal.Zero)
+}
+
+func (p Position) ShortQty() decimal.Decimal {
+	return decimal.Max(p.Quantity.Neg(), decimal.Zero)
+}
+
+// apply books a buy or sell of quantity at price. Trades against the position realize
+// their difference to the average cost, and the rest opens at price.
+func (p *Position) apply(side domain.OrderSide, price, quantity decimal.Decimal) {
+	delta := quantity
+	if side == domain.SELL {
+		delta = quantity.Neg()
+		p.SoldQty = p.SoldQty.Add(quantity)
+	} else {
+		p.BoughtQty = p.BoughtQty.Add(quantity)
+	}
+	if p.Quantity.IsZero() || p.Quantity.Sign() == delta.Sign() {
+		open := p.Quantity.Abs()
+		p.AvgCost = p.AvgCost.Mul(open).Add(price.Mul(quantity)).Div(open.Add(quantity))
+		p.Quantity = p.Quantity.Add(delta)
+		return
+	}
+	closing := decimal.Min(quantity, p.Quantity.Abs())
+	p.RealizedPnL = p.RealizedPnL.Add(price.Sub(p.AvgCost).Mul(closing).Mul(decimal.NewFromInt(int64(p.Quantity.Sign()))))
+	p.Quantity = p.Quantity.Add(delta)
+	switch {
+	case p.Quantity.IsZero():
+		p.AvgCost = decimal.Zero
+	case quantity.GreaterThan(closing):
+		p.AvgCost = price
+	}
+}
+
+func (a *Application) position(account, symbol, compID string) *Position {
+	key := positionKey{account: account, symbol: symbol}
+	p, ok := a.positions[key]
+	if !ok {
+		p = &Position{Account: account, Symbol: symbol, Quantity: decimal.Zero, AvgCost: decimal.Zero,
+			BoughtQty: decimal.Zero, SoldQty: decimal.Zero, RealizedPnL: decimal.Zero}
+		a.positions[key] = p
+	}
+	if !slices.Contains(p.traders, compID) {
+		p.traders = append(p.traders, compID)
+		slices.Sort(p.traders)
+	}
+	return p
+}
+
+// positionAccount is the account positions are kept under, the CompID without one.
+func positionAccount(account, senderCompID string) string {
+	if account != "" {
+		return account
+	}
+	return senderCompID
+}
+
+// bookTrade moves the positions of both sides of trade, unless it was busted. It runs
+// under the engine lock.
+func (a *Application) bookTrade(trade *Trade) {
+	for _, side := range []tradeSide{trade.buy, trade.sell} {
+		p := a.position(positionAccount(side.order.Account(), side.order.SenderCompID()), trade.Symbol, side.order.SenderCompID())
+		if trade.Status != TradeBusted {
+			p.apply(side.order.Side(), trade.Price, trade.Quantity)
+		}
+	}
+}
+
+// openPositions lists the positions left open, by account and symbol. It runs under the
+// engine lock.
+func (a *Application) openPositions() []carriedPosition {
+	positions := make([]carriedPosition, 0)
+	for _, p := range a.positions {
+		if !p.Quantity.IsZero() {
+			positions = append(positions, carriedPosition{Account: p.Account, Symbol: p.Symbol, Quantity: p.Quantity,
+				AvgCost: p.AvgCost, Traders: slices.Clone(p.traders)})
+		}
+	}
+	slices.SortFunc(positions, func(x, y carriedPosition) int {
+		return cmp.Or(cmp.Compare(x.Account, y.Account), cmp.Compare(x.Symbol, y.Symbol))
+	})
+	return positions
+}
+
+// carryPositions starts the positions of the trading date from those carried into it,
+// with nothing bought, sold or realized yet. It runs under the engine lock.
+func (a *Application) carryPositions(carried []carriedPosition) {
+	a.carriedPositions = carried
+	a.positions = make(map[positionKey]*Position)
+	for _, c := range carried {
+		a.carryPosition(c)
+	}
+}
+
+func (a *Application) carryPosition(c carriedPosition) {
+	a.positions[positionKey{account: c.Account, symbol: c.Symbol}] = &Position{Account: c.Account, Symbol: c.Symbol,
+		Quantity: c.Quantity, AvgCost: c.AvgCost, BoughtQty: decimal.Zero, SoldQty: decimal.Zero,
+		RealizedPnL: decimal.Zero, traders: slices.Clone(c.Traders)}
+}
+
+// rebookPositions replays the trades of symbol as they stand after a bust or correction
+// on the positions carried into the day, the average cost depending on the order they
+// happened in, then its allocations as they were made, leaving what a bust or correction
+// changed on the block account.
+func (a *Application) rebookPositions(symbol string) {
+	for key := range a.positions {
+		if key.symbol == symbol {
+			delete(a.positions, key)
+		}
+	}
+	for _, c := range a.carriedPositions {
+		if c.Symbol == symbol {
+			a.carryPosition(c)
+		}
+	}
+	for _, trade := range a.symbolTrades[symbol] {
+		a.bookTrade(trade)
+	}
+	for _, allocation := range a.allocations {
+		if allocation.Symbol == symbol {
+			a.bookAllocation(allocation)
+		}
+	}
+}
+
+// markPrice is the price of the last trade of symbol that stands, else the mid of its
+// book, else false.
+func (a *Application) markPrice(symbol string) (decimal.Decimal, bool) {
+	if price, ok := a.lastPrices[symbol]; ok {
+		return price, true
+	}
+	if book, ok := a.OrderBook(symbol); ok {
+		bbo := book.BBO()
+		if bbo.Bid != nil && bbo.Ask != nil {
+			return bbo.Bid.Price.Add(bbo.Ask.Price).Div(decimal.NewFromInt(2)), true
+		}
+	}
+	return decimal.Zero, false
+}
+
+// Positions lists the positions of account, or of every account when it is empty,
+// sorted by account and symbol and marked to market.
+func (a *Application) Positions(account string) []Position {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	return a.markedPositions(func(p *Position) bool {
+		return account == "" || p.Account == account
+	})
+}
+
+func (a *Application) markedPositions(match func(p *Position) bool) []Position {
+	positions := make([]Position, 0)
+	marks := make(map[string]decimal.Decimal)
+	for _, p := range a.positions {
+		if !match(p) {
+			continue
+		}
+		mark, ok := marks[p.Symbol]
+		if !ok {
+			mark, ok = a.markPrice(p.Symbol)
+			if !ok {
+				mark = p.AvgCost
+			}
+			marks[p.Symbol] = mark
+		}
+		position := *p
+		position.traders = slices.Clone(p.traders)
+		position.MarkPrice = mark
+		position.PriorSettlPrice = mark
+		if settlement, ok := a.settlements[p.Symbol]; ok {
+			position.PriorSettlPrice = settlement
+		}
+		position.UnrealizedPnL = mark.Sub(p.AvgCost).Mul(p.Quantity)
+		if p.Quantity.IsZero() {
+			position.UnrealizedPnL = decimal.Zero
+		}
+		positions = append(positions, position)
+	}
+	slices.SortFunc(positions, func(x, y Position) int {
+		return cmp.Or(cmp.Compare(x.Account, y.Account), cmp.Compare(x.Symbol, y.Symbol))
+	})
+	return positions
+}
@@ -0,0 +1,190 @@
+package order_gateway
+
+import (
+	"bytes"
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix44rfp "github.com/quickfixgo/fix44/requestforpositions"
+	fix50sp2rfp "github.com/quickfixgo/fix50sp2/requestforpositions"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/quickfix/datadictionary"
+	"github.com/quickfixgo/tag"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+	"time"
+)
+
+func TestPosition_Apply(t *testing.T) {
+	p := &Position{Quantity: decimal.Zero, AvgCost: decimal.Zero, BoughtQty: decimal.Zero, SoldQty: decimal.Zero,
+		RealizedPnL: decimal.Zero}
+	tests := []struct {
+		side                        domain.OrderSide
+		price, qty                  string
+		quantity, avgCost, realized string
+	}{
+		{domain.BUY, "10", "100", "100", "10", "0"},
+		{domain.BUY, "12", "100", "200", "11", "0"},
+		{domain.SELL, "13", "50", "150", "11", "100"},
+		// through flat to short, the rest opening at the trade price
+		{domain.SELL, "9", "200", "-50", "9", "-200"},
+		{domain.SELL, "10", "50", "-100", "9.5", "-200"},
+		{domain.BUY, "8", "100", "0", "0", "-50"},
+	}
+	for i, tt := range tests {
+		p.apply(tt.side, decimal.RequireFromString(tt.price), decimal.RequireFromString(tt.qty))
+		require.Equal(t, tt.quantity, p.Quantity.String(), "trade %d quantity", i)
+		require.Equal(t, tt.avgCost, p.AvgCost.String(), "trade %d average cost", i)
+		require.Equal(t, tt.realized, p.RealizedPnL.String(), "trade %d realized", i)
+	}
+	require.Equal(t, "300", p.BoughtQty.String())
+	require.Equal(t, "300", p.SoldQty.String())
+}
+
+func TestApplication_Positions(t *testing.T) {
+	app := NewApplication()
+	submit := func(clOrdID, sender, account string, side domain.OrderSide, price, qty int64) []ExecReportRequiredEvent {
+		order := app.NewOrder(clOrdID, "VALE3", sender, "EX", side, enum.OrdType_LIMIT, decimal.NewFromInt(price), decimal.NewFromInt(qty))
+		order.SetAccount(account)
+		events, err := app.Submit(order)
+		require.NoError(t, err)
+		return events
+	}
+	submit("s1", "A", "", domain.SELL, 10, 100)
+	first := submit("b1", "B", "ACC1", domain.BUY, 10, 60)
+	submit("b2", "B", "ACC1", domain.BUY, 12, 40)
+	submit("s2", "B", "ACC1", domain.SELL, 14, 30)
+	// a bid of 12 and an offer of 14 are left resting
+	submit("b3", "C", "", domain.BUY, 12, 10)
+
+	positions := app.Positions("")
+	require.Len(t, positions, 2)
+	seller, buyer := positions[0], positions[1]
+	require.Equal(t, "A", seller.Account, "orders without an account are kept under their CompID")
+	require.Equal(t, "ACC1", buyer.Account)
+	require.Equal(t, "-100", seller.Quantity.String())
+	require.Equal(t, "100", seller.ShortQty().String())
+	require.True(t, seller.LongQty().IsZero())
+	require.Equal(t, "10", seller.MarkPrice.String())
+	require.Equal(t, "0", seller.UnrealizedPnL.String())
+	require.Equal(t, "100", buyer.Quantity.String())
+	require.Equal(t, "10", buyer.AvgCost.String())
+
+	// busting the first trade leaves only the second, and the mid marks them
+	_, err := app.BustTrade(first[1].TradeID, "")
+	require.NoError(t, err)
+	positions = app.Positions("ACC1")
+	require.Len(t, positions, 1)
+	buyer = positions[0]
+	require.Equal(t, "40", buyer.Quantity.String())
+	require.Equal(t, "10", buyer.MarkPrice.String())
+
+	// a correction of the last trade moves the mark along
+	trades := app.Trades("VALE3")
+	_, err = app.CorrectTrade(trades[1].TradeID, decimal.NewFromInt(11), decimal.NewFromInt(40), "")
+	require.NoError(t, err)
+	require.Equal(t, "11", app.Positions("ACC1")[0].MarkPrice.String())
+
+	_, err = app.BustTrade(trades[1].TradeID, "")
+	require.NoError(t, err)
+	buyer = app.Positions("ACC1")[0]
+	require.True(t, buyer.Quantity.IsZero())
+	require.Equal(t, "13", buyer.MarkPrice.String(), "mid of 12 and 14")
+	require.True(t, buyer.UnrealizedPnL.IsZero())
+	require.Equal(t, []string{"B"}, buyer.traders)
+}
+
+func TestApplication_RequestForPositions(t *testing.T) {
+	app, counterparty, sessions := startFIX(t)
+	for _, o := range []struct {
+		clOrdID, sender, account string
+		side                     domain.OrderSide
+		price                    int64
+	}{
+		{"S1", "CLIENT44", "ACC44", domain.SELL, 10},
+		{"B1", "CLIENT42", "", domain.BUY, 11},
+		{"B2", "RESTUSER", "ACC44", domain.BUY, 9},
+	} {
+		order := app.NewOrder(o.clOrdID, "VALE3", o.sender, "ORDERGATEWAY", o.side, enum.OrdType_LIMIT,
+			decimal.NewFromInt(o.price), decimal.NewFromInt(100))
+		order.SetAccount(o.account)
+		_, err := app.Submit(order)
+		require.NoError(t, err)
+	}
+	for range 4 {
+		counterparty.next(t)
+	}
+
+	request := func(posReqID, account string) {
+		msg := fix44rfp.New(field.NewPosReqID(posReqID), field.NewPosReqType(enum.PosReqType_POSITIONS), field.NewAccount(account),
+			field.NewAccountType(enum.AccountType_ACCOUNT_IS_CARRIED_ON_CUSTOMER_SIDE_OF_THE_BOOKS),
+			field.NewClearingBusinessDate("20260302"), field.NewTransactTime(time.Now()))
+		require.NoError(t, quickfix.SendToTarget(msg, sessions["CLIENT44"]))
+	}
+	request("P1", "ACC44")
+	ack := counterparty.next(t)
+	require.True(t, ack.IsMsgTypeOf(string(enum.MsgType_REQUEST_FOR_POSITIONS_ACK)))
+	requireFields(t, ack, map[int]string{710: "P1", 728: "0", 729: "0", 727: "1", 1: "ACC44"})
+	report := counterparty.next(t)
+	require.True(t, report.IsMsgTypeOf(string(enum.MsgType_POSITION_REPORT)))
+	requireFields(t, report, map[int]string{710: "P1", 1: "ACC44", 55: "VALE3", 715: "20260302", 730: "10.00", 731: "2",
+		703: "ETR", 704: "0.00", 705: "100.00"})
+
+	// CLIENT44 did not trade the account of CLIENT42
+	request("P2", "CLIENT42")
+	requireFields(t, counterparty.next(t), map[int]string{710: "P2", 728: "3", 729: "2", 727: "0"})
+
+	// without an Account, FIX 5.0 SP2 asks for every position the session may see
+	msg := fix50sp2rfp.New(field.NewPosReqID("P3"), field.NewPosReqType(enum.PosReqType_POSITIONS),
+		field.NewClearingBusinessDate("20260302"), field.NewTransactTime(time.Now()))
+	require.NoError(t, quickfix.SendToTarget(msg, sessions["CLIENT50"]))
+	requireFields(t, counterparty.next(t), map[int]string{710: "P3", 728: "2", 729: "0", 727: "0"})
+}
+
+func TestPositionReport_DataDictionary(t *testing.T) {
+	dir := specDir(t)
+	dictionary := func(name string) *datadictionary.DataDictionary {
+		dd, err := datadictionary.Parse(filepath.Join(dir, name))
+		require.NoError(t, err)
+		return dd
+	}
+	settings := quickfix.ValidatorSettings{CheckFieldsOutOfOrder: true, RejectInvalidMessage: true, CheckUserDefinedFields: true}
+	validators := map[string]quickfix.Validator{
+		quickfix.BeginStringFIX44:  quickfix.NewValidator(settings, dictionary("FIX44.xml"), nil),
+		quickfix.BeginStringFIXT11: quickfix.NewValidator(settings, dictionary("FIX50SP2.xml"), dictionary("FIXT11.xml")),
+	}
+	app := NewApplication()
+	req := positionRequest{posReqID: "P1", account: "ACC1", accountType: enum.AccountType_ACCOUNT_IS_CARRIED_ON_CUSTOMER_SIDE_OF_THE_BOOKS,
+		businessDate: "20260302"}
+	position := Position{Account: "ACC1", Symbol: "VALE3", Quantity: decimal.NewFromInt(-50), AvgCost: decimal.NewFromInt(10),
+		RealizedPnL: decimal.RequireFromString("12.5"), MarkPrice: decimal.NewFromInt(11), UnrealizedPnL: decimal.NewFromInt(-50)}
+	for beginString, validator := range validators {
+		report := app.positionReport(req, position, 1, beginString)
+		amounts := quickfix.NewRepeatingGroup(tag.NoPosAmt,
+			quickfix.GroupTemplate{quickfix.GroupElement(tag.PosAmtType), quickfix.GroupElement(tag.PosAmt)})
+		require.Nil(t, report.Body.GetGroup(amounts))
+		require.Equal(t, 2, amounts.Len())
+		for i, want := range [][2]string{{"TVAR", "12.50"}, {"IMTM", "-50.00"}} {
+			amtType, err := amounts.Get(i).GetString(tag.PosAmtType)
+			require.Nil(t, err)
+			amt, err := amounts.Get(i).GetString(tag.PosAmt)
+			require.Nil(t, err)
+			require.Equal(t, want, [2]string{amtType, amt})
+		}
+		for _, msg := range []*quickfix.Message{report, app.requestForPositionsAck(req, enum.PosReqResult_VALID_REQUEST, 1, beginString)} {
+			// the session fills these in when sending
+			msg.Header.SetString(quickfix.Tag(49), "ORDERGATEWAY")
+			msg.Header.SetString(quickfix.Tag(56), "CLIENT44")
+			msg.Header.SetInt(quickfix.Tag(34), 1)
+			msg.Header.SetString(quickfix.Tag(52), "20260302-13:30:00.000")
+			if beginString == quickfix.BeginStringFIXT11 {
+				msg.Header.SetString(quickfix.Tag(1128), string(enum.ApplVerID_FIX50SP2))
+			}
+			parsed := quickfix.NewMessage()
+			require.NoError(t, quickfix.ParseMessage(parsed, bytes.NewBufferString(msg.String())))
+			require.Nil(t, validator.Validate(parsed), beginString)
+		}
+	}
+}
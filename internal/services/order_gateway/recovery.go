@@ -0,0 +1,228 @@
+package order_gateway
+
+import (
+	"fmt"
+	"github.com/shopspring/decimal"
+	"log"
+	"maps"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+)
+
+// restingOrders lists the orders on every book, by symbol and side from the best
+// price, each level in time priority. It runs under the engine lock.
+func (a *Application) restingOrders() []domain.OrderView {
+	orders := make([]domain.OrderView, 0)
+	for _, symbol := range slices.Sorted(maps.Keys(a.orderBookBySymbol)) {
+		depth := a.orderBookBySymbol[symbol].L3()
+		for _, level := range append(depth.Bids, depth.Asks...) {
+			orders = append(orders, level.Orders...)
+		}
+	}
+	return orders
+}
+
+// recoveredOrder is the state of an order as its journal left it.
+type recoveredOrder struct {
+	view domain.OrderView
+	// entered is the journal line the order took its place in the queue of its level at
+	entered  int
+	clOrdIDs []string
+	// executions are the trades of the order on the trading date, as they stand after
+	// any bust or correction
+	executions []recoveredExecution
+}
+
+type recoveredExecution struct {
+	tradeID         string
+	price, quantity decimal.Decimal
+}
+
+// recoveredTrade is a trade as the journal left it: the trade events of both of its
+// sides and the last restatement of each, by OrderID.
+type recoveredTrade struct {
+	sides    []ExecReportRequiredEvent
+	restated map[string]ExecReportRequiredEvent
+}
+
+// RecoverOrders rebuilds the trading date from its journal on startup: the orders
+// carried into it by end of day processing, GTC and GTD orders, and those entered
+// since, with the positions carried into it and the trades of the date, and the
+// positions and last prices they make.
+// Open orders rest on their books again in time priority and the others keep their
+// ClOrdIDs taken. The fees of the trades are taken from the journal, their notional
+// being in the monthly volumes already. It returns how many orders were put back on
+// the books.
+func (a *Application) RecoverOrders() (int, error) {
+	if a.journal == nil {
+		return 0, nil
+	}
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	recovered := make(map[string]*recoveredOrder)
+	trades := make(map[string]*recoveredTrade)
+	tradeIDs := make([]string, 0)
+	positions := make([]carriedPosition, 0)
+	n := 0
+	err := readJournal(JournalFileName(a.journal.dir, a.journal.date), func(line journalLine) {
+		n++
+		if line.Carried != nil {
+			recovered[line.Carried.OrderID] = &recoveredOrder{view: *line.Carried, entered: n,
+				clOrdIDs: []string{line.Carried.ClOrdID}}
+			return
+		}
+		if line.Position != nil {
+			positions = append(positions, *line.Position)
+			return
+		}
+		if !line.isEvent() {
+			return
+		}
+		event := line.ExecReportRequiredEvent
+		r, ok := recovered[event.Order.OrderID]
+		if !ok {
+			r = &recoveredOrder{entered: n}
+			recovered[event.Order.OrderID] = r
+		}
+		// a replace keeps the place of the order only when it reduces its quantity at the same price
+		if ok && event.Type == OrderEventReplaced &&
+			!(event.Order.Price.Equal(r.view.Price) && event.Order.Quantity.LessThanOrEqual(r.view.Quantity)) {
+			r.entered = n
+		}
+		r.view = event.Order
+		if !slices.Contains(r.clOrdIDs, event.Order.ClOrdID) {
+			r.clOrdIDs = append(r.clOrdIDs, event.Order.ClOrdID)
+		}
+		switch event.Type {
+		case OrderEventTrade:
+			r.executions = append(r.executions, recoveredExecution{tradeID: event.TradeID, price: event.LastPx,
+				quantity: event.LastQty})
+			trade, ok := trades[event.TradeID]
+			if !ok {
+				trade = &recoveredTrade{restated: make(map[string]ExecReportRequiredEvent)}
+				trades[event.TradeID] = trade
+				tradeIDs = append(tradeIDs, event.TradeID)
+			}
+			trade.sides = append(trade.sides, event)
+		case OrderEventTradeCanceled, OrderEventTradeCorrected:
+			quantity := event.LastQty
+			if event.Type == OrderEventTradeCanceled {
+				quantity = decimal.Zero
+			}
+			for i := range r.executions {
+				if r.executions[i].tradeID == event.TradeID {
+					r.executions[i].price, r.executions[i].quantity = event.LastPx, quantity
+				}
+			}
+			if trade, ok := trades[event.TradeID]; ok {
+				trade.restated[event.Order.OrderID] = event
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	orders := slices.SortedFunc(maps.Values(recovered), func(x, y *recoveredOrder) int {
+		return x.entered - y.entered
+	})
+	restored := make(map[string]*domain.Order)
+	resting := 0
+	for _, r := range orders {
+		order := domain.RestoreOrder(r.view)
+		for _, execution := range r.executions {
+			order.RestoreExecution(execution.price, execution.quantity)
+		}
+		refs := make([]orderRef, 0, len(r.clOrdIDs))
+		for _, clOrdID := range r.clOrdIDs {
+			ref := orderRef{senderCompID: order.SenderCompID(), clOrdID: clOrdID}
+			// the reject of a duplicate ClOrdID leaves it to the order that had it first
+			if _, taken := a.ordersByClOrdID[ref]; !taken {
+				refs = append(refs, ref)
+			}
+		}
+		if len(refs) == 0 {
+			continue
+		}
+		if order.IsOpen() {
+			err = a.getOrCreateOrderBook(order.Symbol()).Restore(order)
+			if err != nil {
+				return resting, fmt.Errorf("error recovering order %s: %s", order.OrderID(), err)
+			}
+			a.exposures.update(order.View())
+			resting++
+		}
+		a.orders[order.OrderID()] = order
+		for _, ref := range refs {
+			a.ordersByClOrdID[ref] = order
+		}
+		restored[order.OrderID()] = order
+	}
+
+	a.carryPositions(positions)
+	symbols := make(map[string]bool)
+	for _, tradeID := range tradeIDs {
+		trade, ok := a.recoverTrade(tradeID, trades[tradeID], recovered, restored)
+		if !ok {
+			log.Printf("trade %s is not complete in the journal, it is not recovered", tradeID)
+			continue
+		}
+		a.trades[trade.TradeID] = trade
+		a.symbolTrades[trade.Symbol] = append(a.symbolTrades[trade.Symbol], trade)
+		a.bookTrade(trade)
+		symbols[trade.Symbol] = true
+	}
+	for symbol := range symbols {
+		a.updateLastPrice(symbol)
+	}
+	return resting, nil
+}
+
+// recoverTrade rebuilds trade tradeID from its journal events, false when the journal
+// misses either side of it. It runs under the engine lock.
+func (a *Application) recoverTrade(tradeID string, r *recoveredTrade, recovered map[string]*recoveredOrder,
+	restored map[string]*domain.Order) (*Trade, bool) {
+	if len(r.sides) != 2 {
+		return nil, false
+	}
+	matched, aggressor := r.sides[0], r.sides[1]
+	if matched.Aggressor {
+		matched, aggressor = aggressor, matched
+	}
+	trade := &Trade{
+		TradeID:       tradeID,
+		Symbol:        matched.Order.Symbol,
+		Price:         matched.LastPx,
+		Quantity:      matched.LastQty,
+		AggressorSide: aggressor.Order.Side,
+		Status:        TradeActive,
+		Time:          matched.TransactTime,
+	}
+	sides := make([]tradeSide, 0, 2)
+	for _, event := range []ExecReportRequiredEvent{matched, aggressor} {
+		order, ok := restored[event.Order.OrderID]
+		if !ok {
+			return nil, false
+		}
+		execution := slices.IndexFunc(recovered[event.Order.OrderID].executions, func(e recoveredExecution) bool {
+			return e.tradeID == tradeID
+		})
+		side := tradeSide{order: order, execution: execution, execID: event.ExecID, fee: event.Fee, feeRate: event.FeeRate}
+		if restated, ok := r.restated[event.Order.OrderID]; ok {
+			side.fee = restated.Fee
+			trade.Price, trade.Quantity, trade.Status = restated.LastPx, restated.LastQty, TradeCorrected
+			if restated.Type == OrderEventTradeCanceled {
+				trade.Status = TradeBusted
+			}
+		}
+		sides = append(sides, side)
+	}
+	if aggressor.Order.Side == domain.BUY {
+		trade.buy, trade.sell = sides[1], sides[0]
+	} else {
+		trade.buy, trade.sell = sides[0], sides[1]
+	}
+	trade.BuyOrderID, trade.SellOrderID = trade.buy.order.OrderID(), trade.sell.order.OrderID()
+	trade.Buyer, trade.Seller = tradeParty(trade.buy.order), tradeParty(trade.sell.order)
+	return trade, true
+}
@@ -0,0 +1,201 @@
+package order_gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+	"github.com/shopspring/decimal"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+)
+
+var ErrNotEntitled = errors.New("not entitled")
+
+// Entitlements restrict what a session may trade; an empty list allows everything
+// and a zero MaxOrderQty means no size limit.
+type Entitlements struct {
+	Symbols     []string        `json:"symbols"`
+	Sides       []string        `json:"sides"`
+	OrderTypes  []string        `json:"order_types"`
+	MaxOrderQty decimal.Decimal `json:"max_order_qty"`
+}
+
+// SessionConfig is what a FIX counterparty logs on with and trades as. The password
+// is only stored as a bcrypt hash.
+type SessionConfig struct {
+	CompID       string `json:"comp_id"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_bcrypt"`
+	Firm         string `json:"firm"`
+	// ClearingFirm clears the trades of the session, its firm when empty
+	ClearingFirm string       `json:"clearing_firm"`
+	Accounts     []string     `json:"accounts"`
+	Entitlements Entitlements `json:"entitlements"`
+	Throttle     Throttle     `json:"throttle"`
+	// DropCopyFirms are the firms, or * for all, whose execution reports the session is sent a copy of
+	DropCopyFirms []string `json:"drop_copy_firms"`
+}
+
+// Sessions maps CompIDs to their session configuration.
+type Sessions map[string]SessionConfig
+
+type sessionsFile struct {
+	Sessions []SessionConfig `json:"sessions"`
+}
+
+// LoadSessions reads a JSON credentials file and validates every entry.
+func LoadSessions(fileName string) (Sessions, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v, %v", fileName, err)
+	}
+	var f sessionsFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sessions: %s", err)
+	}
+	sessions := make(Sessions, len(f.Sessions))
+	for _, session := range f.Sessions {
+		if session.CompID == "" {
+			return nil, fmt.Errorf("session without comp_id")
+		}
+		if _, ok := sessions[session.CompID]; ok {
+			return nil, fmt.Errorf("session %s is defined twice", session.CompID)
+		}
+		if session.Username == "" {
+			return nil, fmt.Errorf("session %s: username is required", session.CompID)
+		}
+		_, err = bcrypt.Cost([]byte(session.PasswordHash))
+		if err != nil {
+			return nil, fmt.Errorf("session %s: password_bcrypt: %s", session.CompID, err)
+		}
+		for _, side := range session.Entitlements.Sides {
+			if side != "buy" && side != "sell" {
+				return nil, fmt.Errorf("session %s: unknown side %q", session.CompID, side)
+			}
+		}
+		for _, ordType := range session.Entitlements.OrderTypes {
+			if ordType != "limit" && ordType != "market" {
+				return nil, fmt.Errorf("session %s: unknown order type %q", session.CompID, ordType)
+			}
+		}
+		if slices.Contains(session.DropCopyFirms, "") {
+			return nil, fmt.Errorf("session %s: empty drop copy firm", session.CompID)
+		}
+		err = session.Throttle.validate()
+		if err != nil {
+			return nil, fmt.Errorf("session %s: %s", session.CompID, err)
+		}
+		sessions[session.CompID] = session
+	}
+	return sessions, nil
+}
+
+// dropCopies lists the sessions copied on the execution reports of the orders of compID.
+func (a *Application) dropCopies(compID string) []string {
+	firm := a.firm(compID)
+	var compIDs []string
+	for _, session := range a.sessions {
+		if session.CompID != compID && slices.ContainsFunc(session.DropCopyFirms, func(f string) bool {
+			return f == "*" || (firm != "" && f == firm)
+		}) {
+			compIDs = append(compIDs, session.CompID)
+		}
+	}
+	slices.Sort(compIDs)
+	return compIDs
+}
+
+// HashPassword returns the value stored as password_bcrypt for password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// authenticate checks the Username (553) and Password (554) of the Logon of compID.
+func (s Sessions) authenticate(compID string, logon *quickfix.Message) error {
+	session, ok := s[compID]
+	if !ok {
+		return fmt.Errorf("unknown session %s", compID)
+	}
+	username, _ := logon.Body.GetString(tag.Username)
+	password, _ := logon.Body.GetString(tag.Password)
+	err := bcrypt.CompareHashAndPassword([]byte(session.PasswordHash), []byte(password))
+	if username != session.Username || err != nil {
+		return fmt.Errorf("invalid username or password")
+	}
+	return nil
+}
+
+// check returns why order, for quantity, may not be sent by the session, booking it to
+// the default account, the first one configured, when it has none.
+func (c SessionConfig) check(order *domain.Order, quantity decimal.Decimal) error {
+	if len(c.Accounts) > 0 {
+		if order.Account() == "" {
+			order.SetAccount(c.Accounts[0])
+		} else if !slices.Contains(c.Accounts, order.Account()) {
+			return fmt.Errorf("%w: account %s", ErrNotEntitled, order.Account())
+		}
+	}
+	e := c.Entitlements
+	if len(e.Symbols) > 0 && !slices.Contains(e.Symbols, order.Symbol()) {
+		return fmt.Errorf("%w: symbol %s", ErrNotEntitled, order.Symbol())
+	}
+	side := "buy"
+	if order.Side() == domain.SELL {
+		side = "sell"
+	}
+	if len(e.Sides) > 0 && !slices.Contains(e.Sides, side) {
+		return fmt.Errorf("%w: side %s", ErrNotEntitled, side)
+	}
+	ordType := "limit"
+	if order.OrdType() == enum.OrdType_MARKET {
+		ordType = "market"
+	}
+	if len(e.OrderTypes) > 0 && !slices.Contains(e.OrderTypes, ordType) {
+		return fmt.Errorf("%w: order type %s", ErrNotEntitled, ordType)
+	}
+	return c.checkQuantity(quantity)
+}
+
+func (c SessionConfig) checkQuantity(quantity decimal.Decimal) error {
+	limit := c.Entitlements.MaxOrderQty
+	if limit.IsPositive() && quantity.GreaterThan(limit) {
+		return fmt.Errorf("%w: quantity %s exceeds max order quantity %s", ErrNotEntitled, quantity, limit)
+	}
+	return nil
+}
+
+// Session returns the configuration of the session of compID, if any.
+func (a *Application) Session(compID string) (SessionConfig, bool) {
+	session, ok := a.sessions[compID]
+	return session, ok
+}
+
+// onLogon rejects Logons whose credentials do not match the session, once sessions are configured.
+func (a *Application) onLogon(msg *quickfix.Message, sessionID quickfix.SessionID) quickfix.MessageRejectError {
+	if a.sessions == nil {
+		return nil
+	}
+	err := a.sessions.authenticate(sessionID.TargetCompID, msg)
+	if err != nil {
+		return quickfix.RejectLogon{Text: err.Error()}
+	}
+	return nil
+}
+
+// entitlementError checks order, for quantity, against the session of its sender, on
+// entry and on every replace. CompIDs without a configured session, such as the API
+// key users of other gateways, are not restricted.
+func (a *Application) entitlementError(order *domain.Order, quantity decimal.Decimal) error {
+	session, ok := a.sessions[order.SenderCompID()]
+	if !ok {
+		return nil
+	}
+	return session.check(order, quantity)
+}
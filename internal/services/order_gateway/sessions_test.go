@@ -0,0 +1,184 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix42nos "github.com/quickfixgo/fix42/newordersingle"
+	"github.com/quickfixgo/quickfix"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+	"time"
+)
+
+func testSessions(t *testing.T) Sessions {
+	hash, err := HashPassword("secret42")
+	require.NoError(t, err)
+	return Sessions{
+		"CLIENT42": {
+			CompID: "CLIENT42", Username: "trader42", PasswordHash: hash, Firm: "FIRM1", Accounts: []string{"ACC1", "ACC2"},
+			Entitlements: Entitlements{Symbols: []string{"VALE3"}, Sides: []string{"buy"}, OrderTypes: []string{"limit"},
+				MaxOrderQty: decimal.NewFromInt(1000)},
+		},
+		"CLIENT44": {CompID: "CLIENT44", Username: "trader44", PasswordHash: hash, Firm: "FIRM2"},
+	}
+}
+
+func TestLoadSessions(t *testing.T) {
+	hash, err := HashPassword("pw")
+	require.NoError(t, err)
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"valid", `{"sessions":[{"comp_id":"A","username":"a","password_bcrypt":"` + hash + `","firm":"F",
+			"accounts":["X"],"drop_copy_firms":["*"],"entitlements":{"symbols":["VALE3"],"sides":["sell"],"order_types":["market"],"max_order_qty":"10"}}]}`, ""},
+		{"plain password", `{"sessions":[{"comp_id":"A","username":"a","password_bcrypt":"pw"}]}`, "password_bcrypt"},
+		{"no username", `{"sessions":[{"comp_id":"A","password_bcrypt":"` + hash + `"}]}`, "username is required"},
+		{"duplicate", `{"sessions":[{"comp_id":"A","username":"a","password_bcrypt":"` + hash + `"},
+			{"comp_id":"A","username":"b","password_bcrypt":"` + hash + `"}]}`, "defined twice"},
+		{"bad side", `{"sessions":[{"comp_id":"A","username":"a","password_bcrypt":"` + hash + `","entitlements":{"sides":["short"]}}]}`, "unknown side"},
+		{"bad throttle action", `{"sessions":[{"comp_id":"A","username":"a","password_bcrypt":"` + hash + `","throttle":{"action":"drop"}}]}`, "unknown throttle action"},
+		{"empty drop copy firm", `{"sessions":[{"comp_id":"A","username":"a","password_bcrypt":"` + hash + `","drop_copy_firms":[""]}]}`, "empty drop copy firm"},
+		{"negative rate", `{"sessions":[{"comp_id":"A","username":"a","password_bcrypt":"` + hash + `","throttle":{"cancels_per_second":-1}}]}`, "negative throttle rate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "sessions.json")
+			require.NoError(t, os.WriteFile(fileName, []byte(tt.content), 0o600))
+			sessions, err := LoadSessions(fileName)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, sessions["A"].Entitlements.MaxOrderQty.Equal(decimal.NewFromInt(10)))
+		})
+	}
+}
+
+func TestApplication_Entitlements(t *testing.T) {
+	app := NewApplication(WithSessions(testSessions(t)))
+	tests := []struct {
+		name    string
+		sender  string
+		account string
+		symbol  string
+		side    domain.OrderSide
+		ordType enum.OrdType
+		qty     int64
+		err     string
+	}{
+		{"entitled", "CLIENT42", "ACC2", "VALE3", domain.BUY, enum.OrdType_LIMIT, 1000, ""},
+		{"default account", "CLIENT42", "", "VALE3", domain.BUY, enum.OrdType_LIMIT, 1, ""},
+		{"account", "CLIENT42", "ACC9", "VALE3", domain.BUY, enum.OrdType_LIMIT, 1, "not entitled: account ACC9"},
+		{"symbol", "CLIENT42", "", "PETR4", domain.BUY, enum.OrdType_LIMIT, 1, "not entitled: symbol PETR4"},
+		{"side", "CLIENT42", "", "VALE3", domain.SELL, enum.OrdType_LIMIT, 1, "not entitled: side sell"},
+		{"order type", "CLIENT42", "", "VALE3", domain.BUY, enum.OrdType_MARKET, 1, "not entitled: order type market"},
+		{"size", "CLIENT42", "", "VALE3", domain.BUY, enum.OrdType_LIMIT, 1001, "not entitled: quantity 1001 exceeds max order quantity 1000"},
+		{"unrestricted session", "CLIENT44", "", "PETR4", domain.SELL, enum.OrdType_LIMIT, 1_000_000, ""},
+		{"unconfigured CompID", "RESTUSER", "ANY", "PETR4", domain.SELL, enum.OrdType_LIMIT, 1_000_000, ""},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clOrdID := "O" + string(rune('A'+i))
+			order := app.NewOrder(clOrdID, tt.symbol, tt.sender, "ORDERGATEWAY", tt.side, tt.ordType,
+				decimal.NewFromInt(10), decimal.NewFromInt(tt.qty))
+			order.SetAccount(tt.account)
+			events, err := app.Submit(order)
+			if tt.err == "" {
+				require.NoError(t, err)
+				require.Equal(t, OrderEventNew, events[0].Type)
+				return
+			}
+			require.ErrorIs(t, err, ErrNotEntitled)
+			require.EqualError(t, err, tt.err)
+			require.Len(t, events, 1)
+			require.Equal(t, OrderEventRejected, events[0].Type)
+			require.Equal(t, tt.err, events[0].Text)
+			view, ok := app.LookupOrder(tt.sender, clOrdID)
+			require.True(t, ok)
+			require.Equal(t, domain.OrderStatus(domain.OrderStatusRejected), view.Status)
+		})
+	}
+	view, _ := app.LookupOrder("CLIENT42", "OB")
+	require.Equal(t, "ACC1", view.Account)
+
+	_, err := app.Replace("CLIENT42", "OA", "OA2", decimal.NewFromInt(10), decimal.NewFromInt(1001))
+	require.ErrorIs(t, err, ErrNotEntitled)
+	_, err = app.Replace("CLIENT42", "OA", "OA2", decimal.NewFromInt(10), decimal.NewFromInt(900))
+	require.NoError(t, err)
+	// entitlements withdrawn since the order was entered, such as across a restart, hold for its replaces
+	session := app.sessions["CLIENT42"]
+	session.Accounts = []string{"ACC1"}
+	app.sessions["CLIENT42"] = session
+	_, err = app.Replace("CLIENT42", "OA2", "OA3", decimal.NewFromInt(10), decimal.NewFromInt(800))
+	require.EqualError(t, err, "not entitled: account ACC2")
+}
+
+func TestApplication_LogonAuthentication(t *testing.T) {
+	app := NewApplication(WithSessions(testSessions(t)))
+	passwords := map[string][2]string{
+		"CLIENT42": {"trader42", "secret42"},
+		"CLIENT44": {"trader44", "wrong"},
+		// CLIENT50 has no configured session
+		"CLIENT50": {"trader50", "secret42"},
+	}
+	counterparty, sessions := startFIXSessions(t, app, passwords, 1)
+	require.Contains(t, sessions, "CLIENT42")
+	select {
+	case sessionID := <-counterparty.logons:
+		t.Fatalf("%s logged on", sessionID)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// orders beyond the entitlements of the session are rejected with the reason
+	nos := fix42nos.New(field.NewClOrdID("N1"), field.NewHandlInst(enum.HandlInst_AUTOMATED_EXECUTION_ORDER_PRIVATE_NO_BROKER_INTERVENTION),
+		field.NewSymbol("VALE3"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()), field.NewOrdType(enum.OrdType_LIMIT))
+	nos.Set(field.NewPrice(decimal.NewFromInt(10), 2))
+	nos.Set(field.NewOrderQty(decimal.NewFromInt(5000), 0))
+	nos.SetAccount("ACC2")
+	require.NoError(t, quickfix.SendToTarget(nos, sessions["CLIENT42"]))
+	er := counterparty.next(t)
+	requireFields(t, er, map[int]string{150: "8", 39: "8", 11: "N1", 1: "ACC2",
+		58: "not entitled: quantity 5000 exceeds max order quantity 1000"})
+}
+
+func TestSessions_Authenticate(t *testing.T) {
+	sessions := testSessions(t)
+	tests := []struct {
+		compID, username, password string
+		ok                         bool
+	}{
+		{"CLIENT42", "trader42", "secret42", true},
+		{"CLIENT42", "trader42", "secret", false},
+		{"CLIENT42", "trader44", "secret42", false},
+		{"CLIENT42", "", "", false},
+		{"NOPE", "trader42", "secret42", false},
+	}
+	for _, tt := range tests {
+		logon := quickfix.NewMessage()
+		logon.Body.Set(field.NewUsername(tt.username))
+		logon.Body.Set(field.NewPassword(tt.password))
+		err := sessions.authenticate(tt.compID, logon)
+		require.Equal(t, tt.ok, err == nil, "%s %s", tt.compID, tt.username)
+	}
+}
+
+func TestApplication_FIXSessions(t *testing.T) {
+	app := NewApplication()
+	fix44 := quickfix.SessionID{BeginString: quickfix.BeginStringFIX44, SenderCompID: "ORDERGATEWAY", TargetCompID: "CLIENT1"}
+	fixt := quickfix.SessionID{BeginString: quickfix.BeginStringFIXT11, SenderCompID: "ORDERGATEWAY", TargetCompID: "CLIENT1"}
+	app.OnCreate(fixt)
+	app.OnCreate(fix44)
+	app.OnLogon(fixt)
+	// two sessions of one CompID are listed apart, only the one logged on as such
+	require.Equal(t, []FIXSession{
+		{CompID: "CLIENT1", BeginString: quickfix.BeginStringFIX44},
+		{CompID: "CLIENT1", BeginString: quickfix.BeginStringFIXT11, LoggedOn: true},
+	}, app.FIXSessions())
+}
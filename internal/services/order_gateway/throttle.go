@@ -0,0 +1,270 @@
+package order_gateway
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThrottleAction is what happens to a message beyond the rate limits of its session.
+type ThrottleAction string
+
+const (
+	// ThrottleReject answers the message with a BusinessMessageReject, the default.
+	ThrottleReject ThrottleAction = "reject"
+	// ThrottleQueue holds the session until the message fits its limits, and rejects it
+	// when that takes longer than the queue allows.
+	ThrottleQueue ThrottleAction = "queue"
+	// ThrottleDisconnect rejects the message and logs the session out.
+	ThrottleDisconnect ThrottleAction = "disconnect"
+)
+
+// DefaultMaxQueueSeconds is how long a queued message waits at most, unless configured.
+const DefaultMaxQueueSeconds = 1.0
+
+// businessRejectThrottleDisconnect is BusinessRejectReason 9, throttle limit exceeded and
+// session will be disconnected.
+const businessRejectThrottleDisconnect = 9
+
+// Throttle limits the application messages of a session; a zero rate means no limit.
+// Cancel/replace requests count as cancels, and every bucket allows a burst of one
+// second worth of messages. Queued messages wait MaxQueueSeconds at most, which
+// bounds the queue to as many seconds worth of messages.
+type Throttle struct {
+	MessagesPerSecond  float64        `json:"messages_per_second"`
+	NewOrdersPerSecond float64        `json:"new_orders_per_second"`
+	CancelsPerSecond   float64        `json:"cancels_per_second"`
+	Action             ThrottleAction `json:"action"`
+	MaxQueueSeconds    float64        `json:"max_queue_seconds"`
+}
+
+func (t Throttle) validate() error {
+	if t.MessagesPerSecond < 0 || t.NewOrdersPerSecond < 0 || t.CancelsPerSecond < 0 {
+		return fmt.Errorf("negative throttle rate")
+	}
+	if t.MaxQueueSeconds < 0 {
+		return fmt.Errorf("negative max_queue_seconds")
+	}
+	if t.Action != "" && !slices.Contains([]ThrottleAction{ThrottleReject, ThrottleQueue, ThrottleDisconnect}, t.Action) {
+		return fmt.Errorf("unknown throttle action %q", t.Action)
+	}
+	return nil
+}
+
+func (t Throttle) enabled() bool {
+	return t.MessagesPerSecond > 0 || t.NewOrdersPerSecond > 0 || t.CancelsPerSecond > 0
+}
+
+// tokenBucket holds up to rate tokens, refilled at rate tokens per second.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.rate, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// wait is how long until the bucket has a token.
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// BucketUsage is how much of a rate limit is taken, Used out of Limit messages per second.
+type BucketUsage struct {
+	Limit float64
+	Used  float64
+}
+
+func (b *tokenBucket) usage() BucketUsage {
+	if b == nil {
+		return BucketUsage{}
+	}
+	return BucketUsage{Limit: b.rate, Used: max(0, b.rate-b.tokens)}
+}
+
+// ThrottleUsage reports the throttle of a session, Breaches counting the messages found beyond its limits.
+type ThrottleUsage struct {
+	CompID    string
+	Action    ThrottleAction
+	Messages  BucketUsage
+	NewOrders BucketUsage
+	Cancels   BucketUsage
+	Breaches  int
+}
+
+type sessionThrottle struct {
+	mu        sync.Mutex
+	action    ThrottleAction
+	maxQueue  time.Duration
+	messages  *tokenBucket
+	newOrders *tokenBucket
+	cancels   *tokenBucket
+	breaches  int
+}
+
+func newSessionThrottle(t Throttle, now time.Time) *sessionThrottle {
+	s := &sessionThrottle{action: t.Action, maxQueue: time.Duration(cmp.Or(t.MaxQueueSeconds, DefaultMaxQueueSeconds) * float64(time.Second))}
+	if s.action == "" {
+		s.action = ThrottleReject
+	}
+	if t.MessagesPerSecond > 0 {
+		s.messages = newTokenBucket(t.MessagesPerSecond, now)
+	}
+	if t.NewOrdersPerSecond > 0 {
+		s.newOrders = newTokenBucket(t.NewOrdersPerSecond, now)
+	}
+	if t.CancelsPerSecond > 0 {
+		s.cancels = newTokenBucket(t.CancelsPerSecond, now)
+	}
+	return s
+}
+
+// buckets lists the buckets a message of msgType draws from.
+func (s *sessionThrottle) buckets(msgType string) []*tokenBucket {
+	buckets := []*tokenBucket{s.messages}
+	switch enum.MsgType(msgType) {
+	case enum.MsgType_ORDER_SINGLE:
+		buckets = append(buckets, s.newOrders)
+	case enum.MsgType_ORDER_CANCEL_REQUEST, enum.MsgType_ORDER_CANCEL_REPLACE_REQUEST:
+		buckets = append(buckets, s.cancels)
+	}
+	return slices.DeleteFunc(buckets, func(b *tokenBucket) bool { return b == nil })
+}
+
+// admit returns how long until every bucket of msgType has a token and whether the message
+// is admitted, after that wait when queueing. An admitted message takes its tokens, in
+// advance when queued so that queued messages keep their order, while a rejected one
+// takes none.
+func (s *sessionThrottle) admit(msgType string, now time.Time) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buckets := s.buckets(msgType)
+	var wait time.Duration
+	for _, b := range buckets {
+		b.refill(now)
+		wait = max(wait, b.wait())
+	}
+	if wait > 0 {
+		s.breaches++
+		if s.action != ThrottleQueue || wait > s.maxQueue {
+			return wait, false
+		}
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return wait, true
+}
+
+func (s *sessionThrottle) usage(compID string, now time.Time) ThrottleUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range []*tokenBucket{s.messages, s.newOrders, s.cancels} {
+		if b != nil {
+			b.refill(now)
+		}
+	}
+	return ThrottleUsage{
+		CompID:    compID,
+		Action:    s.action,
+		Messages:  s.messages.usage(),
+		NewOrders: s.newOrders.usage(),
+		Cancels:   s.cancels.usage(),
+		Breaches:  s.breaches,
+	}
+}
+
+// newThrottles creates the throttle of every session that has one.
+func newThrottles(sessions Sessions) map[string]*sessionThrottle {
+	throttles := make(map[string]*sessionThrottle)
+	now := time.Now()
+	for compID, session := range sessions {
+		if session.Throttle.enabled() {
+			throttles[compID] = newSessionThrottle(session.Throttle, now)
+		}
+	}
+	return throttles
+}
+
+// ThrottleUsage reports the current usage of every throttled session, sorted by CompID.
+func (a *Application) ThrottleUsage() []ThrottleUsage {
+	now := time.Now()
+	usages := make([]ThrottleUsage, 0, len(a.throttles))
+	for compID, throttle := range a.throttles {
+		usages = append(usages, throttle.usage(compID, now))
+	}
+	slices.SortFunc(usages, func(x, y ThrottleUsage) int {
+		return strings.Compare(x.CompID, y.CompID)
+	})
+	return usages
+}
+
+// throttle applies the rate limits of the session to msg and reports whether it may be processed.
+func (a *Application) throttle(msg *quickfix.Message, sessionID quickfix.SessionID) (bool, quickfix.MessageRejectError) {
+	throttle, ok := a.throttles[sessionID.TargetCompID]
+	if !ok {
+		return true, nil
+	}
+	msgType, err := msg.MsgType()
+	if err != nil {
+		return true, nil
+	}
+	wait, admitted := throttle.admit(msgType, time.Now())
+	if admitted {
+		time.Sleep(wait)
+		return true, nil
+	}
+	clOrdID, _ := msg.Body.GetString(tag.ClOrdID)
+	if throttle.action == ThrottleDisconnect {
+		log.Printf("session %s exceeded its throttle, logging it out", sessionID)
+		logOutThrottled(msg, sessionID, msgType, clOrdID)
+		return false, nil
+	}
+	// BusinessRejectReason 0 is Other
+	return false, quickfix.NewBusinessMessageRejectErrorWithRefID("throttle exceeded", 0, clOrdID, nil)
+}
+
+// logOutThrottled answers msg with a BusinessMessageReject saying the session will be
+// disconnected, then sends the session a Logout, which the counterparty answers before
+// the session is disconnected.
+func logOutThrottled(msg *quickfix.Message, sessionID quickfix.SessionID, msgType, clOrdID string) {
+	reject := quickfix.NewMessage()
+	reject.Header.SetString(tag.MsgType, string(enum.MsgType_BUSINESS_MESSAGE_REJECT))
+	if seqNum, err := msg.Header.GetInt(tag.MsgSeqNum); err == nil {
+		reject.Body.SetInt(tag.RefSeqNum, seqNum)
+	}
+	reject.Body.SetString(tag.RefMsgType, msgType)
+	if clOrdID != "" {
+		reject.Body.SetString(tag.BusinessRejectRefID, clOrdID)
+	}
+	reject.Body.SetInt(tag.BusinessRejectReason, businessRejectThrottleDisconnect)
+	reject.Body.SetString(tag.Text, "throttle exceeded, logging out")
+	logout := quickfix.NewMessage()
+	logout.Header.SetString(tag.MsgType, string(enum.MsgType_LOGOUT))
+	logout.Body.SetString(tag.Text, "throttle exceeded")
+	for _, m := range []*quickfix.Message{reject, logout} {
+		if err := quickfix.SendToTarget(m, sessionID); err != nil {
+			log.Printf("failed to log session %s out: %s", sessionID, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/field"
+	fix42nos "github.com/quickfixgo/fix42/newordersingle"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSessionThrottle_Admit(t *testing.T) {
+	start := time.Now()
+	type step struct {
+		after   time.Duration
+		msgType enum.MsgType
+		wait    time.Duration
+		// admitted is whether the message goes through, after wait when queued
+		admitted bool
+	}
+	tests := []struct {
+		name     string
+		throttle Throttle
+		steps    []step
+		breaches int
+	}{
+		{"messages", Throttle{MessagesPerSecond: 2}, []step{
+			{0, enum.MsgType_ORDER_SINGLE, 0, true},
+			{0, enum.MsgType_ORDER_CANCEL_REQUEST, 0, true},
+			{0, enum.MsgType_ORDER_SINGLE, 500 * time.Millisecond, false},
+			{250 * time.Millisecond, enum.MsgType_ORDER_SINGLE, 250 * time.Millisecond, false},
+			{500 * time.Millisecond, enum.MsgType_ORDER_SINGLE, 0, true},
+		}, 2},
+		{"new orders only", Throttle{NewOrdersPerSecond: 1}, []step{
+			{0, enum.MsgType_ORDER_SINGLE, 0, true},
+			{0, enum.MsgType_ORDER_CANCEL_REQUEST, 0, true},
+			{0, enum.MsgType_ORDER_SINGLE, time.Second, false},
+			{time.Second, enum.MsgType_ORDER_SINGLE, 0, true},
+		}, 1},
+		{"cancels and replaces", Throttle{CancelsPerSecond: 1}, []step{
+			{0, enum.MsgType_ORDER_CANCEL_REPLACE_REQUEST, 0, true},
+			{0, enum.MsgType_ORDER_CANCEL_REQUEST, time.Second, false},
+			{0, enum.MsgType_ORDER_SINGLE, 0, true},
+		}, 1},
+		{"rejected messages take no tokens", Throttle{MessagesPerSecond: 10, NewOrdersPerSecond: 1}, []step{
+			{0, enum.MsgType_ORDER_SINGLE, 0, true},
+			{0, enum.MsgType_ORDER_SINGLE, time.Second, false},
+			{0, enum.MsgType_ORDER_SINGLE, time.Second, false},
+		}, 2},
+		{"queued messages take tokens in advance", Throttle{NewOrdersPerSecond: 1, Action: ThrottleQueue, MaxQueueSeconds: 2}, []step{
+			{0, enum.MsgType_ORDER_SINGLE, 0, true},
+			{0, enum.MsgType_ORDER_SINGLE, time.Second, true},
+			{0, enum.MsgType_ORDER_SINGLE, 2 * time.Second, true},
+			{0, enum.MsgType_ORDER_SINGLE, 3 * time.Second, false},
+			{time.Second, enum.MsgType_ORDER_SINGLE, 2 * time.Second, true},
+		}, 4},
+		{"queue waits a second by default", Throttle{NewOrdersPerSecond: 1, Action: ThrottleQueue}, []step{
+			{0, enum.MsgType_ORDER_SINGLE, 0, true},
+			{0, enum.MsgType_ORDER_SINGLE, time.Second, true},
+			{0, enum.MsgType_ORDER_SINGLE, 2 * time.Second, false},
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := newSessionThrottle(tt.throttle, start)
+			now := start
+			for i, s := range tt.steps {
+				now = now.Add(s.after)
+				wait, admitted := throttle.admit(string(s.msgType), now)
+				require.InDelta(t, s.wait, wait, float64(time.Microsecond), "step %d", i)
+				require.Equal(t, s.admitted, admitted, "step %d", i)
+			}
+			require.Equal(t, tt.breaches, throttle.usage("A", now).Breaches)
+		})
+	}
+}
+
+func throttledSessions(t *testing.T) Sessions {
+	sessions := testSessions(t)
+	client42 := sessions["CLIENT42"]
+	client42.Throttle = Throttle{MessagesPerSecond: 2}
+	sessions["CLIENT42"] = client42
+	client44 := sessions["CLIENT44"]
+	client44.PasswordHash = client42.PasswordHash
+	client44.Throttle = Throttle{NewOrdersPerSecond: 1, Action: ThrottleDisconnect}
+	sessions["CLIENT44"] = client44
+	return sessions
+}
+
+func TestApplication_Throttle(t *testing.T) {
+	app := NewApplication(WithSessions(throttledSessions(t)))
+	passwords := map[string][2]string{
+		"CLIENT42": {"trader42", "secret42"},
+		"CLIENT44": {"trader44", "secret42"},
+	}
+	counterparty, sessions := startFIXSessions(t, app, passwords, 2)
+	nos := func(clOrdID string) *fix42nos.NewOrderSingle {
+		msg := fix42nos.New(field.NewClOrdID(clOrdID), field.NewHandlInst(enum.HandlInst_AUTOMATED_EXECUTION_ORDER_PRIVATE_NO_BROKER_INTERVENTION),
+			field.NewSymbol("VALE3"), field.NewSide(enum.Side_BUY), field.NewTransactTime(time.Now()), field.NewOrdType(enum.OrdType_LIMIT))
+		msg.Set(field.NewPrice(decimal.NewFromInt(10), 2))
+		msg.Set(field.NewOrderQty(decimal.NewFromInt(100), 0))
+		return &msg
+	}
+
+	// the third message within a second is rejected
+	for _, clOrdID := range []string{"T1", "T2", "T3"} {
+		require.NoError(t, quickfix.SendToTarget(nos(clOrdID), sessions["CLIENT42"]))
+	}
+	byMsgType := make(map[string][]*quickfix.Message)
+	for i := 0; i < 3; i++ {
+		msg := counterparty.next(t)
+		msgType, err := msg.MsgType()
+		require.NoError(t, err)
+		byMsgType[msgType] = append(byMsgType[msgType], msg)
+	}
+	require.Len(t, byMsgType[string(enum.MsgType_EXECUTION_REPORT)], 2)
+	require.Len(t, byMsgType[string(enum.MsgType_BUSINESS_MESSAGE_REJECT)], 1)
+	requireFields(t, byMsgType[string(enum.MsgType_BUSINESS_MESSAGE_REJECT)][0],
+		map[int]string{372: "D", 379: "T3", 380: "0", 58: "throttle exceeded"})
+	_, ok := app.LookupOrder("CLIENT42", "T3")
+	require.False(t, ok)
+
+	usage := app.ThrottleUsage()
+	require.Len(t, usage, 2)
+	require.Equal(t, "CLIENT42", usage[0].CompID)
+	require.Equal(t, ThrottleReject, usage[0].Action)
+	require.Equal(t, 2.0, usage[0].Messages.Limit)
+	require.Greater(t, usage[0].Messages.Used, 1.5)
+	require.Equal(t, 1, usage[0].Breaches)
+	require.Equal(t, BucketUsage{}, usage[0].NewOrders)
+
+	// a second new order within a second is rejected, then the session is sent a Logout
+	require.NoError(t, quickfix.SendToTarget(nos("U1"), sessions["CLIENT44"]))
+	require.NoError(t, quickfix.SendToTarget(nos("U2"), sessions["CLIENT44"]))
+	// CLIENT50 has no configured session and keeps failing to log on
+	for loggedOut := false; !loggedOut; {
+		select {
+		case sessionID := <-counterparty.logouts:
+			loggedOut = sessionID.SenderCompID == "CLIENT44"
+		case <-time.After(2 * time.Second):
+			t.Fatal("throttled session was not logged out")
+		}
+	}
+	var logout *quickfix.Message
+	for logout == nil {
+		select {
+		case msg := <-counterparty.admin:
+			if compID, _ := msg.Header.GetString(tag.TargetCompID); compID == "CLIENT44" {
+				logout = msg
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("throttled session was not sent a Logout")
+		}
+	}
+	requireFields(t, logout, map[int]string{58: "throttle exceeded"})
+	reject := counterparty.next(t)
+	require.True(t, reject.IsMsgTypeOf(string(enum.MsgType_BUSINESS_MESSAGE_REJECT)))
+	requireFields(t, reject, map[int]string{379: "U2", 380: "9", 372: "D"})
+	rejectSeqNum, err := reject.Header.GetInt(tag.MsgSeqNum)
+	require.NoError(t, err)
+	logoutSeqNum, err := logout.Header.GetInt(tag.MsgSeqNum)
+	require.NoError(t, err)
+	require.Equal(t, rejectSeqNum+1, logoutSeqNum, "the Logout follows the reject")
+	require.Eventually(t, func() bool {
+		return !slices.ContainsFunc(app.FIXSessions(), func(s FIXSession) bool {
+			return s.CompID == "CLIENT44" && s.LoggedOn
+		})
+	}, 2*time.Second, 10*time.Millisecond)
+	_, ok = app.LookupOrder("CLIENT44", "U1")
+	require.True(t, ok)
+	_, ok = app.LookupOrder("CLIENT44", "U2")
+	require.False(t, ok)
+	require.Equal(t, 1, app.ThrottleUsage()[1].Breaches)
+}
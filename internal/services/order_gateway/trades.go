@@ -0,0 +1,244 @@
+package order_gateway
+
+import (
+	"errors"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"slices"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownTrade = errors.New("unknown trade")
+	ErrTradeBusted  = errors.New("trade already busted")
+)
+
+// TradeStatus is where a trade stands after operations reviewed it.
+type TradeStatus string
+
+const (
+	TradeActive    TradeStatus = "active"
+	TradeCorrected TradeStatus = "corrected"
+	TradeBusted    TradeStatus = "busted"
+)
+
+// Trade is a match between a buy and a sell order, as it stands after any correction.
+// A busted trade keeps the price and quantity it had when busted.
+type Trade struct {
+	TradeID     string
+	Symbol      string
+	Price       decimal.Decimal
+	Quantity    decimal.Decimal
+	BuyOrderID  string
+	SellOrderID string
+	// Buyer and Seller are who sent the orders of each side, and for whom
+	Buyer, Seller TradeParty
+	AggressorSide domain.OrderSide
+	Status        TradeStatus
+	Time          time.Time
+	buy, sell     tradeSide
+}
+
+// TradeParty is who an order was sent by and booked to, in what capacity.
+type TradeParty struct {
+	CompID        string
+	Account       string
+	OrderCapacity enum.OrderCapacity
+	Parties       []domain.Party
+}
+
+func tradeParty(order *domain.Order) TradeParty {
+	return TradeParty{CompID: order.SenderCompID(), Account: order.Account(), OrderCapacity: order.OrderCapacity(),
+		Parties: slices.Clone(order.Parties())}
+}
+
+// tradeSide is the execution a trade left on one of its orders, the ExecID it was
+// reported with and the fee it was charged, at a rate in basis points.
+type tradeSide struct {
+	order     *domain.Order
+	execution int
+	execID    string
+	fee       decimal.Decimal
+	feeRate   decimal.Decimal
+}
+
+// side is the side of the trade order is on.
+func (t *Trade) side(order *domain.Order) tradeSide {
+	if t.buy.order == order {
+		return t.buy
+	}
+	return t.sell
+}
+
+// recordTrade keeps the trade both trade events of a match stand for, charges its fees
+// and books it to the positions of both accounts. It runs under the engine lock.
+func (a *Application) recordTrade(matched, aggressor ExecReportRequiredEvent, matchedOrder, aggressorOrder *domain.Order,
+	matchedExecution, aggressorExecution int) *Trade {
+	trade := &Trade{
+		TradeID:       matched.TradeID,
+		Symbol:        matched.Order.Symbol,
+		Price:         matched.LastPx,
+		Quantity:      matched.LastQty,
+		AggressorSide: aggressor.Order.Side,
+		Status:        TradeActive,
+		Time:          matched.TransactTime,
+	}
+	matchedSide := tradeSide{order: matchedOrder, execution: matchedExecution, execID: matched.ExecID}
+	aggressorSide := tradeSide{order: aggressorOrder, execution: aggressorExecution, execID: aggressor.ExecID}
+	if aggressor.Order.Side == domain.BUY {
+		trade.buy, trade.sell = aggressorSide, matchedSide
+	} else {
+		trade.buy, trade.sell = matchedSide, aggressorSide
+	}
+	trade.BuyOrderID, trade.SellOrderID = trade.buy.order.OrderID(), trade.sell.order.OrderID()
+	trade.Buyer, trade.Seller = tradeParty(trade.buy.order), tradeParty(trade.sell.order)
+	a.trades[trade.TradeID] = trade
+	a.symbolTrades[trade.Symbol] = append(a.symbolTrades[trade.Symbol], trade)
+	a.lastPrices[trade.Symbol] = trade.Price
+	a.chargeFees(trade)
+	a.bookTrade(trade)
+	return trade
+}
+
+// LookupTrade returns the trade of tradeID.
+func (a *Application) LookupTrade(tradeID string) (Trade, bool) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	trade, ok := a.trades[tradeID]
+	if !ok {
+		return Trade{}, false
+	}
+	return *trade, true
+}
+
+// Trades lists the trades of symbol, or of every symbol when it is empty, in the order
+// they happened.
+func (a *Application) Trades(symbol string) []Trade {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	trades := make([]Trade, 0)
+	for _, trade := range a.trades {
+		if symbol == "" || trade.Symbol == symbol {
+			trades = append(trades, *trade)
+		}
+	}
+	// TradeIDs sort in the order they were assigned
+	slices.SortFunc(trades, func(x, y Trade) int {
+		return strings.Compare(x.TradeID, y.TradeID)
+	})
+	return trades
+}
+
+// BustTrade cancels trade tradeID: both orders and positions lose its execution, which
+// is not put back to work, and their owners and drop copies are sent a trade cancel.
+// What is left of an order still open keeps working.
+func (a *Application) BustTrade(tradeID, reason string) ([]ExecReportRequiredEvent, error) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	trade, err := a.reviewedTrade(tradeID)
+	if err != nil {
+		return nil, err
+	}
+	err = adjustExecutions(trade, trade.Price, decimal.Zero)
+	if err != nil {
+		return nil, err
+	}
+	previousNotional := trade.Price.Mul(trade.Quantity)
+	trade.Status = TradeBusted
+	a.rechargeFees(trade, previousNotional)
+	a.rebookPositions(trade.Symbol)
+	a.updateLastPrice(trade.Symbol)
+	events := a.restateTrade(trade, OrderEventTradeCanceled, reason)
+	a.publish(events)
+	return events, nil
+}
+
+// CorrectTrade restates trade tradeID at price for quantity, which may only shrink, and
+// sends a trade correct to the owners and drop copies of both orders. What is left of
+// an order still open keeps working, as after a bust.
+func (a *Application) CorrectTrade(tradeID string, price, quantity decimal.Decimal, reason string) ([]ExecReportRequiredEvent, error) {
+	a.engineMu.Lock()
+	defer a.engineMu.Unlock()
+	trade, err := a.reviewedTrade(tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if !price.IsPositive() {
+		return nil, fmt.Errorf("corrected price must be positive")
+	}
+	if !quantity.IsPositive() || quantity.GreaterThan(trade.Quantity) {
+		return nil, fmt.Errorf("corrected quantity must be positive and at most %s", trade.Quantity)
+	}
+	err = adjustExecutions(trade, price, quantity)
+	if err != nil {
+		return nil, err
+	}
+	previousNotional := trade.Price.Mul(trade.Quantity)
+	trade.Price, trade.Quantity, trade.Status = price, quantity, TradeCorrected
+	a.rechargeFees(trade, previousNotional)
+	a.rebookPositions(trade.Symbol)
+	a.updateLastPrice(trade.Symbol)
+	events := a.restateTrade(trade, OrderEventTradeCorrected, reason)
+	a.publish(events)
+	return events, nil
+}
+
+// adjustExecutions restates the execution trade left on both of its orders as quantity
+// at price, changing neither unless both can be.
+func adjustExecutions(trade *Trade, price, quantity decimal.Decimal) error {
+	sides := []tradeSide{trade.buy, trade.sell}
+	for _, side := range sides {
+		if err := side.order.CheckAdjustment(side.execution, quantity); err != nil {
+			return err
+		}
+	}
+	for _, side := range sides {
+		if err := side.order.AdjustExecution(side.execution, price, quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateLastPrice finds the last trade of symbol that stands after a bust or correction,
+// walking back only past the trades busted.
+func (a *Application) updateLastPrice(symbol string) {
+	trades := a.symbolTrades[symbol]
+	for i := len(trades) - 1; i >= 0; i-- {
+		if trades[i].Status != TradeBusted {
+			a.lastPrices[symbol] = trades[i].Price
+			return
+		}
+	}
+	delete(a.lastPrices, symbol)
+}
+
+func (a *Application) reviewedTrade(tradeID string) (*Trade, error) {
+	trade, ok := a.trades[tradeID]
+	if !ok {
+		return nil, ErrUnknownTrade
+	}
+	if trade.Status == TradeBusted {
+		return nil, ErrTradeBusted
+	}
+	return trade, nil
+}
+
+// restateTrade reports the bust or correction of trade to both of its orders.
+func (a *Application) restateTrade(trade *Trade, eventType OrderEventType, reason string) []ExecReportRequiredEvent {
+	events := make([]ExecReportRequiredEvent, 0, 2)
+	for _, side := range []tradeSide{trade.buy, trade.sell} {
+		event := a.newEvent(eventType, side.order.View())
+		event.TradeID = trade.TradeID
+		event.ExecRefID = side.execID
+		event.LastQty = trade.Quantity
+		event.LastPx = trade.Price
+		event.Text = reason
+		event.Fee = side.fee
+		events = append(events, event)
+	}
+	return events
+}
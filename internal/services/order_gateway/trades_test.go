@@ -0,0 +1,137 @@
+package order_gateway
+
+import (
+	"github.com/quickfixgo/enum"
+	"github.com/quickfixgo/quickfix"
+	"github.com/quickfixgo/tag"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+)
+
+func TestApplication_BustAndCorrectTrade(t *testing.T) {
+	app := NewApplication()
+	submit := func(clOrdID, sender string, side domain.OrderSide, price, qty int64) []ExecReportRequiredEvent {
+		events, err := app.Submit(app.NewOrder(clOrdID, "VALE3", sender, "EX", side, enum.OrdType_LIMIT,
+			decimal.NewFromInt(price), decimal.NewFromInt(qty)))
+		require.NoError(t, err)
+		return events
+	}
+	submit("s1", "A", domain.SELL, 10, 100)
+	first := submit("b1", "B", domain.BUY, 10, 40)
+	second := submit("b2", "B", domain.BUY, 11, 60)
+	require.Len(t, first, 3)
+	require.Len(t, second, 3)
+	trades := app.Trades("VALE3")
+	require.Len(t, trades, 2)
+	require.Equal(t, first[1].TradeID, trades[0].TradeID)
+	require.Equal(t, first[2].Order.OrderID, trades[0].BuyOrderID)
+	require.Equal(t, first[1].Order.OrderID, trades[0].SellOrderID)
+	require.Equal(t, domain.OrderSide(domain.BUY), trades[0].AggressorSide)
+	require.Empty(t, app.Trades("PETR4"))
+
+	events, err := app.BustTrade(trades[0].TradeID, "erroneous")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	// the buy side first, each referring to the execution it withdraws
+	require.Equal(t, OrderEventTradeCanceled, events[0].Type)
+	require.Equal(t, "b1", events[0].Order.ClOrdID)
+	require.Equal(t, first[2].ExecID, events[0].ExecRefID)
+	require.Equal(t, first[1].ExecID, events[1].ExecRefID)
+	require.Equal(t, trades[0].TradeID, events[1].TradeID)
+	require.Equal(t, "erroneous", events[1].Text)
+	require.True(t, events[0].Order.ExecutedQuantity.IsZero())
+	require.Equal(t, enum.OrdStatus_DONE_FOR_DAY, fixOrdStatus(events[0].Order))
+	seller := events[1].Order
+	require.Equal(t, "60", seller.ExecutedQuantity.String())
+	require.Equal(t, "10", seller.AvgPx().String())
+	require.True(t, seller.LeavesQty.IsZero(), "nothing of a busted trade is put back to work")
+	require.Equal(t, enum.OrdStatus_DONE_FOR_DAY, fixOrdStatus(seller))
+
+	_, err = app.BustTrade(trades[0].TradeID, "")
+	require.ErrorIs(t, err, ErrTradeBusted)
+	_, err = app.CorrectTrade(trades[0].TradeID, decimal.NewFromInt(9), decimal.NewFromInt(1), "")
+	require.ErrorIs(t, err, ErrTradeBusted)
+	_, err = app.BustTrade("nope", "")
+	require.ErrorIs(t, err, ErrUnknownTrade)
+	_, err = app.CorrectTrade(trades[1].TradeID, decimal.NewFromInt(9), decimal.NewFromInt(61), "")
+	require.EqualError(t, err, "corrected quantity must be positive and at most 60")
+	_, err = app.CorrectTrade(trades[1].TradeID, decimal.Zero, decimal.NewFromInt(10), "")
+	require.EqualError(t, err, "corrected price must be positive")
+
+	events, err = app.CorrectTrade(trades[1].TradeID, decimal.RequireFromString("9.5"), decimal.NewFromInt(50), "price out of band")
+	require.NoError(t, err)
+	require.Equal(t, OrderEventTradeCorrected, events[1].Type)
+	require.Equal(t, "50", events[1].LastQty.String())
+	require.Equal(t, "9.5", events[1].LastPx.String())
+	seller = events[1].Order
+	require.Equal(t, "50", seller.ExecutedQuantity.String())
+	require.Equal(t, "9.5", seller.AvgPx().String())
+	trade, ok := app.LookupTrade(trades[1].TradeID)
+	require.True(t, ok)
+	require.Equal(t, TradeCorrected, trade.Status)
+
+	// a side that cannot be restated leaves the other one as it was
+	app.trades[trades[1].TradeID].sell.execution = 9
+	_, err = app.BustTrade(trades[1].TradeID, "")
+	require.ErrorContains(t, err, "has no execution 9")
+	buyer, ok := app.LookupOrder("B", "b2")
+	require.True(t, ok)
+	require.Equal(t, "50", buyer.ExecutedQuantity.String())
+	app.trades[trades[1].TradeID].sell.execution = 1
+
+	stats := app.Stats()
+	require.Equal(t, 1, stats.Trades)
+	require.Equal(t, "50", stats.TradedQuantity.String())
+	require.Equal(t, "475", stats.TradedNotional.String())
+}
+
+func TestApplication_TradeDropCopies(t *testing.T) {
+	hash, err := HashPassword("secret")
+	require.NoError(t, err)
+	app := NewApplication(WithSessions(Sessions{
+		"CLIENT44": {CompID: "CLIENT44", Username: "trader44", PasswordHash: hash, Firm: "FIRM2"},
+		"CLIENT50": {CompID: "CLIENT50", Username: "surveillance", PasswordHash: hash, DropCopyFirms: []string{"FIRM2"}},
+	}))
+	counterparty, _ := startFIXSessions(t, app, map[string][2]string{
+		"CLIENT44": {"trader44", "secret"},
+		"CLIENT50": {"surveillance", "secret"},
+	}, 2)
+	_, err = app.Submit(app.NewOrder("S1", "VALE3", "CLIENT44", "ORDERGATEWAY", domain.SELL, enum.OrdType_LIMIT,
+		decimal.NewFromInt(10), decimal.NewFromInt(100)))
+	require.NoError(t, err)
+	events, err := app.Submit(app.NewOrder("B1", "VALE3", "RESTUSER", "ORDERGATEWAY", domain.BUY, enum.OrdType_LIMIT,
+		decimal.NewFromInt(10), decimal.NewFromInt(40)))
+	require.NoError(t, err)
+	_, err = app.BustTrade(events[1].TradeID, "erroneous")
+	require.NoError(t, err)
+
+	// the seller and its drop copy are sent the new order, the trade and the bust, each in its own version
+	received := make(map[string][]*quickfix.Message)
+	for range 6 {
+		msg := counterparty.next(t)
+		compID, err := msg.Header.GetString(quickfix.Tag(56))
+		require.NoError(t, err)
+		received[compID] = append(received[compID], msg)
+	}
+	require.Len(t, received["CLIENT44"], 3)
+	require.Len(t, received["CLIENT50"], 3)
+	requireFields(t, received["CLIENT44"][2], map[int]string{150: "H", 39: "0", 11: "S1", 19: events[1].ExecID, 32: "40.00",
+		14: "0.00", 151: "60.00"})
+	requireFields(t, received["CLIENT50"][2], map[int]string{150: "H", 11: "S1", 19: events[1].ExecID, 880: events[1].TradeID,
+		58: "erroneous"})
+	// only the drop copies are flagged as such
+	for _, msg := range received["CLIENT44"] {
+		require.False(t, msg.Body.Has(tag.CopyMsgIndicator))
+	}
+	for _, msg := range received["CLIENT50"] {
+		requireFields(t, msg, map[int]string{797: "Y"})
+	}
+	// what the seller had left keeps working
+	book, ok := app.OrderBook("VALE3")
+	require.True(t, ok)
+	order, ok := book.Order("CLIENT44", "S1")
+	require.True(t, ok)
+	require.Equal(t, "60", order.LeavesQty.String())
+}
@@ -0,0 +1,121 @@
+package ouch_gateway
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Client is a reference client of the gateway, it keeps the session alive with
+// heartbeats and numbers the sequenced messages it receives.
+type Client struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	done    chan struct{}
+	once    sync.Once
+	// Session and NextSequence are what the server accepted the login with;
+	// NextSequence is then the number of the next sequenced message.
+	Session      string
+	NextSequence uint64
+}
+
+// Dial connects to addr and logs in, heartbeating every heartbeatInterval until Close.
+func Dial(addr string, login LoginRequest, heartbeatInterval time.Duration) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	err = writePacket(conn, PacketLoginRequest, login.encode())
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	packetType, payload, err := readPacket(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	switch packetType {
+	case PacketLoginAccepted:
+	case PacketLoginRejected:
+		_ = conn.Close()
+		if len(payload) == 1 {
+			return nil, fmt.Errorf("login rejected: %q", payload[0])
+		}
+		return nil, fmt.Errorf("login rejected")
+	default:
+		_ = conn.Close()
+		return nil, fmt.Errorf("unexpected packet %q during login", packetType)
+	}
+	accepted, err := decodeLoginAccepted(payload)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	c := &Client{conn: conn, done: make(chan struct{}), Session: accepted.Session, NextSequence: accepted.SequenceNumber}
+	go c.heartbeat(heartbeatInterval)
+	return c, nil
+}
+
+func (c *Client) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if c.write(PacketClientHeartbeat, nil) != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Client) write(packetType byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return writePacket(c.conn, packetType, payload)
+}
+
+// Send sends an EnterOrder, ReplaceOrder or CancelOrder.
+func (c *Client) Send(msg interface{ Encode() []byte }) error {
+	return c.write(PacketUnsequencedData, msg.Encode())
+}
+
+// Receive returns the next sequenced message and its sequence number, skipping heartbeats.
+// It returns io.EOF when the server ends the session.
+func (c *Client) Receive(timeout time.Duration) (uint64, any, error) {
+	for {
+		_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+		packetType, payload, err := readPacket(c.conn)
+		if err != nil {
+			return 0, nil, err
+		}
+		switch packetType {
+		case PacketServerHeartbeat:
+			continue
+		case PacketEndOfSession:
+			return 0, nil, io.EOF
+		case PacketSequencedData:
+			msg, err := DecodeOutbound(payload)
+			if err != nil {
+				return 0, nil, err
+			}
+			seq := c.NextSequence
+			c.NextSequence++
+			return seq, msg, nil
+		default:
+			return 0, nil, fmt.Errorf("unexpected packet %q", packetType)
+		}
+	}
+}
+
+// Close logs out and closes the connection.
+func (c *Client) Close() error {
+	c.once.Do(func() { close(c.done) })
+	_ = c.write(PacketLogoutRequest, nil)
+	return c.conn.Close()
+}
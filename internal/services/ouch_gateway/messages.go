@@ -0,0 +1,313 @@
+package ouch_gateway
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/shopspring/decimal"
+)
+
+// OUCH-style application messages, carried in unsequenced (client) and sequenced
+// (server) packets. Fields are fixed length: integers big endian, alphas space padded,
+// prices signed integers with PriceDecimals implied decimals.
+const (
+	MessageEnterOrder   byte = 'O'
+	MessageReplaceOrder byte = 'U'
+	MessageCancelOrder  byte = 'X'
+
+	MessageAccepted byte = 'A'
+	MessageReplaced byte = 'U'
+	MessageCanceled byte = 'C'
+	MessageExecuted byte = 'E'
+	MessageRejected byte = 'J'
+	MessageBroken   byte = 'B'
+
+	SideBuy  byte = 'B'
+	SideSell byte = 'S'
+
+	OrderTypeLimit  byte = 'L'
+	OrderTypeMarket byte = 'M'
+
+	LiquidityAdded   byte = 'A'
+	LiquidityRemoved byte = 'R'
+
+	CancelReasonUserRequested     byte = 'U'
+	CancelReasonImmediateOrCancel byte = 'I'
+	CancelReasonHalted            byte = 'H'
+	CancelReasonClosed            byte = 'C'
+
+	RejectDuplicateToken byte = 'D'
+	RejectInvalidShares  byte = 'Z'
+	RejectInvalidPrice   byte = 'X'
+	RejectInvalidStock   byte = 'S'
+	RejectUnknownToken   byte = 'T'
+	RejectTooLate        byte = 'L'
+	RejectHalted         byte = 'H'
+	RejectOther          byte = 'O'
+
+	BrokenReasonErroneous   byte = 'E'
+	BrokenReasonSupervisory byte = 'S'
+
+	PriceDecimals = 4
+
+	tokenLen = 14
+	stockLen = 8
+
+	enterOrderLen   = 1 + tokenLen + 1 + 4 + stockLen + 8 + 1
+	replaceOrderLen = 1 + tokenLen + tokenLen + 4 + 8
+	cancelOrderLen  = 1 + tokenLen
+	acceptedLen     = 1 + 8 + tokenLen + 1 + 4 + stockLen + 8 + 8 + 1
+	replacedLen     = 1 + 8 + tokenLen + 1 + 4 + stockLen + 8 + 8 + tokenLen
+	canceledLen     = 1 + 8 + tokenLen + 4 + 1
+	executedLen     = 1 + 8 + tokenLen + 4 + 8 + 1 + 8
+	rejectedLen     = 1 + 8 + tokenLen + 1
+	brokenTradeLen  = 1 + 8 + tokenLen + 8 + 1
+)
+
+// PriceToWire scales a price to the wire representation, failing when it has more than PriceDecimals decimals.
+func PriceToWire(price decimal.Decimal) (int64, error) {
+	scaled := price.Shift(PriceDecimals)
+	if !scaled.IsInteger() {
+		return 0, fmt.Errorf("price %s has more than %d decimals", price, PriceDecimals)
+	}
+	return scaled.IntPart(), nil
+}
+
+func PriceFromWire(price int64) decimal.Decimal {
+	return decimal.New(price, -PriceDecimals)
+}
+
+type EnterOrder struct {
+	Token     string
+	Side      byte
+	Shares    uint32
+	Stock     string
+	Price     int64
+	OrderType byte
+}
+
+type ReplaceOrder struct {
+	ExistingToken    string
+	ReplacementToken string
+	Shares           uint32
+	Price            int64
+}
+
+// CancelOrder cancels the whole remaining quantity of an order.
+type CancelOrder struct {
+	Token string
+}
+
+type Accepted struct {
+	Timestamp      uint64
+	Token          string
+	Side           byte
+	Shares         uint32
+	Stock          string
+	Price          int64
+	OrderReference uint64
+	OrderType      byte
+}
+
+type Replaced struct {
+	Timestamp        uint64
+	ReplacementToken string
+	Side             byte
+	Shares           uint32
+	Stock            string
+	Price            int64
+	OrderReference   uint64
+	PreviousToken    string
+}
+
+type Canceled struct {
+	Timestamp         uint64
+	Token             string
+	DecrementedShares uint32
+	Reason            byte
+}
+
+type Executed struct {
+	Timestamp      uint64
+	Token          string
+	ExecutedShares uint32
+	ExecutionPrice int64
+	Liquidity      byte
+	MatchNumber    uint64
+}
+
+type Rejected struct {
+	Timestamp uint64
+	Token     string
+	Reason    byte
+}
+
+// BrokenTrade withdraws the execution of MatchNumber from the order of Token.
+type BrokenTrade struct {
+	Timestamp   uint64
+	Token       string
+	MatchNumber uint64
+	Reason      byte
+}
+
+// encoder appends fixed length fields to a message buffer.
+type encoder []byte
+
+func (e encoder) byte(b byte) encoder           { return append(e, b) }
+func (e encoder) alpha(s string, n int) encoder { return append(e, alpha(s, n)...) }
+func (e encoder) uint32(v uint32) encoder       { return binary.BigEndian.AppendUint32(e, v) }
+func (e encoder) uint64(v uint64) encoder       { return binary.BigEndian.AppendUint64(e, v) }
+func (e encoder) int64(v int64) encoder         { return binary.BigEndian.AppendUint64(e, uint64(v)) }
+
+// decoder reads fixed length fields from a message whose length was already checked.
+type decoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *decoder) byte() byte {
+	d.pos++
+	return d.b[d.pos-1]
+}
+
+func (d *decoder) alpha(n int) string {
+	d.pos += n
+	return parseAlpha(d.b[d.pos-n : d.pos])
+}
+
+func (d *decoder) uint32() uint32 {
+	d.pos += 4
+	return binary.BigEndian.Uint32(d.b[d.pos-4 : d.pos])
+}
+
+func (d *decoder) uint64() uint64 {
+	d.pos += 8
+	return binary.BigEndian.Uint64(d.b[d.pos-8 : d.pos])
+}
+
+func (d *decoder) int64() int64 {
+	return int64(d.uint64())
+}
+
+func (m EnterOrder) Encode() []byte {
+	return encoder(make([]byte, 0, enterOrderLen)).byte(MessageEnterOrder).alpha(m.Token, tokenLen).byte(m.Side).
+		uint32(m.Shares).alpha(m.Stock, stockLen).int64(m.Price).byte(m.OrderType)
+}
+
+func (m ReplaceOrder) Encode() []byte {
+	return encoder(make([]byte, 0, replaceOrderLen)).byte(MessageReplaceOrder).alpha(m.ExistingToken, tokenLen).
+		alpha(m.ReplacementToken, tokenLen).uint32(m.Shares).int64(m.Price)
+}
+
+func (m CancelOrder) Encode() []byte {
+	return encoder(make([]byte, 0, cancelOrderLen)).byte(MessageCancelOrder).alpha(m.Token, tokenLen)
+}
+
+func (m Accepted) Encode() []byte {
+	return encoder(make([]byte, 0, acceptedLen)).byte(MessageAccepted).uint64(m.Timestamp).alpha(m.Token, tokenLen).
+		byte(m.Side).uint32(m.Shares).alpha(m.Stock, stockLen).int64(m.Price).uint64(m.OrderReference).byte(m.OrderType)
+}
+
+func (m Replaced) Encode() []byte {
+	return encoder(make([]byte, 0, replacedLen)).byte(MessageReplaced).uint64(m.Timestamp).alpha(m.ReplacementToken, tokenLen).
+		byte(m.Side).uint32(m.Shares).alpha(m.Stock, stockLen).int64(m.Price).uint64(m.OrderReference).alpha(m.PreviousToken, tokenLen)
+}
+
+func (m Canceled) Encode() []byte {
+	return encoder(make([]byte, 0, canceledLen)).byte(MessageCanceled).uint64(m.Timestamp).alpha(m.Token, tokenLen).
+		uint32(m.DecrementedShares).byte(m.Reason)
+}
+
+func (m Executed) Encode() []byte {
+	return encoder(make([]byte, 0, executedLen)).byte(MessageExecuted).uint64(m.Timestamp).alpha(m.Token, tokenLen).
+		uint32(m.ExecutedShares).int64(m.ExecutionPrice).byte(m.Liquidity).uint64(m.MatchNumber)
+}
+
+func (m Rejected) Encode() []byte {
+	return encoder(make([]byte, 0, rejectedLen)).byte(MessageRejected).uint64(m.Timestamp).alpha(m.Token, tokenLen).byte(m.Reason)
+}
+
+func (m BrokenTrade) Encode() []byte {
+	return encoder(make([]byte, 0, brokenTradeLen)).byte(MessageBroken).uint64(m.Timestamp).alpha(m.Token, tokenLen).
+		uint64(m.MatchNumber).byte(m.Reason)
+}
+
+func checkLen(b []byte, want int) error {
+	if len(b) != want {
+		return fmt.Errorf("message %q of %d bytes, want %d", b[0], len(b), want)
+	}
+	return nil
+}
+
+// DecodeInbound decodes a client message into EnterOrder, ReplaceOrder or CancelOrder.
+func DecodeInbound(b []byte) (any, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty message")
+	}
+	d := &decoder{b: b, pos: 1}
+	switch b[0] {
+	case MessageEnterOrder:
+		if err := checkLen(b, enterOrderLen); err != nil {
+			return nil, err
+		}
+		return EnterOrder{Token: d.alpha(tokenLen), Side: d.byte(), Shares: d.uint32(), Stock: d.alpha(stockLen),
+			Price: d.int64(), OrderType: d.byte()}, nil
+	case MessageReplaceOrder:
+		if err := checkLen(b, replaceOrderLen); err != nil {
+			return nil, err
+		}
+		return ReplaceOrder{ExistingToken: d.alpha(tokenLen), ReplacementToken: d.alpha(tokenLen), Shares: d.uint32(),
+			Price: d.int64()}, nil
+	case MessageCancelOrder:
+		if err := checkLen(b, cancelOrderLen); err != nil {
+			return nil, err
+		}
+		return CancelOrder{Token: d.alpha(tokenLen)}, nil
+	default:
+		return nil, fmt.Errorf("unknown inbound message type %q", b[0])
+	}
+}
+
+// DecodeOutbound decodes a server message into Accepted, Replaced, Canceled, Executed, Rejected or BrokenTrade.
+func DecodeOutbound(b []byte) (any, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty message")
+	}
+	d := &decoder{b: b, pos: 1}
+	switch b[0] {
+	case MessageAccepted:
+		if err := checkLen(b, acceptedLen); err != nil {
+			return nil, err
+		}
+		return Accepted{Timestamp: d.uint64(), Token: d.alpha(tokenLen), Side: d.byte(), Shares: d.uint32(),
+			Stock: d.alpha(stockLen), Price: d.int64(), OrderReference: d.uint64(), OrderType: d.byte()}, nil
+	case MessageReplaced:
+		if err := checkLen(b, replacedLen); err != nil {
+			return nil, err
+		}
+		return Replaced{Timestamp: d.uint64(), ReplacementToken: d.alpha(tokenLen), Side: d.byte(), Shares: d.uint32(),
+			Stock: d.alpha(stockLen), Price: d.int64(), OrderReference: d.uint64(), PreviousToken: d.alpha(tokenLen)}, nil
+	case MessageCanceled:
+		if err := checkLen(b, canceledLen); err != nil {
+			return nil, err
+		}
+		return Canceled{Timestamp: d.uint64(), Token: d.alpha(tokenLen), DecrementedShares: d.uint32(), Reason: d.byte()}, nil
+	case MessageExecuted:
+		if err := checkLen(b, executedLen); err != nil {
+			return nil, err
+		}
+		return Executed{Timestamp: d.uint64(), Token: d.alpha(tokenLen), ExecutedShares: d.uint32(),
+			ExecutionPrice: d.int64(), Liquidity: d.byte(), MatchNumber: d.uint64()}, nil
+	case MessageRejected:
+		if err := checkLen(b, rejectedLen); err != nil {
+			return nil, err
+		}
+		return Rejected{Timestamp: d.uint64(), Token: d.alpha(tokenLen), Reason: d.byte()}, nil
+	case MessageBroken:
+		if err := checkLen(b, brokenTradeLen); err != nil {
+			return nil, err
+		}
+		return BrokenTrade{Timestamp: d.uint64(), Token: d.alpha(tokenLen), MatchNumber: d.uint64(), Reason: d.byte()}, nil
+	default:
+		return nil, fmt.Errorf("unknown outbound message type %q", b[0])
+	}
+}
@@ -0,0 +1,522 @@
+package ouch_gateway
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"log"
+	"net"
+	"slices"
+	"stock_exchange/internal/services/api_keys"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultTargetCompID = "ORDERGATEWAY"
+
+// DefaultRetention is how many outbound messages of a CompID are kept for replay.
+const DefaultRetention = 100_000
+
+// Server is the OUCH-style binary order entry gateway. A login's username is the
+// CompID its orders are sent as and its password an API key of that CompID.
+// Every message the server sends a CompID about the orders it entered through the
+// gateway is sequenced, and the last ones are kept so a client can log in again and
+// replay from any of them. Logging in from a sequence number acknowledges, and
+// drops, the messages before it.
+type Server struct {
+	app               *order_gateway.Application
+	keys              api_keys.APIKeys
+	targetCompID      string
+	session           string
+	heartbeatInterval time.Duration
+	idleTimeout       time.Duration
+	retention         int
+
+	mu       sync.Mutex
+	users    map[string]*userSession
+	conns    map[net.Conn]bool
+	listener net.Listener
+	closed   bool
+}
+
+// userSession is the sequenced outbound stream of one CompID, of which it keeps the
+// messages from sequence number first on.
+type userSession struct {
+	mu        sync.Mutex
+	retention int
+	first     uint64
+	messages  [][]byte
+	notify    chan struct{}
+	connected bool
+}
+
+func (u *userSession) append(msg []byte) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.messages = append(u.messages, msg)
+	if len(u.messages) > u.retention {
+		u.trim(u.first + uint64(len(u.messages)-u.retention))
+	}
+	close(u.notify)
+	u.notify = make(chan struct{})
+}
+
+// next is the sequence number of the next message, u.mu held.
+func (u *userSession) next() uint64 {
+	return u.first + uint64(len(u.messages))
+}
+
+// trim drops the messages before sequence number seq, u.mu held.
+func (u *userSession) trim(seq uint64) {
+	n := int(min(seq, u.next()) - u.first)
+	if n <= 0 {
+		return
+	}
+	clear(u.messages[:n])
+	u.messages = u.messages[n:]
+	u.first += uint64(n)
+}
+
+func (u *userSession) disconnect() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.connected = false
+}
+
+// from returns the messages from sequence number seq on, or from the first one kept when
+// those before it were dropped, the sequence number of the first message returned and a
+// channel closed when more arrive.
+func (u *userSession) from(seq uint64) ([][]byte, uint64, chan struct{}) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	seq = max(seq, u.first)
+	return slices.Clone(u.messages[seq-u.first:]), seq, u.notify
+}
+
+type Option func(*Server)
+
+// WithTargetCompID sets the TargetCompID of the orders entered through the gateway.
+func WithTargetCompID(targetCompID string) Option {
+	return func(s *Server) {
+		s.targetCompID = targetCompID
+	}
+}
+
+// WithRetention sets how many outbound messages of a CompID are kept for replay.
+func WithRetention(messages int) Option {
+	return func(s *Server) {
+		s.retention = messages
+	}
+}
+
+// WithHeartbeats sets how often an idle server sends heartbeats and how long it
+// waits for any packet of a client before disconnecting it.
+func WithHeartbeats(interval, idleTimeout time.Duration) Option {
+	return func(s *Server) {
+		s.heartbeatInterval = interval
+		s.idleTimeout = idleTimeout
+	}
+}
+
+func NewServer(app *order_gateway.Application, keys api_keys.APIKeys, opts ...Option) *Server {
+	s := &Server{
+		app:               app,
+		keys:              keys,
+		targetCompID:      DefaultTargetCompID,
+		session:           time.Now().UTC().Format("0601021504"),
+		heartbeatInterval: time.Second,
+		idleTimeout:       15 * time.Second,
+		retention:         DefaultRetention,
+		users:             make(map[string]*userSession),
+		conns:             make(map[net.Conn]bool),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	app.AddListener(s)
+	return s
+}
+
+// Session is the name of the server session clients log in to.
+func (s *Server) Session() string {
+	return s.session
+}
+
+// ListenAndServe serves the gateway on addr until Close is called.
+func (s *Server) ListenAndServe(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(lis)
+}
+
+// Serve accepts connections on lis until Close is called.
+func (s *Server) Serve(lis net.Listener) error {
+	s.mu.Lock()
+	s.listener = lis
+	s.mu.Unlock()
+	log.Printf("starting OUCH gateway on %s", lis.Addr())
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// Close stops accepting connections and drops every connected client.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) user(compID string) *userSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[compID]
+	if !ok {
+		u = &userSession{retention: s.retention, first: 1, notify: make(chan struct{})}
+		s.users[compID] = u
+	}
+	return u
+}
+
+// login authenticates the first packet of conn and claims the user session.
+func (s *Server) login(conn net.Conn) (string, *userSession, uint64, bool) {
+	_ = conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+	packetType, payload, err := readPacket(conn)
+	if err != nil || packetType != PacketLoginRequest {
+		return "", nil, 0, false
+	}
+	req, err := decodeLoginRequest(payload)
+	if err != nil {
+		return "", nil, 0, false
+	}
+	compID, ok := s.keys.CompID(req.Password)
+	if !ok || compID != req.Username {
+		_ = writePacket(conn, PacketLoginRejected, []byte{LoginRejectNotAuthorized})
+		return "", nil, 0, false
+	}
+	if req.Session != "" && req.Session != s.session {
+		_ = writePacket(conn, PacketLoginRejected, []byte{LoginRejectSessionNotAvailable})
+		return "", nil, 0, false
+	}
+	u := s.user(compID)
+	u.mu.Lock()
+	if u.connected {
+		u.mu.Unlock()
+		_ = writePacket(conn, PacketLoginRejected, []byte{LoginRejectSessionNotAvailable})
+		return "", nil, 0, false
+	}
+	u.connected = true
+	next := u.next()
+	if req.RequestedSequence > 0 && req.RequestedSequence < next {
+		u.trim(req.RequestedSequence)
+		next = max(req.RequestedSequence, u.first)
+	}
+	u.mu.Unlock()
+	err = writePacket(conn, PacketLoginAccepted, LoginAccepted{Session: s.session, SequenceNumber: next}.encode())
+	if err != nil {
+		u.disconnect()
+		return "", nil, 0, false
+	}
+	return compID, u, next, true
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+	compID, u, next, ok := s.login(conn)
+	if !ok {
+		return
+	}
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		u.disconnect()
+	}()
+	go s.write(conn, u, next, done)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		packetType, payload, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+		switch packetType {
+		case PacketUnsequencedData:
+			s.onMessage(compID, u, payload)
+		case PacketClientHeartbeat:
+		case PacketLogoutRequest:
+			return
+		default:
+			log.Printf("OUCH session %s sent unknown packet type %q", compID, packetType)
+			return
+		}
+	}
+}
+
+// write streams the sequenced messages of u from next on, with heartbeats while idle,
+// until the client falls too far behind for them to be kept.
+func (s *Server) write(conn net.Conn, u *userSession, next uint64, done chan struct{}) {
+	heartbeat := time.NewTicker(s.heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		messages, first, notify := u.from(next)
+		if first != next {
+			// the client fell behind the messages kept, logging in again tells it where they resume
+			log.Printf("OUCH session fell %d messages behind, disconnecting it", first-next)
+			_ = conn.Close()
+			return
+		}
+		for _, msg := range messages {
+			err := writePacket(conn, PacketSequencedData, msg)
+			if err != nil {
+				_ = conn.Close()
+				return
+			}
+			next++
+		}
+		if len(messages) > 0 {
+			heartbeat.Reset(s.heartbeatInterval)
+			continue
+		}
+		select {
+		case <-notify:
+		case <-heartbeat.C:
+			err := writePacket(conn, PacketServerHeartbeat, nil)
+			if err != nil {
+				_ = conn.Close()
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func decimalShares(shares uint32) decimal.Decimal {
+	return decimal.NewFromInt(int64(shares))
+}
+
+func timestamp() uint64 {
+	return uint64(time.Now().UnixNano())
+}
+
+func (s *Server) reject(u *userSession, token string, reason byte) {
+	u.append(Rejected{Timestamp: timestamp(), Token: token, Reason: reason}.Encode())
+}
+
+func rejectReason(err error) byte {
+	switch {
+	case errors.Is(err, order_gateway.ErrUnknownOrder):
+		return RejectUnknownToken
+	case errors.Is(err, order_gateway.ErrOrderNotOpen):
+		return RejectTooLate
+	case errors.Is(err, order_gateway.ErrDuplicateClOrdID):
+		return RejectDuplicateToken
+	case errors.Is(err, order_gateway.ErrHalted):
+		return RejectHalted
+	default:
+		return RejectOther
+	}
+}
+
+// refuse rejects token, recording that the request of receipt was refused for text.
+func (s *Server) refuse(u *userSession, receipt *order_gateway.AuditReceipt, token string, reason byte, text string) {
+	receipt.Rejected(text)
+	s.reject(u, token, reason)
+}
+
+func (s *Server) onMessage(compID string, u *userSession, payload []byte) {
+	message := hex.EncodeToString(payload)
+	msg, err := DecodeInbound(payload)
+	if err != nil {
+		log.Printf("OUCH session %s: %s", compID, err)
+		receipt := s.app.ReceiveRequest(domain.EntryOUCH, compID, "", "", "", message)
+		defer receipt.Done()
+		s.refuse(u, receipt, "", RejectOther, err.Error())
+		return
+	}
+	switch m := msg.(type) {
+	case EnterOrder:
+		receipt := s.app.ReceiveRequest(domain.EntryOUCH, compID, enum.MsgType_ORDER_SINGLE, m.Token, "", message)
+		defer receipt.Done()
+		s.onEnterOrder(compID, u, m, receipt)
+	case ReplaceOrder:
+		receipt := s.app.ReceiveRequest(domain.EntryOUCH, compID, enum.MsgType_ORDER_CANCEL_REPLACE_REQUEST,
+			m.ReplacementToken, m.ExistingToken, message)
+		defer receipt.Done()
+		if m.Shares == 0 {
+			s.refuse(u, receipt, m.ReplacementToken, RejectInvalidShares, "shares must be positive")
+			return
+		}
+		_, err = s.app.Replace(compID, m.ExistingToken, m.ReplacementToken, PriceFromWire(m.Price), decimalShares(m.Shares))
+		if err != nil {
+			s.refuse(u, receipt, m.ReplacementToken, rejectReason(err), err.Error())
+		}
+	case CancelOrder:
+		receipt := s.app.ReceiveRequest(domain.EntryOUCH, compID, enum.MsgType_ORDER_CANCEL_REQUEST, "", m.Token, message)
+		defer receipt.Done()
+		_, err = s.app.Cancel(compID, m.Token)
+		if err != nil {
+			s.refuse(u, receipt, m.Token, rejectReason(err), err.Error())
+		}
+	}
+}
+
+// onEnterOrder submits an order, its acknowledgements come back through OnOrderEvent.
+func (s *Server) onEnterOrder(compID string, u *userSession, m EnterOrder, receipt *order_gateway.AuditReceipt) {
+	var side domain.OrderSide
+	switch m.Side {
+	case SideBuy:
+		side = domain.BUY
+	case SideSell:
+		side = domain.SELL
+	default:
+		s.refuse(u, receipt, m.Token, RejectOther, "invalid side")
+		return
+	}
+	var ordType enum.OrdType
+	switch m.OrderType {
+	case OrderTypeLimit:
+		ordType = enum.OrdType_LIMIT
+		if m.Price <= 0 {
+			s.refuse(u, receipt, m.Token, RejectInvalidPrice, "limit orders need a positive price")
+			return
+		}
+	case OrderTypeMarket:
+		ordType = enum.OrdType_MARKET
+	default:
+		s.refuse(u, receipt, m.Token, RejectOther, "invalid order type")
+		return
+	}
+	if m.Shares == 0 {
+		s.refuse(u, receipt, m.Token, RejectInvalidShares, "shares must be positive")
+		return
+	}
+	if m.Stock == "" {
+		s.refuse(u, receipt, m.Token, RejectInvalidStock, "stock is required")
+		return
+	}
+	order := s.app.NewOrder(m.Token, m.Stock, compID, s.targetCompID, side, ordType, PriceFromWire(m.Price), decimalShares(m.Shares))
+	order.SetEntryProtocol(domain.EntryOUCH)
+	receipt.Validated(order)
+	_, _ = s.app.Submit(order)
+}
+
+// OnOrderEvent implements order_gateway.OrderEventListener, sequencing the outbound
+// message of every event of an order entered through the gateway by a CompID that
+// ever logged in.
+func (s *Server) OnOrderEvent(event order_gateway.ExecReportRequiredEvent) {
+	if event.Order.EntryProtocol != domain.EntryOUCH {
+		return
+	}
+	s.mu.Lock()
+	u, ok := s.users[event.Order.SenderCompID]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	msg := outboundMessage(event)
+	if msg != nil {
+		u.append(msg)
+	}
+}
+
+func wireSide(side domain.OrderSide) byte {
+	if side == domain.BUY {
+		return SideBuy
+	}
+	return SideSell
+}
+
+func wireOrderType(ordType enum.OrdType) byte {
+	if ordType == enum.OrdType_MARKET {
+		return OrderTypeMarket
+	}
+	return OrderTypeLimit
+}
+
+func wirePrice(view domain.OrderView) int64 {
+	price, err := PriceToWire(view.Price)
+	if err != nil {
+		// orders entered through other gateways may carry finer prices
+		price = view.Price.Shift(PriceDecimals).IntPart()
+	}
+	return price
+}
+
+func outboundMessage(event order_gateway.ExecReportRequiredEvent) []byte {
+	order := event.Order
+	ts := timestamp()
+	orderReference, _ := strconv.ParseUint(order.OrderID, 10, 64)
+	switch event.Type {
+	case order_gateway.OrderEventNew:
+		return Accepted{Timestamp: ts, Token: order.ClOrdID, Side: wireSide(order.Side), Shares: uint32(order.Quantity.IntPart()),
+			Stock: order.Symbol, Price: wirePrice(order), OrderReference: orderReference, OrderType: wireOrderType(order.OrdType)}.Encode()
+	case order_gateway.OrderEventReplaced:
+		return Replaced{Timestamp: ts, ReplacementToken: order.ClOrdID, Side: wireSide(order.Side), Shares: uint32(order.LeavesQty.IntPart()),
+			Stock: order.Symbol, Price: wirePrice(order), OrderReference: orderReference, PreviousToken: event.OrigClOrdID}.Encode()
+	case order_gateway.OrderEventTrade:
+		liquidity := LiquidityAdded
+		if event.Aggressor {
+			liquidity = LiquidityRemoved
+		}
+		price, _ := PriceToWire(event.LastPx)
+		matchNumber, _ := strconv.ParseUint(event.TradeID, 10, 64)
+		return Executed{Timestamp: ts, Token: order.ClOrdID, ExecutedShares: uint32(event.LastQty.IntPart()),
+			ExecutionPrice: price, Liquidity: liquidity, MatchNumber: matchNumber}.Encode()
+	case order_gateway.OrderEventCanceled:
+		reason := CancelReasonImmediateOrCancel
+		if event.OrigClOrdID != "" {
+			reason = CancelReasonUserRequested
+		} else if event.Reason == order_gateway.EventReasonHalted {
+			reason = CancelReasonHalted
+		}
+		return Canceled{Timestamp: ts, Token: order.ClOrdID, DecrementedShares: uint32(order.LeavesQty.IntPart()), Reason: reason}.Encode()
+	case order_gateway.OrderEventExpired:
+		return Canceled{Timestamp: ts, Token: order.ClOrdID, DecrementedShares: uint32(order.LeavesQty.IntPart()),
+			Reason: CancelReasonClosed}.Encode()
+	case order_gateway.OrderEventRejected:
+		reason := RejectOther
+		switch event.Reason {
+		case order_gateway.EventReasonDuplicateClOrdID:
+			reason = RejectDuplicateToken
+		case order_gateway.EventReasonHalted:
+			reason = RejectHalted
+		}
+		return Rejected{Timestamp: ts, Token: order.ClOrdID, Reason: reason}.Encode()
+	case order_gateway.OrderEventTradeCanceled:
+		matchNumber, _ := strconv.ParseUint(event.TradeID, 10, 64)
+		return BrokenTrade{Timestamp: ts, Token: order.ClOrdID, MatchNumber: matchNumber, Reason: BrokenReasonSupervisory}.Encode()
+	default:
+		return nil
+	}
+}
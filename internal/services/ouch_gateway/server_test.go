@@ -0,0 +1,248 @@
+package ouch_gateway
+
+import (
+	"errors"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"net"
+	"stock_exchange/internal/services/api_keys"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+	"time"
+)
+
+const receiveTimeout = 2 * time.Second
+
+func startTestServer(t *testing.T, opts ...Option) (*order_gateway.Application, *Server, string) {
+	app := order_gateway.NewApplication()
+	keys := api_keys.APIKeys{
+		{CompID: "HFT1", KeySHA256: api_keys.HashAPIKey("secret1")},
+		{CompID: "HFT2", KeySHA256: api_keys.HashAPIKey("secret2")},
+	}
+	server := NewServer(app, keys, opts...)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(func() { _ = server.Close() })
+	return app, server, lis.Addr().String()
+}
+
+func dial(t *testing.T, addr, username, password string, seq uint64) *Client {
+	var client *Client
+	// a previous connection of the user may still be closing on the server
+	require.Eventually(t, func() bool {
+		var err error
+		client, err = Dial(addr, LoginRequest{Username: username, Password: password, RequestedSequence: seq}, 50*time.Millisecond)
+		return err == nil
+	}, receiveTimeout, 10*time.Millisecond)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func receive(t *testing.T, c *Client) (uint64, any) {
+	seq, msg, err := c.Receive(receiveTimeout)
+	require.NoError(t, err)
+	return seq, msg
+}
+
+func TestMessages_RoundTrip(t *testing.T) {
+	inbound := []any{
+		EnterOrder{Token: "ORD1", Side: SideBuy, Shares: 100, Stock: "VALE3", Price: 465200, OrderType: OrderTypeLimit},
+		ReplaceOrder{ExistingToken: "ORD1", ReplacementToken: "ORD2", Shares: 50, Price: -1},
+		CancelOrder{Token: "ORD2"},
+	}
+	for _, msg := range inbound {
+		decoded, err := DecodeInbound(msg.(interface{ Encode() []byte }).Encode())
+		require.NoError(t, err)
+		require.Equal(t, msg, decoded)
+	}
+	outbound := []any{
+		Accepted{Timestamp: 1, Token: "ORD1", Side: SideSell, Shares: 100, Stock: "PETR4", Price: 1, OrderReference: 7, OrderType: OrderTypeMarket},
+		Replaced{Timestamp: 2, ReplacementToken: "ORD2", Side: SideBuy, Shares: 10, Stock: "VALE3", Price: 2, OrderReference: 7, PreviousToken: "ORD1"},
+		Canceled{Timestamp: 3, Token: "ORD2", DecrementedShares: 10, Reason: CancelReasonUserRequested},
+		Executed{Timestamp: 4, Token: "ORD2", ExecutedShares: 5, ExecutionPrice: 465200, Liquidity: LiquidityAdded, MatchNumber: 9},
+		Rejected{Timestamp: 5, Token: "ORD3", Reason: RejectDuplicateToken},
+		BrokenTrade{Timestamp: 6, Token: "ORD2", MatchNumber: 9, Reason: BrokenReasonSupervisory},
+	}
+	for _, msg := range outbound {
+		decoded, err := DecodeOutbound(msg.(interface{ Encode() []byte }).Encode())
+		require.NoError(t, err)
+		require.Equal(t, msg, decoded)
+	}
+	_, err := DecodeInbound(append(CancelOrder{Token: "X"}.Encode(), 0))
+	require.Error(t, err)
+}
+
+func TestServer_LoginRejected(t *testing.T) {
+	_, server, addr := startTestServer(t)
+	_, err := Dial(addr, LoginRequest{Username: "HFT1", Password: "secret2"}, time.Second)
+	require.ErrorContains(t, err, "login rejected")
+	_, err = Dial(addr, LoginRequest{Username: "HFT1", Password: "secret1", Session: "OTHER"}, time.Second)
+	require.ErrorContains(t, err, "login rejected")
+
+	c := dial(t, addr, "HFT1", "secret1", 0)
+	require.Equal(t, server.Session(), c.Session)
+	_, err = Dial(addr, LoginRequest{Username: "HFT1", Password: "secret1"}, time.Second)
+	require.ErrorContains(t, err, "login rejected", "a session has a single live connection")
+}
+
+func TestServer_OrderLifecycle(t *testing.T) {
+	app, _, addr := startTestServer(t)
+	maker := dial(t, addr, "HFT1", "secret1", 0)
+	taker := dial(t, addr, "HFT2", "secret2", 0)
+
+	require.NoError(t, maker.Send(EnterOrder{Token: "M1", Side: SideSell, Shares: 100, Stock: "VALE3", Price: 465200, OrderType: OrderTypeLimit}))
+	seq, msg := receive(t, maker)
+	require.Equal(t, uint64(1), seq)
+	accepted := msg.(Accepted)
+	require.Equal(t, "M1", accepted.Token)
+	require.NotZero(t, accepted.OrderReference)
+
+	require.NoError(t, taker.Send(EnterOrder{Token: "T1", Side: SideBuy, Shares: 150, Stock: "VALE3", OrderType: OrderTypeMarket}))
+	_, msg = receive(t, taker)
+	require.IsType(t, Accepted{}, msg)
+	_, msg = receive(t, taker)
+	executed := msg.(Executed)
+	require.Equal(t, uint32(100), executed.ExecutedShares)
+	require.Equal(t, int64(465200), executed.ExecutionPrice)
+	require.Equal(t, LiquidityRemoved, executed.Liquidity)
+	_, msg = receive(t, taker)
+	require.Equal(t, Canceled{Timestamp: msg.(Canceled).Timestamp, Token: "T1", DecrementedShares: 50, Reason: CancelReasonImmediateOrCancel}, msg)
+
+	_, msg = receive(t, maker)
+	require.Equal(t, LiquidityAdded, msg.(Executed).Liquidity)
+
+	require.NoError(t, maker.Send(EnterOrder{Token: "M2", Side: SideBuy, Shares: 10, Stock: "VALE3", Price: 460000, OrderType: OrderTypeLimit}))
+	_, msg = receive(t, maker)
+	require.IsType(t, Accepted{}, msg)
+	require.NoError(t, maker.Send(ReplaceOrder{ExistingToken: "M2", ReplacementToken: "M3", Shares: 20, Price: 461000}))
+	_, msg = receive(t, maker)
+	replaced := msg.(Replaced)
+	require.Equal(t, "M3", replaced.ReplacementToken)
+	require.Equal(t, "M2", replaced.PreviousToken)
+	require.Equal(t, uint32(20), replaced.Shares)
+
+	require.NoError(t, maker.Send(CancelOrder{Token: "M3"}))
+	_, msg = receive(t, maker)
+	require.Equal(t, CancelReasonUserRequested, msg.(Canceled).Reason)
+	require.Empty(t, app.OpenOrders("HFT1"))
+
+	rejects := []struct {
+		msg    interface{ Encode() []byte }
+		token  string
+		reason byte
+	}{
+		{CancelOrder{Token: "M3"}, "M3", RejectTooLate},
+		{CancelOrder{Token: "NOPE"}, "NOPE", RejectUnknownToken},
+		{EnterOrder{Token: "M1", Side: SideBuy, Shares: 1, Stock: "VALE3", Price: 1, OrderType: OrderTypeLimit}, "M1", RejectDuplicateToken},
+		{EnterOrder{Token: "M4", Side: SideBuy, Shares: 0, Stock: "VALE3", Price: 1, OrderType: OrderTypeLimit}, "M4", RejectInvalidShares},
+		{EnterOrder{Token: "M5", Side: SideBuy, Shares: 1, Stock: "VALE3", OrderType: OrderTypeLimit}, "M5", RejectInvalidPrice},
+	}
+	for _, tt := range rejects {
+		require.NoError(t, maker.Send(tt.msg))
+		_, msg = receive(t, maker)
+		rejected := msg.(Rejected)
+		require.Equal(t, tt.token, rejected.Token)
+		require.Equal(t, string(tt.reason), string(rejected.Reason))
+	}
+}
+
+func TestServer_Halted(t *testing.T) {
+	app, _, addr := startTestServer(t)
+	c := dial(t, addr, "HFT1", "secret1", 0)
+	require.NoError(t, c.Send(EnterOrder{Token: "H1", Side: SideBuy, Shares: 1, Stock: "VALE3", Price: 10000, OrderType: OrderTypeLimit}))
+	_, msg := receive(t, c)
+	require.IsType(t, Accepted{}, msg)
+
+	_, err := app.Halt(order_gateway.HaltSession, "HFT1", "runaway algo", true)
+	require.NoError(t, err)
+	_, msg = receive(t, c)
+	require.Equal(t, CancelReasonHalted, msg.(Canceled).Reason)
+	require.NoError(t, c.Send(EnterOrder{Token: "H2", Side: SideBuy, Shares: 1, Stock: "VALE3", Price: 10000, OrderType: OrderTypeLimit}))
+	_, msg = receive(t, c)
+	require.Equal(t, string(RejectHalted), string(msg.(Rejected).Reason))
+}
+
+func TestServer_ReplayAfterReconnect(t *testing.T) {
+	_, _, addr := startTestServer(t, WithHeartbeats(20*time.Millisecond, time.Second))
+	c := dial(t, addr, "HFT1", "secret1", 0)
+	for _, token := range []string{"A", "B", "C"} {
+		require.NoError(t, c.Send(EnterOrder{Token: token, Side: SideBuy, Shares: 1, Stock: "VALE3", Price: 10000, OrderType: OrderTypeLimit}))
+	}
+	live := make([]any, 0, 3)
+	for i := 0; i < 3; i++ {
+		_, msg := receive(t, c)
+		live = append(live, msg)
+	}
+	require.NoError(t, c.Close())
+
+	// heartbeats keep an idle session alive past several intervals
+	c = dial(t, addr, "HFT1", "secret1", 2)
+	require.Equal(t, uint64(2), c.NextSequence)
+	time.Sleep(100 * time.Millisecond)
+	for i := 1; i < 3; i++ {
+		seq, msg := receive(t, c)
+		require.Equal(t, uint64(i+1), seq)
+		require.Equal(t, live[i], msg)
+	}
+	require.NoError(t, c.Close())
+
+	c = dial(t, addr, "HFT1", "secret1", 0)
+	require.Equal(t, uint64(4), c.NextSequence)
+}
+
+func TestServer_Retention(t *testing.T) {
+	app, _, addr := startTestServer(t, WithRetention(2))
+	c := dial(t, addr, "HFT1", "secret1", 0)
+	// orders of the CompID entered through other gateways are not sequenced
+	order := app.NewOrder("FIX1", "VALE3", "HFT1", DefaultTargetCompID, domain.BUY, enum.OrdType_LIMIT, decimal.NewFromInt(1),
+		decimal.NewFromInt(1))
+	order.SetEntryProtocol(domain.EntryFIX)
+	_, err := app.Submit(order)
+	require.NoError(t, err)
+	for _, token := range []string{"A", "B", "C"} {
+		require.NoError(t, c.Send(EnterOrder{Token: token, Side: SideBuy, Shares: 1, Stock: "VALE3", Price: 10000, OrderType: OrderTypeLimit}))
+		seq, msg := receive(t, c)
+		require.Equal(t, token, msg.(Accepted).Token, "message %d", seq)
+	}
+	require.NoError(t, c.Close())
+
+	// the first message is no longer kept
+	c = dial(t, addr, "HFT1", "secret1", 1)
+	require.Equal(t, uint64(2), c.NextSequence)
+	require.NoError(t, c.Close())
+	// logging in from 3 acknowledges 2
+	c = dial(t, addr, "HFT1", "secret1", 3)
+	require.Equal(t, uint64(3), c.NextSequence)
+	require.NoError(t, c.Close())
+	c = dial(t, addr, "HFT1", "secret1", 2)
+	require.Equal(t, uint64(3), c.NextSequence)
+	seq, msg := receive(t, c)
+	require.Equal(t, uint64(3), seq)
+	require.Equal(t, "C", msg.(Accepted).Token)
+}
+
+func TestServer_DisconnectsSilentClients(t *testing.T) {
+	_, _, addr := startTestServer(t, WithHeartbeats(10*time.Millisecond, 50*time.Millisecond))
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, writePacket(conn, PacketLoginRequest, LoginRequest{Username: "HFT1", Password: "secret1"}.encode()))
+	packetType, _, err := readPacket(conn)
+	require.NoError(t, err)
+	require.Equal(t, PacketLoginAccepted, packetType)
+	_ = conn.SetReadDeadline(time.Now().Add(receiveTimeout))
+	for {
+		packetType, _, err = readPacket(conn)
+		if err != nil {
+			break
+		}
+		require.Equal(t, PacketServerHeartbeat, packetType)
+	}
+	var netErr net.Error
+	require.False(t, errors.As(err, &netErr) && netErr.Timeout(), "server should have closed the connection")
+}
@@ -0,0 +1,143 @@
+package ouch_gateway
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SoupBinTCP-like session layer: every packet is a big endian uint16 length, counting
+// the type byte and the payload, followed by the packet type and its payload.
+const (
+	// client to server
+	PacketLoginRequest    byte = 'L'
+	PacketUnsequencedData byte = 'U'
+	PacketClientHeartbeat byte = 'R'
+	PacketLogoutRequest   byte = 'O'
+	// server to client
+	PacketLoginAccepted   byte = 'A'
+	PacketLoginRejected   byte = 'J'
+	PacketSequencedData   byte = 'S'
+	PacketServerHeartbeat byte = 'H'
+	PacketEndOfSession    byte = 'Z'
+
+	LoginRejectNotAuthorized       byte = 'A'
+	LoginRejectSessionNotAvailable byte = 'S'
+
+	usernameLen = 6
+	passwordLen = 10
+	sessionLen  = 10
+	seqLen      = 20
+	maxPacket   = 1 << 12
+)
+
+func writePacket(w io.Writer, packetType byte, payload []byte) error {
+	buf := make([]byte, 3+len(payload))
+	binary.BigEndian.PutUint16(buf, uint16(1+len(payload)))
+	buf[2] = packetType
+	copy(buf[3:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var header [3]byte
+	_, err := io.ReadFull(r, header[:2])
+	if err != nil {
+		return 0, nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[:2]))
+	if length == 0 || length > maxPacket {
+		return 0, nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	_, err = io.ReadFull(r, header[2:3])
+	if err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length-1)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	return header[2], payload, nil
+}
+
+// alpha left justifies s in a space padded field of n bytes.
+func alpha(s string, n int) []byte {
+	field := []byte(strings.Repeat(" ", n))
+	copy(field, s)
+	return field
+}
+
+// numeric right justifies v in a space padded field of n bytes.
+func numeric(v uint64, n int) []byte {
+	return []byte(fmt.Sprintf("%*d", n, v))
+}
+
+func parseAlpha(b []byte) string {
+	return strings.TrimRight(string(b), " ")
+}
+
+func parseNumeric(b []byte) (uint64, error) {
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// LoginRequest opens a session; a RequestedSequence of 0 asks for live messages only,
+// any other value replays the sequenced messages from that number on.
+type LoginRequest struct {
+	Username          string
+	Password          string
+	Session           string
+	RequestedSequence uint64
+}
+
+func (m LoginRequest) encode() []byte {
+	payload := make([]byte, 0, usernameLen+passwordLen+sessionLen+seqLen)
+	payload = append(payload, alpha(m.Username, usernameLen)...)
+	payload = append(payload, alpha(m.Password, passwordLen)...)
+	payload = append(payload, alpha(m.Session, sessionLen)...)
+	return append(payload, numeric(m.RequestedSequence, seqLen)...)
+}
+
+func decodeLoginRequest(payload []byte) (LoginRequest, error) {
+	if len(payload) != usernameLen+passwordLen+sessionLen+seqLen {
+		return LoginRequest{}, fmt.Errorf("login request of %d bytes", len(payload))
+	}
+	seq, err := parseNumeric(payload[usernameLen+passwordLen+sessionLen:])
+	if err != nil {
+		return LoginRequest{}, fmt.Errorf("login request sequence: %s", err)
+	}
+	return LoginRequest{
+		Username:          parseAlpha(payload[:usernameLen]),
+		Password:          parseAlpha(payload[usernameLen : usernameLen+passwordLen]),
+		Session:           parseAlpha(payload[usernameLen+passwordLen : usernameLen+passwordLen+sessionLen]),
+		RequestedSequence: seq,
+	}, nil
+}
+
+// LoginAccepted tells the client the session and the sequence number of the next message it will get.
+type LoginAccepted struct {
+	Session        string
+	SequenceNumber uint64
+}
+
+func (m LoginAccepted) encode() []byte {
+	return append(alpha(m.Session, sessionLen), numeric(m.SequenceNumber, seqLen)...)
+}
+
+func decodeLoginAccepted(payload []byte) (LoginAccepted, error) {
+	if len(payload) != sessionLen+seqLen {
+		return LoginAccepted{}, fmt.Errorf("login accepted of %d bytes", len(payload))
+	}
+	seq, err := parseNumeric(payload[sessionLen:])
+	if err != nil {
+		return LoginAccepted{}, err
+	}
+	return LoginAccepted{Session: parseAlpha(payload[:sessionLen]), SequenceNumber: seq}, nil
+}
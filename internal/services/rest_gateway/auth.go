@@ -0,0 +1,21 @@
+package rest_gateway
+
+import (
+	"net/http"
+	"stock_exchange/internal/services/api_keys"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	// apiKeyParam authenticates WebSocket upgrades, browsers cannot set headers on them
+	apiKeyParam = "api_key"
+)
+
+// authenticate returns the CompID of the key presented in r.
+func authenticate(keys api_keys.APIKeys, r *http.Request) (string, bool) {
+	presented := r.Header.Get(apiKeyHeader)
+	if presented == "" && r.Header.Get("Upgrade") == "websocket" {
+		presented = r.URL.Query().Get(apiKeyParam)
+	}
+	return keys.CompID(presented)
+}
@@ -0,0 +1,108 @@
+package rest_gateway
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"slices"
+)
+
+// ErrSequenceGap means book updates were missed; resubscribe to get a fresh snapshot.
+var ErrSequenceGap = errors.New("book sequence gap")
+
+// BookTracker rebuilds the aggregated book of a symbol from the stream, the
+// reference client side of book_snapshot and book_update messages.
+type BookTracker struct {
+	Symbol string
+	seq    uint64
+	synced bool
+	bids   map[string]LevelChange
+	asks   map[string]LevelChange
+}
+
+func NewBookTracker(symbol string) *BookTracker {
+	return &BookTracker{Symbol: symbol}
+}
+
+// Seq is the sequence number of the last message applied.
+func (t *BookTracker) Seq() uint64 {
+	return t.seq
+}
+
+// Synced reports whether the tracker holds a snapshot with every update since.
+func (t *BookTracker) Synced() bool {
+	return t.synced
+}
+
+// ApplySnapshot replaces the book, resynchronizing the tracker.
+func (t *BookTracker) ApplySnapshot(msg BookSnapshotMessage) {
+	t.bids = make(map[string]LevelChange, len(msg.Bids))
+	t.asks = make(map[string]LevelChange, len(msg.Asks))
+	for _, level := range msg.Bids {
+		t.bids[level.Price.String()] = LevelChange{Side: "bid", Price: level.Price, Quantity: level.Quantity, Orders: level.Orders}
+	}
+	for _, level := range msg.Asks {
+		t.asks[level.Price.String()] = LevelChange{Side: "ask", Price: level.Price, Quantity: level.Quantity, Orders: level.Orders}
+	}
+	t.seq = msg.Seq
+	t.synced = true
+}
+
+// ApplyUpdate applies the next update. Stale updates are ignored, while a skipped
+// sequence number leaves the tracker out of sync and returns ErrSequenceGap.
+func (t *BookTracker) ApplyUpdate(msg BookUpdateMessage) error {
+	if !t.synced {
+		return ErrSequenceGap
+	}
+	if msg.Seq <= t.seq {
+		return nil
+	}
+	if msg.Seq != t.seq+1 {
+		t.synced = false
+		return fmt.Errorf("%w: expected %d, got %d", ErrSequenceGap, t.seq+1, msg.Seq)
+	}
+	for _, change := range msg.Changes {
+		levels := t.asks
+		if change.Side == "bid" {
+			levels = t.bids
+		}
+		if change.Quantity.IsZero() {
+			delete(levels, change.Price.String())
+		} else {
+			levels[change.Price.String()] = change
+		}
+	}
+	t.seq = msg.Seq
+	return nil
+}
+
+// Levels returns one side of the book from the best price.
+func (t *BookTracker) Levels(side string) []LevelChange {
+	byPrice := t.asks
+	if side == "bid" {
+		byPrice = t.bids
+	}
+	levels := make([]LevelChange, 0, len(byPrice))
+	for _, level := range byPrice {
+		levels = append(levels, level)
+	}
+	slices.SortFunc(levels, func(x, y LevelChange) int {
+		if side == "bid" {
+			return y.Price.Cmp(x.Price)
+		}
+		return x.Price.Cmp(y.Price)
+	})
+	return levels
+}
+
+// Quantity returns the quantity resting at px on side.
+func (t *BookTracker) Quantity(side string, px decimal.Decimal) decimal.Decimal {
+	byPrice := t.asks
+	if side == "bid" {
+		byPrice = t.bids
+	}
+	if level, ok := byPrice[px.String()]; ok {
+		return level.Quantity
+	}
+	return decimal.Zero
+}
@@ -0,0 +1,358 @@
+package rest_gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"io"
+	"net/http"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strconv"
+	"time"
+)
+
+const maxBodySize = 1 << 20
+
+type orderRequest struct {
+	ClientOrderID string          `json:"client_order_id"`
+	Symbol        string          `json:"symbol"`
+	Side          string          `json:"side"`
+	Type          string          `json:"type"`
+	Price         decimal.Decimal `json:"price"`
+	Quantity      decimal.Decimal `json:"quantity"`
+}
+
+type amendRequest struct {
+	Price    decimal.Decimal `json:"price"`
+	Quantity decimal.Decimal `json:"quantity"`
+}
+
+type orderResponse struct {
+	OrderID          string          `json:"order_id"`
+	ClientOrderID    string          `json:"client_order_id"`
+	Symbol           string          `json:"symbol"`
+	Side             string          `json:"side"`
+	Type             string          `json:"type"`
+	Price            decimal.Decimal `json:"price"`
+	Quantity         decimal.Decimal `json:"quantity"`
+	LeavesQuantity   decimal.Decimal `json:"leaves_quantity"`
+	ExecutedQuantity decimal.Decimal `json:"executed_quantity"`
+	AvgPrice         decimal.Decimal `json:"avg_price"`
+	Status           string          `json:"status"`
+	RejectReason     string          `json:"reject_reason,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+type levelResponse struct {
+	Price    decimal.Decimal `json:"price"`
+	Quantity decimal.Decimal `json:"quantity"`
+	Orders   int             `json:"orders"`
+}
+
+type bookResponse struct {
+	Symbol string          `json:"symbol"`
+	Bids   []levelResponse `json:"bids"`
+	Asks   []levelResponse `json:"asks"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func sideName(side domain.OrderSide) string {
+	if side == domain.BUY {
+		return "buy"
+	}
+	return "sell"
+}
+
+func ordTypeName(ordType enum.OrdType) string {
+	if ordType == enum.OrdType_MARKET {
+		return "market"
+	}
+	return "limit"
+}
+
+func statusName(status domain.OrderStatus) string {
+	switch status {
+	case domain.OrderStatusOpen:
+		return "open"
+	case domain.OrderStatusFilled:
+		return "filled"
+	case domain.OrderStatusCanceled:
+		return "canceled"
+	case domain.OrderStatusRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+func newOrderResponse(view domain.OrderView) orderResponse {
+	return orderResponse{
+		OrderID:          view.OrderID,
+		ClientOrderID:    view.ClOrdID,
+		Symbol:           view.Symbol,
+		Side:             sideName(view.Side),
+		Type:             ordTypeName(view.OrdType),
+		Price:            view.Price,
+		Quantity:         view.Quantity,
+		LeavesQuantity:   view.LeavesQty,
+		ExecutedQuantity: view.ExecutedQuantity,
+		AvgPrice:         view.AvgPx(),
+		Status:           statusName(view.Status),
+		CreatedAt:        view.CreatedAt,
+	}
+}
+
+func levelsResponse(levels []domain.PriceLevel) []levelResponse {
+	out := make([]levelResponse, 0, len(levels))
+	for _, level := range levels {
+		out = append(out, levelResponse{Price: level.Price, Quantity: level.Quantity, Orders: level.Orders})
+	}
+	return out
+}
+
+func encode(v any) []byte {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return errorBody("error encoding response: %s", err)
+	}
+	return body
+}
+
+func errorBody(format string, args ...any) []byte {
+	body, _ := json.Marshal(errorResponse{Error: fmt.Sprintf(format, args...)})
+	return body
+}
+
+func writeJSON(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, errorBody(format, args...))
+}
+
+func writeReplayable(w http.ResponseWriter, status int, body []byte, replayed bool) {
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	writeJSON(w, status, body)
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	return io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+}
+
+func (req orderRequest) toDomain() (domain.OrderSide, enum.OrdType, error) {
+	var side domain.OrderSide
+	switch req.Side {
+	case "buy":
+		side = domain.BUY
+	case "sell":
+		side = domain.SELL
+	default:
+		return 0, "", fmt.Errorf("side must be buy or sell")
+	}
+	var ordType enum.OrdType
+	switch req.Type {
+	case "limit", "":
+		ordType = enum.OrdType_LIMIT
+		if !req.Price.IsPositive() {
+			return 0, "", fmt.Errorf("limit orders need a positive price")
+		}
+	case "market":
+		ordType = enum.OrdType_MARKET
+	default:
+		return 0, "", fmt.Errorf("type must be limit or market")
+	}
+	if req.Symbol == "" {
+		return 0, "", fmt.Errorf("symbol is required")
+	}
+	if !req.Quantity.IsPositive() {
+		return 0, "", fmt.Errorf("quantity must be positive")
+	}
+	return side, ordType, nil
+}
+
+// refusal records that the request of receipt was refused for the reason format
+// gives, and is the body that says so.
+func refusal(receipt *order_gateway.AuditReceipt, format string, args ...any) []byte {
+	reason := fmt.Sprintf(format, args...)
+	receipt.Rejected(reason)
+	return errorBody("%s", reason)
+}
+
+// submitOrder enters a new order; client_order_id doubles as its idempotency key.
+func (s *Server) submitOrder(w http.ResponseWriter, r *http.Request, compID string) {
+	body, err := readBody(r)
+	var req orderRequest
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	message := r.Method + " " + r.URL.Path + " " + string(body)
+	receipt := s.app.ReceiveRequest(domain.EntryREST, compID, enum.MsgType_ORDER_SINGLE, req.ClientOrderID, "", message)
+	defer receipt.Done()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, refusal(receipt, "invalid order: %s", err))
+		return
+	}
+	if req.ClientOrderID == "" {
+		writeJSON(w, http.StatusBadRequest, refusal(receipt, "client_order_id is required"))
+		return
+	}
+	key := idempotencyKey{compID: compID, msgType: enum.MsgType_ORDER_SINGLE, requestID: req.ClientOrderID}
+	status, resp, replayed := s.idempotency.do(key, message, func() (int, []byte) {
+		side, ordType, err := req.toDomain()
+		if err != nil {
+			return http.StatusBadRequest, refusal(receipt, "invalid order: %s", err)
+		}
+		order := s.app.NewOrder(req.ClientOrderID, req.Symbol, compID, s.targetCompID, side, ordType, req.Price, req.Quantity)
+		order.SetEntryProtocol(domain.EntryREST)
+		receipt.Validated(order)
+		events, err := s.app.Submit(order)
+		if errors.Is(err, order_gateway.ErrDuplicateClOrdID) {
+			return http.StatusConflict, errorBody("client_order_id %s was already used", req.ClientOrderID)
+		}
+		if len(events) > 0 && events[0].Type == order_gateway.OrderEventRejected {
+			rejected := newOrderResponse(events[0].Order)
+			rejected.RejectReason = events[0].Text
+			if errors.Is(err, order_gateway.ErrNotEntitled) {
+				return http.StatusForbidden, encode(rejected)
+			}
+			if errors.Is(err, order_gateway.ErrHalted) {
+				return http.StatusConflict, encode(rejected)
+			}
+			return http.StatusUnprocessableEntity, encode(rejected)
+		}
+		view, _ := s.app.LookupOrder(compID, req.ClientOrderID)
+		return http.StatusCreated, encode(newOrderResponse(view))
+	})
+	writeReplayable(w, status, resp, replayed)
+}
+
+// requestID returns the X-Request-ID header that makes cancels and amends idempotent,
+// refusing the request of receipt without it.
+func requestID(w http.ResponseWriter, r *http.Request, receipt *order_gateway.AuditReceipt) (string, bool) {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, refusal(receipt, "%s header is required", requestIDHeader))
+		return "", false
+	}
+	return id, true
+}
+
+func engineErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, order_gateway.ErrUnknownOrder):
+		return http.StatusNotFound
+	case errors.Is(err, order_gateway.ErrOrderNotOpen), errors.Is(err, order_gateway.ErrDuplicateClOrdID),
+		errors.Is(err, order_gateway.ErrHalted):
+		return http.StatusConflict
+	case errors.Is(err, order_gateway.ErrNotEntitled):
+		return http.StatusForbidden
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+func (s *Server) cancelOrder(w http.ResponseWriter, r *http.Request, compID string) {
+	clOrdID := r.PathValue("clOrdID")
+	receipt := s.app.ReceiveRequest(domain.EntryREST, compID, enum.MsgType_ORDER_CANCEL_REQUEST, "", clOrdID,
+		r.Method+" "+r.URL.Path)
+	defer receipt.Done()
+	id, ok := requestID(w, r, receipt)
+	if !ok {
+		return
+	}
+	key := idempotencyKey{compID: compID, msgType: enum.MsgType_ORDER_CANCEL_REQUEST, requestID: id}
+	status, resp, replayed := s.idempotency.do(key, r.Method+" "+r.URL.Path, func() (int, []byte) {
+		event, err := s.app.Cancel(compID, clOrdID)
+		if err != nil {
+			return engineErrorStatus(err), refusal(receipt, "cannot cancel %s: %s", clOrdID, err)
+		}
+		return http.StatusOK, encode(newOrderResponse(event.Order))
+	})
+	writeReplayable(w, status, resp, replayed)
+}
+
+// amendOrder replaces price and quantity of an order; X-Request-ID becomes its new client order id.
+func (s *Server) amendOrder(w http.ResponseWriter, r *http.Request, compID string) {
+	clOrdID := r.PathValue("clOrdID")
+	body, err := readBody(r)
+	message := r.Method + " " + r.URL.Path + " " + string(body)
+	receipt := s.app.ReceiveRequest(domain.EntryREST, compID, enum.MsgType_ORDER_CANCEL_REPLACE_REQUEST,
+		r.Header.Get(requestIDHeader), clOrdID, message)
+	defer receipt.Done()
+	id, ok := requestID(w, r, receipt)
+	if !ok {
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, refusal(receipt, "error reading body: %s", err))
+		return
+	}
+	key := idempotencyKey{compID: compID, msgType: enum.MsgType_ORDER_CANCEL_REPLACE_REQUEST, requestID: id}
+	status, resp, replayed := s.idempotency.do(key, message, func() (int, []byte) {
+		var req amendRequest
+		err := json.Unmarshal(body, &req)
+		if err != nil {
+			return http.StatusBadRequest, refusal(receipt, "invalid amend: %s", err)
+		}
+		_, err = s.app.Replace(compID, clOrdID, id, req.Price, req.Quantity)
+		if err != nil {
+			return engineErrorStatus(err), refusal(receipt, "cannot amend %s: %s", clOrdID, err)
+		}
+		// a retried submit of the old client order id must not be answered with the order as it was
+		s.idempotency.forget(idempotencyKey{compID: compID, msgType: enum.MsgType_ORDER_SINGLE, requestID: clOrdID})
+		view, _ := s.app.LookupOrder(compID, id)
+		return http.StatusOK, encode(newOrderResponse(view))
+	})
+	writeReplayable(w, status, resp, replayed)
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request, compID string) {
+	clOrdID := r.PathValue("clOrdID")
+	view, ok := s.app.LookupOrder(compID, clOrdID)
+	if !ok {
+		writeError(w, http.StatusNotFound, "order %s not found", clOrdID)
+		return
+	}
+	writeJSON(w, http.StatusOK, encode(newOrderResponse(view)))
+}
+
+func (s *Server) listOpenOrders(w http.ResponseWriter, r *http.Request, compID string) {
+	views := s.app.OpenOrders(compID)
+	orders := make([]orderResponse, 0, len(views))
+	for _, view := range views {
+		orders = append(orders, newOrderResponse(view))
+	}
+	writeJSON(w, http.StatusOK, encode(orders))
+}
+
+// getBook returns the aggregated book of a symbol, the top ?depth=N levels or all of them.
+func (s *Server) getBook(w http.ResponseWriter, r *http.Request, _ string) {
+	symbol := r.PathValue("symbol")
+	depth := 0
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "depth must be a non negative integer")
+			return
+		}
+		depth = n
+	}
+	resp := bookResponse{Symbol: symbol, Bids: []levelResponse{}, Asks: []levelResponse{}}
+	if book, ok := s.app.OrderBook(symbol); ok {
+		d := book.Depth(depth)
+		resp.Bids = levelsResponse(d.Bids)
+		resp.Asks = levelsResponse(d.Asks)
+	}
+	writeJSON(w, http.StatusOK, encode(resp))
+}
@@ -0,0 +1,131 @@
+package rest_gateway
+
+import (
+	"container/list"
+	"github.com/quickfixgo/enum"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+const (
+	// DefaultIdempotencyTTL is how long a response is replayed to retries of its request.
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// DefaultIdempotencySize is how many responses are remembered at most.
+	DefaultIdempotencySize = 100_000
+)
+
+// idempotencyKey names a request by client, the kind of request and its request ID, so that
+// the client order id of a submit and the X-Request-ID of a cancel or amend never collide.
+type idempotencyKey struct {
+	compID    string
+	msgType   enum.MsgType
+	requestID string
+}
+
+// cachedResponse is the response to a request, available once done is closed.
+type cachedResponse struct {
+	key         idempotencyKey
+	element     *list.Element
+	fingerprint string
+	expires     time.Time
+	done        chan struct{}
+	status      int
+	body        []byte
+}
+
+// completed reports whether the request is done and its response set.
+func (r *cachedResponse) completed() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// idempotencyCache remembers the response to mutating requests by client and request ID
+// for ttl, and at most size of them, so retries are answered without touching the book again.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	size      int
+	now       func() time.Time
+	responses map[idempotencyKey]*cachedResponse
+	// order holds the responses oldest first, which is also the order they expire in
+	order *list.List
+}
+
+func newIdempotencyCache(ttl time.Duration, size int) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:       ttl,
+		size:      size,
+		now:       time.Now,
+		responses: make(map[idempotencyKey]*cachedResponse),
+		order:     list.New(),
+	}
+}
+
+// do runs fn once per key. A retry with the same fingerprint replays the first response,
+// waiting for it when the first request is still running, while reusing the request ID
+// for a different request is a conflict. Requests of different keys run concurrently.
+func (c *idempotencyCache) do(key idempotencyKey, fingerprint string, fn func() (int, []byte)) (int, []byte, bool) {
+	c.mu.Lock()
+	cached, ok := c.responses[key]
+	if ok && !c.now().Before(cached.expires) && cached.completed() {
+		c.forgetLocked(key)
+		ok = false
+	}
+	if !ok {
+		c.evict()
+		cached = &cachedResponse{key: key, fingerprint: fingerprint, expires: c.now().Add(c.ttl), done: make(chan struct{})}
+		c.responses[key] = cached
+		cached.element = c.order.PushBack(cached)
+	}
+	c.mu.Unlock()
+	if ok {
+		if cached.fingerprint != fingerprint {
+			return http.StatusConflict, errorBody("request id %s was already used for a different request", key.requestID), true
+		}
+		<-cached.done
+		return cached.status, cached.body, true
+	}
+	cached.status, cached.body = fn()
+	close(cached.done)
+	return cached.status, cached.body, false
+}
+
+// forget drops the response of key, which no longer stands for the current state, such as
+// the creation of an order since replaced under another client order id.
+func (c *idempotencyCache) forget(key idempotencyKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forgetLocked(key)
+}
+
+func (c *idempotencyCache) forgetLocked(key idempotencyKey) {
+	if cached, ok := c.responses[key]; ok {
+		c.order.Remove(cached.element)
+		delete(c.responses, key)
+	}
+}
+
+// evict drops the responses past their ttl and the oldest ones to make room for another, c.mu held.
+// Requests still running are kept whatever their age, as retries wait for them, so the cache
+// may hold more than size of them for as long as they run.
+func (c *idempotencyCache) evict() {
+	now := c.now()
+	for e := c.order.Front(); e != nil; {
+		cached, next := e.Value.(*cachedResponse), e.Next()
+		if now.Before(cached.expires) && len(c.responses) < c.size {
+			return
+		}
+		if cached.completed() {
+			c.order.Remove(e)
+			delete(c.responses, cached.key)
+		}
+		e = next
+	}
+}
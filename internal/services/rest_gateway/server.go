@@ -0,0 +1,117 @@
+package rest_gateway
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"stock_exchange/internal/services/api_keys"
+	"stock_exchange/internal/services/order_gateway"
+	"sync"
+	"time"
+)
+
+const DefaultTargetCompID = "ORDERGATEWAY"
+
+// Server is the REST/JSON order entry gateway. Orders go through the same
+// matching path as FIX NewOrderSingle, as orders of the CompID the API key belongs to.
+type Server struct {
+	app          *order_gateway.Application
+	keys         api_keys.APIKeys
+	targetCompID string
+	idempotency  *idempotencyCache
+	streams      *streamHub
+	mu           sync.Mutex
+	httpServer   *http.Server
+}
+
+type Option func(*Server)
+
+// WithTargetCompID sets the TargetCompID of the orders entered through the gateway.
+func WithTargetCompID(targetCompID string) Option {
+	return func(s *Server) {
+		s.targetCompID = targetCompID
+	}
+}
+
+// WithIdempotency replays the response of a request to its retries for ttl, remembering
+// at most size responses.
+func WithIdempotency(ttl time.Duration, size int) Option {
+	return func(s *Server) {
+		s.idempotency = newIdempotencyCache(ttl, size)
+	}
+}
+
+func NewServer(app *order_gateway.Application, keys api_keys.APIKeys, opts ...Option) *Server {
+	s := &Server{
+		app:          app,
+		keys:         keys,
+		targetCompID: DefaultTargetCompID,
+		idempotency:  newIdempotencyCache(DefaultIdempotencyTTL, DefaultIdempotencySize),
+		streams:      newStreamHub(app),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	app.AddListener(s.streams)
+	app.AddBookListener(s.streams)
+	app.Quiesce(s.streams.reset)
+	return s
+}
+
+// Handler routes the /api/v1 endpoints, every one of them behind API key auth.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/orders", s.authenticated(s.submitOrder))
+	mux.HandleFunc("GET /api/v1/orders", s.authenticated(s.listOpenOrders))
+	mux.HandleFunc("GET /api/v1/orders/{clOrdID}", s.authenticated(s.getOrder))
+	mux.HandleFunc("DELETE /api/v1/orders/{clOrdID}", s.authenticated(s.cancelOrder))
+	mux.HandleFunc("PATCH /api/v1/orders/{clOrdID}", s.authenticated(s.amendOrder))
+	mux.HandleFunc("GET /api/v1/books/{symbol}", s.authenticated(s.getBook))
+	mux.HandleFunc("GET /api/v1/stream", s.authenticated(s.stream))
+	return mux
+}
+
+// ListenAndServe serves the gateway on addr until Shutdown is called.
+func (s *Server) ListenAndServe(addr string) error {
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	s.mu.Lock()
+	s.httpServer = httpServer
+	s.mu.Unlock()
+	log.Printf("starting REST gateway on %s", addr)
+	err := httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting requests, closes the WebSocket streams and waits for the
+// requests in progress until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.streams.close()
+	s.mu.Lock()
+	httpServer := s.httpServer
+	s.mu.Unlock()
+	if httpServer == nil {
+		return nil
+	}
+	return httpServer.Shutdown(ctx)
+}
+
+type authenticatedHandler func(w http.ResponseWriter, r *http.Request, compID string)
+
+func (s *Server) authenticated(h authenticatedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		compID, ok := authenticate(s.keys, r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "missing or invalid %s", apiKeyHeader)
+			return
+		}
+		h(w, r, compID)
+	}
+}
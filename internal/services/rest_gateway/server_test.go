@@ -0,0 +1,248 @@
+package rest_gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"stock_exchange/internal/services/api_keys"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"testing"
+	"time"
+)
+
+type testClient struct {
+	t      *testing.T
+	server *httptest.Server
+	key    string
+}
+
+func newTestServer(t *testing.T) (*order_gateway.Application, *httptest.Server) {
+	app := order_gateway.NewApplication()
+	keys := api_keys.APIKeys{
+		{CompID: "CLIENT1", KeySHA256: api_keys.HashAPIKey("key-1")},
+		{CompID: "CLIENT2", KeySHA256: api_keys.HashAPIKey("key-2")},
+	}
+	server := httptest.NewServer(NewServer(app, keys).Handler())
+	t.Cleanup(server.Close)
+	return app, server
+}
+
+func (c testClient) do(method, path string, body any, headers map[string]string) (*http.Response, []byte) {
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		require.NoError(c.t, err)
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, c.server.URL+path, reader)
+	require.NoError(c.t, err)
+	if c.key != "" {
+		req.Header.Set(apiKeyHeader, c.key)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.server.Client().Do(req)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(resp.Body)
+	require.NoError(c.t, err)
+	return resp, buf.Bytes()
+}
+
+func decodeOrder(t *testing.T, body []byte) orderResponse {
+	var order orderResponse
+	require.NoError(t, json.Unmarshal(body, &order))
+	return order
+}
+
+func limitOrder(id, side, px string, qty int64) map[string]any {
+	return map[string]any{"client_order_id": id, "symbol": "VALE3", "side": side, "type": "limit", "price": px, "quantity": qty}
+}
+
+func TestServer_RequiresAPIKey(t *testing.T) {
+	_, server := newTestServer(t)
+	for _, key := range []string{"", "wrong"} {
+		resp, _ := testClient{t: t, server: server, key: key}.do(http.MethodGet, "/api/v1/orders", nil, nil)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestServer_SubmitMatchesAgainstBook(t *testing.T) {
+	_, server := newTestServer(t)
+	c1 := testClient{t: t, server: server, key: "key-1"}
+	c2 := testClient{t: t, server: server, key: "key-2"}
+
+	resp, body := c1.do(http.MethodPost, "/api/v1/orders", limitOrder("s1", "sell", "46.72", 100), nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(body))
+	sell := decodeOrder(t, body)
+	require.Equal(t, "open", sell.Status)
+	require.NotEmpty(t, sell.OrderID)
+
+	resp, body = c2.do(http.MethodPost, "/api/v1/orders", limitOrder("b1", "buy", "46.80", 40), nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(body))
+	buy := decodeOrder(t, body)
+	require.Equal(t, "filled", buy.Status)
+	require.True(t, buy.AvgPrice.Equal(decimal.RequireFromString("46.72")))
+
+	resp, body = c1.do(http.MethodGet, "/api/v1/orders/s1", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.True(t, decodeOrder(t, body).LeavesQuantity.Equal(decimal.NewFromInt(60)))
+
+	// orders are scoped to the CompID of the key
+	resp, _ = c2.do(http.MethodGet, "/api/v1/orders/s1", nil, nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, body = c1.do(http.MethodGet, "/api/v1/books/VALE3?depth=5", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var book bookResponse
+	require.NoError(t, json.Unmarshal(body, &book))
+	require.Empty(t, book.Bids)
+	require.Len(t, book.Asks, 1)
+	require.True(t, book.Asks[0].Quantity.Equal(decimal.NewFromInt(60)))
+}
+
+func TestServer_SubmitIsIdempotent(t *testing.T) {
+	app, server := newTestServer(t)
+	c1 := testClient{t: t, server: server, key: "key-1"}
+
+	resp, first := c1.do(http.MethodPost, "/api/v1/orders", limitOrder("o1", "buy", "10", 100), nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, replay := c1.do(http.MethodPost, "/api/v1/orders", limitOrder("o1", "buy", "10", 100), nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+	require.Equal(t, first, replay)
+	require.Len(t, app.OpenOrders("CLIENT1"), 1)
+
+	resp, _ = c1.do(http.MethodPost, "/api/v1/orders", limitOrder("o1", "buy", "11", 100), nil)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	require.Len(t, app.OpenOrders("CLIENT1"), 1)
+
+	// the same client order id is independent for another client
+	c2 := testClient{t: t, server: server, key: "key-2"}
+	resp, _ = c2.do(http.MethodPost, "/api/v1/orders", limitOrder("o1", "buy", "10", 100), nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestServer_CancelAndAmend(t *testing.T) {
+	_, server := newTestServer(t)
+	c1 := testClient{t: t, server: server, key: "key-1"}
+	resp, _ := c1.do(http.MethodPost, "/api/v1/orders", limitOrder("o1", "buy", "10", 100), nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, _ = c1.do(http.MethodPost, "/api/v1/orders", limitOrder("o2", "buy", "9", 100), nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, _ = c1.do(http.MethodDelete, "/api/v1/orders/o1", nil, nil)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// request ids of cancels do not collide with client order ids of submits
+	cancel := map[string]string{requestIDHeader: "o2"}
+	resp, body := c1.do(http.MethodDelete, "/api/v1/orders/o1", nil, cancel)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	require.Equal(t, "canceled", decodeOrder(t, body).Status)
+	resp, _ = c1.do(http.MethodDelete, "/api/v1/orders/o1", nil, cancel)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = c1.do(http.MethodDelete, "/api/v1/orders/o1", nil, map[string]string{requestIDHeader: "c2"})
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, _ = c1.do(http.MethodDelete, "/api/v1/orders/missing", nil, map[string]string{requestIDHeader: "c3"})
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	amend := map[string]any{"price": "9.5", "quantity": 150}
+	resp, body = c1.do(http.MethodPatch, "/api/v1/orders/o2", amend, map[string]string{requestIDHeader: "o2-a"})
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	amended := decodeOrder(t, body)
+	require.Equal(t, "o2-a", amended.ClientOrderID)
+	require.True(t, amended.Price.Equal(decimal.RequireFromString("9.5")))
+	require.True(t, amended.Quantity.Equal(decimal.NewFromInt(150)))
+
+	resp, body = c1.do(http.MethodGet, "/api/v1/orders", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var open []orderResponse
+	require.NoError(t, json.Unmarshal(body, &open))
+	require.Len(t, open, 1)
+	require.Equal(t, "o2-a", open[0].ClientOrderID)
+
+	// the creation of o2 is not replayed once it was replaced
+	resp, _ = c1.do(http.MethodPost, "/api/v1/orders", limitOrder("o2", "buy", "9", 100), nil)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	require.Empty(t, resp.Header.Get("Idempotent-Replayed"))
+}
+
+func TestIdempotencyCache(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	cache := newIdempotencyCache(time.Minute, 2)
+	cache.now = func() time.Time { return now }
+	runs := 0
+	do := func(requestID string) bool {
+		_, _, replayed := cache.do(idempotencyKey{compID: "A", requestID: requestID}, "f", func() (int, []byte) {
+			runs++
+			return http.StatusOK, nil
+		})
+		return replayed
+	}
+	require.False(t, do("r1"))
+	require.True(t, do("r1"))
+	now = now.Add(time.Minute)
+	require.False(t, do("r1"), "expired")
+	require.False(t, do("r2"))
+	require.False(t, do("r3"))
+	require.False(t, do("r1"), "the oldest is dropped beyond the size")
+	require.Equal(t, 5, runs)
+
+	// concurrent retries wait for the first request instead of running it again
+	started, release := make(chan struct{}), make(chan struct{})
+	key := idempotencyKey{compID: "A", requestID: "slow"}
+	go cache.do(key, "f", func() (int, []byte) {
+		close(started)
+		<-release
+		return http.StatusCreated, []byte("first")
+	})
+	<-started
+	require.False(t, do("other"), "other keys are not held up")
+	// a request still running is not evicted to make room, even once the oldest
+	require.False(t, do("another"))
+	require.Contains(t, cache.responses, key)
+	go close(release)
+	status, body, replayed := cache.do(key, "f", func() (int, []byte) {
+		t.Fatal("ran twice")
+		return 0, nil
+	})
+	require.True(t, replayed)
+	require.Equal(t, http.StatusCreated, status)
+	require.Equal(t, "first", string(body))
+}
+
+func TestServer_SharesMatchingPathWithFIX(t *testing.T) {
+	app, server := newTestServer(t)
+	// an order entered by a FIX counterparty, as onNewOrderSingle does
+	fixOrder := app.NewOrder("F1", "VALE3", "FIXCLIENT", "ORDERGATEWAY", domain.SELL, enum.OrdType_LIMIT,
+		decimal.NewFromInt(10), decimal.NewFromInt(100))
+	_, err := app.Submit(fixOrder)
+	require.NoError(t, err)
+
+	c1 := testClient{t: t, server: server, key: "key-1"}
+	market := map[string]any{"client_order_id": "m1", "symbol": "VALE3", "side": "buy", "type": "market", "quantity": 30}
+	resp, body := c1.do(http.MethodPost, "/api/v1/orders", market, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(body))
+	require.Equal(t, "filled", decodeOrder(t, body).Status)
+
+	view, ok := app.LookupOrder("FIXCLIENT", "F1")
+	require.True(t, ok)
+	require.True(t, view.LeavesQty.Equal(decimal.NewFromInt(70)))
+
+	market["client_order_id"] = "m2"
+	market["symbol"] = "PETR4"
+	resp, body = c1.do(http.MethodPost, "/api/v1/orders", market, nil)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	rejected := decodeOrder(t, body)
+	require.Equal(t, "rejected", rejected.Status)
+	require.NotEmpty(t, rejected.RejectReason)
+}
@@ -0,0 +1,419 @@
+package rest_gateway
+
+import (
+	"encoding/json"
+	"github.com/shopspring/decimal"
+	"golang.org/x/net/websocket"
+	"log"
+	"net/http"
+	"slices"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"sync"
+	"time"
+)
+
+const (
+	ChannelBook   = "book"
+	ChannelTrades = "trades"
+	ChannelOrders = "orders"
+
+	streamBufferSize = 256
+)
+
+// streamCommand is sent by clients to manage their subscriptions. Orders carry no
+// symbol: they are the execution reports of the CompID of the API key.
+type streamCommand struct {
+	Op      string `json:"op"`
+	Channel string `json:"channel"`
+	Symbol  string `json:"symbol,omitempty"`
+}
+
+type controlMessage struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel,omitempty"`
+	Symbol  string `json:"symbol,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BookSnapshotMessage is the full aggregated book as of Seq, sent on subscribe.
+type BookSnapshotMessage struct {
+	Type   string          `json:"type"`
+	Symbol string          `json:"symbol"`
+	Seq    uint64          `json:"seq"`
+	Bids   []levelResponse `json:"bids"`
+	Asks   []levelResponse `json:"asks"`
+}
+
+// LevelChange is the new state of one price level, a zero quantity removes the level.
+type LevelChange struct {
+	Side     string          `json:"side"`
+	Price    decimal.Decimal `json:"price"`
+	Quantity decimal.Decimal `json:"quantity"`
+	Orders   int             `json:"orders"`
+}
+
+// BookUpdateMessage carries the level changes of one step of the book. Seq grows by
+// one per update of the symbol, so a client that sees it skip must resubscribe.
+type BookUpdateMessage struct {
+	Type    string        `json:"type"`
+	Symbol  string        `json:"symbol"`
+	Seq     uint64        `json:"seq"`
+	Changes []LevelChange `json:"changes"`
+}
+
+// TradeMessage is a print of the symbol, sequenced per symbol like book updates.
+type TradeMessage struct {
+	Type          string          `json:"type"`
+	Symbol        string          `json:"symbol"`
+	Seq           uint64          `json:"seq"`
+	Price         decimal.Decimal `json:"price"`
+	Quantity      decimal.Decimal `json:"quantity"`
+	AggressorSide string          `json:"aggressor_side"`
+	Time          time.Time       `json:"time"`
+}
+
+type executionReportMessage struct {
+	Type         string          `json:"type"`
+	ExecID       string          `json:"exec_id"`
+	ExecType     string          `json:"exec_type"`
+	OrigClOrdID  string          `json:"orig_client_order_id,omitempty"`
+	TradeID      string          `json:"trade_id,omitempty"`
+	LastQuantity decimal.Decimal `json:"last_quantity"`
+	LastPrice    decimal.Decimal `json:"last_price"`
+	Text         string          `json:"text,omitempty"`
+	Order        orderResponse   `json:"order"`
+}
+
+// streamConn is one WebSocket client. Messages are queued without blocking the
+// matching path; when a slow client's queue is full they are dropped and the
+// client notices the gap in the sequence numbers.
+type streamConn struct {
+	compID string
+	send   chan []byte
+}
+
+func (c *streamConn) enqueue(msg any) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("error encoding stream message: %s", err)
+		return
+	}
+	select {
+	case c.send <- body:
+	default:
+	}
+}
+
+// symbolStream is the published state of a symbol, kept only while anyone subscribes to it.
+// pending holds the levels changed by the book events of the operation in progress,
+// published as one update with its order events.
+type symbolStream struct {
+	bookSeq  uint64
+	tradeSeq uint64
+	pending  []domain.DepthChange
+	book     map[*streamConn]bool
+	trades   map[*streamConn]bool
+}
+
+func (s *symbolStream) idle() bool {
+	return len(s.book) == 0 && len(s.trades) == 0
+}
+
+// streamHub turns engine events into book deltas, trades and execution reports. The depth
+// of every book is kept from its book events, so publishing never walks a book.
+type streamHub struct {
+	mu      sync.Mutex
+	app     *order_gateway.Application
+	depths  map[string]*domain.DepthTracker
+	symbols map[string]*symbolStream
+	orders  map[string]map[*streamConn]bool
+	// sockets are the WebSockets connected, closed with the hub
+	sockets map[*websocket.Conn]bool
+	closed  bool
+}
+
+func newStreamHub(app *order_gateway.Application) *streamHub {
+	return &streamHub{
+		app:     app,
+		depths:  make(map[string]*domain.DepthTracker),
+		symbols: make(map[string]*symbolStream),
+		orders:  make(map[string]map[*streamConn]bool),
+		sockets: make(map[*websocket.Conn]bool),
+	}
+}
+
+// close disconnects every client and refuses those connecting afterwards.
+func (h *streamHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ws := range h.sockets {
+		_ = ws.Close()
+	}
+}
+
+// reset takes the depth of the books from the books themselves, it runs with the matching path idle.
+func (h *streamHub) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, book := range h.app.OrderBooks() {
+		h.depth(book.Symbol()).Reset(book.L3())
+	}
+}
+
+func (h *streamHub) depth(symbol string) *domain.DepthTracker {
+	tracker, ok := h.depths[symbol]
+	if !ok {
+		tracker = domain.NewDepthTracker(symbol)
+		h.depths[symbol] = tracker
+	}
+	return tracker
+}
+
+// OnBookEvent implements domain.BookListener.
+func (h *streamHub) OnBookEvent(event domain.BookEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	changes := h.depth(event.Symbol).Apply(event)
+	if stream, ok := h.symbols[event.Symbol]; ok && len(stream.book) > 0 {
+		stream.pending = append(stream.pending, changes...)
+	}
+}
+
+// OnOrderEvent implements order_gateway.OrderEventListener.
+func (h *streamHub) OnOrderEvent(event order_gateway.ExecReportRequiredEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn := range h.orders[event.Order.SenderCompID] {
+		conn.enqueue(newExecutionReportMessage(event))
+	}
+	stream, ok := h.symbols[event.Order.Symbol]
+	if !ok {
+		return
+	}
+	if event.Type == order_gateway.OrderEventTrade && event.Aggressor && len(stream.trades) > 0 {
+		stream.tradeSeq++
+		trade := TradeMessage{
+			Type:          "trade",
+			Symbol:        event.Order.Symbol,
+			Seq:           stream.tradeSeq,
+			Price:         event.LastPx,
+			Quantity:      event.LastQty,
+			AggressorSide: sideName(event.Order.Side),
+			Time:          time.Now().UTC(),
+		}
+		for conn := range stream.trades {
+			conn.enqueue(trade)
+		}
+	}
+	h.flush(event.Order.Symbol, stream)
+}
+
+func newExecutionReportMessage(event order_gateway.ExecReportRequiredEvent) executionReportMessage {
+	return executionReportMessage{
+		Type:         "execution_report",
+		ExecID:       event.ExecID,
+		ExecType:     event.Type.String(),
+		OrigClOrdID:  event.OrigClOrdID,
+		TradeID:      event.TradeID,
+		LastQuantity: event.LastQty,
+		LastPrice:    event.LastPx,
+		Text:         event.Text,
+		Order:        newOrderResponse(event.Order),
+	}
+}
+
+// flush publishes to the book subscribers of symbol the levels changed since the last update,
+// each in its last state.
+func (h *streamHub) flush(symbol string, stream *symbolStream) {
+	if len(stream.pending) == 0 {
+		return
+	}
+	changes := make([]LevelChange, 0, len(stream.pending))
+	for _, change := range stream.pending {
+		level := LevelChange{Side: levelSide(change.Side), Price: change.Level.Price, Quantity: change.Level.Quantity,
+			Orders: change.Level.Orders}
+		i := slices.IndexFunc(changes, func(c LevelChange) bool { return c.Side == level.Side && c.Price.Equal(level.Price) })
+		if i >= 0 {
+			changes[i] = level
+		} else {
+			changes = append(changes, level)
+		}
+	}
+	stream.pending = stream.pending[:0]
+	slices.SortStableFunc(changes, func(x, y LevelChange) int {
+		switch {
+		case x.Side != y.Side && x.Side == "bid":
+			return -1
+		case x.Side != y.Side:
+			return 1
+		case x.Side == "bid":
+			return y.Price.Cmp(x.Price)
+		default:
+			return x.Price.Cmp(y.Price)
+		}
+	})
+	stream.bookSeq++
+	update := BookUpdateMessage{Type: "book_update", Symbol: symbol, Seq: stream.bookSeq, Changes: changes}
+	for conn := range stream.book {
+		conn.enqueue(update)
+	}
+}
+
+func levelSide(side domain.OrderSide) string {
+	if side == domain.BUY {
+		return "bid"
+	}
+	return "ask"
+}
+
+func (h *streamHub) subscribe(conn *streamConn, cmd streamCommand) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if cmd.Channel == ChannelOrders {
+		if h.orders[conn.compID] == nil {
+			h.orders[conn.compID] = make(map[*streamConn]bool)
+		}
+		h.orders[conn.compID][conn] = true
+		conn.enqueue(controlMessage{Type: "subscribed", Channel: cmd.Channel})
+		return
+	}
+	stream, ok := h.symbols[cmd.Symbol]
+	if !ok {
+		stream = &symbolStream{book: make(map[*streamConn]bool), trades: make(map[*streamConn]bool)}
+		h.symbols[cmd.Symbol] = stream
+	}
+	conn.enqueue(controlMessage{Type: "subscribed", Channel: cmd.Channel, Symbol: cmd.Symbol})
+	if cmd.Channel == ChannelTrades {
+		stream.trades[conn] = true
+		return
+	}
+	// bring existing subscribers up to date first, so the snapshot matches their sequence
+	h.flush(cmd.Symbol, stream)
+	stream.book[conn] = true
+	depth := h.depth(cmd.Symbol).Depth(0)
+	conn.enqueue(BookSnapshotMessage{
+		Type:   "book_snapshot",
+		Symbol: cmd.Symbol,
+		Seq:    stream.bookSeq,
+		Bids:   levelsResponse(depth.Bids),
+		Asks:   levelsResponse(depth.Asks),
+	})
+}
+
+func (h *streamHub) unsubscribe(conn *streamConn, cmd streamCommand) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(conn, cmd.Channel, cmd.Symbol)
+	conn.enqueue(controlMessage{Type: "unsubscribed", Channel: cmd.Channel, Symbol: cmd.Symbol})
+}
+
+func (h *streamHub) remove(conn *streamConn, channel, symbol string) {
+	if channel == ChannelOrders {
+		delete(h.orders[conn.compID], conn)
+		if len(h.orders[conn.compID]) == 0 {
+			delete(h.orders, conn.compID)
+		}
+		return
+	}
+	stream, ok := h.symbols[symbol]
+	if !ok {
+		return
+	}
+	if channel == ChannelTrades {
+		delete(stream.trades, conn)
+	} else {
+		delete(stream.book, conn)
+	}
+	if stream.idle() {
+		delete(h.symbols, symbol)
+	}
+}
+
+func (h *streamHub) disconnect(conn *streamConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(conn, ChannelOrders, "")
+	for symbol := range h.symbols {
+		h.remove(conn, ChannelBook, symbol)
+		h.remove(conn, ChannelTrades, symbol)
+	}
+}
+
+func validCommand(cmd streamCommand) (string, bool) {
+	switch cmd.Op {
+	case "subscribe", "unsubscribe":
+	default:
+		return "op must be subscribe or unsubscribe", false
+	}
+	switch cmd.Channel {
+	case ChannelOrders:
+	case ChannelBook, ChannelTrades:
+		if cmd.Symbol == "" {
+			return "symbol is required", false
+		}
+	default:
+		return "channel must be book, trades or orders", false
+	}
+	return "", true
+}
+
+// serve reads the commands of one client until it disconnects, while its queue is written out.
+func (h *streamHub) serve(ws *websocket.Conn, compID string) {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		_ = ws.Close()
+		return
+	}
+	h.sockets[ws] = true
+	h.mu.Unlock()
+	conn := &streamConn{compID: compID, send: make(chan []byte, streamBufferSize)}
+	done := make(chan struct{})
+	defer func() {
+		h.disconnect(conn)
+		h.mu.Lock()
+		delete(h.sockets, ws)
+		h.mu.Unlock()
+		close(done)
+		_ = ws.Close()
+	}()
+	go func() {
+		for {
+			select {
+			case msg := <-conn.send:
+				err := websocket.Message.Send(ws, string(msg))
+				if err != nil {
+					_ = ws.Close()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	for {
+		var cmd streamCommand
+		err := websocket.JSON.Receive(ws, &cmd)
+		if err != nil {
+			return
+		}
+		if reason, ok := validCommand(cmd); !ok {
+			conn.enqueue(controlMessage{Type: "error", Channel: cmd.Channel, Symbol: cmd.Symbol, Error: reason})
+			continue
+		}
+		if cmd.Op == "subscribe" {
+			h.subscribe(conn, cmd)
+		} else {
+			h.unsubscribe(conn, cmd)
+		}
+	}
+}
+
+// stream upgrades to a WebSocket that streams book deltas, trades and the caller's execution reports.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, compID string) {
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		s.streams.serve(ws, compID)
+	}}.ServeHTTP(w, r)
+}
@@ -0,0 +1,204 @@
+package rest_gateway
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/quickfixgo/enum"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+	"io"
+	"net/http/httptest"
+	"stock_exchange/internal/services/api_keys"
+	"stock_exchange/internal/services/order_gateway"
+	"stock_exchange/internal/services/order_gateway/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testStream struct {
+	t  *testing.T
+	ws *websocket.Conn
+}
+
+func dialStream(t *testing.T, server *httptest.Server, key string) testStream {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/stream"
+	config, err := websocket.NewConfig(url, server.URL)
+	require.NoError(t, err)
+	config.Header.Set(apiKeyHeader, key)
+	ws, err := websocket.DialConfig(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ws.Close() })
+	return testStream{t: t, ws: ws}
+}
+
+func (s testStream) send(op, channel, symbol string) {
+	require.NoError(s.t, websocket.JSON.Send(s.ws, streamCommand{Op: op, Channel: channel, Symbol: symbol}))
+}
+
+// next returns the type of the next message, decoding it into out when it is not nil.
+func (s testStream) next(out any) string {
+	require.NoError(s.t, s.ws.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var raw string
+	require.NoError(s.t, websocket.Message.Receive(s.ws, &raw))
+	var header struct {
+		Type string `json:"type"`
+	}
+	require.NoError(s.t, json.Unmarshal([]byte(raw), &header))
+	if out != nil {
+		require.NoError(s.t, json.Unmarshal([]byte(raw), out))
+	}
+	return header.Type
+}
+
+func (s testStream) expect(msgType string, out any) {
+	require.Equal(s.t, msgType, s.next(out))
+}
+
+func submit(t *testing.T, app *order_gateway.Application, clOrdID, sender string, side domain.OrderSide, px string, qty int64) {
+	_, err := app.Submit(app.NewOrder(clOrdID, "VALE3", sender, "ORDERGATEWAY", side, enum.OrdType_LIMIT,
+		decimal.RequireFromString(px), decimal.NewFromInt(qty)))
+	require.NoError(t, err)
+}
+
+func requireTrackerMatchesBook(t *testing.T, app *order_gateway.Application, tracker *BookTracker) {
+	book, ok := app.OrderBook(tracker.Symbol)
+	require.True(t, ok)
+	depth := book.Depth(0)
+	for side, levels := range map[string][]domain.PriceLevel{"bid": depth.Bids, "ask": depth.Asks} {
+		tracked := tracker.Levels(side)
+		require.Len(t, tracked, len(levels), side)
+		for i, level := range levels {
+			require.True(t, tracked[i].Price.Equal(level.Price))
+			require.True(t, tracked[i].Quantity.Equal(level.Quantity))
+			require.Equal(t, level.Orders, tracked[i].Orders)
+		}
+	}
+}
+
+func TestStream_BookDeltasTrackTheEngineBook(t *testing.T) {
+	app, server := newTestServer(t)
+	submit(t, app, "s1", "CLIENT2", domain.SELL, "10.02", 100)
+
+	stream := dialStream(t, server, "key-1")
+	stream.send("subscribe", ChannelBook, "VALE3")
+	stream.expect("subscribed", nil)
+	var snapshot BookSnapshotMessage
+	stream.expect("book_snapshot", &snapshot)
+	require.Len(t, snapshot.Asks, 1)
+	tracker := NewBookTracker("VALE3")
+	tracker.ApplySnapshot(snapshot)
+
+	submit(t, app, "s2", "CLIENT2", domain.SELL, "10.01", 50)
+	submit(t, app, "b1", "CLIENT1", domain.BUY, "10.00", 70)
+	submit(t, app, "b2", "CLIENT1", domain.BUY, "10.02", 120)
+	_, err := app.Cancel("CLIENT1", "b1")
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		var update BookUpdateMessage
+		stream.expect("book_update", &update)
+		require.NoError(t, tracker.ApplyUpdate(update))
+	}
+	require.Equal(t, uint64(4), tracker.Seq())
+	requireTrackerMatchesBook(t, app, tracker)
+	require.True(t, tracker.Quantity("ask", decimal.RequireFromString("10.02")).Equal(decimal.NewFromInt(30)))
+}
+
+func TestStream_TradesAndOwnExecutionReports(t *testing.T) {
+	app, server := newTestServer(t)
+	stream := dialStream(t, server, "key-1")
+	stream.send("subscribe", ChannelTrades, "VALE3")
+	stream.expect("subscribed", nil)
+	stream.send("subscribe", ChannelOrders, "")
+	stream.expect("subscribed", nil)
+
+	submit(t, app, "s1", "CLIENT2", domain.SELL, "10", 100)
+	submit(t, app, "b1", "CLIENT1", domain.BUY, "10", 40)
+
+	var report executionReportMessage
+	stream.expect("execution_report", &report)
+	require.Equal(t, "new", report.ExecType)
+	require.Equal(t, "b1", report.Order.ClientOrderID)
+	stream.expect("execution_report", &report)
+	require.Equal(t, "trade", report.ExecType)
+	require.Equal(t, "filled", report.Order.Status)
+	require.True(t, report.LastPrice.Equal(decimal.NewFromInt(10)))
+	var trade TradeMessage
+	stream.expect("trade", &trade)
+	require.Equal(t, uint64(1), trade.Seq)
+	require.Equal(t, "buy", trade.AggressorSide)
+	require.True(t, trade.Quantity.Equal(decimal.NewFromInt(40)))
+
+	// the resting side belongs to CLIENT2, its reports are not streamed to CLIENT1
+	stream.send("unsubscribe", ChannelTrades, "VALE3")
+	stream.expect("unsubscribed", nil)
+	submit(t, app, "b2", "CLIENT2", domain.BUY, "10", 10)
+	stream.send("subscribe", "nope", "")
+	stream.expect("error", nil)
+}
+
+func TestStream_ResyncAfterGap(t *testing.T) {
+	app, server := newTestServer(t)
+	stream := dialStream(t, server, "key-1")
+	stream.send("subscribe", ChannelBook, "VALE3")
+	stream.expect("subscribed", nil)
+	var snapshot BookSnapshotMessage
+	stream.expect("book_snapshot", &snapshot)
+	tracker := NewBookTracker("VALE3")
+	tracker.ApplySnapshot(snapshot)
+
+	submit(t, app, "b1", "CLIENT1", domain.BUY, "10", 10)
+	submit(t, app, "b2", "CLIENT1", domain.BUY, "9", 10)
+	var first, second BookUpdateMessage
+	stream.expect("book_update", &first)
+	stream.expect("book_update", &second)
+	// lose the first update
+	require.ErrorIs(t, tracker.ApplyUpdate(second), ErrSequenceGap)
+	require.False(t, tracker.Synced())
+	require.ErrorIs(t, tracker.ApplyUpdate(first), ErrSequenceGap)
+
+	stream.send("subscribe", ChannelBook, "VALE3")
+	stream.expect("subscribed", nil)
+	stream.expect("book_snapshot", &snapshot)
+	require.Equal(t, second.Seq, snapshot.Seq)
+	tracker.ApplySnapshot(snapshot)
+	require.True(t, tracker.Synced())
+	requireTrackerMatchesBook(t, app, tracker)
+
+	submit(t, app, "b3", "CLIENT1", domain.BUY, "9", 5)
+	var update BookUpdateMessage
+	stream.expect("book_update", &update)
+	require.NoError(t, tracker.ApplyUpdate(update))
+	requireTrackerMatchesBook(t, app, tracker)
+}
+
+func TestStream_RequiresAPIKey(t *testing.T) {
+	_, server := newTestServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/stream"
+	_, err := websocket.Dial(url, "", server.URL)
+	require.Error(t, err)
+	ws, err := websocket.Dial(url+"?api_key=key-2", "", server.URL)
+	require.NoError(t, err)
+	_ = ws.Close()
+}
+
+func TestServer_ShutdownClosesStreams(t *testing.T) {
+	app := order_gateway.NewApplication()
+	keys := api_keys.APIKeys{{CompID: "CLIENT1", KeySHA256: api_keys.HashAPIKey("key-1")}}
+	gateway := NewServer(app, keys)
+	server := httptest.NewServer(gateway.Handler())
+	t.Cleanup(server.Close)
+	stream := dialStream(t, server, "key-1")
+	stream.send("subscribe", ChannelOrders, "")
+	stream.expect("subscribed", nil)
+
+	require.NoError(t, gateway.Shutdown(context.Background()))
+	require.NoError(t, stream.ws.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var raw string
+	require.ErrorIs(t, websocket.Message.Receive(stream.ws, &raw), io.EOF)
+
+	// a client connecting afterwards is turned away
+	stream = dialStream(t, server, "key-1")
+	require.ErrorIs(t, websocket.Message.Receive(stream.ws, &raw), io.EOF)
+}